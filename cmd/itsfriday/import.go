@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"itsfriday/internal/archive"
+	"itsfriday/store"
+	"itsfriday/store/db"
+)
+
+var (
+	importCmd = &cobra.Command{
+		Use:   "import <archive.zip>",
+		Short: "Import an exported archive into the account of a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			username, _ := cmd.Flags().GetString("user")
+			policyFlag, _ := cmd.Flags().GetString("policy")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			policy, err := archive.ParseConflictPolicy(policyFlag)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			a, err := archive.Read(f, info.Size())
+			if err != nil {
+				return err
+			}
+
+			profile := newProfile()
+			if err := profile.Validate(); err != nil {
+				return err
+			}
+			dbDriver, err := db.NewDBDriver(profile)
+			if err != nil {
+				return fmt.Errorf("failed to create db driver: %w", err)
+			}
+			storeInstance := store.New(dbDriver, profile)
+			defer storeInstance.Close()
+
+			ctx := context.Background()
+			if err := storeInstance.Migrate(ctx); err != nil {
+				return fmt.Errorf("failed to migrate: %w", err)
+			}
+			if username == "" {
+				username = a.Manifest.Username
+			}
+			user, err := storeInstance.GetUser(ctx, &store.FindUser{Username: &username})
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				return errors.New("user not found: " + username)
+			}
+
+			report, err := archive.Import(ctx, storeInstance, user.ID, a, archive.ImportOptions{
+				Policy: policy,
+				DryRun: dryRun,
+			})
+			if report != nil {
+				printImportReport(user.Username, report)
+			}
+			if err != nil && report != nil && !report.DryRun {
+				fmt.Println("The import failed, the records counted above have been imported and are kept.")
+				for _, t := range report.Tables {
+					if len(t.CreatedIDs) > 0 {
+						fmt.Printf("created %s: %v\n", t.Table, t.CreatedIDs)
+					}
+					if len(t.OverwrittenIDs) > 0 {
+						fmt.Printf("overwritten %s: %v\n", t.Table, t.OverwrittenIDs)
+					}
+				}
+			}
+			return err
+		},
+	}
+)
+
+func init() {
+	importCmd.Flags().String("user", "", "username of the account to import into, the exported one if empty")
+	importCmd.Flags().String("policy", "skip", `what happens to existing books and expense categories, can be "skip", "overwrite" or "duplicate"`)
+	importCmd.Flags().Bool("dry-run", false, "report what would be imported without changing anything")
+	rootCmd.AddCommand(importCmd)
+}
+
+func printImportReport(username string, report *archive.Report) {
+	if report.DryRun {
+		fmt.Printf("Dry run of the import into %s with the %s policy, nothing has been changed.\n", username, report.Policy)
+	} else {
+		fmt.Printf("Imported into %s with the %s policy.\n", username, report.Policy)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tCREATED\tSKIPPED\tOVERWRITTEN\tDUPLICATED")
+	for _, t := range report.Tables {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", t.Table, t.Created, t.Skipped, t.Overwritten, t.Duplicated)
+	}
+	w.Flush()
+}
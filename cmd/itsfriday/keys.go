@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"itsfriday/server/keyring"
+)
+
+var (
+	keysCmd = &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the JWT signing keys",
+	}
+
+	keysListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the signing keys",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			k, err := loadKeyring()
+			if err != nil {
+				return err
+			}
+
+			keys := k.List()
+			for i, key := range keys {
+				current := ""
+				if i == len(keys)-1 {
+					current = " (current)"
+				}
+				fmt.Printf("%s\tcreated at %s%s\n", key.ID, time.Unix(key.CreatedTs, 0).Format(time.RFC3339), current)
+			}
+			return nil
+		},
+	}
+
+	keysRotateCmd = &cobra.Command{
+		Use:   "rotate",
+		Short: "Generate a new signing key, older keys keep validating tokens",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			k, err := loadKeyring()
+			if err != nil {
+				return err
+			}
+
+			key, err := k.Rotate()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("New tokens are signed with key %s, restart the server to apply.\n", key.ID)
+			return nil
+		},
+	}
+
+	keysInvalidateCmd = &cobra.Command{
+		Use:   "invalidate <kid>",
+		Short: "Remove a signing key, tokens signed with it are rejected",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			k, err := loadKeyring()
+			if err != nil {
+				return err
+			}
+
+			if err := k.Invalidate(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Key %s has been invalidated, restart the server to apply.\n", args[0])
+			return nil
+		},
+	}
+)
+
+func init() {
+	keysCmd.AddCommand(keysListCmd, keysRotateCmd, keysInvalidateCmd)
+	rootCmd.AddCommand(keysCmd)
+}
+
+func loadKeyring() (*keyring.Keyring, error) {
+	profile := newProfile()
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return keyring.Load(profile)
+}
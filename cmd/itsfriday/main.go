@@ -7,7 +7,10 @@ import (
     "net/http"
     "os"
     "os/signal"
+	"strings"
 	"syscall"
+	// timezones of the user settings do not depend on the zoneinfo of the host
+	_ "time/tzdata"
 
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
@@ -31,15 +34,7 @@ var (
 			logger := slog.New(handler)
             slog.SetDefault(logger)
 
-            profile := &profile.Profile{
-                Mode:        viper.GetString("mode"),
-				Addr:        viper.GetString("addr"),
-				Port:        viper.GetInt("port"),
-                Data:        viper.GetString("data"),
-                Driver:      viper.GetString("driver"),
-                DSN:         viper.GetString("dsn"),
-                Version:     version.GetCurrentVersion(viper.GetString("mode")),
-            }
+            profile := newProfile()
             if err := profile.Validate(); err != nil {
 				panic(err)
 			}
@@ -101,18 +96,68 @@ var (
     }
 )
 
+func newProfile() *profile.Profile {
+	return &profile.Profile{
+		Mode:    viper.GetString("mode"),
+		Addr:    viper.GetString("addr"),
+		Port:    viper.GetInt("port"),
+		Data:    viper.GetString("data"),
+		Driver:  viper.GetString("driver"),
+		DSN:     viper.GetString("dsn"),
+		Secret:  viper.GetString("secret"),
+		InstanceURL:  viper.GetString("instance-url"),
+		ServerURL:    viper.GetString("server-url"),
+		Mailer:       viper.GetString("mailer"),
+		MailFrom:     viper.GetString("mail-from"),
+		SMTPHost:     viper.GetString("smtp-host"),
+		SMTPPort:     viper.GetInt("smtp-port"),
+		SMTPUsername: viper.GetString("smtp-username"),
+		SMTPPassword: viper.GetString("smtp-password"),
+		BlobStore:    viper.GetString("blob-store"),
+		S3Endpoint:   viper.GetString("s3-endpoint"),
+		S3Region:     viper.GetString("s3-region"),
+		S3Bucket:     viper.GetString("s3-bucket"),
+		S3AccessKey:  viper.GetString("s3-access-key"),
+		S3SecretKey:  viper.GetString("s3-secret-key"),
+		TrustedProxies: viper.GetStringSlice("trusted-proxies"),
+		Version: version.GetCurrentVersion(viper.GetString("mode")),
+	}
+}
+
 func init() {
     viper.SetDefault("mode", "dev")
 	viper.SetDefault("driver", "sqlite")
 	viper.SetDefault("port", 8088)
+	viper.SetDefault("instance-url", "http://localhost:4321")
+	viper.SetDefault("server-url", "http://localhost:8088")
+	viper.SetDefault("mailer", "log")
+	viper.SetDefault("mail-from", "itsfriday <noreply@localhost>")
+	viper.SetDefault("smtp-port", 587)
+	viper.SetDefault("blob-store", "local")
 
     rootCmd.PersistentFlags().String("mode", "dev", `mode of server, can be "prod" or "dev"`)
     rootCmd.PersistentFlags().String("addr", "", "address of server")
 	rootCmd.PersistentFlags().Int("port", 8088, "port of server")
     rootCmd.PersistentFlags().String("data", "", "data directory")
-    rootCmd.PersistentFlags().String("driver", "sqlite", "database driver")
+    rootCmd.PersistentFlags().String("driver", "sqlite", `database driver, "sqlite", "postgres" or "mysql"`)
     rootCmd.PersistentFlags().String("dsn", "", "database source name(aka. DSN)")
     rootCmd.PersistentFlags().Bool("test", false, "insert test data")
+	rootCmd.PersistentFlags().String("secret", "", "JWT signing secret of a new keyring, generated if empty and ignored once the keyring file exists")
+	rootCmd.PersistentFlags().String("instance-url", "http://localhost:4321", "public URL of the web app used in mails")
+	rootCmd.PersistentFlags().String("server-url", "http://localhost:8088", "public URL of the server used in the SSO redirect URIs")
+	rootCmd.PersistentFlags().String("mailer", "log", `mail backend, can be "log", "file" or "smtp"`)
+	rootCmd.PersistentFlags().String("mail-from", "itsfriday <noreply@localhost>", "sender address of mails")
+	rootCmd.PersistentFlags().String("smtp-host", "", "smtp server host")
+	rootCmd.PersistentFlags().Int("smtp-port", 587, "smtp server port")
+	rootCmd.PersistentFlags().String("smtp-username", "", "smtp username")
+	rootCmd.PersistentFlags().String("smtp-password", "", "smtp password")
+	rootCmd.PersistentFlags().String("blob-store", "local", `storage of uploaded files, can be "local" or "s3"`)
+	rootCmd.PersistentFlags().String("s3-endpoint", "", "URL of the s3 compatible storage, e.g. http://localhost:9000")
+	rootCmd.PersistentFlags().String("s3-region", "", "s3 region")
+	rootCmd.PersistentFlags().String("s3-bucket", "", "s3 bucket, created if missing")
+	rootCmd.PersistentFlags().String("s3-access-key", "", "s3 access key")
+	rootCmd.PersistentFlags().String("s3-secret-key", "", "s3 secret key")
+	rootCmd.PersistentFlags().StringSlice("trusted-proxies", nil, "CIDRs of the reverse proxies trusted for the X-Forwarded-For header, e.g. 10.0.0.0/8")
 
     if err := viper.BindPFlag("mode", rootCmd.PersistentFlags().Lookup("mode")); err != nil {
 		panic(err)
@@ -135,6 +180,57 @@ func init() {
 	if err := viper.BindPFlag("test", rootCmd.PersistentFlags().Lookup("test")); err != nil {
 		panic(err)
 	}
+	if err := viper.BindPFlag("secret", rootCmd.PersistentFlags().Lookup("secret")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("instance-url", rootCmd.PersistentFlags().Lookup("instance-url")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("server-url", rootCmd.PersistentFlags().Lookup("server-url")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("mailer", rootCmd.PersistentFlags().Lookup("mailer")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("mail-from", rootCmd.PersistentFlags().Lookup("mail-from")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("smtp-host", rootCmd.PersistentFlags().Lookup("smtp-host")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("smtp-port", rootCmd.PersistentFlags().Lookup("smtp-port")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("smtp-username", rootCmd.PersistentFlags().Lookup("smtp-username")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("smtp-password", rootCmd.PersistentFlags().Lookup("smtp-password")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("blob-store", rootCmd.PersistentFlags().Lookup("blob-store")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("s3-endpoint", rootCmd.PersistentFlags().Lookup("s3-endpoint")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("s3-region", rootCmd.PersistentFlags().Lookup("s3-region")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("s3-bucket", rootCmd.PersistentFlags().Lookup("s3-bucket")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("s3-access-key", rootCmd.PersistentFlags().Lookup("s3-access-key")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("s3-secret-key", rootCmd.PersistentFlags().Lookup("s3-secret-key")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindPFlag("trusted-proxies", rootCmd.PersistentFlags().Lookup("trusted-proxies")); err != nil {
+		panic(err)
+	}
+	viper.SetEnvPrefix("itsfriday")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
 }
 
 func printGreetings(profile *profile.Profile) {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"itsfriday/store"
+	"itsfriday/store/db"
+)
+
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Inspect and apply the schema migrations of the database",
+	}
+
+	migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show the applied and pending migrations",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			storeInstance, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer storeInstance.Close()
+
+			status, err := storeInstance.GetMigrationStatus(context.Background())
+			if err != nil {
+				return err
+			}
+			printMigrationStatus(status)
+			return nil
+		},
+	}
+
+	migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "Apply the pending migrations",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			storeInstance, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer storeInstance.Close()
+
+			ctx := context.Background()
+			status, err := storeInstance.GetMigrationStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if err := storeInstance.Migrate(ctx); err != nil {
+				return err
+			}
+			switch {
+			case status.DatabaseVersion == "":
+				fmt.Printf("Created the database at schema version %s.\n", status.SchemaVersion)
+			case len(status.Pending) == 0:
+				fmt.Printf("The database is up to date at schema version %s.\n", status.DatabaseVersion)
+			default:
+				for _, migration := range status.Pending {
+					fmt.Printf("Applied %s\t%s\n", migration.Version, migration.FileName)
+				}
+				fmt.Printf("The database is at schema version %s.\n", status.SchemaVersion)
+			}
+			return nil
+		},
+	}
+
+	migrateRepairCmd = &cobra.Command{
+		Use:   "repair",
+		Short: "Delete the rows which refer to rows which do not exist",
+		Long: `Deletes the rows which refer to rows which do not exist, like reviews of deleted books, in one transaction.
+The migration to foreign keys fails on them. Stop the server before, the rows are gone for good.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			storeInstance, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer storeInstance.Close()
+
+			ctx := context.Background()
+			dryRun, err := cmd.Flags().GetBool("dry-run")
+			if err != nil {
+				return err
+			}
+			var list []*store.Orphans
+			if dryRun {
+				list, err = storeInstance.FindOrphans(ctx)
+			} else {
+				list, err = storeInstance.RepairOrphans(ctx)
+			}
+			if err != nil {
+				return err
+			}
+			printOrphans(cmd.OutOrStdout(), list, dryRun)
+			return nil
+		},
+	}
+)
+
+func init() {
+	migrateRepairCmd.Flags().Bool("dry-run", false, "only count the rows which would be deleted")
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateRepairCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func openStore() (*store.Store, error) {
+	profile := newProfile()
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	dbDriver, err := db.NewDBDriver(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create db driver: %w", err)
+	}
+	return store.New(dbDriver, profile), nil
+}
+
+func printMigrationStatus(status *store.MigrationStatus) {
+	fmt.Printf("Schema version of this binary: %s\n", status.SchemaVersion)
+	if status.DatabaseVersion == "" {
+		fmt.Println("The database is new, LATEST.sql will be applied.")
+		return
+	}
+	fmt.Printf("Schema version of the database: %s\n", status.DatabaseVersion)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED\tFILE")
+	for _, migrationHistory := range status.Applied {
+		fmt.Fprintf(w, "%s\tapplied\t%s\t\n", migrationHistory.Version, time.Unix(migrationHistory.CreatedTs, 0).Format(time.RFC3339))
+	}
+	for _, migration := range status.Pending {
+		fmt.Fprintf(w, "%s\tpending\t\t%s\n", migration.Version, migration.FileName)
+	}
+	w.Flush()
+	if len(status.Pending) > 0 {
+		fmt.Println("Run `itsfriday migrate up` or start the server to apply the pending migrations.")
+	}
+	if status.IsDatabaseNewer() {
+		fmt.Println("The database is newer than this binary, which refuses to start.")
+	}
+}
+
+func printOrphans(out io.Writer, list []*store.Orphans, dryRun bool) {
+	total := int64(0)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tCOLUMN\tREFERS TO\tROWS")
+	for _, orphans := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", orphans.Table, orphans.Column, orphans.ReferencedTable, orphans.Count)
+		total += orphans.Count
+	}
+	w.Flush()
+	switch {
+	case total == 0:
+		fmt.Fprintln(out, "No row refers to a row which does not exist.")
+	case dryRun:
+		fmt.Fprintf(out, "%d rows would be deleted.\n", total)
+	default:
+		fmt.Fprintf(out, "Deleted %d rows.\n", total)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"itsfriday/server/profile"
+	"itsfriday/store/db/sqlite"
+)
+
+// runMigrate runs `itsfriday migrate` with the args on the data directory and returns its output.
+func runMigrate(t *testing.T, data string, args ...string) (string, error) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(out)
+	rootCmd.SetArgs(append([]string{"migrate", "--data", data, "--driver", "sqlite", "--mode", "dev"}, args...))
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+func TestMigrateRepair(t *testing.T) {
+	data := t.TempDir()
+	driver, err := sqlite.NewDB(&profile.Profile{Driver: "sqlite", DSN: filepath.Join(data, "itsfriday_dev.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	db := driver.GetDB()
+	// a database of 0.0.0, which had no foreign keys, with an expense of a deleted category
+	schema, err := os.ReadFile(filepath.Join("..", "..", "store", "testdata", "sqlite_0.0.0.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		string(schema),
+		"INSERT INTO migration_history (version) VALUES ('0.0.0')",
+		"INSERT INTO user (id, username, email, nickname, password_hash) VALUES (1, 'alice', 'alice@example.com', 'alice', '')",
+		"INSERT INTO expense (user_id, category_id, date_used, item, price) VALUES (1, 1, '2024-12-31', 'dangling', 1)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	countExpenses := func() int {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM expense").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	if _, err := runMigrate(t, data, "up"); err == nil || !strings.Contains(err.Error(), "itsfriday migrate repair") {
+		t.Fatalf("migrate up returned %v, want the failed migration with the repair", err)
+	}
+
+	// the flags of cobra are kept between runs, so --dry-run is given either way
+	out, err := runMigrate(t, data, "repair", "--dry-run=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`\nexpense +category_id +expense_category +1\n`).MatchString(out) || !strings.Contains(out, "1 rows would be deleted.") {
+		t.Errorf("the dry run printed\n%s\nwant the expense of the missing category", out)
+	}
+	if count := countExpenses(); count != 1 {
+		t.Fatalf("%d expenses after the dry run, want 1", count)
+	}
+
+	out, err = runMigrate(t, data, "repair", "--dry-run=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Deleted 1 rows.") {
+		t.Errorf("the repair printed\n%s\nwant the deleted expense", out)
+	}
+	if count := countExpenses(); count != 0 {
+		t.Fatalf("%d expenses after the repair, want none", count)
+	}
+
+	if _, err := runMigrate(t, data, "up"); err != nil {
+		t.Fatal(err)
+	}
+}
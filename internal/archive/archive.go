@@ -0,0 +1,188 @@
+// Package archive writes the data of a user as a zip archive, every table as JSON and CSV with a manifest, and imports it again.
+package archive
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"itsfriday/store"
+)
+
+// SchemaVersion is the version of the layout of the archive, it changes when a file or field is renamed or removed.
+const SchemaVersion = 1
+
+const ManifestFileName = "manifest.json"
+
+// names of the tables, each is written as <name>.json and <name>.csv
+const (
+	TableProfile           = "profile"
+	TableSettings          = "settings"
+	TableBooks             = "books"
+	TableBookReviews       = "book_reviews"
+	TableExpenseCategories = "expense_categories"
+	TableExpenses          = "expenses"
+	TableEvents            = "events"
+)
+
+// ExportedUserSettingKeys are the settings in the archive. The others hold secrets or state of the server.
+var ExportedUserSettingKeys = []store.UserSettingKey{
+	store.UserSettingKey_LOCALE,
+	store.UserSettingKey_TIMEZONE,
+	store.UserSettingKey_CURRENCY,
+	store.UserSettingKey_WEEK_START,
+	store.UserSettingKey_APPEARANCE,
+	store.UserSettingKey_HOME_LAYOUT,
+}
+
+type Manifest struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Version is the version of the server which wrote the archive.
+	Version    string          `json:"version"`
+	ExportedTs int64           `json:"exportedTs"`
+	UserID     int32           `json:"userId"`
+	Username   string          `json:"username"`
+	Files      []*ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	Name    string `json:"name"`
+	Table   string `json:"table"`
+	Records int    `json:"records"`
+}
+
+// The records of the tables. IDs are those of the exporting server, the references between the tables use them.
+
+type Profile struct {
+	ID          int32      `json:"id"`
+	CreatedTs   int64      `json:"createdTs"`
+	Username    string     `json:"username"`
+	Role        store.Role `json:"role"`
+	Email       string     `json:"email"`
+	Nickname    string     `json:"nickname"`
+	AvatarURL   string     `json:"avatarUrl"`
+	Description string     `json:"description"`
+}
+
+type Setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Book struct {
+	ID         int32  `json:"id"`
+	CreatedTs  int64  `json:"createdTs"`
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Translator string `json:"translator"`
+	Pages      int32  `json:"pages"`
+	PubYear    int32  `json:"pubYear"`
+	Genre      string `json:"genre"`
+}
+
+type BookReview struct {
+	ID        int32   `json:"id"`
+	CreatedTs int64   `json:"createdTs"`
+	BookID    int32   `json:"bookId"`
+	DateRead  string  `json:"dateRead"`
+	Rating    float32 `json:"rating"`
+	Review    string  `json:"review"`
+}
+
+type ExpenseCategory struct {
+	ID       int32  `json:"id"`
+	Name     string `json:"name"`
+	Priority int32  `json:"priority"`
+}
+
+type Expense struct {
+	ID         int32  `json:"id"`
+	CreatedTs  int64  `json:"createdTs"`
+	CategoryID int32  `json:"categoryId"`
+	DateUsed   string `json:"dateUsed"`
+	Item       string `json:"item"`
+	Price      int32  `json:"price"`
+}
+
+type Event struct {
+	ID        int32  `json:"id"`
+	CreatedTs int64  `json:"createdTs"`
+	Title     string `json:"title"`
+	Place     string `json:"place"`
+	StartTs   int64  `json:"startTs"`
+	EndTs     int64  `json:"endTs"`
+}
+
+// csvRecord is a record which is also written as a row of a CSV file.
+type csvRecord interface {
+	csvHeader() []string
+	csvRow() []string
+}
+
+func (Profile) csvHeader() []string {
+	return []string{"id", "created_ts", "username", "role", "email", "nickname", "avatar_url", "description"}
+}
+
+func (r Profile) csvRow() []string {
+	return []string{itoa(r.ID), i64toa(r.CreatedTs), r.Username, string(r.Role), r.Email, r.Nickname, r.AvatarURL, r.Description}
+}
+
+func (Setting) csvHeader() []string {
+	return []string{"key", "value"}
+}
+
+func (r Setting) csvRow() []string {
+	return []string{r.Key, r.Value}
+}
+
+func (Book) csvHeader() []string {
+	return []string{"id", "created_ts", "title", "author", "translator", "pages", "pub_year", "genre"}
+}
+
+func (r Book) csvRow() []string {
+	return []string{itoa(r.ID), i64toa(r.CreatedTs), r.Title, r.Author, r.Translator, itoa(r.Pages), itoa(r.PubYear), r.Genre}
+}
+
+func (BookReview) csvHeader() []string {
+	return []string{"id", "created_ts", "book_id", "date_read", "rating", "review"}
+}
+
+func (r BookReview) csvRow() []string {
+	return []string{itoa(r.ID), i64toa(r.CreatedTs), itoa(r.BookID), r.DateRead, strconv.FormatFloat(float64(r.Rating), 'f', -1, 32), r.Review}
+}
+
+func (ExpenseCategory) csvHeader() []string {
+	return []string{"id", "name", "priority"}
+}
+
+func (r ExpenseCategory) csvRow() []string {
+	return []string{itoa(r.ID), r.Name, itoa(r.Priority)}
+}
+
+func (Expense) csvHeader() []string {
+	return []string{"id", "created_ts", "category_id", "date_used", "item", "price"}
+}
+
+func (r Expense) csvRow() []string {
+	return []string{itoa(r.ID), i64toa(r.CreatedTs), itoa(r.CategoryID), r.DateUsed, r.Item, itoa(r.Price)}
+}
+
+func (Event) csvHeader() []string {
+	return []string{"id", "created_ts", "title", "place", "start_ts", "end_ts"}
+}
+
+func (r Event) csvRow() []string {
+	return []string{itoa(r.ID), i64toa(r.CreatedTs), r.Title, r.Place, i64toa(r.StartTs), i64toa(r.EndTs)}
+}
+
+func itoa(v int32) string {
+	return strconv.FormatInt(int64(v), 10)
+}
+
+func i64toa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+// ExportDir is the directory of the exported archives of the user.
+func ExportDir(dataDir string, userID int32) string {
+	return filepath.Join(dataDir, "exports", itoa(userID))
+}
@@ -0,0 +1,238 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"itsfriday/store"
+)
+
+// Export writes everything the user owns to w as a zip archive.
+// Books reviewed by the user are included even when another user added them, so the reviews can be imported.
+func Export(ctx context.Context, s *store.Store, userID int32, version string, w io.Writer) (*Manifest, error) {
+	user, err := s.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	userSettings, err := s.ListUserSettings(ctx, &store.FindUserSetting{UserID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user settings: %w", err)
+	}
+	settings := []Setting{}
+	for _, userSetting := range userSettings {
+		if slices.Contains(ExportedUserSettingKeys, userSetting.Key) {
+			settings = append(settings, Setting{Key: userSetting.Key.String(), Value: userSetting.Value})
+		}
+	}
+
+	bookReviews, err := s.ListBookReviews(ctx, &store.FindBookReview{UserID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list book reviews: %w", err)
+	}
+	ownBooks, err := s.ListBooks(ctx, &store.FindBook{UserID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list books: %w", err)
+	}
+	books := []Book{}
+	bookIDs := map[int32]bool{}
+	for _, book := range ownBooks {
+		books = append(books, convertBook(book))
+		bookIDs[book.ID] = true
+	}
+	reviews := []BookReview{}
+	for _, review := range bookReviews {
+		if !bookIDs[review.BookID] {
+			book, err := s.GetBook(ctx, &store.FindBook{ID: &review.BookID})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get book: %w", err)
+			}
+			if book == nil {
+				// the review of a book which is gone can not be imported
+				continue
+			}
+			books = append(books, convertBook(book))
+			bookIDs[book.ID] = true
+		}
+		reviews = append(reviews, BookReview{
+			ID:        review.ID,
+			CreatedTs: review.CreatedTs,
+			BookID:    review.BookID,
+			DateRead:  review.DateRead,
+			Rating:    review.Rating,
+			Review:    review.Review,
+		})
+	}
+
+	dineroCategories, err := s.ListDineroCategories(ctx, &store.FindDineroCategory{UserID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expense categories: %w", err)
+	}
+	categories := []ExpenseCategory{}
+	for _, category := range dineroCategories {
+		categories = append(categories, ExpenseCategory{
+			ID:       category.ID,
+			Name:     category.Name,
+			Priority: category.Priority,
+		})
+	}
+
+	dineroExpenses, err := s.ListDineroExpenses(ctx, &store.FindDineroExpense{UserID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expenses: %w", err)
+	}
+	expenses := []Expense{}
+	for _, expense := range dineroExpenses {
+		expenses = append(expenses, Expense{
+			ID:         expense.ID,
+			CreatedTs:  expense.CreatedTs,
+			CategoryID: expense.CategoryID,
+			DateUsed:   expense.DateUsed,
+			Item:       expense.Item,
+			Price:      expense.Price,
+		})
+	}
+
+	storeEvents, err := s.ListEvents(ctx, &store.FindEvent{UserID: &userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	events := []Event{}
+	for _, event := range storeEvents {
+		events = append(events, Event{
+			ID:        event.ID,
+			CreatedTs: event.CreatedTs,
+			Title:     event.Title,
+			Place:     event.Place,
+			StartTs:   event.StartTs,
+			EndTs:     event.EndTs,
+		})
+	}
+
+	manifest := &Manifest{
+		SchemaVersion: SchemaVersion,
+		Version:       version,
+		ExportedTs:    time.Now().Unix(),
+		UserID:        user.ID,
+		Username:      user.Username,
+		Files:         []*ManifestFile{},
+	}
+	zw := zip.NewWriter(w)
+	profile := []Profile{{
+		ID:          user.ID,
+		CreatedTs:   user.CreatedTs,
+		Username:    user.Username,
+		Role:        user.Role,
+		Email:       user.Email,
+		Nickname:    user.Nickname,
+		AvatarURL:   user.AvatarURL,
+		Description: user.Description,
+	}}
+	if err := writeTable(zw, manifest, TableProfile, profile); err != nil {
+		return nil, err
+	}
+	if err := writeTable(zw, manifest, TableSettings, settings); err != nil {
+		return nil, err
+	}
+	if err := writeTable(zw, manifest, TableBooks, books); err != nil {
+		return nil, err
+	}
+	if err := writeTable(zw, manifest, TableBookReviews, reviews); err != nil {
+		return nil, err
+	}
+	if err := writeTable(zw, manifest, TableExpenseCategories, categories); err != nil {
+		return nil, err
+	}
+	if err := writeTable(zw, manifest, TableExpenses, expenses); err != nil {
+		return nil, err
+	}
+	if err := writeTable(zw, manifest, TableEvents, events); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(zw, ManifestFileName, manifest, time.Unix(manifest.ExportedTs, 0)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close the archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func convertBook(book *store.Book) Book {
+	return Book{
+		ID:         book.ID,
+		CreatedTs:  book.CreatedTs,
+		Title:      book.Title,
+		Author:     book.Author,
+		Translator: book.Translator,
+		Pages:      book.Pages,
+		PubYear:    book.PubYear,
+		Genre:      book.Genre,
+	}
+}
+
+// writeTable writes the records as <table>.json and <table>.csv and lists both in the manifest.
+func writeTable[T csvRecord](zw *zip.Writer, manifest *Manifest, table string, records []T) error {
+	modified := time.Unix(manifest.ExportedTs, 0)
+	jsonName := table + ".json"
+	if err := writeJSON(zw, jsonName, records, modified); err != nil {
+		return err
+	}
+
+	csvName := table + ".csv"
+	f, err := createFile(zw, csvName, modified)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", csvName, err)
+	}
+	cw := csv.NewWriter(f)
+	var header T
+	if err := cw.Write(header.csvHeader()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", csvName, err)
+	}
+	for _, record := range records {
+		if err := cw.Write(record.csvRow()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", csvName, err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", csvName, err)
+	}
+
+	manifest.Files = append(manifest.Files,
+		&ManifestFile{Name: jsonName, Table: table, Records: len(records)},
+		&ManifestFile{Name: csvName, Table: table, Records: len(records)},
+	)
+	return nil
+}
+
+func writeJSON(zw *zip.Writer, name string, v any, modified time.Time) error {
+	f, err := createFile(zw, name, modified)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func createFile(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+}
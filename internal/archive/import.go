@@ -0,0 +1,592 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"itsfriday/internal/util"
+	"itsfriday/store"
+)
+
+// maxFileSize bounds the uncompressed size of a file of an archive.
+const maxFileSize = 64 << 20
+
+// ConflictPolicy decides what happens to a book or an expense category whose unique key is taken already,
+// i.e. the title and author of a book or the name of a category of the user.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySkip keeps the existing row, the imported rows refer to it.
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// ConflictPolicyOverwrite updates the existing row. Books added by other users are kept as they are.
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+	// ConflictPolicyDuplicate imports the row with a numbered title or name, e.g. "Dune (2)".
+	ConflictPolicyDuplicate ConflictPolicy = "duplicate"
+)
+
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	switch ConflictPolicy(policy) {
+	case "":
+		return ConflictPolicySkip, nil
+	case ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyDuplicate:
+		return ConflictPolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid conflict policy %q, one of skip, overwrite and duplicate is expected", policy)
+}
+
+// Archive is the content of an archive which is imported.
+type Archive struct {
+	Manifest          *Manifest
+	Books             []Book
+	BookReviews       []BookReview
+	ExpenseCategories []ExpenseCategory
+	Expenses          []Expense
+	Events            []Event
+}
+
+// Read reads and validates an archive written by Export. The profile and settings are not imported.
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the archive: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	a := &Archive{Manifest: &Manifest{}}
+	if files[ManifestFileName] == nil {
+		return nil, errors.New("not an itsfriday archive, manifest.json is missing")
+	}
+	if err := readJSON(files[ManifestFileName], a.Manifest); err != nil {
+		return nil, err
+	}
+	if a.Manifest.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d of the archive, %d is expected", a.Manifest.SchemaVersion, SchemaVersion)
+	}
+	for table, v := range map[string]any{
+		TableBooks:             &a.Books,
+		TableBookReviews:       &a.BookReviews,
+		TableExpenseCategories: &a.ExpenseCategories,
+		TableExpenses:          &a.Expenses,
+		TableEvents:            &a.Events,
+	} {
+		// a table without records may be left out
+		if f := files[table+".json"]; f != nil {
+			if err := readJSON(f, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := a.validate(); err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	return a, nil
+}
+
+func readJSON(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if len(data) > maxFileSize {
+		return fmt.Errorf("%s is larger than %d bytes", f.Name, maxFileSize)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// validate checks the records and their references before anything is imported.
+func (a *Archive) validate() error {
+	books := map[int32]bool{}
+	bookKeys := map[string]bool{}
+	for _, book := range a.Books {
+		if book.Title == "" || book.Author == "" {
+			return fmt.Errorf("book %d has no title or author", book.ID)
+		}
+		if books[book.ID] || bookKeys[getBookKey(book.Title, book.Author)] {
+			return fmt.Errorf("book %d is duplicated", book.ID)
+		}
+		books[book.ID] = true
+		bookKeys[getBookKey(book.Title, book.Author)] = true
+	}
+	reviewKeys := map[string]bool{}
+	for _, review := range a.BookReviews {
+		if !books[review.BookID] {
+			return fmt.Errorf("book review %d refers to the unknown book %d", review.ID, review.BookID)
+		}
+		if !util.ValidateDate(review.DateRead) {
+			return fmt.Errorf("book review %d has the invalid date %q", review.ID, review.DateRead)
+		}
+		if review.Rating < 0 || review.Rating > 5 {
+			return fmt.Errorf("book review %d has the invalid rating %v", review.ID, review.Rating)
+		}
+		key := fmt.Sprintf("%d/%s", review.BookID, review.DateRead)
+		if reviewKeys[key] {
+			return fmt.Errorf("book review %d is duplicated", review.ID)
+		}
+		reviewKeys[key] = true
+	}
+
+	categories := map[int32]bool{}
+	categoryNames := map[string]bool{}
+	for _, category := range a.ExpenseCategories {
+		if category.Name == "" {
+			return fmt.Errorf("expense category %d has no name", category.ID)
+		}
+		if categories[category.ID] || categoryNames[category.Name] {
+			return fmt.Errorf("expense category %d is duplicated", category.ID)
+		}
+		categories[category.ID] = true
+		categoryNames[category.Name] = true
+	}
+	for _, expense := range a.Expenses {
+		if !categories[expense.CategoryID] {
+			return fmt.Errorf("expense %d refers to the unknown category %d", expense.ID, expense.CategoryID)
+		}
+		if !util.ValidateDate(expense.DateUsed) {
+			return fmt.Errorf("expense %d has the invalid date %q", expense.ID, expense.DateUsed)
+		}
+	}
+
+	for _, event := range a.Events {
+		if event.Title == "" {
+			return fmt.Errorf("event %d has no title", event.ID)
+		}
+	}
+	return nil
+}
+
+type ImportOptions struct {
+	Policy ConflictPolicy
+	// DryRun reports what the import would do without changing anything.
+	DryRun bool
+}
+
+// Report tells what the import did. Every row is written on its own, so when the import fails
+// the report of the failed import lists the rows written before the failure, they are kept.
+type Report struct {
+	DryRun bool           `json:"dryRun"`
+	Policy ConflictPolicy `json:"policy"`
+	Tables []*TableReport `json:"tables"`
+}
+
+// TableReport counts what happened to the records of a table.
+// Skipped records exist already, Overwritten ones updated an existing row and Duplicated ones were imported under a new title or name.
+type TableReport struct {
+	Table       string `json:"table"`
+	Created     int    `json:"created"`
+	Skipped     int    `json:"skipped"`
+	Overwritten int    `json:"overwritten"`
+	Duplicated  int    `json:"duplicated"`
+	// CreatedIDs are the IDs of the created and duplicated rows and OverwrittenIDs the ones of the updated rows,
+	// both are empty in a dry run.
+	CreatedIDs     []int32 `json:"createdIds,omitempty"`
+	OverwrittenIDs []int32 `json:"overwrittenIds,omitempty"`
+}
+
+type importer struct {
+	store  *store.Store
+	userID int32
+	opts   ImportOptions
+
+	// IDs of the archive to the IDs of the imported or existing rows
+	bookIDs     map[int32]int32
+	categoryIDs map[int32]int32
+
+	// the rows a dry run would have created, they have negative IDs
+	lastDryRunID     int32
+	dryRunBooks      map[string]bool
+	dryRunCategories map[string]bool
+}
+
+// Import recreates the books, reviews, expense categories, expenses and events of the archive for the user.
+// The references between the records are remapped to the new IDs.
+// Expenses and events equal to existing ones are skipped unless the policy is ConflictPolicyDuplicate.
+func Import(ctx context.Context, s *store.Store, userID int32, a *Archive, opts ImportOptions) (*Report, error) {
+	if opts.Policy == "" {
+		opts.Policy = ConflictPolicySkip
+	}
+	im := &importer{
+		store:            s,
+		userID:           userID,
+		opts:             opts,
+		bookIDs:          map[int32]int32{},
+		categoryIDs:      map[int32]int32{},
+		dryRunBooks:      map[string]bool{},
+		dryRunCategories: map[string]bool{},
+	}
+	report := &Report{
+		DryRun: opts.DryRun,
+		Policy: opts.Policy,
+	}
+	for _, step := range []struct {
+		table string
+		run   func(context.Context, *TableReport) error
+	}{
+		{TableBooks, func(ctx context.Context, r *TableReport) error { return im.importBooks(ctx, a.Books, r) }},
+		{TableBookReviews, func(ctx context.Context, r *TableReport) error { return im.importBookReviews(ctx, a.BookReviews, r) }},
+		{TableExpenseCategories, func(ctx context.Context, r *TableReport) error {
+			return im.importExpenseCategories(ctx, a.ExpenseCategories, r)
+		}},
+		{TableExpenses, func(ctx context.Context, r *TableReport) error { return im.importExpenses(ctx, a.Expenses, r) }},
+		{TableEvents, func(ctx context.Context, r *TableReport) error { return im.importEvents(ctx, a.Events, r) }},
+	} {
+		tableReport := &TableReport{Table: step.table}
+		report.Tables = append(report.Tables, tableReport)
+		if err := step.run(ctx, tableReport); err != nil {
+			return report, fmt.Errorf("failed to import %s: %w", step.table, err)
+		}
+	}
+	return report, nil
+}
+
+func (im *importer) importBooks(ctx context.Context, books []Book, report *TableReport) error {
+	for _, book := range books {
+		existing, err := im.findBook(ctx, book.Title, book.Author)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			id, err := im.createBook(ctx, book, book.Title)
+			if err != nil {
+				return err
+			}
+			im.bookIDs[book.ID] = id
+			report.created(id)
+			continue
+		}
+
+		switch {
+		case im.opts.Policy == ConflictPolicyOverwrite && existing.UserID == im.userID:
+			if !im.opts.DryRun {
+				if _, err := im.store.UpdateBook(ctx, &store.UpdateBook{
+					ID:         existing.ID,
+					Translator: &book.Translator,
+					Pages:      &book.Pages,
+					PubYear:    &book.PubYear,
+					Genre:      &book.Genre,
+				}); err != nil {
+					return err
+				}
+				report.OverwrittenIDs = append(report.OverwrittenIDs, existing.ID)
+			}
+			im.bookIDs[book.ID] = existing.ID
+			report.Overwritten++
+		case im.opts.Policy == ConflictPolicyDuplicate:
+			title, err := im.getFreeBookTitle(ctx, book.Title, book.Author)
+			if err != nil {
+				return err
+			}
+			id, err := im.createBook(ctx, book, title)
+			if err != nil {
+				return err
+			}
+			im.bookIDs[book.ID] = id
+			report.duplicated(id)
+		default:
+			im.bookIDs[book.ID] = existing.ID
+			report.Skipped++
+		}
+	}
+	return nil
+}
+
+func (im *importer) findBook(ctx context.Context, title string, author string) (*store.Book, error) {
+	if im.dryRunBooks[getBookKey(title, author)] {
+		return &store.Book{ID: -1, UserID: im.userID, Title: title, Author: author}, nil
+	}
+	return im.store.GetBook(ctx, &store.FindBook{Title: &title, Author: &author})
+}
+
+func (im *importer) createBook(ctx context.Context, book Book, title string) (int32, error) {
+	if im.opts.DryRun {
+		im.dryRunBooks[getBookKey(title, book.Author)] = true
+		return im.nextDryRunID(), nil
+	}
+	created, err := im.store.CreateBook(ctx, &store.Book{
+		UserID:     im.userID,
+		Title:      title,
+		Author:     book.Author,
+		Translator: book.Translator,
+		Pages:      book.Pages,
+		PubYear:    book.PubYear,
+		Genre:      book.Genre,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+func (im *importer) getFreeBookTitle(ctx context.Context, title string, author string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", title, n)
+		existing, err := im.findBook(ctx, candidate, author)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+}
+
+func (im *importer) importBookReviews(ctx context.Context, reviews []BookReview, report *TableReport) error {
+	for _, review := range reviews {
+		bookID := im.bookIDs[review.BookID]
+		var existing *store.BookReview
+		if bookID > 0 {
+			var err error
+			existing, err = im.store.GetBookReview(ctx, &store.FindBookReview{
+				UserID:   &im.userID,
+				BookID:   &bookID,
+				DateRead: &review.DateRead,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if existing == nil {
+			if !im.opts.DryRun {
+				created, err := im.store.CreateBookReview(ctx, &store.BookReview{
+					UserID:   im.userID,
+					BookID:   bookID,
+					DateRead: review.DateRead,
+					Rating:   review.Rating,
+					Review:   review.Review,
+				})
+				if err != nil {
+					return err
+				}
+				report.CreatedIDs = append(report.CreatedIDs, created.ID)
+			}
+			report.Created++
+			continue
+		}
+
+		// a user reviews a book once a day, so a review is never duplicated
+		if im.opts.Policy == ConflictPolicyOverwrite {
+			if !im.opts.DryRun {
+				if _, err := im.store.UpdateBookReview(ctx, &store.UpdateBookReview{
+					ID:     existing.ID,
+					Rating: &review.Rating,
+					Review: &review.Review,
+				}); err != nil {
+					return err
+				}
+				report.OverwrittenIDs = append(report.OverwrittenIDs, existing.ID)
+			}
+			report.Overwritten++
+		} else {
+			report.Skipped++
+		}
+	}
+	return nil
+}
+
+func (im *importer) importExpenseCategories(ctx context.Context, categories []ExpenseCategory, report *TableReport) error {
+	for _, category := range categories {
+		existing, err := im.findExpenseCategory(ctx, category.Name)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			id, err := im.createExpenseCategory(ctx, category, category.Name)
+			if err != nil {
+				return err
+			}
+			im.categoryIDs[category.ID] = id
+			report.created(id)
+			continue
+		}
+
+		switch im.opts.Policy {
+		case ConflictPolicyOverwrite:
+			if !im.opts.DryRun {
+				if _, err := im.store.UpdateDineroCategory(ctx, &store.UpdateDineroCategory{
+					ID:       existing.ID,
+					Priority: &category.Priority,
+				}); err != nil {
+					return err
+				}
+				report.OverwrittenIDs = append(report.OverwrittenIDs, existing.ID)
+			}
+			im.categoryIDs[category.ID] = existing.ID
+			report.Overwritten++
+		case ConflictPolicyDuplicate:
+			name, err := im.getFreeExpenseCategoryName(ctx, category.Name)
+			if err != nil {
+				return err
+			}
+			id, err := im.createExpenseCategory(ctx, category, name)
+			if err != nil {
+				return err
+			}
+			im.categoryIDs[category.ID] = id
+			report.duplicated(id)
+		default:
+			im.categoryIDs[category.ID] = existing.ID
+			report.Skipped++
+		}
+	}
+	return nil
+}
+
+func (im *importer) findExpenseCategory(ctx context.Context, name string) (*store.DineroCategory, error) {
+	if im.dryRunCategories[name] {
+		return &store.DineroCategory{ID: -1, UserID: im.userID, Name: name}, nil
+	}
+	return im.store.GetDineroCategory(ctx, &store.FindDineroCategory{UserID: &im.userID, Name: &name})
+}
+
+func (im *importer) createExpenseCategory(ctx context.Context, category ExpenseCategory, name string) (int32, error) {
+	if im.opts.DryRun {
+		im.dryRunCategories[name] = true
+		return im.nextDryRunID(), nil
+	}
+	created, err := im.store.CreateDineroCaterory(ctx, &store.DineroCategory{
+		UserID:   im.userID,
+		Name:     name,
+		Priority: category.Priority,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+func (im *importer) getFreeExpenseCategoryName(ctx context.Context, name string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		existing, err := im.findExpenseCategory(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+}
+
+func (im *importer) importExpenses(ctx context.Context, expenses []Expense, report *TableReport) error {
+	// counts of the existing expenses, an imported one equal to an existing one takes its place
+	existing := map[string]int{}
+	if im.opts.Policy != ConflictPolicyDuplicate {
+		list, err := im.store.ListDineroExpenses(ctx, &store.FindDineroExpense{UserID: &im.userID})
+		if err != nil {
+			return err
+		}
+		for _, expense := range list {
+			existing[getExpenseKey(expense.CategoryID, expense.DateUsed, expense.Item, expense.Price)]++
+		}
+	}
+
+	for _, expense := range expenses {
+		categoryID := im.categoryIDs[expense.CategoryID]
+		key := getExpenseKey(categoryID, expense.DateUsed, expense.Item, expense.Price)
+		if existing[key] > 0 {
+			existing[key]--
+			report.Skipped++
+			continue
+		}
+		if !im.opts.DryRun {
+			created, err := im.store.CreateDineroExpense(ctx, &store.DineroExpense{
+				UserID:     im.userID,
+				CategoryID: categoryID,
+				DateUsed:   expense.DateUsed,
+				Item:       expense.Item,
+				Price:      expense.Price,
+			})
+			if err != nil {
+				return err
+			}
+			report.CreatedIDs = append(report.CreatedIDs, created.ID)
+		}
+		report.Created++
+	}
+	return nil
+}
+
+func (im *importer) importEvents(ctx context.Context, events []Event, report *TableReport) error {
+	existing := map[string]int{}
+	if im.opts.Policy != ConflictPolicyDuplicate {
+		list, err := im.store.ListEvents(ctx, &store.FindEvent{UserID: &im.userID})
+		if err != nil {
+			return err
+		}
+		for _, event := range list {
+			existing[getEventKey(event.Title, event.StartTs, event.EndTs)]++
+		}
+	}
+
+	for _, event := range events {
+		key := getEventKey(event.Title, event.StartTs, event.EndTs)
+		if existing[key] > 0 {
+			existing[key]--
+			report.Skipped++
+			continue
+		}
+		if !im.opts.DryRun {
+			created, err := im.store.CreateEvent(ctx, &store.Event{
+				UserID:  im.userID,
+				Title:   event.Title,
+				Place:   event.Place,
+				StartTs: event.StartTs,
+				EndTs:   event.EndTs,
+			})
+			if err != nil {
+				return err
+			}
+			report.CreatedIDs = append(report.CreatedIDs, created.ID)
+		}
+		report.Created++
+	}
+	return nil
+}
+
+// created counts a created row, the negative IDs of a dry run are not listed.
+func (r *TableReport) created(id int32) {
+	r.Created++
+	if id > 0 {
+		r.CreatedIDs = append(r.CreatedIDs, id)
+	}
+}
+
+func (r *TableReport) duplicated(id int32) {
+	r.Duplicated++
+	if id > 0 {
+		r.CreatedIDs = append(r.CreatedIDs, id)
+	}
+}
+
+func (im *importer) nextDryRunID() int32 {
+	im.lastDryRunID--
+	return im.lastDryRunID
+}
+
+func getBookKey(title string, author string) string {
+	return title + "\x00" + author
+}
+
+func getExpenseKey(categoryID int32, dateUsed string, item string, price int32) string {
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%d", categoryID, dateUsed, item, price)
+}
+
+func getEventKey(title string, startTs int64, endTs int64) string {
+	return fmt.Sprintf("%s\x00%d\x00%d", title, startTs, endTs)
+}
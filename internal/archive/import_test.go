@@ -0,0 +1,223 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+	"itsfriday/store/db/memory"
+)
+
+// testArchive has other IDs than the rows it creates, so a reference which is not remapped points to nothing.
+var testArchive = &Archive{
+	Manifest: &Manifest{SchemaVersion: SchemaVersion, Username: "alice"},
+	Books: []Book{
+		{ID: 11, Title: "Dune", Author: "Frank Herbert", Pages: 600},
+		{ID: 12, Title: "Emma", Author: "Jane Austen", Pages: 400},
+	},
+	BookReviews: []BookReview{
+		{ID: 21, BookID: 11, DateRead: "2024-01-02", Rating: 4},
+		{ID: 22, BookID: 12, DateRead: "2024-02-03", Rating: 5},
+	},
+	ExpenseCategories: []ExpenseCategory{
+		{ID: 31, Name: "Food", Priority: 9},
+		{ID: 32, Name: "Travel", Priority: 2},
+	},
+	Expenses: []Expense{
+		{ID: 41, CategoryID: 31, DateUsed: "2024-01-05", Item: "Bread", Price: 3},
+		{ID: 42, CategoryID: 32, DateUsed: "2024-03-01", Item: "Train", Price: 40},
+	},
+	Events: []Event{
+		{ID: 51, Title: "Party", StartTs: 100, EndTs: 200},
+	},
+}
+
+// newTestStore returns a store whose user alice has a book, a review, a category and an expense which the archive has too.
+func newTestStore(t *testing.T, driver store.Driver) (*store.Store, int32) {
+	t.Helper()
+	ctx := context.Background()
+	s := store.New(driver, &profile.Profile{Mode: "dev", Driver: "memory"})
+	user, err := s.CreateUser(ctx, &store.User{Username: "alice", Role: store.RoleUser, Email: "alice@example.com", PasswordHash: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := s.CreateBook(ctx, &store.Book{UserID: user.ID, Title: "Dune", Author: "Frank Herbert", Pages: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateBookReview(ctx, &store.BookReview{UserID: user.ID, BookID: book.ID, DateRead: "2024-01-02", Rating: 3}); err != nil {
+		t.Fatal(err)
+	}
+	category, err := s.CreateDineroCaterory(ctx, &store.DineroCategory{UserID: user.ID, Name: "Food", Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateDineroExpense(ctx, &store.DineroExpense{UserID: user.ID, CategoryID: category.ID, DateUsed: "2024-01-05", Item: "Bread", Price: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateEvent(ctx, &store.Event{UserID: user.ID, Title: "Party", StartTs: 100, EndTs: 200}); err != nil {
+		t.Fatal(err)
+	}
+	return s, user.ID
+}
+
+// listReviews lists the reviews of the user as "<date read> <rating>@<title of the book>".
+func listReviews(t *testing.T, s *store.Store, userID int32) []string {
+	t.Helper()
+	ctx := context.Background()
+	reviews, err := s.ListBookReviews(ctx, &store.FindBookReview{UserID: &userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []string{}
+	for _, review := range reviews {
+		book, err := s.GetBook(ctx, &store.FindBook{ID: &review.BookID})
+		if err != nil || book == nil {
+			t.Fatalf("review %d refers to the missing book %d: %v", review.ID, review.BookID, err)
+		}
+		list = append(list, fmt.Sprintf("%s %v@%s", review.DateRead, review.Rating, book.Title))
+	}
+	slices.Sort(list)
+	return list
+}
+
+// listExpenses lists the expenses of the user as "<item>@<name of the category>".
+func listExpenses(t *testing.T, s *store.Store, userID int32) []string {
+	t.Helper()
+	ctx := context.Background()
+	expenses, err := s.ListDineroExpenses(ctx, &store.FindDineroExpense{UserID: &userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []string{}
+	for _, expense := range expenses {
+		category, err := s.GetDineroCategory(ctx, &store.FindDineroCategory{ID: &expense.CategoryID})
+		if err != nil || category == nil {
+			t.Fatalf("expense %d refers to the missing category %d: %v", expense.ID, expense.CategoryID, err)
+		}
+		list = append(list, expense.Item+"@"+category.Name)
+	}
+	slices.Sort(list)
+	return list
+}
+
+func TestImport(t *testing.T) {
+	// created, skipped, overwritten and duplicated records of the books, reviews, categories, expenses and events
+	type counts [5][4]int
+	before := struct{ reviews, expenses []string }{
+		reviews:  []string{"2024-01-02 3@Dune"},
+		expenses: []string{"Bread@Food"},
+	}
+
+	for _, tc := range []struct {
+		policy   ConflictPolicy
+		counts   counts
+		reviews  []string
+		expenses []string
+	}{
+		{
+			policy:   ConflictPolicySkip,
+			counts:   counts{{1, 1, 0, 0}, {1, 1, 0, 0}, {1, 1, 0, 0}, {1, 1, 0, 0}, {0, 1, 0, 0}},
+			reviews:  []string{"2024-01-02 3@Dune", "2024-02-03 5@Emma"},
+			expenses: []string{"Bread@Food", "Train@Travel"},
+		},
+		{
+			policy:   ConflictPolicyOverwrite,
+			counts:   counts{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 1, 0, 0}, {0, 1, 0, 0}},
+			reviews:  []string{"2024-01-02 4@Dune", "2024-02-03 5@Emma"},
+			expenses: []string{"Bread@Food", "Train@Travel"},
+		},
+		{
+			policy:   ConflictPolicyDuplicate,
+			counts:   counts{{1, 0, 0, 1}, {2, 0, 0, 0}, {1, 0, 0, 1}, {2, 0, 0, 0}, {1, 0, 0, 0}},
+			reviews:  []string{"2024-01-02 3@Dune", "2024-01-02 4@Dune (2)", "2024-02-03 5@Emma"},
+			expenses: []string{"Bread@Food", "Bread@Food (2)", "Train@Travel"},
+		},
+	} {
+		for _, dryRun := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s dryRun=%v", tc.policy, dryRun), func(t *testing.T) {
+				s, userID := newTestStore(t, memory.NewDB())
+				report, err := Import(context.Background(), s, userID, testArchive, ImportOptions{Policy: tc.policy, DryRun: dryRun})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got counts
+				for i, table := range report.Tables {
+					got[i] = [4]int{table.Created, table.Skipped, table.Overwritten, table.Duplicated}
+					if dryRun && (len(table.CreatedIDs) != 0 || len(table.OverwrittenIDs) != 0) {
+						t.Errorf("dry run reports the IDs %v and %v of %s", table.CreatedIDs, table.OverwrittenIDs, table.Table)
+					}
+					if !dryRun && len(table.CreatedIDs) != table.Created+table.Duplicated {
+						t.Errorf("%d IDs of created %s, want %d", len(table.CreatedIDs), table.Table, table.Created+table.Duplicated)
+					}
+				}
+				if got != tc.counts {
+					t.Errorf("counts are %v, want %v", got, tc.counts)
+				}
+
+				wantReviews, wantExpenses := tc.reviews, tc.expenses
+				if dryRun {
+					wantReviews, wantExpenses = before.reviews, before.expenses
+				}
+				if got := listReviews(t, s, userID); !slices.Equal(got, wantReviews) {
+					t.Errorf("reviews are %v, want %v", got, wantReviews)
+				}
+				if got := listExpenses(t, s, userID); !slices.Equal(got, wantExpenses) {
+					t.Errorf("expenses are %v, want %v", got, wantExpenses)
+				}
+			})
+		}
+	}
+}
+
+// failingEventDriver fails to create events, the last table of an import, once fail is set.
+type failingEventDriver struct {
+	store.Driver
+	fail bool
+}
+
+func (d *failingEventDriver) CreateEvent(ctx context.Context, create *store.Event) (*store.Event, error) {
+	if d.fail {
+		return nil, errors.New("disk full")
+	}
+	return d.Driver.CreateEvent(ctx, create)
+}
+
+func TestImportReportsCommittedRows(t *testing.T) {
+	driver := &failingEventDriver{Driver: memory.NewDB()}
+	s, userID := newTestStore(t, driver)
+	driver.fail = true
+	report, err := Import(context.Background(), s, userID, testArchive, ImportOptions{Policy: ConflictPolicyDuplicate})
+	if err == nil {
+		t.Fatal("import did not fail")
+	}
+
+	for _, table := range report.Tables {
+		if table.Table == TableEvents {
+			if len(table.CreatedIDs) != 0 {
+				t.Errorf("the failed events report the created IDs %v", table.CreatedIDs)
+			}
+			continue
+		}
+		if len(table.CreatedIDs) != table.Created+table.Duplicated {
+			t.Errorf("%d IDs of created %s, want %d", len(table.CreatedIDs), table.Table, table.Created+table.Duplicated)
+		}
+	}
+	books, err := s.ListBooks(context.Background(), &store.FindBook{UserID: &userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range report.Tables[0].CreatedIDs {
+		if !slices.ContainsFunc(books, func(book *store.Book) bool { return book.ID == id }) {
+			t.Errorf("the reported book %d does not exist", id)
+		}
+	}
+	if len(books) != 1+len(report.Tables[0].CreatedIDs) {
+		t.Errorf("%d books after the failed import, want the existing one and the %d reported", len(books), len(report.Tables[0].CreatedIDs))
+	}
+}
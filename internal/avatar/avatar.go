@@ -0,0 +1,146 @@
+// Package avatar validates uploaded avatar images and re-encodes them to a bounded size.
+package avatar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	// decoders of the accepted formats
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxUploadSize bounds the size of an uploaded image.
+	MaxUploadSize = 10 << 20
+	// MaxSize is the largest width and height of a stored avatar.
+	MaxSize = 512
+	// maxPixels bounds the decoded image, a small file can declare a huge one.
+	maxPixels = 50_000_000
+
+	jpegQuality = 85
+
+	// pathPrefix is the prefix of the route of the served avatars, the rest of the path is the blob key.
+	pathPrefix = "/v1/"
+	keyPrefix  = "avatars/"
+)
+
+var avatarNameRegexp = regexp.MustCompile(`^[0-9a-f]{16}\.(jpg|png)$`)
+
+var ErrInvalidImage = errors.New("the file is not a supported image, use JPEG, PNG, GIF or WebP")
+
+// Image is a re-encoded avatar.
+type Image struct {
+	Data        []byte
+	ContentType string
+	// Extension is the file extension of the content type with the leading dot.
+	Extension string
+}
+
+// Process decodes the image, scales it down to fit MaxSize and encodes it again.
+// Opaque images become JPEG and images with transparency PNG, the metadata of the upload is dropped.
+func Process(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the image: %w", err)
+	}
+	if len(data) > MaxUploadSize {
+		return nil, fmt.Errorf("the image is larger than %d MiB", MaxUploadSize>>20)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("the image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	dst := resize(src)
+	buf := &bytes.Buffer{}
+	if isOpaque(dst) {
+		if err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode the image: %w", err)
+		}
+		return &Image{Data: buf.Bytes(), ContentType: "image/jpeg", Extension: ".jpg"}, nil
+	}
+	if err := png.Encode(buf, dst); err != nil {
+		return nil, fmt.Errorf("failed to encode the image: %w", err)
+	}
+	return &Image{Data: buf.Bytes(), ContentType: "image/png", Extension: ".png"}, nil
+}
+
+// resize scales the image down to fit MaxSize keeping its aspect ratio, smaller images keep their size.
+func resize(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > MaxSize || height > MaxSize {
+		if width >= height {
+			width, height = MaxSize, max(1, height*MaxSize/width)
+		} else {
+			width, height = max(1, width*MaxSize/height), MaxSize
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, xdraw.Src, nil)
+	}
+	return dst
+}
+
+func isOpaque(img *image.RGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// Key is the blob key of the avatar of the user. It is named after the content, so the URL changes with the avatar.
+func Key(userID int32, img *Image) string {
+	sum := sha256.Sum256(img.Data)
+	return fmt.Sprintf("%s%d/%s%s", keyPrefix, userID, hex.EncodeToString(sum[:8]), img.Extension)
+}
+
+// Path is where the avatar with the key is served, it is kept as the avatar URL of the user.
+func Path(key string) string {
+	return pathPrefix + key
+}
+
+// KeyFromURL returns the blob key of an uploaded avatar, external avatar URLs have none.
+func KeyFromURL(avatarURL string) (string, bool) {
+	if !strings.HasPrefix(avatarURL, pathPrefix+keyPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(avatarURL, pathPrefix), true
+}
+
+// ParseKey returns the blob key of the avatar served at /v1/avatars/<userID>/<name>.
+func ParseKey(userID string, name string) (string, bool) {
+	if !avatarNameRegexp.MatchString(name) {
+		return "", false
+	}
+	if _, err := strconv.ParseInt(userID, 10, 32); err != nil {
+		return "", false
+	}
+	return keyPrefix + userID + "/" + name, true
+}
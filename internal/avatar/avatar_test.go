@@ -0,0 +1,104 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width int, height int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gifHeader is the header of a GIF which declares the size, the decoder reads nothing more for the config.
+func gifHeader(width uint16, height uint16) []byte {
+	header := []byte("GIF89a")
+	header = binary.LittleEndian.AppendUint16(header, width)
+	header = binary.LittleEndian.AppendUint16(header, height)
+	return append(header, 0, 0, 0)
+}
+
+func TestProcess(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		contentType string
+		width       int
+		height      int
+		// err is a part of the error of a rejected image
+		err string
+	}{
+		{name: "opaque image scaled down", data: encodePNG(t, 1024, 640, color.White), contentType: "image/jpeg", width: 512, height: 320},
+		{name: "tall image scaled down", data: encodePNG(t, 100, 2000, color.White), contentType: "image/jpeg", width: 25, height: 512},
+		{name: "transparent image kept", data: encodePNG(t, 40, 30, color.NRGBA{R: 255, A: 128}), contentType: "image/png", width: 40, height: 30},
+		{name: "text", data: []byte("not an image"), err: ErrInvalidImage.Error()},
+		{name: "truncated image", data: encodePNG(t, 40, 30, color.White)[:60], err: ErrInvalidImage.Error()},
+		{name: "too many pixels", data: gifHeader(10000, 10000), err: "10000x10000 pixels is too large"},
+		{name: "no pixels", data: gifHeader(0, 10), err: "0x10 pixels is too large"},
+		{name: "too large upload", data: bytes.Repeat([]byte{0}, MaxUploadSize+1), err: "larger than 10 MiB"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := Process(bytes.NewReader(tc.data))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error is %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.ContentType != tc.contentType {
+				t.Errorf("content type is %s, want %s", img.ContentType, tc.contentType)
+			}
+			config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tc.width || config.Height != tc.height {
+				t.Errorf("size is %dx%d, want %dx%d", config.Width, config.Height, tc.width, tc.height)
+			}
+		})
+	}
+}
+
+func TestProcessInvalidImage(t *testing.T) {
+	if _, err := Process(strings.NewReader("<svg></svg>")); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("error is %v, want ErrInvalidImage", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, tc := range []struct {
+		userID string
+		name   string
+		want   string
+	}{
+		{"1", "0123456789abcdef.jpg", "avatars/1/0123456789abcdef.jpg"},
+		{"1", "0123456789abcdef.gif", ""},
+		{"1", "../0123456789abcdef.jpg", ""},
+		{"..", "0123456789abcdef.jpg", ""},
+		{"99999999999", "0123456789abcdef.png", ""},
+	} {
+		key, ok := ParseKey(tc.userID, tc.name)
+		if key != tc.want || ok != (tc.want != "") {
+			t.Errorf("ParseKey(%q, %q) is %q, %v, want %q", tc.userID, tc.name, key, ok, tc.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package clock tells the time of a request, in the timezone of the requesting user.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time {
+	return f()
+}
+
+// System is the clock of the server.
+var System Clock = clockFunc(time.Now)
+
+// Fixed returns a clock which always tells t, for pinning the time in tests.
+func Fixed(t time.Time) Clock {
+	return clockFunc(func() time.Time {
+		return t
+	})
+}
+
+// In returns a clock which tells the time of c in loc.
+func In(c Clock, loc *time.Location) Clock {
+	return clockFunc(func() time.Time {
+		return c.Now().In(loc)
+	})
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the clock of the request.
+func NewContext(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the clock of the request, or System if it has none.
+func FromContext(ctx context.Context) Clock {
+	if c, ok := ctx.Value(contextKey{}).(Clock); ok {
+		return c
+	}
+	return System
+}
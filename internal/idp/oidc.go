@@ -0,0 +1,149 @@
+// Package idp implements the login through external identity providers.
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"itsfriday/store"
+)
+
+var defaultScopes = []string{oidc.ScopeOpenID, "profile", "email"}
+
+var defaultFieldMapping = store.FieldMapping{
+	Identifier:  "preferred_username",
+	DisplayName: "name",
+	Email:       "email",
+}
+
+// UserInfo is the user of the identity provider, mapped with the FieldMapping of the provider.
+type UserInfo struct {
+	// Subject is the stable id of the user at the provider.
+	Subject     string
+	Identifier  string
+	DisplayName string
+	Email       string
+}
+
+type OIDC struct {
+	provider     *oidc.Provider
+	oauth2       *oauth2.Config
+	clientID     string
+	fieldMapping store.FieldMapping
+}
+
+// NewOIDC discovers the provider at the issuer URL of the config.
+func NewOIDC(ctx context.Context, config *store.OIDCConfig, redirectURL string) (*OIDC, error) {
+	if config == nil || config.IssuerURL == "" || config.ClientID == "" {
+		return nil, errors.New("issuer url and client id are required")
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover the provider: %w", err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	} else if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	fieldMapping := defaultFieldMapping
+	if v := config.FieldMapping; v != nil {
+		if v.Identifier != "" {
+			fieldMapping.Identifier = v.Identifier
+		}
+		if v.DisplayName != "" {
+			fieldMapping.DisplayName = v.DisplayName
+		}
+		if v.Email != "" {
+			fieldMapping.Email = v.Email
+		}
+	}
+
+	return &OIDC{
+		provider: provider,
+		oauth2: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+		},
+		clientID:     config.ClientID,
+		fieldMapping: fieldMapping,
+	}, nil
+}
+
+// AuthCodeURL returns the URL of the provider where the user signs in.
+func (p *OIDC) AuthCodeURL(state string, nonce string, codeVerifier string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// ExchangeCode exchanges the authorization code for the ID token and returns the user in it.
+// The claims missing from the ID token are read from the userinfo endpoint.
+func (p *OIDC) ExchangeCode(ctx context.Context, code string, codeVerifier string, nonce string) (*UserInfo, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange the code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in the token response")
+	}
+	idToken, err := p.provider.Verifier(&oidc.Config{ClientID: p.clientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("unmatched nonce of the id token")
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to read the id token claims: %w", err)
+	}
+	if p.provider.UserInfoEndpoint() != "" {
+		userInfo, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the userinfo: %w", err)
+		}
+		if userInfo.Subject != idToken.Subject {
+			return nil, errors.New("unmatched subject of the userinfo")
+		}
+		userInfoClaims := map[string]any{}
+		if err := userInfo.Claims(&userInfoClaims); err != nil {
+			return nil, fmt.Errorf("failed to read the userinfo claims: %w", err)
+		}
+		for key, value := range userInfoClaims {
+			if _, ok := claims[key]; !ok {
+				claims[key] = value
+			}
+		}
+	}
+
+	return &UserInfo{
+		Subject:     idToken.Subject,
+		Identifier:  getStringClaim(claims, p.fieldMapping.Identifier),
+		DisplayName: getStringClaim(claims, p.fieldMapping.DisplayName),
+		Email:       getStringClaim(claims, p.fieldMapping.Email),
+	}, nil
+}
+
+func getStringClaim(claims map[string]any, name string) string {
+	if value, ok := claims[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// GenerateCodeVerifier generates a PKCE code verifier for AuthCodeURL and ExchangeCode.
+func GenerateCodeVerifier() string {
+	return oauth2.GenerateVerifier()
+}
@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of the test vectors of RFC 6238, appendix B.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateCode(t *testing.T) {
+	// The vectors have 8 digits, a code of 6 digits is their last 6.
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "94287082"},
+		{unix: 1111111109, code: "07081804"},
+		{unix: 1111111111, code: "14050471"},
+		{unix: 1234567890, code: "89005924"},
+		{unix: 2000000000, code: "69279037"},
+		{unix: 20000000000, code: "65353130"},
+	} {
+		code, err := GenerateCode(rfcSecret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tc.code[len(tc.code)-Digits:]; code != want {
+			t.Errorf("code at %d is %s, want %s", tc.unix, code, want)
+		}
+	}
+
+	// a lower case secret with spaces around it is the same secret
+	code, err := GenerateCode(" "+strings.ToLower(rfcSecret)+" ", time.Unix(59, 0))
+	if err != nil || code != "287082" {
+		t.Errorf("code of the lower case secret is %s, want 287082: %v", code, err)
+	}
+	if _, err := GenerateCode("not base32!", time.Unix(59, 0)); err == nil {
+		t.Error("a code was generated for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / Period
+	for _, tc := range []struct {
+		name string
+		at   time.Time
+		code string
+		ok   bool
+		step int64
+	}{
+		{name: "current period", at: now, ok: true, step: current},
+		{name: "previous period", at: now.Add(-Period * time.Second), ok: true, step: current - 1},
+		{name: "next period", at: now.Add(Period * time.Second), ok: true, step: current + 1},
+		{name: "two periods ago", at: now.Add(-2 * Period * time.Second)},
+		{name: "two periods ahead", at: now.Add(2 * Period * time.Second)},
+		{name: "short code", code: "12345"},
+		{name: "long code", code: "1234567"},
+	} {
+		code := tc.code
+		if code == "" {
+			var err error
+			if code, err = GenerateCode(rfcSecret, tc.at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		step, ok := Validate(rfcSecret, " "+code+" ", now)
+		if ok != tc.ok || step != tc.step {
+			t.Errorf("%s: validate returned step %d and %v, want %d and %v", tc.name, step, ok, tc.step, tc.ok)
+		}
+	}
+	if _, ok := Validate("not base32!", "123456", now); ok {
+		t.Error("a code of an invalid secret was accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != secretLength || secret == other {
+		t.Errorf("secrets are %q and %q, want two random ones of %d bytes", secret, other, secretLength)
+	}
+}
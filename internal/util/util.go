@@ -22,9 +22,10 @@ func ValidateDate(dateStr string) bool {
 	return err == nil
 }
 
-func GetYearFromQueryParam(year string) (int32, error) {
+// GetYearFromQueryParam parses the year, which defaults to the year of now.
+func GetYearFromQueryParam(year string, now time.Time) (int32, error) {
 	if year == "" {
-		return int32(time.Now().Year()), nil // this year
+		return int32(now.Year()), nil // this year
 	}
 	
 	if len(year) != 4 {
@@ -37,9 +38,10 @@ func GetYearFromQueryParam(year string) (int32, error) {
 	return y, nil
 }
 
-func GetMonthFromQueryParam(month string) (int32, error) {
+// GetMonthFromQueryParam parses the month, which defaults to the month of now.
+func GetMonthFromQueryParam(month string, now time.Time) (int32, error) {
 	if month == "" {
-		return int32(time.Now().Month()), nil // this month
+		return int32(now.Month()), nil // this month
 	}
 
 	m, err := ConvertStringToInt32(month)
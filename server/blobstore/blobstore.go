@@ -0,0 +1,65 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"itsfriday/server/profile"
+)
+
+const (
+	// BlobStoreLocal keeps the blobs as files in the data directory, it is the default.
+	BlobStoreLocal = "local"
+	// BlobStoreS3 keeps the blobs in a bucket of an S3 compatible storage, e.g. MinIO.
+	BlobStoreS3 = "s3"
+
+	blobDirName = "blobs"
+)
+
+// ErrNotFound is returned by Get when there is no blob with the key.
+var ErrNotFound = errors.New("blob not found")
+
+// Object describes a stored blob.
+type Object struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore keeps binary objects such as the uploaded avatars.
+// Keys are slash separated paths like "avatars/1/0a1b2c.jpg".
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob, the caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete removes the blob, a missing one is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the blob store configured by the profile.
+func New(profile *profile.Profile) (BlobStore, error) {
+	switch profile.BlobStore {
+	case "", BlobStoreLocal:
+		return NewLocalBlobStore(filepath.Join(profile.Data, blobDirName))
+	case BlobStoreS3:
+		if profile.S3Endpoint == "" || profile.S3Bucket == "" {
+			return nil, fmt.Errorf("s3 endpoint and bucket are required for the s3 blob store")
+		}
+		return NewS3BlobStore(profile.S3Endpoint, profile.S3Region, profile.S3Bucket, profile.S3AccessKey, profile.S3SecretKey)
+	default:
+		return nil, fmt.Errorf("unknown blob store: %s", profile.BlobStore)
+	}
+}
+
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
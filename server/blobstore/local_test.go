@@ -0,0 +1,81 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// invalidKeys are the keys every blob store rejects before touching the storage.
+var invalidKeys = []string{"", "..", "../secret", "../../etc/passwd", "avatars/../../secret", "/etc/passwd", "/avatars/1/a.jpg", "avatars//a.jpg", "./avatars/a.jpg", "avatars/"}
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "blobs")
+	b, err := NewLocalBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("avatar")
+	if err := b.Put(ctx, "avatars/1/a.png", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	r, obj, err := b.Get(ctx, "avatars/1/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || obj.ContentType != "image/png" || obj.Size != int64(len(data)) {
+		t.Errorf("blob is %q of %s and %d bytes, want %q of image/png", got, obj.ContentType, obj.Size, data)
+	}
+
+	if err := b.Delete(ctx, "avatars/1/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.Get(ctx, "avatars/1/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted blob: error is %v, want ErrNotFound", err)
+	}
+	if err := b.Delete(ctx, "avatars/1/a.png"); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestLocalBlobStoreRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	b, err := NewLocalBlobStore(filepath.Join(root, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a key escaping the directory would reach this file
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range invalidKeys {
+		if err := b.Put(ctx, key, bytes.NewReader([]byte("x")), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if r, _, err := b.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			if r != nil {
+				r.Close()
+			}
+			t.Errorf("Get(%q): error is %v, want an invalid key", key, err)
+		}
+		if err := b.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "secret")); err != nil || string(data) != "secret" {
+		t.Errorf("the file outside the blob directory is %q: %v", data, err)
+	}
+}
@@ -0,0 +1,216 @@
+package blobstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+}
+
+// fakeS3 stands in for an S3 compatible storage with path style requests, it does not check the signatures.
+type fakeS3 struct {
+	mu       sync.Mutex
+	buckets  map[string]map[string]*fakeS3Object
+	requests int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	s := &fakeS3{buckets: map[string]map[string]*fakeS3Object{}}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	bucket, ok := s.buckets[bucketName]
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead && ok:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut && !ok:
+			s.buckets[bucketName] = map[string]*fakeS3Object{}
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeS3Error(w, http.StatusBadRequest, "NotImplemented")
+		}
+		return
+	}
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Body(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		bucket[key] = &fakeS3Object{data: data, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := bucket[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", time.Unix(1700000000, 0).UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusBadRequest, "NotImplemented")
+	}
+}
+
+// readS3Body reads the uploaded object, which the client sends in signed chunks over plain HTTP.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	body := bufio.NewReader(r.Body)
+	for {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	ctx := context.Background()
+	s3, server := newFakeS3(t)
+	b, err := NewS3BlobStore(server.URL, "us-east-1", "itsfriday", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s3.buckets["itsfriday"]; !ok {
+		t.Fatal("the missing bucket was not created")
+	}
+
+	data := []byte("avatar")
+	if err := b.Put(ctx, "avatars/1/a.png", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	stored := s3.buckets["itsfriday"]["avatars/1/a.png"]
+	if stored == nil || !bytes.Equal(stored.data, data) || stored.contentType != "image/png" {
+		t.Fatalf("stored object is %+v, want %q of image/png", stored, data)
+	}
+
+	r, obj, err := b.Get(ctx, "avatars/1/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || obj.ContentType != "image/png" || obj.Size != int64(len(data)) || obj.ModTime.Unix() != 1700000000 {
+		t.Errorf("blob is %q with %+v, want %q of image/png", got, obj, data)
+	}
+	if _, _, err := b.Get(ctx, "avatars/1/missing.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing blob: error is %v, want ErrNotFound", err)
+	}
+
+	if err := b.Delete(ctx, "avatars/1/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s3.buckets["itsfriday"]["avatars/1/a.png"]; ok {
+		t.Error("the deleted object is still stored")
+	}
+	if _, _, err := b.Get(ctx, "avatars/1/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted blob: error is %v, want ErrNotFound", err)
+	}
+
+	// an existing bucket is used as it is
+	if _, err := NewS3BlobStore(server.URL, "us-east-1", "itsfriday", "access", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s3.buckets) != 1 {
+		t.Errorf("%d buckets, want 1", len(s3.buckets))
+	}
+}
+
+func TestS3BlobStoreRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	s3, server := newFakeS3(t)
+	b, err := NewS3BlobStore(server.URL, "us-east-1", "itsfriday", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := s3.requests
+
+	for _, key := range invalidKeys {
+		if err := b.Put(ctx, key, bytes.NewReader([]byte("x")), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, _, err := b.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): error is %v, want an invalid key", key, err)
+		}
+		if err := b.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if s3.requests != requests {
+		t.Errorf("%d requests for invalid keys, want none", s3.requests-requests)
+	}
+}
+
+func TestNewS3BlobStoreInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:9000", "ftp://localhost:9000", "http://"} {
+		if _, err := NewS3BlobStore(endpoint, "us-east-1", "itsfriday", "access", "secret"); err == nil {
+			t.Errorf("endpoint %q was accepted", endpoint)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"itsfriday/server/profile"
+)
+
+const (
+	// secretLength is the number of random bytes of a generated signing secret.
+	secretLength = 32
+	// keyIDPrefix prefixes the sequence number of a key, e.g. "v1", "v2".
+	keyIDPrefix = "v"
+)
+
+// Key is a JWT signing secret identified by the kid header.
+type Key struct {
+	ID        string `json:"kid"`
+	Secret    string `json:"secret"`
+	CreatedTs int64  `json:"createdTs"`
+}
+
+// Keyring holds the signing keys of the server.
+// The newest key signs new tokens, older keys only validate tokens until they are invalidated.
+type Keyring struct {
+	path string
+
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+type keyringFile struct {
+	Keys []*Key `json:"keys"`
+}
+
+// GetKeyringPath returns the path of the keyring file in the data directory.
+func GetKeyringPath(profile *profile.Profile) string {
+	return filepath.Join(profile.Data, fmt.Sprintf("itsfriday_%s.keys", profile.Mode))
+}
+
+// Load reads the keyring from the data directory.
+// If it does not exist yet, a keyring with a single key is created and persisted.
+// The secret of the profile is used for the first key if it is given, otherwise a random one is generated.
+// Once the keyring exists the secret of the profile is ignored, a different one is only warned about.
+func Load(profile *profile.Profile) (*Keyring, error) {
+	k := &Keyring{
+		path: GetKeyringPath(profile),
+	}
+
+	bytes, err := os.ReadFile(k.path)
+	if err == nil {
+		var file keyringFile
+		if err := json.Unmarshal(bytes, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse keyring file %s: %w", k.path, err)
+		}
+		if len(file.Keys) == 0 {
+			return nil, fmt.Errorf("keyring file %s has no keys", k.path)
+		}
+		k.keys = file.Keys
+		if profile.Secret != "" && !k.hasSecret(profile.Secret) {
+			slog.Warn("the secret is ignored, the keys of the keyring file sign the tokens, rotate them with `itsfriday keys rotate`", "path", k.path)
+		}
+		return k, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read keyring file %s: %w", k.path, err)
+	}
+
+	secret := profile.Secret
+	if secret == "" {
+		secret, err = generateSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+	k.keys = []*Key{{
+		ID:        keyIDPrefix + "1",
+		Secret:    secret,
+		CreatedTs: time.Now().Unix(),
+	}}
+	if err := k.save(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Current returns the key used to sign new tokens.
+func (k *Keyring) Current() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[len(k.keys)-1]
+}
+
+// Lookup returns the secret of the key with the given kid.
+func (k *Keyring) Lookup(kid string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return []byte(key.Secret), true
+		}
+	}
+	return nil, false
+}
+
+// List returns all the keys from the oldest to the newest.
+func (k *Keyring) List() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	list := make([]*Key, len(k.keys))
+	copy(list, k.keys)
+	return list
+}
+
+// Rotate generates a new key which signs new tokens from now on.
+func (k *Keyring) Rotate() (*Key, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{
+		ID:        fmt.Sprintf("%s%d", keyIDPrefix, k.nextSequence()),
+		Secret:    secret,
+		CreatedTs: time.Now().Unix(),
+	}
+	k.keys = append(k.keys, key)
+	if err := k.save(); err != nil {
+		k.keys = k.keys[:len(k.keys)-1]
+		return nil, err
+	}
+	return key, nil
+}
+
+// Invalidate removes the key with the given kid, so tokens signed with it are rejected.
+// The current key can not be invalidated, rotate first.
+func (k *Keyring) Invalidate(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.keys[len(k.keys)-1].ID == kid {
+		return fmt.Errorf("key %s is the current signing key, rotate keys before invalidating it", kid)
+	}
+	keys := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key.ID == kid {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == len(k.keys) {
+		return fmt.Errorf("key %s not found", kid)
+	}
+
+	previous := k.keys
+	k.keys = keys
+	if err := k.save(); err != nil {
+		k.keys = previous
+		return err
+	}
+	return nil
+}
+
+func (k *Keyring) hasSecret(secret string) bool {
+	for _, key := range k.keys {
+		if key.Secret == secret {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Keyring) nextSequence() int {
+	max := 0
+	for _, key := range k.keys {
+		sequence, err := strconv.Atoi(strings.TrimPrefix(key.ID, keyIDPrefix))
+		if err == nil && sequence > max {
+			max = sequence
+		}
+	}
+	return max + 1
+}
+
+func (k *Keyring) save() error {
+	bytes, err := json.MarshalIndent(&keyringFile{Keys: k.keys}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated keyring behind.
+	tmpPath := k.path + ".tmp"
+	if err := os.WriteFile(tmpPath, bytes, 0600); err != nil {
+		return fmt.Errorf("failed to write keyring file %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, k.path); err != nil {
+		return fmt.Errorf("failed to replace keyring file %s: %w", k.path, err)
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	bytes := make([]byte, secretLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
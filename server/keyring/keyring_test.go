@@ -0,0 +1,167 @@
+package keyring_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"itsfriday/server/keyring"
+	"itsfriday/server/profile"
+)
+
+func newProfile(t *testing.T, secret string) *profile.Profile {
+	t.Helper()
+	return &profile.Profile{Mode: "dev", Data: t.TempDir(), Secret: secret}
+}
+
+// expectPersisted fails unless the keyring file holds the keys of k, with no temporary file left behind.
+func expectPersisted(t *testing.T, p *profile.Profile, k *keyring.Keyring) {
+	t.Helper()
+	loaded, err := keyring.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.List(), k.List()) {
+		t.Errorf("the keyring file has %+v, want %+v", loaded.List(), k.List())
+	}
+	info, err := os.Stat(keyring.GetKeyringPath(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the keyring file mode is %v, want 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(keyring.GetKeyringPath(p) + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary keyring file is left behind: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	p := newProfile(t, "secret")
+	k, err := keyring.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := k.List(); len(keys) != 1 || keys[0].ID != "v1" || keys[0].Secret != "secret" || k.Current() != keys[0] {
+		t.Errorf("keys are %+v, want v1 of the secret of the profile", keys)
+	}
+	expectPersisted(t, p, k)
+
+	// the keyring file wins over the secret once it exists
+	p.Secret = "another secret"
+	loaded, err := keyring.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, ok := loaded.Lookup("v1"); !ok || string(secret) != "secret" {
+		t.Errorf("v1 is %q, want the secret of the keyring file", secret)
+	}
+
+	// without a secret a random one is generated
+	generated := []string{}
+	for range 2 {
+		k, err := keyring.Load(newProfile(t, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		generated = append(generated, k.Current().Secret)
+	}
+	if len(generated[0]) < 32 || generated[0] == generated[1] {
+		t.Errorf("generated secrets are %q, want two different random ones", generated)
+	}
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"malformed": "{",
+		"no keys":   `{"keys": []}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := newProfile(t, "")
+			if err := os.WriteFile(keyring.GetKeyringPath(p), []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := keyring.Load(p); err == nil {
+				t.Error("the invalid keyring file was loaded")
+			}
+		})
+	}
+}
+
+func TestRotateAndInvalidate(t *testing.T) {
+	p := newProfile(t, "secret")
+	k, err := keyring.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := k.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "v2" || k.Current() != key || key.Secret == "secret" {
+		t.Errorf("the rotated key is %+v and the current one %+v, want a new v2", key, k.Current())
+	}
+	// the old key keeps validating
+	if secret, ok := k.Lookup("v1"); !ok || string(secret) != "secret" {
+		t.Errorf("v1 is %q after the rotation, want the old secret", secret)
+	}
+	expectPersisted(t, p, k)
+
+	if err := k.Invalidate("v2"); err == nil {
+		t.Error("the current key was invalidated")
+	}
+	if err := k.Invalidate("v9"); err == nil {
+		t.Error("an unknown key was invalidated")
+	}
+	if err := k.Invalidate("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := k.Lookup("v1"); ok {
+		t.Error("v1 is found after it was invalidated")
+	}
+	expectPersisted(t, p, k)
+
+	// the ids of invalidated keys are not used again
+	key, err = k.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID != "v3" {
+		t.Errorf("the rotated key is %s, want v3", key.ID)
+	}
+	expectPersisted(t, p, k)
+}
+
+func TestKeyringKeptOnFailedSave(t *testing.T) {
+	p := newProfile(t, "secret")
+	k, err := keyring.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	keys := k.List()
+	// the temporary file cannot be written over a directory
+	if err := os.Mkdir(keyring.GetKeyringPath(p)+".tmp", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := k.Rotate(); err == nil {
+		t.Fatal("the keyring was rotated without being saved")
+	}
+	if err := k.Invalidate("v1"); err == nil {
+		t.Fatal("v1 was invalidated without being saved")
+	}
+	if !reflect.DeepEqual(k.List(), keys) {
+		t.Errorf("keys are %+v after the failed saves, want %+v", k.List(), keys)
+	}
+	loaded, err := keyring.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.List(), keys) {
+		t.Errorf("the keyring file has %+v after the failed saves, want %+v", loaded.List(), keys)
+	}
+}
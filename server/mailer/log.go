@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogMailer logs the mails instead of sending them.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{
+		from: from,
+	}
+}
+
+func (m *LogMailer) Send(_ context.Context, message *Message) error {
+	slog.Info("mail", "from", m.from, "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"itsfriday/server/profile"
+)
+
+const (
+	// MailerLog writes mails to the log, it is the default for development.
+	MailerLog = "log"
+	// MailerFile writes every mail as an .eml file into the data directory.
+	MailerFile = "file"
+	// MailerSMTP delivers mails through an SMTP server.
+	MailerSMTP = "smtp"
+
+	mailDirName = "mails"
+)
+
+// Message is a plain text mail.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mails to the users.
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// New creates the mailer configured by the profile.
+func New(profile *profile.Profile) (Mailer, error) {
+	switch profile.Mailer {
+	case "", MailerLog:
+		return NewLogMailer(profile.MailFrom), nil
+	case MailerFile:
+		return NewFileMailer(filepath.Join(profile.Data, mailDirName), profile.MailFrom)
+	case MailerSMTP:
+		if profile.SMTPHost == "" {
+			return nil, fmt.Errorf("smtp host is required for the smtp mailer")
+		}
+		return NewSMTPMailer(profile.SMTPHost, profile.SMTPPort, profile.SMTPUsername, profile.SMTPPassword, profile.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer: %s", profile.Mailer)
+	}
+}
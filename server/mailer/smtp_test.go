@@ -0,0 +1,180 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer answers one SMTP session per connection and records what it received.
+// A silent server accepts connections and never answers.
+type fakeSMTPServer struct {
+	listener net.Listener
+	silent   bool
+	sessions chan *smtpSession
+}
+
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTPServer(t *testing.T, silent bool) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &fakeSMTPServer{listener: listener, silent: silent, sessions: make(chan *smtpSession, 4)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if s.silent {
+		// hold the connection until the client gives up
+		r.ReadString(0)
+		return
+	}
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	session := &smtpSession{}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			session.auth = strings.TrimPrefix(command, "AUTH PLAIN ")
+			reply("235 authenticated")
+		case "MAIL":
+			session.from = command
+			reply("250 ok")
+		case "RCPT":
+			session.to = append(session.to, command)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			session.data = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.sessions <- session
+			return
+		default:
+			reply("502 unknown command " + verb)
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := startFakeSMTPServer(t, false)
+	m := NewSMTPMailer("127.0.0.1", server.port(), "user", "password", "itsfriday <noreply@example.com>")
+	message := &Message{To: "Alice <alice@example.com>", Subject: "Verify your email", Body: "Hello\nthere"}
+	if err := m.Send(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	var session *smtpSession
+	select {
+	case session = <-server.sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not receive the mail")
+	}
+	if auth, err := base64.StdEncoding.DecodeString(session.auth); err != nil || string(auth) != "\x00user\x00password" {
+		t.Errorf("auth is %q, want the credentials", auth)
+	}
+	if session.from != "MAIL FROM:<noreply@example.com>" {
+		t.Errorf("sender is %q", session.from)
+	}
+	if len(session.to) != 1 || session.to[0] != "RCPT TO:<alice@example.com>" {
+		t.Errorf("recipients are %q", session.to)
+	}
+	for _, want := range []string{"From: itsfriday <noreply@example.com>\r\n", "To: Alice <alice@example.com>\r\n", "Subject: Verify your email\r\n", "\r\n\r\nHello\r\nthere"} {
+		if !strings.Contains(session.data, want) {
+			t.Errorf("the mail is %q, want %q in it", session.data, want)
+		}
+	}
+}
+
+func TestSMTPMailerSendTimeout(t *testing.T) {
+	server := startFakeSMTPServer(t, true)
+	message := &Message{To: "alice@example.com", Subject: "Subject", Body: "Body"}
+
+	m := NewSMTPMailer("127.0.0.1", server.port(), "", "", "noreply@example.com")
+	m.timeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := m.Send(context.Background(), message); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("send to a silent server returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("send to a silent server took %v, want the timeout", elapsed)
+	}
+
+	// a cancelled context stops the send too
+	m.timeout = smtpTimeout
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := m.Send(ctx, message); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled send returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSMTPMailerSendRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	m := NewSMTPMailer("127.0.0.1", port, "", "", "noreply@example.com")
+	err = m.Send(context.Background(), &Message{To: "alice@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:"+strconv.Itoa(port)) {
+		t.Errorf("send to a closed port returned %v", err)
+	}
+	if err := m.Send(context.Background(), &Message{To: "not an address"}); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Errorf("send to an invalid address returned %v", err)
+	}
+}
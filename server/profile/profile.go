@@ -3,6 +3,7 @@ package profile
 import (
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,8 +20,34 @@ type Profile struct {
 	Data string
 	// DSN points to where itsfriday stores its own data
 	DSN string
-	// Driver is the database driver: sqlite
+	// Driver is the database driver: sqlite, postgres or mysql
 	Driver string
+	// Secret is the initial JWT signing secret, a random one is generated if empty
+	Secret string
+	// InstanceURL is the public URL of the web app, used for the links in mails
+	InstanceURL string
+	// ServerURL is the public URL of this server, used for the redirect URIs of the identity providers
+	ServerURL string
+	// Mailer is the mail backend: log, file or smtp
+	Mailer string
+	// MailFrom is the sender address of the mails
+	MailFrom string
+	// SMTPHost, SMTPPort, SMTPUsername and SMTPPassword configure the smtp mailer
+	SMTPHost string
+	SMTPPort int
+	SMTPUsername string
+	SMTPPassword string
+	// BlobStore is where uploaded files such as avatars are kept: local or s3
+	BlobStore string
+	// S3Endpoint, S3Region, S3Bucket, S3AccessKey and S3SecretKey configure the s3 blob store
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	// TrustedProxies are the CIDRs of the reverse proxies whose X-Forwarded-For header gives the client IP.
+	// Without any the client IP is the address of the connection.
+	TrustedProxies []string
 	// Version is the current version of server
 	Version string
 }
@@ -41,10 +68,29 @@ func (p *Profile) Validate() error {
 		dbFile := fmt.Sprintf("itsfriday_%s.db", p.Mode)
 		p.DSN = filepath.Join(dataDir, dbFile)
 	}
+	if (p.Driver == "postgres" || p.Driver == "mysql") && p.DSN == "" {
+		return fmt.Errorf("dsn is required for the %s driver", p.Driver)
+	}
+	if _, err := p.TrustedProxyNets(); err != nil {
+		return err
+	}
 
     return nil
 }
 
+// TrustedProxyNets parses TrustedProxies.
+func (p *Profile) TrustedProxyNets() ([]*net.IPNet, error) {
+	ipNets := make([]*net.IPNet, 0, len(p.TrustedProxies))
+	for _, cidr := range p.TrustedProxies {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
 func checkDataDir(dataDir string) (string, error) {
 	// Convert to absolute path if relative path is supplied.
 	if !filepath.IsAbs(dataDir) {
@@ -0,0 +1,497 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"itsfriday/internal/clock"
+	"itsfriday/internal/util"
+	"itsfriday/server/mailer"
+	"itsfriday/store"
+)
+
+// account service: email verification, password reset and restoring deleted accounts
+
+const (
+	// mailSendTimeout bounds the delivery of a mail which is sent in the background.
+	mailSendTimeout = 30 * time.Second
+
+	// accountDeletionGracePeriod is how long a deleted account can be restored before it is purged.
+	accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+	verifyEmailPath   = "/dashboard/auth/verify-email"
+	resetPasswordPath = "/dashboard/auth/reset-password"
+)
+
+type AccountServiceServer interface {
+	VerifyEmail(echo.Context) error
+	SendEmailVerification(echo.Context) error
+	ForgotPassword(echo.Context) error
+	ResetPassword(echo.Context) error
+	RestoreAccount(echo.Context) error
+}
+
+type VerifyEmailRequest struct {
+	Token        string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email        string `json:"email"`
+}
+
+type RestoreAccountRequest struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+}
+
+type ResetPasswordRequest struct {
+	Token        string `json:"token"`
+	Password     string `json:"password"`
+}
+
+// VerifyEmail marks the email of the user as verified with the token sent to it.
+func (s *APIV1Service) VerifyEmail(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(VerifyEmailRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid verify email request: %v", err),
+		})
+	}
+
+	user, tokenID, err := s.getUserFromMailToken(ctx, request.Token, EmailVerificationAudienceName)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid or expired verification token: %v", err),
+		})
+	}
+
+	emailVerification, err := s.Store.GetUserEmailVerification(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get email verification: %v", err),
+		})
+	}
+	if emailVerification == nil || emailVerification.TokenID == "" || emailVerification.TokenID != tokenID || emailVerification.Email != user.Email {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "verification token has already been used or replaced",
+		})
+	}
+
+	emailVerification.Verified = true
+	emailVerification.VerifiedTs = time.Now().Unix()
+	emailVerification.TokenID = ""
+	emailVerification.ExpiresTs = 0
+	if err := s.upsertUserEmailVerification(ctx, user.ID, emailVerification); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save email verification: %v", err),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SendEmailVerification sends a new verification mail to the current email of the user.
+func (s *APIV1Service) SendEmailVerification(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+	if user.Email == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "user has no email",
+		})
+	}
+
+	emailVerification, err := s.Store.GetUserEmailVerification(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get email verification: %v", err),
+		})
+	}
+	if emailVerification.IsVerified(user.Email) {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "email has already been verified",
+		})
+	}
+
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to send email verification: %v", err),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForgotPassword mails a password reset link to the user of the email.
+// It always succeeds so that it does not reveal which emails are registered.
+func (s *APIV1Service) ForgotPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(ForgotPasswordRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid forgot password request: %v", err),
+		})
+	}
+	if request.Email == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "email should be provided",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{Email: &request.Email})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil || user.RowStatus == store.Archived {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	tokenID := uuid.NewString()
+	expireTime := time.Now().Add(PasswordResetTokenDuration)
+	token, err := generateToken(user.Username, user.ID, PasswordResetAudienceName, tokenID, expireTime, s.Keyring.Current())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate password reset token: %v", err),
+		})
+	}
+	value, err := store.ConvertUserSettingValueToString(&store.UserSettingPasswordReset{
+		TokenID:   tokenID,
+		ExpiresTs: expireTime.Unix(),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to marshal password reset: %v", err),
+		})
+	}
+	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: user.ID,
+		Key:    store.UserSettingKey_PASSWORD_RESET,
+		Value:  value,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save password reset: %v", err),
+		})
+	}
+
+	s.sendMail(&mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your itsfriday password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to choose a new password. It expires in %s.\n\n%s\n\nIf you did not ask for it, you can ignore this mail.\n",
+			user.Nickname, formatMailDuration(PasswordResetTokenDuration), s.buildMailLink(resetPasswordPath, token)),
+	})
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ResetPassword sets a new password with a reset token and signs the user out everywhere.
+func (s *APIV1Service) ResetPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(ResetPasswordRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid reset password request: %v", err),
+		})
+	}
+	if request.Password == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "password should be provided",
+		})
+	}
+
+	user, tokenID, err := s.getUserFromMailToken(ctx, request.Token, PasswordResetAudienceName)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid or expired reset token: %v", err),
+		})
+	}
+
+	passwordReset, err := s.Store.GetUserPasswordReset(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get password reset: %v", err),
+		})
+	}
+	if passwordReset == nil || passwordReset.TokenID != tokenID {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "reset token has already been used or replaced",
+		})
+	}
+	// Consume the token before anything else so it can not be used twice.
+	if err := s.Store.DeleteUserSetting(ctx, &store.DeleteUserSetting{
+		UserID: &user.ID,
+		Key:    store.UserSettingKey_PASSWORD_RESET,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to delete password reset: %v", err),
+		})
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate password hash: %v", err),
+		})
+	}
+	currentTs := time.Now().Unix()
+	passwordHashStr := string(passwordHash)
+	if _, err := s.Store.UpdateUser(ctx, &store.UpdateUser{
+		ID:           user.ID,
+		UpdatedTs:    &currentTs,
+		PasswordHash: &passwordHashStr,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update password: %v", err),
+		})
+	}
+
+	// Revoke every session and personal access token, whoever knew the old password is signed out.
+	if err := s.revokeAllTokens(ctx, user.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to revoke tokens: %v", err),
+		})
+	}
+	if err := s.clearSignInCookies(c); err != nil {
+		slog.Error("failed to clear cookies", "error", err)
+	}
+	s.recordAuditLog(c, user.ID, store.AuditActionPasswordReset, store.AuditOutcomeSuccess, "every session and personal access token was revoked")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// sendEmailVerification issues a new verification token for the current email of the user and mails it.
+// A previously sent token stops working.
+func (s *APIV1Service) sendEmailVerification(ctx context.Context, user *store.User) error {
+	tokenID := uuid.NewString()
+	expireTime := time.Now().Add(EmailVerificationTokenDuration)
+	token, err := generateToken(user.Username, user.ID, EmailVerificationAudienceName, tokenID, expireTime, s.Keyring.Current())
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %v", err)
+	}
+	if err := s.upsertUserEmailVerification(ctx, user.ID, &store.UserSettingEmailVerification{
+		Email:     user.Email,
+		Verified:  false,
+		TokenID:   tokenID,
+		ExpiresTs: expireTime.Unix(),
+	}); err != nil {
+		return err
+	}
+
+	s.sendMail(&mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your itsfriday email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to verify your email. It expires in %s.\n\n%s\n",
+			user.Nickname, formatMailDuration(EmailVerificationTokenDuration), s.buildMailLink(verifyEmailPath, token)),
+	})
+	return nil
+}
+
+func (s *APIV1Service) upsertUserEmailVerification(ctx context.Context, userID int32, emailVerification *store.UserSettingEmailVerification) error {
+	value, err := store.ConvertUserSettingValueToString(emailVerification)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: userID,
+		Key:    store.UserSettingKey_EMAIL_VERIFICATION,
+		Value:  value,
+	}); err != nil {
+		return fmt.Errorf("failed to upsert user setting: %v", err)
+	}
+	return nil
+}
+
+// getUserFromMailToken returns the user and the token ID of a token sent by mail.
+func (s *APIV1Service) getUserFromMailToken(ctx context.Context, token string, audience string) (*store.User, string, error) {
+	_, claims, err := parseToken(token, audience, s.Keyring)
+	if err != nil {
+		return nil, "", err
+	}
+	userID, err := util.ConvertStringToInt32(claims.Subject)
+	if err != nil {
+		return nil, "", fmt.Errorf("malformed ID in the token: %v", err)
+	}
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil || user.RowStatus == store.Archived {
+		return nil, "", fmt.Errorf("user not found")
+	}
+	return user, claims.ID, nil
+}
+
+// sendMail delivers the mail in the background, the response does not wait for the mail server.
+func (s *APIV1Service) sendMail(message *mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.Mailer.Send(ctx, message); err != nil {
+			slog.Error("failed to send mail", "subject", message.Subject, "error", err)
+		}
+	}()
+}
+
+func (s *APIV1Service) buildMailLink(path string, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", s.Profile.InstanceURL, path, url.QueryEscape(token))
+}
+
+func formatMailDuration(d time.Duration) string {
+	if hours := int(d.Hours()); hours > 1 {
+		return fmt.Sprintf("%d hours", hours)
+	}
+	if d >= time.Hour {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
+
+// RestoreAccount cancels the scheduled deletion of an account, the user signs in again afterwards.
+func (s *APIV1Service) RestoreAccount(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(RestoreAccountRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid restore account request: %v", err),
+		})
+	}
+	if request.Username == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "username should be provided",
+		})
+	}
+
+	// the password is checked like a login, with the same protection against guessing
+	now := clock.FromContext(ctx).Now()
+	loginAttemptSubjects := getLoginAttemptSubjects(c, request.Username)
+	retryAfter, err := s.checkLoginAttempts(ctx, loginAttemptSubjects, now)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to check login attempts: %v", err),
+		})
+	}
+	if retryAfter > 0 {
+		s.recordAuditLog(c, 0, store.AuditActionAccountRestore, store.AuditOutcomeFailure, fmt.Sprintf("too many failed login attempts for %s", request.Username))
+		return tooManyLoginAttempts(c, retryAfter)
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{Username: &request.Username})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)) != nil {
+		s.recordLoginFailure(ctx, loginAttemptSubjects, now)
+		if user == nil {
+			s.recordAuditLog(c, 0, store.AuditActionAccountRestore, store.AuditOutcomeFailure, fmt.Sprintf("unknown user %s", request.Username))
+		} else {
+			s.recordAuditLog(c, user.ID, store.AuditActionAccountRestore, store.AuditOutcomeFailure, "wrong password")
+		}
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "unmatched username and password",
+		})
+	}
+	s.resetLoginAttempts(ctx, loginAttemptSubjects)
+
+	deletion, err := s.Store.GetUserDeletion(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user deletion: %v", err),
+		})
+	}
+	if deletion == nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "the account is not scheduled for deletion",
+		})
+	}
+
+	restoredUser, err := s.cancelUserDeletion(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to restore account: %v", err),
+		})
+	}
+	slog.Info("user deletion canceled", "user", user.ID)
+	s.recordAuditLog(c, user.ID, store.AuditActionAccountRestore, store.AuditOutcomeSuccess, "")
+
+	return c.JSON(http.StatusOK, s.convertUserFromStore(restoredUser))
+}
+
+// cancelUserDeletion unarchives the user and drops the scheduled deletion, if any.
+func (s *APIV1Service) cancelUserDeletion(ctx context.Context, userID int32) (*store.User, error) {
+	if err := s.Store.DeleteUserSetting(ctx, &store.DeleteUserSetting{
+		UserID: &userID,
+		Key:    store.UserSettingKey_DELETION,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to delete user setting: %w", err)
+	}
+	rowStatus := store.Normal
+	currentTs := time.Now().Unix()
+	return s.Store.UpdateUser(ctx, &store.UpdateUser{
+		ID:        userID,
+		UpdatedTs: &currentTs,
+		RowStatus: &rowStatus,
+	})
+}
@@ -0,0 +1,213 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"itsfriday/store"
+)
+
+var mailTokenPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+// receiveMailToken waits for the mail to the address and returns the token of the link in it.
+func receiveMailToken(t *testing.T, s *APIV1Service, to string, path string) string {
+	t.Helper()
+	message := s.Mailer.(*testMailer).receive(t)
+	if message.To != to || !strings.Contains(message.Body, s.Profile.InstanceURL+path+"?token=") {
+		t.Fatalf("mail is %+v, want a link to %s sent to %s", message, path, to)
+	}
+	token, err := url.QueryUnescape(mailTokenPattern.FindStringSubmatch(message.Body)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// expectErrorResponse fails unless the response is an error with the status and a part of the message.
+func expectErrorResponse(t *testing.T, rec *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+	response := &ErrorResponse{}
+	decodeResponse(t, rec, status, response)
+	if !strings.Contains(response.Message, message) {
+		t.Errorf("message is %q, want %q", response.Message, message)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "password")
+
+	decodeResponse(t, callHandler(t, s.SendEmailVerification, http.MethodPost, "/v1/user/email/verification", nil, user.ID), http.StatusNoContent, nil)
+	replacedToken := receiveMailToken(t, s, user.Email, verifyEmailPath)
+	decodeResponse(t, callHandler(t, s.SendEmailVerification, http.MethodPost, "/v1/user/email/verification", nil, user.ID), http.StatusNoContent, nil)
+	token := receiveMailToken(t, s, user.Email, verifyEmailPath)
+
+	emailVerification, err := s.Store.GetUserEmailVerification(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredToken, err := generateToken(user.Username, user.ID, EmailVerificationAudienceName, emailVerification.TokenID, time.Now().Add(-time.Minute), s.Keyring.Current())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetToken, err := generateToken(user.Username, user.ID, PasswordResetAudienceName, emailVerification.TokenID, time.Now().Add(time.Hour), s.Keyring.Current())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		status  int
+		message string
+	}{
+		{name: "expired token", token: expiredToken, status: http.StatusBadRequest, message: "invalid or expired verification token"},
+		{name: "token of a password reset", token: resetToken, status: http.StatusBadRequest, message: "invalid or expired verification token"},
+		{name: "malformed token", token: "token", status: http.StatusBadRequest, message: "invalid or expired verification token"},
+		{name: "replaced token", token: replacedToken, status: http.StatusBadRequest, message: "already been used or replaced"},
+		{name: "token", token: token, status: http.StatusNoContent},
+		{name: "used token", token: token, status: http.StatusBadRequest, message: "already been used or replaced"},
+	} {
+		rec := callHandler(t, s.VerifyEmail, http.MethodPost, "/v1/auth/email/verify", &VerifyEmailRequest{Token: tc.token}, InvalidUserID)
+		if tc.status == http.StatusNoContent {
+			decodeResponse(t, rec, tc.status, nil)
+		} else {
+			expectErrorResponse(t, rec, tc.status, tc.message)
+		}
+		emailVerification, err := s.Store.GetUserEmailVerification(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verified := emailVerification.IsVerified(user.Email); verified != (tc.name == "token" || tc.name == "used token") {
+			t.Errorf("%s: the email is verified %v", tc.name, verified)
+		}
+	}
+
+	rec := callHandler(t, s.SendEmailVerification, http.MethodPost, "/v1/user/email/verification", nil, user.ID)
+	expectErrorResponse(t, rec, http.StatusBadRequest, "already been verified")
+}
+
+func TestVerifyEmailOfChangedEmail(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "password")
+
+	decodeResponse(t, callHandler(t, s.SendEmailVerification, http.MethodPost, "/v1/user/email/verification", nil, user.ID), http.StatusNoContent, nil)
+	token := receiveMailToken(t, s, user.Email, verifyEmailPath)
+	email := "alice@example.org"
+	if _, err := s.Store.UpdateUser(ctx, &store.UpdateUser{ID: user.ID, Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token verifies the email it was sent to only
+	rec := callHandler(t, s.VerifyEmail, http.MethodPost, "/v1/auth/email/verify", &VerifyEmailRequest{Token: token}, InvalidUserID)
+	expectErrorResponse(t, rec, http.StatusBadRequest, "already been used or replaced")
+	emailVerification, err := s.Store.GetUserEmailVerification(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emailVerification.IsVerified(email) || emailVerification.IsVerified(user.Email) {
+		t.Errorf("email verification is %+v, want unverified", emailVerification)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "password")
+	// two signed-in sessions, which the reset signs out
+	var accessTokens []string
+	for range 2 {
+		tokens, err := s.doSignIn(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessTokens = append(accessTokens, tokens.AccessToken)
+	}
+
+	// an unknown email is not revealed
+	decodeResponse(t, callHandler(t, s.ForgotPassword, http.MethodPost, "/v1/auth/password/forgot", &ForgotPasswordRequest{Email: "bob@example.com"}, InvalidUserID), http.StatusNoContent, nil)
+	expectErrorResponse(t, callHandler(t, s.ForgotPassword, http.MethodPost, "/v1/auth/password/forgot", &ForgotPasswordRequest{}, InvalidUserID), http.StatusBadRequest, "email should be provided")
+
+	decodeResponse(t, callHandler(t, s.ForgotPassword, http.MethodPost, "/v1/auth/password/forgot", &ForgotPasswordRequest{Email: user.Email}, InvalidUserID), http.StatusNoContent, nil)
+	replacedToken := receiveMailToken(t, s, user.Email, resetPasswordPath)
+	decodeResponse(t, callHandler(t, s.ForgotPassword, http.MethodPost, "/v1/auth/password/forgot", &ForgotPasswordRequest{Email: user.Email}, InvalidUserID), http.StatusNoContent, nil)
+	token := receiveMailToken(t, s, user.Email, resetPasswordPath)
+
+	passwordReset, err := s.Store.GetUserPasswordReset(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredToken, err := generateToken(user.Username, user.ID, PasswordResetAudienceName, passwordReset.TokenID, time.Now().Add(-time.Minute), s.Keyring.Current())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verificationToken, err := generateToken(user.Username, user.ID, EmailVerificationAudienceName, passwordReset.TokenID, time.Now().Add(time.Hour), s.Keyring.Current())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		token    string
+		password string
+		status   int
+		message  string
+	}{
+		{name: "missing password", token: token, status: http.StatusBadRequest, message: "password should be provided"},
+		{name: "expired token", token: expiredToken, password: "expired", status: http.StatusBadRequest, message: "invalid or expired reset token"},
+		{name: "token of an email verification", token: verificationToken, password: "verification", status: http.StatusBadRequest, message: "invalid or expired reset token"},
+		{name: "replaced token", token: replacedToken, password: "replaced", status: http.StatusBadRequest, message: "already been used or replaced"},
+		{name: "token", token: token, password: "new password", status: http.StatusNoContent},
+		{name: "used token", token: token, password: "used", status: http.StatusBadRequest, message: "already been used or replaced"},
+	} {
+		rec := callHandler(t, s.ResetPassword, http.MethodPost, "/v1/auth/password/reset", &ResetPasswordRequest{Token: tc.token, Password: tc.password}, InvalidUserID)
+		if tc.status != http.StatusNoContent {
+			expectErrorResponse(t, rec, tc.status, tc.message)
+			continue
+		}
+		decodeResponse(t, rec, tc.status, nil)
+		if cookies := rec.Header().Values("Set-Cookie"); len(cookies) != 2 || !strings.HasPrefix(cookies[0], AccessTokenCookieName+"=;") {
+			t.Errorf("cookies are %v, want the cleared sign-in cookies", cookies)
+		}
+	}
+
+	user, err = s.Store.GetUser(ctx, &store.FindUser{ID: &user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("new password")) != nil {
+		t.Error("the password was not reset to the new one")
+	}
+
+	// every session is signed out
+	userAccessTokens, err := s.Store.GetUserAccessTokens(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, accessToken := range accessTokens {
+		if validateAccessToken(accessToken, "", userAccessTokens) != nil {
+			t.Error("an access token of the old password still works")
+		}
+	}
+	userRefreshTokens, err := s.Store.GetUserRefreshTokens(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := s.Store.GetUserSessions(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userAccessTokens) != 0 || len(userRefreshTokens) != 0 || len(sessions) != 0 {
+		t.Errorf("%d access tokens, %d refresh tokens and %d sessions after the reset, want none", len(userAccessTokens), len(userRefreshTokens), len(sessions))
+	}
+}
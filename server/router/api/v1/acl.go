@@ -5,32 +5,42 @@ import (
 	"log/slog"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	echojwt "github.com/labstack/echo-jwt/v4"
 
-	"itsfriday/store"
+	"itsfriday/internal/clock"
 	"itsfriday/internal/util"
+	"itsfriday/server/keyring"
+	"itsfriday/store"
 )
 
 const (
 	useridContextKey      string      = "userid"
 	accessTokenContextKey string      = "access-token"
+	// sessionIDContextKey is the token family of a session, empty for personal access tokens.
+	sessionIDContextKey   string      = "session-id"
 
 	InvalidUserID int32   = 0
+
+	accessTokenTouchInterval = time.Minute
 )
 
+var errPermissionDenied = errors.New("permission denied")
+
 type authHandler struct {
 	Store      *store.Store
-	secret     string
+	keyring    *keyring.Keyring
 	ContextKey string
 }
 
-func NewAuthHandler(store *store.Store, secret string, contextKey string) *authHandler {
+func NewAuthHandler(store *store.Store, keyring *keyring.Keyring, contextKey string) *authHandler {
 	return &authHandler{
-		Store:  store,
-		secret: secret,
+		Store:      store,
+		keyring:    keyring,
 		ContextKey: contextKey,
 	}
 }
@@ -38,23 +48,27 @@ func NewAuthHandler(store *store.Store, secret string, contextKey string) *authH
 func (ai *authHandler) ErrorHandler(c echo.Context, err error) error {
 	req := c.Request()
 	path := req.URL.Path
-	if isUnauthorizeAllowedMethod(path) {
+	if isUnauthorizeAllowedMethod(path) || isUnauthorizeAllowedMethod(c.Path()) {
 		return nil
 	}
 
 	if e, ok := err.(*echojwt.TokenParsingError); ok {
-		return e
+		return convertAuthError(e)
 	}
 
 	cookie, cookieErr := c.Cookie(AccessTokenCookieName)
     if cookieErr != nil {
 		// show error from authorization header if both authorization header and cookie header do not exist
 		slog.Error("failed to get access token", "error", err)
-        return err
+        return convertAuthError(err)
     }
 	token, err := ai.ParseTokenFunc(c, cookie.Value)
 	if err != nil {
-		return err
+		return convertAuthError(err)
+	}
+	// a browser sends the cookie with cross-site requests too, so changes need the CSRF token
+	if err := ai.validateCSRFToken(c); err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error()).SetInternal(err)
 	}
 	c.Set(ai.ContextKey, token)
 	return nil
@@ -62,72 +76,153 @@ func (ai *authHandler) ErrorHandler(c echo.Context, err error) error {
 
 func (ai *authHandler) ParseTokenFunc(c echo.Context, auth string) (interface{}, error) {
 	ctx := c.Request().Context()
-	token, userID, err := ai.authenticate(ctx, auth)
+	token, user, userAccessToken, err := ai.authenticate(ctx, auth)
 	if err != nil {
 		return nil, &echojwt.TokenError{Token: token, Err: err}
 	}
+	userID := user.ID
+	if route := c.Request().Method + " " + c.Path(); !isRoleAllowedMethod(route, user.Role) {
+		return nil, &echojwt.TokenError{Token: token, Err: fmt.Errorf("%w: %s requires the %s role", errPermissionDenied, route, roleRequiredMethods[route])}
+	}
+	if userAccessToken.IsPersonal() {
+		route := c.Request().Method + " " + c.Path()
+		if !isScopeAllowedMethod(route, userAccessToken.Scopes) {
+			return nil, &echojwt.TokenError{Token: token, Err: fmt.Errorf("%w: %s is not allowed for the access token", errPermissionDenied, route)}
+		}
+	}
+	ai.touchAccessToken(ctx, userID, userAccessToken)
+	if userAccessToken.FamilyID != "" {
+		ai.touchSession(ctx, userID, userAccessToken.FamilyID, userAccessToken.LastUsedTs, c.RealIP(), c.Request().UserAgent())
+	}
 
 	if userID != InvalidUserID {
 		c.Set(useridContextKey, userID)
 	}
+	c.SetRequest(c.Request().WithContext(clock.NewContext(ctx, ai.userClock(ctx, userID))))
+	c.Set(sessionIDContextKey, userAccessToken.FamilyID)
 	c.Set(accessTokenContextKey, auth)
 	return token, nil
 }
 
-func (ai *authHandler) authenticate(ctx context.Context, accessToken string) (*jwt.Token, int32, error) {
+func (ai *authHandler) authenticate(ctx context.Context, accessToken string) (*jwt.Token, *store.User, *store.UserSettingAccessToken, error) {
     if accessToken == "" {
-		return nil, 0, errors.New("access token not found")
+		return nil, nil, nil, errors.New("access token not found")
 	}
-	claims := &ClaimsMessage{}
-	token, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (any, error) {
-		if t.Method.Alg() != jwt.SigningMethodHS256.Name {
-			return nil, fmt.Errorf("unexpected access token signing method=%v, expect %v", t.Header["alg"], jwt.SigningMethodHS256)
-		}
-		if kid, ok := t.Header["kid"].(string); ok {
-			if kid == "v1" {
-				return []byte(ai.secret), nil
-			}
-		}
-		return nil, fmt.Errorf("unexpected access token kid=%v", t.Header["kid"])
-	})
+	token, claims, err := parseToken(accessToken, AccessTokenAudienceName, ai.keyring)
 	if err != nil {
-		return nil, InvalidUserID, fmt.Errorf("invalid or expired access token: %v", err)
+		return nil, nil, nil, fmt.Errorf("invalid or expired access token: %v", err)
 	}
 
 	// We either have a valid access token or we will attempt to generate new access token.
 	userID, err := util.ConvertStringToInt32(claims.Subject)
 	if err != nil {
-		return nil, InvalidUserID, fmt.Errorf("malformed ID in the token: %v", err)
+		return nil, nil, nil, fmt.Errorf("malformed ID in the token: %v", err)
 	}
 	user, err := ai.Store.GetUser(ctx, &store.FindUser{
 		ID: &userID,
 	})
 	if err != nil {
-		return nil, InvalidUserID, fmt.Errorf("failed to get user: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to get user: %v", err)
 	}
 	if user == nil {
-		return nil, InvalidUserID, fmt.Errorf("user %q not exists", userID)
+		return nil, nil, nil, fmt.Errorf("user %q not exists", userID)
 	}
 	if user.RowStatus == store.Archived {
-		return nil, InvalidUserID, fmt.Errorf("user %q is archived", userID)
+		return nil, nil, nil, fmt.Errorf("user %q is archived", userID)
 	}
 
 	accessTokens, err := ai.Store.GetUserAccessTokens(ctx, user.ID)
 	if err != nil {
-		return nil, InvalidUserID, fmt.Errorf("failed to get user access tokens: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to get user access tokens: %v", err)
 	}
-	if !validateAccessToken(accessToken, accessTokens) {
-		return nil, InvalidUserID, fmt.Errorf("invalid access token")
+	userAccessToken := validateAccessToken(accessToken, claims.ID, accessTokens)
+	if userAccessToken == nil {
+		return nil, nil, nil, fmt.Errorf("invalid access token")
 	}
 
-	return token, userID, nil
+	return token, user, userAccessToken, nil
 }
 
-func validateAccessToken(accessTokenString string, userAccessTokens []*store.UserSettingAccessToken) bool {
+// touchAccessToken records when the access token was last used.
+// It is written at most once per accessTokenTouchInterval to keep requests cheap.
+func (ai *authHandler) touchAccessToken(ctx context.Context, userID int32, userAccessToken *store.UserSettingAccessToken) {
+	now := time.Now().Unix()
+	if now-userAccessToken.LastUsedTs < int64(accessTokenTouchInterval.Seconds()) {
+		return
+	}
+
+	// Only the stored entry is touched, a token revoked since the request was authenticated stays revoked.
+	if err := ai.Store.UpdateUserAccessTokens(ctx, userID, func(accessTokens []*store.UserSettingAccessToken) ([]*store.UserSettingAccessToken, error) {
+		for _, accessToken := range accessTokens {
+			if accessToken.ID == userAccessToken.ID && accessToken.TokenHash == userAccessToken.TokenHash {
+				accessToken.LastUsedTs = now
+			}
+		}
+		return accessTokens, nil
+	}); err != nil {
+		slog.Error("failed to update access token last used time", "error", err)
+	}
+}
+
+// touchSession records when and from where the session was last used.
+// Like touchAccessToken it is written at most once per accessTokenTouchInterval, which is checked on the access token
+// before the sessions are loaded. A session which is not stored any more has been revoked and is not recreated.
+func (ai *authHandler) touchSession(ctx context.Context, userID int32, sessionID string, lastUsedTs int64, clientIP string, userAgent string) {
+	now := time.Now().Unix()
+	if now-lastUsedTs < int64(accessTokenTouchInterval.Seconds()) {
+		return
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	if err := ai.Store.UpdateUserSessions(ctx, userID, func(userSessions []*store.UserSettingSession) ([]*store.UserSettingSession, error) {
+		for _, userSession := range userSessions {
+			if userSession.ID == sessionID {
+				userSession.LastUsedTs = now
+				userSession.ClientIP = clientIP
+				userSession.UserAgent = userAgent
+			}
+		}
+		return userSessions, nil
+	}); err != nil {
+		slog.Error("failed to update session last used time", "error", err)
+	}
+}
+
+// validateAccessToken finds the stored access token by the token ID and checks its hash.
+// Tokens issued before token IDs were introduced are matched against every stored hash.
+func validateAccessToken(accessTokenString string, tokenID string, userAccessTokens []*store.UserSettingAccessToken) *store.UserSettingAccessToken {
 	for _, userAccessToken := range userAccessTokens {
-		if accessTokenString == userAccessToken.AccessToken {
-			return true
+		if tokenID != "" && userAccessToken.ID != tokenID {
+			continue
 		}
+		if userAccessToken.Matches(accessTokenString) {
+			return userAccessToken
+		}
+	}
+	return nil
+}
+
+// userClock returns the clock of the request in the timezone of the user.
+// A clock already in the context, e.g. a fixed one of a test, is kept.
+func (ai *authHandler) userClock(ctx context.Context, userID int32) clock.Clock {
+	loc := time.UTC
+	timezone, err := ai.Store.GetUserTimezone(ctx, userID)
+	if err != nil {
+		slog.Error("failed to get user timezone", "user", userID, "error", err)
+	} else if l, err := time.LoadLocation(timezone); err != nil {
+		slog.Error("failed to load user timezone", "user", userID, "timezone", timezone, "error", err)
+	} else {
+		loc = l
+	}
+	return clock.In(clock.FromContext(ctx), loc)
+}
+
+// convertAuthError converts an authentication failure to an HTTP error.
+func convertAuthError(err error) error {
+	if errors.Is(err, errPermissionDenied) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error()).SetInternal(err)
 	}
-	return false
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired access token").SetInternal(err)
 }
@@ -1,11 +1,143 @@
 package v1
 
+import (
+	"slices"
+	"strings"
+
+	"itsfriday/store"
+)
+
 var authenticationAllowlistMethods = map[string]bool{
-	"/monitor/health":     true,
-	"/v1/user/signup":     true,
-	"/v1/user/login":      true,
+	"/monitor/health":           true,
+	"/v1/user/signup":           true,
+	"/v1/user/login":            true,
+	"/v1/user/login/2fa":        true,
+	"/v1/user/login/passkey/begin":  true,
+	"/v1/user/login/passkey/finish": true,
+	"/v1/auth/refresh":          true,
+	"/v1/auth/email/verify":     true,
+	"/v1/auth/password/forgot":  true,
+	"/v1/auth/password/reset":   true,
+	"/v1/auth/account/restore":  true,
+	"/v1/workspace/profile":     true,
+	"/v1/avatars/:id/:name":     true,
+	"/v1/auth/idps":             true,
+	"/v1/auth/idps/:id/authorize": true,
+	"/v1/auth/idps/:id/callback":  true,
 }
 
 func isUnauthorizeAllowedMethod(fullMethodName string) bool {
 	return authenticationAllowlistMethods[fullMethodName]
 }
+
+// roleRequiredMethods is the lowest role which can call each route.
+// Routes not listed here are open to every signed-in user.
+var roleRequiredMethods = map[string]store.Role{
+	"GET /v1/admin/users":                store.RoleAdmin,
+	"GET /v1/admin/users/:id":            store.RoleAdmin,
+	"POST /v1/admin/users/:id/archive":   store.RoleAdmin,
+	"POST /v1/admin/users/:id/unarchive": store.RoleAdmin,
+	"POST /v1/admin/users/:id/logout":    store.RoleAdmin,
+	"PUT /v1/admin/users/:id/role":       store.RoleHost,
+
+	"GET /v1/admin/login-attempts":         store.RoleAdmin,
+	"POST /v1/admin/login-attempts/unlock": store.RoleAdmin,
+	"GET /v1/admin/audit-log":              store.RoleAdmin,
+
+	"GET /v1/admin/workspace/setting":                store.RoleAdmin,
+	"PUT /v1/admin/workspace/setting":                store.RoleHost,
+	"GET /v1/admin/workspace/invite-codes":           store.RoleAdmin,
+	"POST /v1/admin/workspace/invite-codes":          store.RoleAdmin,
+	"DELETE /v1/admin/workspace/invite-codes/:code":  store.RoleAdmin,
+
+	"GET /v1/admin/idps":        store.RoleAdmin,
+	"POST /v1/admin/idps":       store.RoleHost,
+	"PUT /v1/admin/idps/:id":    store.RoleHost,
+	"DELETE /v1/admin/idps/:id": store.RoleHost,
+}
+
+// roleLevels orders the roles, a role can do everything a lower one can.
+var roleLevels = map[store.Role]int{
+	store.RoleUser:  1,
+	store.RoleAdmin: 2,
+	store.RoleHost:  3,
+}
+
+// isRoleAllowedMethod checks if the role may call the route, e.g. "GET /v1/admin/users".
+func isRoleAllowedMethod(route string, role store.Role) bool {
+	required, ok := roleRequiredMethods[route]
+	if !ok {
+		return true
+	}
+	return isRoleAtLeast(role, required)
+}
+
+func isRoleAtLeast(role store.Role, required store.Role) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+// scopes of personal access tokens. A write scope also grants the read scope of the same resource.
+const (
+	ScopeUserRead    = "user:read"
+	ScopeLibroRead   = "libro:read"
+	ScopeLibroWrite  = "libro:write"
+	ScopeDineroRead  = "dinero:read"
+	ScopeDineroWrite = "dinero:write"
+)
+
+var personalAccessTokenScopeList = []string{
+	ScopeUserRead,
+	ScopeLibroRead,
+	ScopeLibroWrite,
+	ScopeDineroRead,
+	ScopeDineroWrite,
+}
+
+// personalAccessTokenScopes is the scope a personal access token needs for each route.
+// Routes not listed here can not be called with a personal access token.
+var personalAccessTokenScopes = map[string]string{
+	"GET /v1/user/profile":  ScopeUserRead,
+	"GET /v1/user/settings": ScopeUserRead,
+
+	"POST /v1/libro/books":              ScopeLibroWrite,
+	"GET /v1/libro/books/:id":           ScopeLibroRead,
+	"PUT /v1/libro/books/:id":           ScopeLibroWrite,
+	"DELETE /v1/libro/books/:id":        ScopeLibroWrite,
+	"POST /v1/libro/reviews":            ScopeLibroWrite,
+	"GET /v1/libro/reviews/:id":         ScopeLibroRead,
+	"PUT /v1/libro/reviews/:id":         ScopeLibroWrite,
+	"DELETE /v1/libro/reviews/:id":      ScopeLibroWrite,
+	"GET /v1/libro/dashboard":           ScopeLibroRead,
+	"GET /v1/libro/reads":               ScopeLibroRead,
+	"GET /v1/libro/report":              ScopeLibroRead,
+	"GET /v1/libro/books/:id/reviews":   ScopeLibroRead,
+
+	"POST /v1/dinero/categories":        ScopeDineroWrite,
+	"PUT /v1/dinero/categories/:id":     ScopeDineroWrite,
+	"DELETE /v1/dinero/categories/:id":  ScopeDineroWrite,
+	"GET /v1/dinero/categories":         ScopeDineroRead,
+	"POST /v1/dinero/expenses":          ScopeDineroWrite,
+	"PUT /v1/dinero/expenses/:id":       ScopeDineroWrite,
+	"DELETE /v1/dinero/expenses/:id":    ScopeDineroWrite,
+	"GET /v1/dinero/expenses":           ScopeDineroRead,
+	"GET /v1/dinero/report":             ScopeDineroRead,
+}
+
+func isValidScope(scope string) bool {
+	return slices.Contains(personalAccessTokenScopeList, scope)
+}
+
+// isScopeAllowedMethod checks if the granted scopes allow calling the route, e.g. "GET /v1/libro/books/:id".
+func isScopeAllowedMethod(route string, scopes []string) bool {
+	required, ok := personalAccessTokenScopes[route]
+	if !ok {
+		return false
+	}
+	if slices.Contains(scopes, required) {
+		return true
+	}
+	if resource, found := strings.CutSuffix(required, ":read"); found {
+		return slices.Contains(scopes, resource+":write")
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestIsScopeAllowedMethod(t *testing.T) {
+	for _, tc := range []struct {
+		route  string
+		scopes []string
+		want   bool
+	}{
+		{route: "GET /v1/libro/books/:id", scopes: []string{ScopeLibroRead}, want: true},
+		{route: "GET /v1/libro/books/:id", scopes: []string{ScopeLibroWrite}, want: true},
+		{route: "PUT /v1/libro/books/:id", scopes: []string{ScopeLibroWrite}, want: true},
+		{route: "PUT /v1/libro/books/:id", scopes: []string{ScopeLibroRead}, want: false},
+		{route: "GET /v1/libro/books/:id", scopes: []string{ScopeDineroRead, ScopeDineroWrite}, want: false},
+		{route: "GET /v1/dinero/expenses", scopes: []string{ScopeLibroRead, ScopeDineroRead}, want: true},
+		{route: "GET /v1/user/profile", scopes: []string{ScopeUserRead}, want: true},
+		{route: "GET /v1/user/profile", scopes: []string{}, want: false},
+		// routes which are not listed are refused whatever the scopes
+		{route: "POST /v1/user/access-tokens", scopes: personalAccessTokenScopeList, want: false},
+		{route: "PUT /v1/user/settings", scopes: personalAccessTokenScopeList, want: false},
+		{route: "GET /v1/libro/books/:id/", scopes: personalAccessTokenScopeList, want: false},
+	} {
+		if got := isScopeAllowedMethod(tc.route, tc.scopes); got != tc.want {
+			t.Errorf("isScopeAllowedMethod(%q, %v) = %v, want %v", tc.route, tc.scopes, got, tc.want)
+		}
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	s := newTestService(t)
+	e := echo.New()
+	NewAPIV1Service(s.Keyring, s.Mailer, s.BlobStore, s.Profile, s.Store, e)
+	routes := map[string]bool{}
+	for _, route := range e.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+
+	used := map[string]bool{}
+	for route, scope := range personalAccessTokenScopes {
+		if !routes[route] {
+			t.Errorf("%s is not a route", route)
+		}
+		if !isValidScope(scope) {
+			t.Errorf("%s requires the unknown scope %s", route, scope)
+		}
+		used[scope] = true
+	}
+	for _, scope := range personalAccessTokenScopeList {
+		if !used[scope] {
+			t.Errorf("the scope %s allows no route", scope)
+		}
+	}
+	// the tokens themselves can not be managed with a token
+	for _, route := range []string{
+		http.MethodGet + " /v1/user/access-tokens",
+		http.MethodPost + " /v1/user/access-tokens",
+		http.MethodDelete + " /v1/user/access-tokens/:id",
+	} {
+		if scope, ok := personalAccessTokenScopes[route]; ok {
+			t.Errorf("%s is allowed with the scope %s", route, scope)
+		}
+	}
+}
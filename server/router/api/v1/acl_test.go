@@ -0,0 +1,176 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/clock"
+	"itsfriday/store"
+)
+
+func TestUserClockDefaultMonth(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	ai := NewAuthHandler(s.Store, s.Keyring, "user")
+
+	for i, tc := range []struct {
+		timezone string
+		now      string
+		// want is the expense of the default month, "December" of 2024 or "January" of 2025
+		want string
+	}{
+		{timezone: "", now: "2024-12-31T20:30:00Z", want: "December"},
+		{timezone: "Asia/Seoul", now: "2024-12-31T20:30:00Z", want: "January"},
+		{timezone: "Asia/Seoul", now: "2024-12-31T14:30:00Z", want: "December"},
+		{timezone: "America/Los_Angeles", now: "2025-01-01T03:00:00Z", want: "December"},
+		{timezone: "America/Los_Angeles", now: "2025-01-01T08:30:00Z", want: "January"},
+		{timezone: "Mars/Olympus_Mons", now: "2025-01-01T03:00:00Z", want: "January"},
+	} {
+		t.Run(tc.timezone+" "+tc.now, func(t *testing.T) {
+			user := createTestUser(t, s, fmt.Sprintf("user%d", i), "password")
+			if tc.timezone != "" {
+				if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{UserID: user.ID, Key: store.UserSettingKey_TIMEZONE, Value: tc.timezone}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			category, err := s.Store.CreateDineroCaterory(ctx, &store.DineroCategory{UserID: user.ID, Name: "Food", Priority: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for dateUsed, item := range map[string]string{"2024-12-31": "December", "2025-01-01": "January"} {
+				if _, err := s.Store.CreateDineroExpense(ctx, &store.DineroExpense{UserID: user.ID, CategoryID: category.ID, DateUsed: dateUsed, Item: item, Price: 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tokens, err := s.doSignIn(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now, err := time.Parse(time.RFC3339, tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the request is authenticated at the pinned time, then listed without a year and month
+			req := httptest.NewRequest(http.MethodGet, "/v1/dinero/expenses", nil).WithContext(clock.NewContext(ctx, clock.Fixed(now)))
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetPath("/v1/dinero/expenses")
+			if _, err := ai.ParseTokenFunc(c, tokens.AccessToken); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.ListDineroExpenses(c); err != nil {
+				t.Fatal(err)
+			}
+			response := &DineroExpenses{}
+			decodeResponse(t, rec, http.StatusOK, response)
+			if len(response.Expenses) != 1 || response.Expenses[0].Item != tc.want {
+				t.Errorf("expenses are %+v, want the one of %s", response.Expenses, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccessTokenAfterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	ai := NewAuthHandler(s.Store, s.Keyring, "user")
+	user := createTestUser(t, s, "alice", "password")
+	authenticate := func(accessToken string) error {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/v1/user/profile", nil), httptest.NewRecorder())
+		c.SetPath("/v1/user/profile")
+		_, err := ai.ParseTokenFunc(c, accessToken)
+		return err
+	}
+	signIn := func() string {
+		tokens, err := s.doSignIn(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens.AccessToken
+	}
+
+	oldToken := signIn()
+	oldKey := s.Keyring.Current()
+	newKey, err := s.Keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken := signIn()
+	for name, token := range map[string]string{oldKey.ID: oldToken, newKey.ID: newToken} {
+		parsed, _, err := parseToken(token, AccessTokenAudienceName, s.Keyring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header["kid"] != name {
+			t.Errorf("the token is signed with %v, want %s", parsed.Header["kid"], name)
+		}
+		if err := authenticate(token); err != nil {
+			t.Errorf("the token of %s is refused after the rotation: %v", name, err)
+		}
+	}
+
+	if err := s.Keyring.Invalidate(oldKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate(oldToken); err == nil {
+		t.Errorf("the token of the invalidated %s is accepted", oldKey.ID)
+	}
+	if err := authenticate(newToken); err != nil {
+		t.Errorf("the token of %s is refused: %v", newKey.ID, err)
+	}
+}
+
+func TestPersonalAccessTokenScopesEnforced(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	ai := NewAuthHandler(s.Store, s.Keyring, "user")
+	user := createTestUser(t, s, "alice", "password")
+	authenticate := func(route string, accessToken string) error {
+		method, path, _ := strings.Cut(route, " ")
+		c := echo.New().NewContext(httptest.NewRequest(method, strings.ReplaceAll(path, ":id", "1"), nil), httptest.NewRecorder())
+		c.SetPath(path)
+		_, err := ai.ParseTokenFunc(c, accessToken)
+		return err
+	}
+
+	personal := &AccessToken{}
+	decodeResponse(t, callHandler(t, s.CreateAccessToken, http.MethodPost, "/v1/user/access-tokens", &CreateAccessTokenRequest{Description: "reader", Scopes: []string{ScopeLibroRead}}, user.ID), http.StatusOK, personal)
+	session, err := s.doSignIn(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		route string
+		// allowed is whether the personal access token may call the route, a session token may call them all
+		allowed bool
+	}{
+		{route: "GET /v1/libro/books/:id", allowed: true},
+		{route: "GET /v1/libro/report", allowed: true},
+		{route: "PUT /v1/libro/books/:id", allowed: false},
+		{route: "GET /v1/dinero/expenses", allowed: false},
+		{route: "GET /v1/user/profile", allowed: false},
+		{route: "POST /v1/user/access-tokens", allowed: false},
+		{route: "PUT /v1/user/settings", allowed: false},
+	} {
+		err := authenticate(tc.route, personal.AccessToken)
+		if tc.allowed && err != nil {
+			t.Errorf("the personal access token is refused on %s: %v", tc.route, err)
+		}
+		if !tc.allowed && !errors.Is(err, errPermissionDenied) {
+			t.Errorf("the personal access token on %s returned %v, want %v", tc.route, err, errPermissionDenied)
+		}
+		if err := authenticate(tc.route, session.AccessToken); err != nil {
+			t.Errorf("the session token is refused on %s: %v", tc.route, err)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package v1
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/util"
+	"itsfriday/store"
+)
+
+// admin service: user management for ADMIN and HOST, see roleRequiredMethods
+
+const (
+	defaultListUsersLimit = 50
+	maxListUsersLimit     = 200
+)
+
+type AdminServiceServer interface {
+	ListUsers(echo.Context) error
+	GetUser(echo.Context) error
+	ArchiveUser(echo.Context) error
+	UnarchiveUser(echo.Context) error
+	UpdateUserRole(echo.Context) error
+	LogoutUser(echo.Context) error
+
+	ListLoginAttempts(echo.Context) error
+	UnlockLogin(echo.Context) error
+}
+
+type Users struct {
+	Users        []*User `json:"users"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role         store.Role `json:"role"`
+}
+
+type LoginAttempt struct {
+	Kind           store.LoginAttemptKind `json:"kind"`
+	Subject        string                 `json:"subject"`
+	FailedCount    int32                  `json:"failedCount"`
+	LastFailedTime int64                  `json:"lastFailedTime"`
+	LockedUntil    int64                  `json:"lockedUntil"`
+}
+
+type LoginAttempts struct {
+	LoginAttempts  []*LoginAttempt `json:"loginAttempts"`
+}
+
+type UnlockLoginRequest struct {
+	Kind           store.LoginAttemptKind `json:"kind"`
+	Subject        string                 `json:"subject"`
+}
+
+// ListUsers lists users, filtered by ?search=&role=&state= and paged by ?limit=&offset=.
+func (s *APIV1Service) ListUsers(c echo.Context) error {
+	ctx := c.Request().Context()
+	find := &store.FindUser{}
+	if search := c.QueryParam("search"); search != "" {
+		find.Search = &search
+	}
+	if role := store.Role(c.QueryParam("role")); role != "" {
+		if _, ok := roleLevels[role]; !ok {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid role: %s", role),
+			})
+		}
+		find.Role = &role
+	}
+	if state := store.RowStatus(c.QueryParam("state")); state != "" {
+		if state != store.Normal && state != store.Archived {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid state: %s", state),
+			})
+		}
+		find.RowStatus = &state
+	}
+	limit, err := getIntFromQueryParam(c.QueryParam("limit"), defaultListUsersLimit)
+	if err != nil || limit <= 0 || limit > maxListUsersLimit {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("limit should be between 1 and %d", maxListUsersLimit),
+		})
+	}
+	offset, err := getIntFromQueryParam(c.QueryParam("offset"), 0)
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid offset",
+		})
+	}
+	find.Limit = &limit
+	find.Offset = &offset
+
+	users, err := s.Store.ListUsers(ctx, find)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list users: %v", err),
+		})
+	}
+
+	response := &Users{
+		Users: make([]*User, 0, len(users)),
+	}
+	for _, user := range users {
+		response.Users = append(response.Users, s.convertUserFromStore(user))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (s *APIV1Service) GetUser(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, err := util.ConvertStringToInt32(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get user id from url",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+	return c.JSON(http.StatusOK, s.convertUserFromStore(user))
+}
+
+// ArchiveUser blocks the user from signing in and revokes all of their tokens.
+func (s *APIV1Service) ArchiveUser(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, status, errResponse := s.getManagedUser(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	rowStatus := store.Archived
+	currentTs := time.Now().Unix()
+	updatedUser, err := s.Store.UpdateUser(ctx, &store.UpdateUser{
+		ID:        user.ID,
+		UpdatedTs: &currentTs,
+		RowStatus: &rowStatus,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to archive user: %v", err),
+		})
+	}
+	if err := s.revokeAllTokens(ctx, user.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to revoke tokens: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, s.convertUserFromStore(updatedUser))
+}
+
+func (s *APIV1Service) UnarchiveUser(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, status, errResponse := s.getManagedUser(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	// unarchiving also restores an account whose owner deleted it
+	deletion, err := s.Store.GetUserDeletion(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user deletion: %v", err),
+		})
+	}
+	updatedUser, err := s.cancelUserDeletion(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to unarchive user: %v", err),
+		})
+	}
+	if deletion != nil {
+		s.recordAuditLog(c, user.ID, store.AuditActionAccountRestore, store.AuditOutcomeSuccess, "restored by an admin")
+	}
+
+	return c.JSON(http.StatusOK, s.convertUserFromStore(updatedUser))
+}
+
+// UpdateUserRole promotes a user to ADMIN or demotes an admin. There is only one HOST.
+func (s *APIV1Service) UpdateUserRole(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(UpdateUserRoleRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid update role request: %v", err),
+		})
+	}
+	if request.Role != store.RoleAdmin && request.Role != store.RoleUser {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("role should be %s or %s", store.RoleAdmin, store.RoleUser),
+		})
+	}
+	user, status, errResponse := s.getManagedUser(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	currentTs := time.Now().Unix()
+	updatedUser, err := s.Store.UpdateUser(ctx, &store.UpdateUser{
+		ID:        user.ID,
+		UpdatedTs: &currentTs,
+		Role:      &request.Role,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update role: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, s.convertUserFromStore(updatedUser))
+}
+
+// LogoutUser signs the user out everywhere by revoking all of their tokens.
+func (s *APIV1Service) LogoutUser(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, status, errResponse := s.getManagedUser(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	if err := s.revokeAllTokens(ctx, user.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to revoke tokens: %v", err),
+		})
+	}
+	s.recordAuditLog(c, user.ID, store.AuditActionTokenRevoke, store.AuditOutcomeSuccess, "signed out by an admin")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListLoginAttempts lists the usernames and IPs with failed logins, ?locked=true for the locked out ones only.
+func (s *APIV1Service) ListLoginAttempts(c echo.Context) error {
+	ctx := c.Request().Context()
+	find := &store.FindLoginAttempt{}
+	if c.QueryParam("locked") == "true" {
+		now := time.Now().Unix()
+		find.LockedAfterTs = &now
+	}
+
+	loginAttempts, err := s.Store.ListLoginAttempts(ctx, find)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list login attempts: %v", err),
+		})
+	}
+
+	response := &LoginAttempts{
+		LoginAttempts: make([]*LoginAttempt, 0, len(loginAttempts)),
+	}
+	for _, loginAttempt := range loginAttempts {
+		response.LoginAttempts = append(response.LoginAttempts, &LoginAttempt{
+			Kind:           loginAttempt.Kind,
+			Subject:        loginAttempt.Subject,
+			FailedCount:    loginAttempt.FailedCount,
+			LastFailedTime: loginAttempt.LastFailedTs,
+			LockedUntil:    loginAttempt.LockedUntilTs,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// UnlockLogin clears the failed logins of a username or an IP.
+func (s *APIV1Service) UnlockLogin(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(UnlockLoginRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid unlock login request: %v", err),
+		})
+	}
+	if _, ok := loginAttemptPolicies[request.Kind]; !ok || request.Subject == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("kind should be %s or %s and subject should be provided", store.LoginAttemptKindUsername, store.LoginAttemptKindIP),
+		})
+	}
+	currentUserID, _ := c.Get(useridContextKey).(int32)
+
+	subject := request.Subject
+	if request.Kind == store.LoginAttemptKindUsername {
+		subject = strings.ToLower(subject)
+	}
+	if err := s.Store.DeleteLoginAttempt(ctx, &store.DeleteLoginAttempt{
+		Kind:    request.Kind,
+		Subject: subject,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to unlock login: %v", err),
+		})
+	}
+	slog.Info("login unlocked", "kind", request.Kind, "subject", subject, "by", currentUserID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getManagedUser returns the user of the :id param if the current user may manage them.
+// Users can only be managed by a user with a higher role, so admins manage users and the host manages both.
+func (s *APIV1Service) getManagedUser(c echo.Context) (*store.User, int, *ErrorResponse) {
+	ctx := c.Request().Context()
+	currentUserID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		}
+	}
+	userID, err := util.ConvertStringToInt32(c.Param("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get user id from url",
+		}
+	}
+	if userID == currentUserID {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "can not manage yourself",
+		}
+	}
+
+	currentUser, err := s.Store.GetUser(ctx, &store.FindUser{ID: &currentUserID})
+	if err != nil || currentUser == nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get current user: %v", err),
+		}
+	}
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		}
+	}
+	if user == nil {
+		return nil, http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		}
+	}
+	if roleLevels[currentUser.Role] <= roleLevels[user.Role] {
+		return nil, http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+			Message: fmt.Sprintf("%s can not manage %s", currentUser.Role, user.Role),
+		}
+	}
+	return user, 0, nil
+}
+
+func getIntFromQueryParam(param string, defaultValue int) (int, error) {
+	if param == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(param)
+}
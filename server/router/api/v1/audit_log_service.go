@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/store"
+)
+
+// audit log service: security relevant events of the accounts, users see their own and admins everyone's
+
+type AuditLogServiceServer interface {
+	ListUserAuditLogs(echo.Context) error
+	ListAuditLogs(echo.Context) error
+}
+
+type AuditLog struct {
+	ID          int32              `json:"id"`
+	CreatedTime int64              `json:"createdTime"`
+	UserID      int32              `json:"userId"`
+	ActorID     int32              `json:"actorId"`
+	Action      store.AuditAction  `json:"action"`
+	Outcome     store.AuditOutcome `json:"outcome"`
+	ClientIP    string             `json:"clientIp"`
+	UserAgent   string             `json:"userAgent"`
+	Detail      string             `json:"detail"`
+}
+
+type AuditLogs struct {
+	AuditLogs []*AuditLog `json:"auditLogs"`
+}
+
+var auditActions = []store.AuditAction{
+	store.AuditActionLogin,
+	store.AuditActionLogout,
+	store.AuditActionPasswordChange,
+	store.AuditActionPasswordReset,
+	store.AuditActionTokenRevoke,
+	store.AuditActionAccountDelete,
+	store.AuditActionAccountRestore,
+	store.AuditActionAccountPurge,
+	store.AuditActionPasskeyAdd,
+	store.AuditActionPasskeyDelete,
+}
+
+// ListUserAuditLogs lists the audit log of the user, filtered by ?action=&outcome= and paged by ?limit=&offset=.
+func (s *APIV1Service) ListUserAuditLogs(c echo.Context) error {
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	find := &store.FindAuditLog{UserID: &userID}
+	return s.listAuditLogs(c, find)
+}
+
+// ListAuditLogs lists the audit log of every user, or of the one in ?userId=.
+func (s *APIV1Service) ListAuditLogs(c echo.Context) error {
+	find := &store.FindAuditLog{}
+	if param := c.QueryParam("userId"); param != "" {
+		userID, err := strconv.ParseInt(param, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid userId: %s", param),
+			})
+		}
+		id := int32(userID)
+		find.UserID = &id
+	}
+	return s.listAuditLogs(c, find)
+}
+
+func (s *APIV1Service) listAuditLogs(c echo.Context, find *store.FindAuditLog) error {
+	ctx := c.Request().Context()
+	if action := store.AuditAction(c.QueryParam("action")); action != "" {
+		if !slices.Contains(auditActions, action) {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid action: %s", action),
+			})
+		}
+		find.Action = &action
+	}
+	if outcome := store.AuditOutcome(c.QueryParam("outcome")); outcome != "" {
+		if outcome != store.AuditOutcomeSuccess && outcome != store.AuditOutcomeFailure {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid outcome: %s", outcome),
+			})
+		}
+		find.Outcome = &outcome
+	}
+	limit, err := getIntFromQueryParam(c.QueryParam("limit"), defaultListUsersLimit)
+	if err != nil || limit <= 0 || limit > maxListUsersLimit {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("limit should be between 1 and %d", maxListUsersLimit),
+		})
+	}
+	offset, err := getIntFromQueryParam(c.QueryParam("offset"), 0)
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid offset",
+		})
+	}
+	find.Limit = &limit
+	find.Offset = &offset
+
+	auditLogs, err := s.Store.ListAuditLogs(ctx, find)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list audit logs: %v", err),
+		})
+	}
+	response := &AuditLogs{
+		AuditLogs: make([]*AuditLog, 0, len(auditLogs)),
+	}
+	for _, auditLog := range auditLogs {
+		response.AuditLogs = append(response.AuditLogs, convertAuditLogFromStore(auditLog))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// recordAuditLog appends an entry about the user to the audit log, with the client of the request.
+// The signed-in user is the actor, or the user itself when nobody is signed in, e.g. on login.
+// A failure to record is logged and does not fail the request.
+func (s *APIV1Service) recordAuditLog(c echo.Context, userID int32, action store.AuditAction, outcome store.AuditOutcome, detail string) {
+	actorID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		actorID = userID
+	}
+	userAgent := c.Request().UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	if _, err := s.Store.CreateAuditLog(c.Request().Context(), &store.AuditLog{
+		UserID:    userID,
+		ActorID:   actorID,
+		Action:    action,
+		Outcome:   outcome,
+		ClientIP:  c.RealIP(),
+		UserAgent: userAgent,
+		Detail:    detail,
+	}); err != nil {
+		slog.Error("failed to record audit log", "user", userID, "action", action, "outcome", outcome, "error", err)
+	}
+}
+
+func convertAuditLogFromStore(auditLog *store.AuditLog) *AuditLog {
+	return &AuditLog{
+		ID:          auditLog.ID,
+		CreatedTime: auditLog.CreatedTs,
+		UserID:      auditLog.UserID,
+		ActorID:     auditLog.ActorID,
+		Action:      auditLog.Action,
+		Outcome:     auditLog.Outcome,
+		ClientIP:    auditLog.ClientIP,
+		UserAgent:   auditLog.UserAgent,
+		Detail:      auditLog.Detail,
+	}
+}
@@ -5,50 +5,121 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"itsfriday/server/keyring"
 )
 
 const (
 	Issuer = "itsfriday"
-	KeyID = "v1"
 	AccessTokenAudienceName = "user"
-	AccessTokenDuration     = 7 * 24 * time.Hour
+	AccessTokenDuration     = 15 * time.Minute
 	AccessTokenCookieName = "itsfriday.access-token"
+	RefreshTokenAudienceName = "refresh"
+	RefreshTokenDuration     = 30 * 24 * time.Hour
+	RefreshTokenCookieName = "itsfriday.refresh-token"
+	// RefreshTokenCookiePath limits the refresh cookie to the token endpoints.
+	RefreshTokenCookiePath = "/v1/auth"
+	// TwoFactorChallengeAudienceName is the audience of the token which is exchanged with a TOTP code at login.
+	TwoFactorChallengeAudienceName = "2fa-challenge"
+	TwoFactorChallengeDuration     = 5 * time.Minute
+	// EmailVerificationAudienceName and PasswordResetAudienceName are the audiences of the single-use tokens sent by mail.
+	EmailVerificationAudienceName  = "email-verification"
+	EmailVerificationTokenDuration = 24 * time.Hour
+	PasswordResetAudienceName      = "password-reset"
+	PasswordResetTokenDuration     = time.Hour
+	// OIDCStateAudienceName is the audience of the state cookie kept between the authorize and callback of an identity provider.
+	OIDCStateAudienceName = "oidc-state"
+	OIDCStateDuration     = 10 * time.Minute
+	OIDCStateCookieName   = "itsfriday.oidc-state"
+	// OIDCStateCookiePath limits the state cookie to the callback endpoints.
+	OIDCStateCookiePath = "/v1/auth/idps"
+	// CSRFTokenAudienceName is the audience of the token which cookie authenticated requests send in CSRFTokenHeaderName.
+	CSRFTokenAudienceName = "csrf"
+	CSRFTokenHeaderName   = "X-CSRF-Token"
+	// PasskeyRegistrationAudienceName and PasskeyLoginAudienceName are the audiences of the tokens which keep
+	// the state of a WebAuthn ceremony between its begin and finish.
+	PasskeyRegistrationAudienceName = "passkey-registration"
+	PasskeyLoginAudienceName        = "passkey-login"
+	PasskeyCeremonyDuration         = 5 * time.Minute
 )
 
 type ClaimsMessage struct {
 	Name string `json:"name"`
+	// FamilyID is the sign-in a refresh token was issued for, a rotated token presented again revokes it.
+	FamilyID string `json:"fid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateAccessToken generates an access token.
-func GenerateAccessToken(username string, userID int32, expirationTime time.Time, secret []byte) (string, error) {
-	return generateToken(username, userID, AccessTokenAudienceName, expirationTime, secret)
+// GenerateAccessToken generates an access token signed with the given key.
+func GenerateAccessToken(username string, userID int32, tokenID string, expirationTime time.Time, key *keyring.Key) (string, error) {
+	return generateToken(username, userID, AccessTokenAudienceName, tokenID, expirationTime, key)
+}
+
+// GenerateRefreshToken generates a refresh token of the token family signed with the given key.
+func GenerateRefreshToken(username string, userID int32, tokenID string, familyID string, expirationTime time.Time, key *keyring.Key) (string, error) {
+	claims := newClaimsMessage(username, userID, RefreshTokenAudienceName, tokenID, expirationTime)
+	claims.FamilyID = familyID
+	return signClaims(claims, key)
 }
 
 // generateToken generates a jwt token.
-func generateToken(username string, userID int32, audience string, expirationTime time.Time, secret []byte) (string, error) {
+func generateToken(username string, userID int32, audience string, tokenID string, expirationTime time.Time, key *keyring.Key) (string, error) {
+	return signClaims(newClaimsMessage(username, userID, audience, tokenID, expirationTime), key)
+}
+
+func newClaimsMessage(username string, userID int32, audience string, tokenID string, expirationTime time.Time) *ClaimsMessage {
 	registeredClaims := jwt.RegisteredClaims{
 		Issuer:   Issuer,
 		Audience: jwt.ClaimStrings{audience},
 		IssuedAt: jwt.NewNumericDate(time.Now()),
 		Subject:  fmt.Sprint(userID),
+		ID:       tokenID,
 	}
 	if !expirationTime.IsZero() {
 		registeredClaims.ExpiresAt = jwt.NewNumericDate(expirationTime)
 	}
 
-	// Declare the token with the HS256 algorithm used for signing, and the claims.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &ClaimsMessage{
+	return &ClaimsMessage{
 		Name:             username,
 		RegisteredClaims: registeredClaims,
-	})
-	token.Header["kid"] = KeyID
+	}
+}
+
+// signClaims signs the claims with the HS256 algorithm and the given key.
+func signClaims(claims *ClaimsMessage, key *keyring.Key) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
 
 	// Create the JWT string.
-	tokenString, err := token.SignedString(secret)
+	tokenString, err := token.SignedString([]byte(key.Secret))
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// parseToken verifies a jwt token signed by one of the keys in the keyring for the given audience.
+func parseToken(tokenString string, audience string, keyring *keyring.Keyring) (*jwt.Token, *ClaimsMessage, error) {
+	claims := &ClaimsMessage{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyringKeyFunc(keyring), jwt.WithAudience(audience), jwt.WithIssuer(Issuer))
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, claims, nil
+}
+
+// keyringKeyFunc looks up the secret of a HS256 token by its kid.
+func keyringKeyFunc(keyring *keyring.Keyring) jwt.Keyfunc {
+	return func(t *jwt.Token) (any, error) {
+		if t.Method.Alg() != jwt.SigningMethodHS256.Name {
+			return nil, fmt.Errorf("unexpected token signing method=%v, expect %v", t.Header["alg"], jwt.SigningMethodHS256)
+		}
+		if kid, ok := t.Header["kid"].(string); ok {
+			if secret, ok := keyring.Lookup(kid); ok {
+				return secret, nil
+			}
+		}
+		return nil, fmt.Errorf("unexpected token kid=%v", t.Header["kid"])
+	}
+}
@@ -2,15 +2,18 @@ package v1
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
 
+	"itsfriday/internal/clock"
 	"itsfriday/internal/util"
 	"itsfriday/store"
 )
@@ -21,6 +24,7 @@ type AuthServiceServer interface {
     SignUp(echo.Context) error
 	Login(echo.Context) error
 	Logout(echo.Context) error
+	RefreshToken(echo.Context) error
 }
 
 type SignUpRequest struct {
@@ -29,6 +33,8 @@ type SignUpRequest struct {
 	Nickname     string `json:"nickname"`
 	Password     string `json:"password"`
 	AvatarUrl    string `json:"avatar_url"`
+	// InviteCode is required when the workspace is invite-only.
+	InviteCode   string `json:"inviteCode"`
 }
 
 type LoginRequest struct {
@@ -37,8 +43,21 @@ type LoginRequest struct {
 	Password     string `json:"password"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
 type AccessTokenInfo struct {
 	AccessToken  string `json:"accessToken"`
+	ExpiresTime  int64  `json:"expiresTime"`
+}
+
+// signInTokens is the pair of tokens issued for a sign-in or a refresh.
+type signInTokens struct {
+	AccessToken            string
+	AccessTokenExpireTime  time.Time
+	RefreshToken           string
+	RefreshTokenExpireTime time.Time
 }
 
 func (s *APIV1Service) SignUp(c echo.Context) error {
@@ -77,15 +96,45 @@ func (s *APIV1Service) SignUp(c echo.Context) error {
 		    Message: fmt.Sprintf("invalid username: %s", create.Username),
 		})
 	}
-	user, err := s.Store.CreateUser(ctx, create)
+	// The first user of the instance becomes the host, the workspace setting applies to the others.
+	// Their invite code is used up before the user is created, and given back if the creation fails.
+	var inviteCode string
+	var status int
+	var errResponse *ErrorResponse
+	user, err := s.Store.CreateSignUpUser(ctx, create, func(first bool) error {
+		if first {
+			return nil
+		}
+		inviteCode, status, errResponse = s.checkSignUpAllowed(ctx, request)
+		if errResponse != nil {
+			return errSignUpRefused
+		}
+		return nil
+	})
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
 	if err != nil {
+		if inviteCode != "" {
+			if err := s.releaseInviteCode(ctx, inviteCode); err != nil {
+				slog.Error("failed to release invite code", "error", err)
+			}
+		}
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Internal,
 		    Message: fmt.Sprintf("failed to create user: %v", err),
 		})
 	}
+	if err := s.setDefaultLocale(ctx, user.ID); err != nil {
+		slog.Error("failed to set default locale", "user", user.ID, "error", err)
+	}
+	if user.Email != "" {
+		if err := s.sendEmailVerification(ctx, user); err != nil {
+			slog.Error("failed to send email verification", "user", user.ID, "error", err)
+		}
+	}
 
-	userInfo := convertUserFromStore(user)
+	userInfo := s.convertUserFromStore(user)
 	return c.JSON(http.StatusOK, userInfo)
 }
 
@@ -100,20 +149,38 @@ func (s *APIV1Service) Login(c echo.Context) error {
 	}
 
 	var findUser store.FindUser
+	var identifier string
 	if request.Email != "" {
 		findUser = store.FindUser{
 			Email: &request.Email,
 		}
+		identifier = request.Email
 	} else if request.Username != "" {
 		findUser = store.FindUser{
 			Username: &request.Username,
 		}
+		identifier = request.Username
 	} else {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    InvalidRequest,
 		    Message: "email or username should be provided",
 		})
 	}
+
+	now := clock.FromContext(ctx).Now()
+	loginAttemptSubjects := getLoginAttemptSubjects(c, identifier)
+	retryAfter, err := s.checkLoginAttempts(ctx, loginAttemptSubjects, now)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+		    Message: fmt.Sprintf("failed to check login attempts: %v", err),
+		})
+	}
+	if retryAfter > 0 {
+		s.recordAuditLog(c, 0, store.AuditActionLogin, store.AuditOutcomeFailure, fmt.Sprintf("too many failed login attempts for %s", identifier))
+		return tooManyLoginAttempts(c, retryAfter)
+	}
+
 	user, err := s.Store.GetUser(ctx, &findUser)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
@@ -122,6 +189,8 @@ func (s *APIV1Service) Login(c echo.Context) error {
 		})
 	}
 	if user == nil {
+		s.recordLoginFailure(ctx, loginAttemptSubjects, now)
+		s.recordAuditLog(c, 0, store.AuditActionLogin, store.AuditOutcomeFailure, fmt.Sprintf("unknown user %s", identifier))
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    InvalidRequest,
 		    Message: fmt.Sprintf("unmatched username and password: %v", err),
@@ -130,33 +199,61 @@ func (s *APIV1Service) Login(c echo.Context) error {
 
 	// Compare the stored hashed password, with the hashed version of the password that was received.
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)); err != nil {
+		s.recordLoginFailure(ctx, loginAttemptSubjects, now)
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, "wrong password")
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    InvalidRequest,
 		    Message: fmt.Sprintf("unmatched username and password: %v", err),
 		})
 	}
+	if user.RowStatus == store.Archived {
+		message := "user has been archived"
+		if deletion, err := s.Store.GetUserDeletion(ctx, user.ID); err == nil && deletion != nil {
+			message = fmt.Sprintf("the account is scheduled for deletion at %s, restore it to sign in", time.Unix(deletion.PurgeTs, 0).UTC().Format(time.RFC3339))
+		}
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, "the account is archived")
+		return c.JSON(http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+		    Message: message,
+		})
+	}
+
+	// Users with two-factor authentication get a challenge instead of tokens.
+	// The failures are kept until the second factor is passed, so the password alone does not reset them.
+	userTOTP, err := s.Store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get two-factor setting: %v", err),
+		})
+	}
+	if userTOTP != nil && userTOTP.Enabled {
+		challenge, err := s.issueTwoFactorChallenge(user)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to issue two-factor challenge: %v", err),
+			})
+		}
+		return c.JSON(http.StatusOK, challenge)
+	}
 
-	expireTime := time.Now().Add(AccessTokenDuration)
-	accessToken, err := s.doSignIn(ctx, user, expireTime)
+	s.resetLoginAttempts(ctx, loginAttemptSubjects)
+	tokens, err := s.doSignIn(ctx, user)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Unauthenticated,
 		    Message: fmt.Sprintf("failed to log in: %v", err),
 		})
 	}
-	
-	origin := c.Request().Header.Get("Origin")
-	cookie, err := s.buildAccessTokenCookie(accessToken, origin, expireTime)
-	if err != nil {
+	s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeSuccess, "password")
+	if err := s.setSignInCookies(c, tokens); err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
-			Code:    InvalidRequest,
-		    Message: fmt.Sprintf("failed to build access token cookie, error: %v", err),
+			Code:    Internal,
+		    Message: fmt.Sprintf("failed to set cookie: %v", err),
 		})
 	}
-	c.Response().Header().Add("Set-Cookie", cookie)
-	return c.JSON(http.StatusOK, &AccessTokenInfo{
-		AccessToken: accessToken,
-	})
+	return c.JSON(http.StatusOK, convertAccessTokenInfo(tokens))
 }
 
 func (s *APIV1Service) Logout(c echo.Context) error {
@@ -199,9 +296,10 @@ func (s *APIV1Service) Logout(c echo.Context) error {
 				Message: fmt.Sprintf("failed to delete access token: %v", err),
 			})
 		}
+		s.recordAuditLog(c, user.ID, store.AuditActionLogout, store.AuditOutcomeSuccess, "")
 	}
 
-	if err := s.clearAccessTokenCookie(c); err != nil {
+	if err := s.clearSignInCookies(c); err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Internal,
 			Message: fmt.Sprintf("failed to set cookie: %v", err),
@@ -211,33 +309,258 @@ func (s *APIV1Service) Logout(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
-func (s *APIV1Service) doSignIn(ctx context.Context, user *store.User, expireTime time.Time) (string, error) {
-	accessToken, err := GenerateAccessToken(user.Username, user.ID, expireTime, []byte(s.Secret))
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// A refresh token can be used only once, presenting it again revokes every token of its family.
+func (s *APIV1Service) RefreshToken(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	refreshToken := ""
+	if cookie, err := c.Cookie(RefreshTokenCookieName); err == nil {
+		refreshToken = cookie.Value
+	} else {
+		request := new(RefreshTokenRequest)
+		if err := c.Bind(request); err != nil {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid refresh token request: %v", err),
+			})
+		}
+		refreshToken = request.RefreshToken
+	}
+	if refreshToken == "" {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "refresh token not found",
+		})
+	}
+
+	_, claims, err := parseToken(refreshToken, RefreshTokenAudienceName, s.Keyring)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("invalid or expired refresh token: %v", err),
+		})
+	}
+	userID, err := util.ConvertStringToInt32(claims.Subject)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("malformed ID in the token: %v", err),
+		})
+	}
+	user, err := s.Store.GetUser(ctx, &store.FindUser{
+		ID: &userID,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil || user.RowStatus == store.Archived {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "user not found",
+		})
+	}
+
+	// The token is consumed under the lock of the user's tokens, of two concurrent refreshes with it one sees it used.
+	var current *store.UserSettingRefreshToken
+	err = s.Store.UpdateUserRefreshTokens(ctx, user.ID, func(refreshTokens []*store.UserSettingRefreshToken) ([]*store.UserSettingRefreshToken, error) {
+		updated, consumed, err := consumeRefreshToken(refreshTokens, claims.ID, claims.FamilyID)
+		current = consumed
+		return updated, err
+	})
+	if errors.Is(err, errRefreshTokenUsed) {
+		slog.Warn("refresh token reuse detected, revoking token family", "user", user.ID, "family", current.FamilyID)
+		if err := s.revokeTokenFamily(ctx, user.ID, current.FamilyID); err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to revoke token family: %v", err),
+			})
+		}
+		s.recordAuditLog(c, user.ID, store.AuditActionTokenRevoke, store.AuditOutcomeSuccess, "refresh token reuse detected, the session was revoked")
+		if err := s.clearSignInCookies(c); err != nil {
+			slog.Error("failed to clear cookies", "error", err)
+		}
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "refresh token has already been used",
+		})
+	}
+	if errors.Is(err, errRefreshTokenRevoked) {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "refresh token has been revoked",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to rotate refresh token: %v", err),
+		})
+	}
+	tokens, err := s.issueTokens(ctx, user, current.FamilyID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to issue tokens: %v", err),
+		})
+	}
+	if err := s.setSignInCookies(c, tokens); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to set cookie: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, convertAccessTokenInfo(tokens))
+}
+
+var (
+	errRefreshTokenRevoked = errors.New("refresh token has been revoked")
+	errRefreshTokenUsed    = errors.New("refresh token has already been used")
+	// errSignUpRefused is returned to CreateSignUpUser when the workspace setting refuses a signup.
+	errSignUpRefused = errors.New("signup refused")
+)
+
+// consumeRefreshToken marks the refresh token used and returns it with the updated list.
+// Only the newest used token of a family is kept, the older ones and the expired tokens are dropped,
+// so the list does not grow with every refresh. An older token is still known by the family ID in it:
+// a token which is not stored while its family is, has been rotated before.
+// A used token is returned with errRefreshTokenUsed.
+func consumeRefreshToken(refreshTokens []*store.UserSettingRefreshToken, tokenID string, familyID string) ([]*store.UserSettingRefreshToken, *store.UserSettingRefreshToken, error) {
+	refreshTokens = pruneExpiredRefreshTokens(refreshTokens)
+	var current *store.UserSettingRefreshToken
+	for _, userRefreshToken := range refreshTokens {
+		if userRefreshToken.ID == tokenID {
+			current = userRefreshToken
+			break
+		}
+	}
+	if current == nil {
+		for _, userRefreshToken := range refreshTokens {
+			if familyID != "" && userRefreshToken.FamilyID == familyID {
+				return nil, &store.UserSettingRefreshToken{ID: tokenID, FamilyID: familyID, Used: true}, errRefreshTokenUsed
+			}
+		}
+		return nil, nil, errRefreshTokenRevoked
+	}
+	if current.Used {
+		return nil, current, errRefreshTokenUsed
+	}
+
+	updated := []*store.UserSettingRefreshToken{}
+	for _, userRefreshToken := range refreshTokens {
+		if userRefreshToken.FamilyID == current.FamilyID && userRefreshToken.Used {
+			continue
+		}
+		updated = append(updated, userRefreshToken)
+	}
+	current.Used = true
+	return updated, current, nil
+}
+
+// doSignIn starts a new token family for the user.
+func (s *APIV1Service) doSignIn(ctx context.Context, user *store.User) (*signInTokens, error) {
+	return s.issueTokens(ctx, user, uuid.NewString())
+}
+
+// issueTokens issues a short-lived access token and a refresh token in the given token family.
+func (s *APIV1Service) issueTokens(ctx context.Context, user *store.User, familyID string) (*signInTokens, error) {
+	now := time.Now()
+	key := s.Keyring.Current()
+
+	accessTokenID := uuid.NewString()
+	accessTokenExpireTime := now.Add(AccessTokenDuration)
+	accessToken, err := GenerateAccessToken(user.Username, user.ID, accessTokenID, accessTokenExpireTime, key)
 	if err != nil {
 		slog.Error("failed to generate access token: ", "error", err)
-		return "", err
+		return nil, err
+	}
+	refreshTokenID := uuid.NewString()
+	refreshTokenExpireTime := now.Add(RefreshTokenDuration)
+	refreshToken, err := GenerateRefreshToken(user.Username, user.ID, refreshTokenID, familyID, refreshTokenExpireTime, key)
+	if err != nil {
+		slog.Error("failed to generate refresh token: ", "error", err)
+		return nil, err
 	}
-	if err := s.UpsertAccessTokenToStore(ctx, user, accessToken, "user login"); err != nil {
-		return "", fmt.Errorf("failed to upsert access token to store, error: %v", err)
+
+	userAccessToken := &store.UserSettingAccessToken{
+		ID:          accessTokenID,
+		Type:        store.AccessTokenTypeSession,
+		Description: "user login",
+		FamilyID:    familyID,
+		CreatedTs:   now.Unix(),
+		ExpiresTs:   accessTokenExpireTime.Unix(),
+	}
+	if err := userAccessToken.SetAccessToken(accessToken); err != nil {
+		return nil, err
+	}
+	if err := s.UpsertAccessTokenToStore(ctx, user, userAccessToken); err != nil {
+		return nil, fmt.Errorf("failed to upsert access token to store, error: %v", err)
+	}
+	if err := s.UpsertRefreshTokenToStore(ctx, user, &store.UserSettingRefreshToken{
+		ID:        refreshTokenID,
+		FamilyID:  familyID,
+		ExpiresTs: refreshTokenExpireTime.Unix(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to upsert refresh token to store, error: %v", err)
+	}
+	if err := s.upsertSession(ctx, user.ID, familyID, refreshTokenExpireTime); err != nil {
+		return nil, fmt.Errorf("failed to upsert session to store, error: %v", err)
 	}
 
-	return accessToken, nil
+	return &signInTokens{
+		AccessToken:            accessToken,
+		AccessTokenExpireTime:  accessTokenExpireTime,
+		RefreshToken:           refreshToken,
+		RefreshTokenExpireTime: refreshTokenExpireTime,
+	}, nil
 }
 
-func (s *APIV1Service) clearAccessTokenCookie(c echo.Context) error {
-	cookie, err := s.buildAccessTokenCookie("", "", time.Time{})
+func (s *APIV1Service) setSignInCookies(c echo.Context, tokens *signInTokens) error {
+	origin := c.Request().Header.Get("Origin")
+	cookie, err := s.buildAccessTokenCookie(tokens.AccessToken, origin, tokens.AccessTokenExpireTime)
 	if err != nil {
 		return fmt.Errorf("failed to build access token cookie: %v", err)
 	}
+	c.Response().Header().Add("Set-Cookie", cookie)
+
+	refreshCookie, err := s.buildRefreshTokenCookie(tokens.RefreshToken, origin, tokens.RefreshTokenExpireTime)
+	if err != nil {
+		return fmt.Errorf("failed to build refresh token cookie: %v", err)
+	}
+	c.Response().Header().Add("Set-Cookie", refreshCookie)
+	return nil
+}
 
+func (s *APIV1Service) clearSignInCookies(c echo.Context) error {
+	cookie, err := s.buildAccessTokenCookie("", "", time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to build access token cookie: %v", err)
+	}
 	c.Response().Header().Add("Set-Cookie", cookie)
+
+	refreshCookie, err := s.buildRefreshTokenCookie("", "", time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to build refresh token cookie: %v", err)
+	}
+	c.Response().Header().Add("Set-Cookie", refreshCookie)
 	return nil
 }
 
-func (*APIV1Service) buildAccessTokenCookie(accessToken string, origin string, expireTime time.Time) (string, error) {
+func (s *APIV1Service) buildAccessTokenCookie(accessToken string, origin string, expireTime time.Time) (string, error) {
+	return s.buildCookie(AccessTokenCookieName, accessToken, "/", origin, expireTime)
+}
+
+func (s *APIV1Service) buildRefreshTokenCookie(refreshToken string, origin string, expireTime time.Time) (string, error) {
+	return s.buildCookie(RefreshTokenCookieName, refreshToken, RefreshTokenCookiePath, origin, expireTime)
+}
+
+func (*APIV1Service) buildCookie(name string, value string, path string, origin string, expireTime time.Time) (string, error) {
 	attrs := []string{
-		fmt.Sprintf("%s=%s", AccessTokenCookieName, accessToken),
-		"Path=/",
+		fmt.Sprintf("%s=%s", name, value),
+		"Path=" + path,
 		"HttpOnly",
 	}
 	if expireTime.IsZero() {
@@ -260,3 +583,10 @@ func (*APIV1Service) buildAccessTokenCookie(accessToken string, origin string, e
 	}
 	return strings.Join(attrs, "; "), nil
 }
+
+func convertAccessTokenInfo(tokens *signInTokens) *AccessTokenInfo {
+	return &AccessTokenInfo{
+		AccessToken: tokens.AccessToken,
+		ExpiresTime: tokens.AccessTokenExpireTime.Unix(),
+	}
+}
@@ -0,0 +1,155 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/store"
+)
+
+// refreshTokens calls RefreshToken with the refresh token cookie and returns the response with the rotated refresh token.
+func refreshTokens(t *testing.T, s *APIV1Service, refreshToken string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: RefreshTokenCookieName, Value: refreshToken})
+	rec := httptest.NewRecorder()
+	if err := s.RefreshToken(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range (&http.Response{Header: rec.Header()}).Cookies() {
+		if cookie.Name == RefreshTokenCookieName {
+			return rec, cookie.Value
+		}
+	}
+	return rec, ""
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ctx := context.Background()
+	for _, distance := range []int{1, 2, 3} {
+		t.Run(fmt.Sprintf("distance %d", distance), func(t *testing.T) {
+			s := newTestService(t)
+			user := createTestUser(t, s, "alice", "password")
+			stolen, err := s.doSignIn(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := s.doSignIn(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the owner keeps refreshing after the token was stolen
+			refreshToken := stolen.RefreshToken
+			for range distance {
+				rec, rotated := refreshTokens(t, s, refreshToken)
+				decodeResponse(t, rec, http.StatusOK, &AccessTokenInfo{})
+				if rotated == "" || rotated == refreshToken {
+					t.Fatalf("the refresh token was not rotated: %v", rec.Header().Values("Set-Cookie"))
+				}
+				refreshToken = rotated
+			}
+
+			rec, _ := refreshTokens(t, s, stolen.RefreshToken)
+			expectErrorResponse(t, rec, http.StatusUnauthorized, "already been used")
+			// the whole family is revoked, the latest token too
+			rec, _ = refreshTokens(t, s, refreshToken)
+			expectErrorResponse(t, rec, http.StatusUnauthorized, "revoked")
+
+			sessions, err := s.Store.GetUserSessions(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			accessTokens, err := s.Store.GetUserAccessTokens(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != 1 || len(accessTokens) != 1 || validateAccessToken(other.AccessToken, "", accessTokens) == nil {
+				t.Errorf("%d sessions and %d access tokens after the reuse, want the other sign-in only", len(sessions), len(accessTokens))
+			}
+			rec, _ = refreshTokens(t, s, other.RefreshToken)
+			decodeResponse(t, rec, http.StatusOK, &AccessTokenInfo{})
+		})
+	}
+}
+
+// inviteCodeUses returns the uses of the invite code.
+func inviteCodeUses(t *testing.T, s *APIV1Service, code string) int32 {
+	t.Helper()
+	inviteCodes, err := s.Store.GetWorkspaceInviteCodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, inviteCode := range inviteCodes {
+		if inviteCode.Code == code {
+			return inviteCode.Uses
+		}
+	}
+	t.Fatalf("invite code %s not found", code)
+	return 0
+}
+
+func TestSignUpWithInviteCode(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	createTestUser(t, s, "alice", "password")
+	if _, err := s.Store.UpsertWorkspaceSetting(ctx, &store.WorkspaceSetting{
+		Key:   store.WorkspaceSettingKey_GENERAL,
+		Value: `{"inviteOnly":true}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.UpdateWorkspaceInviteCodes(ctx, func(inviteCodes []*store.WorkspaceInviteCode) ([]*store.WorkspaceInviteCode, error) {
+		return append(inviteCodes, &store.WorkspaceInviteCode{Code: "ONCE", MaxUses: 1}), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// a signup which fails to create the user gives the code back
+	rec := callHandlerAt(t, s.SignUp, "/v1/user/signup", &SignUpRequest{Username: "alice", Password: "password", InviteCode: "ONCE"}, InvalidUserID, now)
+	expectErrorResponse(t, rec, http.StatusInternalServerError, "failed to create user")
+	if uses := inviteCodeUses(t, s, "ONCE"); uses != 0 {
+		t.Fatalf("the code has %d uses after the failed signup, want 0", uses)
+	}
+
+	// the code of a single use signs up one of the users who send it at once
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	statuses := make(chan int, 8)
+	for i := range cap(statuses) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			request := &SignUpRequest{Username: fmt.Sprintf("user-%d", i), Password: "password", InviteCode: "ONCE"}
+			statuses <- callHandlerAt(t, s.SignUp, "/v1/user/signup", request, InvalidUserID, now).Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(statuses)
+	signedUp := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusOK:
+			signedUp++
+		case http.StatusForbidden:
+		default:
+			t.Errorf("a signup returned %d, want %d or %d", status, http.StatusOK, http.StatusForbidden)
+		}
+	}
+	if signedUp != 1 {
+		t.Errorf("%d signups with the code of a single use, want 1", signedUp)
+	}
+	if uses := inviteCodeUses(t, s, "ONCE"); uses != 1 {
+		t.Errorf("the code has %d uses, want 1", uses)
+	}
+}
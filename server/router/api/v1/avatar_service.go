@@ -0,0 +1,192 @@
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/avatar"
+	"itsfriday/server/blobstore"
+	"itsfriday/store"
+)
+
+// avatar service: uploaded avatars are re-encoded, kept in the blob store and served by the server
+
+type AvatarServiceServer interface {
+	UploadAvatar(echo.Context) error
+	DeleteAvatar(echo.Context) error
+	GetAvatar(echo.Context) error
+}
+
+// UploadAvatar replaces the avatar of the user with the image in the "file" field of the form.
+func (s *APIV1Service) UploadAvatar(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, avatar.MaxUploadSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("failed to get the image: %v", err),
+		})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to open the image: %v", err),
+		})
+	}
+	defer file.Close()
+
+	img, err := avatar.Process(file)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+
+	key := avatar.Key(userID, img)
+	if err := s.BlobStore.Put(ctx, key, bytes.NewReader(img.Data), int64(len(img.Data)), img.ContentType); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to store the avatar: %v", err),
+		})
+	}
+	updatedUser, err := s.updateUserAvatar(c, user, avatar.Path(key))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update user: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, s.convertUserFromStore(updatedUser))
+}
+
+// DeleteAvatar removes the avatar of the user, an uploaded one is deleted from the blob store.
+func (s *APIV1Service) DeleteAvatar(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+
+	updatedUser, err := s.updateUserAvatar(c, user, "")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update user: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, s.convertUserFromStore(updatedUser))
+}
+
+// updateUserAvatar sets the avatar URL of the user and deletes the blob of the replaced avatar.
+func (s *APIV1Service) updateUserAvatar(c echo.Context, user *store.User, avatarURL string) (*store.User, error) {
+	ctx := c.Request().Context()
+	currentTs := time.Now().Unix()
+	updatedUser, err := s.Store.UpdateUser(ctx, &store.UpdateUser{
+		ID:        user.ID,
+		UpdatedTs: &currentTs,
+		AvatarURL: &avatarURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := avatar.KeyFromURL(user.AvatarURL); ok && user.AvatarURL != avatarURL {
+		if err := s.BlobStore.Delete(ctx, key); err != nil {
+			slog.Error("failed to delete the replaced avatar", "user", user.ID, "error", err)
+		}
+	}
+	return updatedUser, nil
+}
+
+// GetAvatar serves an uploaded avatar. It is named after its content, so it is cached for good.
+func (s *APIV1Service) GetAvatar(c echo.Context) error {
+	ctx := c.Request().Context()
+	key, ok := avatar.ParseKey(c.Param("id"), c.Param("name"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "avatar not found",
+		})
+	}
+
+	name := c.Param("name")
+	etag := `"` + strings.TrimSuffix(name, path.Ext(name)) + `"`
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "public, max-age=31536000, immutable")
+	header.Set("ETag", etag)
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	r, object, err := s.BlobStore.Get(ctx, key)
+	if err != nil {
+		header.Del(echo.HeaderCacheControl)
+		header.Del("ETag")
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, &ErrorResponse{
+				Code:    NotFound,
+				Message: "avatar not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get the avatar: %v", err),
+		})
+	}
+	defer r.Close()
+
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(object.Size, 10))
+	header.Set(echo.HeaderLastModified, object.ModTime.UTC().Format(http.TimeFormat))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	return c.Stream(http.StatusOK, object.ContentType, r)
+}
@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// csrf service: requests authenticated by the access token cookie have to prove they come from the web app.
+// The CSRF token is signed and bound to the session, a cross-site page can not read it and so can not send it back
+// in the header. Requests with a bearer token are not exposed and need no CSRF token.
+
+type CSRFServiceServer interface {
+	GetCSRFToken(echo.Context) error
+}
+
+type CSRFToken struct {
+	CSRFToken   string `json:"csrfToken"`
+	HeaderName  string `json:"headerName"`
+	ExpiresTime int64  `json:"expiresTime"`
+}
+
+// GetCSRFToken issues the token the web app sends in the X-CSRF-Token header of its POST, PUT and DELETE requests.
+// It stays valid for the whole session, also after the access token is refreshed.
+func (s *APIV1Service) GetCSRFToken(c echo.Context) error {
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	sessionID, _ := c.Get(sessionIDContextKey).(string)
+	if sessionID == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "CSRF tokens are only issued to sessions",
+		})
+	}
+
+	expireTime := time.Now().Add(RefreshTokenDuration)
+	csrfToken, err := generateToken("", userID, CSRFTokenAudienceName, sessionID, expireTime, s.Keyring.Current())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate CSRF token: %v", err),
+		})
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusOK, &CSRFToken{
+		CSRFToken:   csrfToken,
+		HeaderName:  CSRFTokenHeaderName,
+		ExpiresTime: expireTime.Unix(),
+	})
+}
+
+// validateCSRFToken checks the CSRF token of a request authenticated by the cookie.
+// It has to be issued for the user and the session of the access token.
+func (ai *authHandler) validateCSRFToken(c echo.Context) error {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	csrfToken := c.Request().Header.Get(CSRFTokenHeaderName)
+	if csrfToken == "" {
+		return errors.New("missing CSRF token")
+	}
+	_, claims, err := parseToken(csrfToken, CSRFTokenAudienceName, ai.keyring)
+	if err != nil {
+		return fmt.Errorf("invalid CSRF token: %v", err)
+	}
+	userID, _ := c.Get(useridContextKey).(int32)
+	sessionID, _ := c.Get(sessionIDContextKey).(string)
+	if sessionID == "" || claims.ID != sessionID || claims.Subject != fmt.Sprint(userID) {
+		return errors.New("the CSRF token belongs to another session")
+	}
+	return nil
+}
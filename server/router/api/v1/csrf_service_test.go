@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer returns the routes of s behind the authentication of the server.
+func newTestServer(t *testing.T, s *APIV1Service) *echo.Echo {
+	t.Helper()
+	e := echo.New()
+	ai := NewAuthHandler(s.Store, s.Keyring, "user")
+	e.Use(echojwt.WithConfig(echojwt.Config{
+		ContextKey:             ai.ContextKey,
+		ContinueOnIgnoredError: true,
+		ParseTokenFunc:         ai.ParseTokenFunc,
+		ErrorHandler:           ai.ErrorHandler,
+	}))
+	NewAPIV1Service(s.Keyring, s.Mailer, s.BlobStore, s.Profile, s.Store, e)
+	return e
+}
+
+func TestCSRFToken(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	e := newTestServer(t, s)
+	user := createTestUser(t, s, "alice", "password")
+	signIn := func() *signInTokens {
+		tokens, err := s.doSignIn(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+	session, other := signIn(), signIn()
+	// serve sends the request with the access token in the cookie, or as a bearer token, and the CSRF token if any
+	serve := func(method string, target string, request any, accessToken string, bearer bool, csrfToken string) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		if request != nil {
+			if err := json.NewEncoder(&body).Encode(request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		req := httptest.NewRequest(method, target, &body)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if bearer {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+accessToken)
+		} else {
+			req.AddCookie(&http.Cookie{Name: AccessTokenCookieName, Value: accessToken})
+		}
+		if csrfToken != "" {
+			req.Header.Set(CSRFTokenHeaderName, csrfToken)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	getCSRFToken := func(tokens *signInTokens) string {
+		csrfToken := &CSRFToken{}
+		decodeResponse(t, serve(http.MethodGet, "/v1/auth/csrf-token", nil, tokens.AccessToken, false, ""), http.StatusOK, csrfToken)
+		return csrfToken.CSRFToken
+	}
+	csrfToken, otherCSRFToken := getCSRFToken(session), getCSRFToken(other)
+
+	category := &DineroCategory{}
+	decodeResponse(t, serve(http.MethodPost, "/v1/dinero/categories", &CreateDineroCategoryRequest{Name: "Food", Priority: 1}, session.AccessToken, false, csrfToken), http.StatusOK, category)
+	categoryTarget := fmt.Sprintf("/v1/dinero/categories/%d", category.ID)
+
+	// a cookie authenticated change needs the CSRF token of its own session
+	for _, tc := range []struct {
+		method string
+		target string
+	}{
+		{method: http.MethodPost, target: "/v1/dinero/categories"},
+		{method: http.MethodPut, target: categoryTarget},
+		{method: http.MethodDelete, target: categoryTarget},
+	} {
+		request := &UpdateDineroCategoryRequest{Name: "Groceries", Priority: 2}
+		for name, csrfToken := range map[string]string{
+			"without a CSRF token":                   "",
+			"with the CSRF token of another session": otherCSRFToken,
+			"with an access token as CSRF token":     session.AccessToken,
+		} {
+			if rec := serve(tc.method, tc.target, request, session.AccessToken, false, csrfToken); rec.Code != http.StatusForbidden {
+				t.Errorf("%s %s %s returned %d, want %d", tc.method, tc.target, name, rec.Code, http.StatusForbidden)
+			}
+		}
+	}
+	// reads need no CSRF token, nothing was changed by the refused requests
+	categories := &DineroCategories{}
+	decodeResponse(t, serve(http.MethodGet, "/v1/dinero/categories", nil, session.AccessToken, false, ""), http.StatusOK, categories)
+	if len(categories.Categories) != 1 || categories.Categories[0].Name != "Food" {
+		t.Errorf("categories are %+v after the refused requests, want Food only", categories.Categories)
+	}
+	decodeResponse(t, serve(http.MethodPut, categoryTarget, &UpdateDineroCategoryRequest{Name: "Groceries", Priority: 2}, session.AccessToken, false, csrfToken), http.StatusOK, category)
+	if category.Name != "Groceries" {
+		t.Errorf("the category is %+v after the update, want Groceries", category)
+	}
+
+	// a bearer token is not sent by the browser on its own, it needs no CSRF token
+	decodeResponse(t, serve(http.MethodPost, "/v1/dinero/categories", &CreateDineroCategoryRequest{Name: "Rent", Priority: 3}, session.AccessToken, true, ""), http.StatusOK, &DineroCategory{})
+	if rec := serve(http.MethodDelete, categoryTarget, &DeleteDineroCategoryRequest{}, session.AccessToken, true, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("deleting with a bearer token returned %d: %s", rec.Code, rec.Body)
+	}
+}
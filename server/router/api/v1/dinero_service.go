@@ -1,12 +1,14 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 
+	"itsfriday/internal/clock"
 	"itsfriday/internal/util"
 	"itsfriday/store"
 )
@@ -282,8 +284,14 @@ func (s *APIV1Service) DeleteDineroCaterory(c echo.Context) error {
 	}
 
 	if err := s.Store.DeleteDineroCategory(ctx, &store.DeleteDineroCategory{
-		ID:   userID,
+		ID:   categoryId,
 	}); err != nil {
+		if errors.Is(err, store.ErrReferenced) {
+			return c.JSON(http.StatusConflict, &ErrorResponse{
+				Code:    Conflict,
+				Message: "the category has expenses, move or delete them first",
+			})
+		}
 		return c.JSON(http.StatusNotFound, &ErrorResponse{
 			Code:    Internal,
 			Message: fmt.Sprintf("failed to delete category: %v", err),
@@ -318,6 +326,12 @@ func (s *APIV1Service) CreateDineroExpense(c echo.Context) error {
 		Price:       request.Price,
 	}
 	category, err := s.Store.CreateDineroExpense(ctx, create)
+	if errors.Is(err, store.ErrMissingReference) {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: fmt.Sprintf("category %d does not exist", request.CategoryID),
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Internal,
@@ -394,6 +408,12 @@ func (s *APIV1Service) UpdateDineroExpense(c echo.Context) error {
 		update.Price = &request.Price
 	}
 	updatedExpense, err := s.Store.UpdateDineroExpense(ctx, update)
+	if errors.Is(err, store.ErrMissingReference) {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: fmt.Sprintf("category %d does not exist", request.CategoryID),
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusNotFound, &ErrorResponse{
 			Code:    Internal,
@@ -461,14 +481,16 @@ func (s *APIV1Service) DeleteDineroExpense(c echo.Context) error {
 
 func (s *APIV1Service) ListDineroExpenses(c echo.Context) error {
     ctx := c.Request().Context()
-	year, err := util.GetYearFromQueryParam(c.QueryParam("year"))
+	// the year and month default to the same instant, so they cannot straddle a new year
+	now := clock.FromContext(ctx).Now()
+	year, err := util.GetYearFromQueryParam(c.QueryParam("year"), now)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &ErrorResponse{
 			Code:    InvalidRequest,
 			Message: fmt.Sprintf("invalid query param: %v", err),
 		})
 	}
-	month, err := util.GetMonthFromQueryParam(c.QueryParam("month"))
+	month, err := util.GetMonthFromQueryParam(c.QueryParam("month"), now)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &ErrorResponse{
 			Code:    InvalidRequest,
@@ -506,14 +528,16 @@ func (s *APIV1Service) ListDineroExpenses(c echo.Context) error {
 
 func (s *APIV1Service) ReportDinero(c echo.Context) error {
 	ctx := c.Request().Context()
-	year, err := util.GetYearFromQueryParam(c.QueryParam("year"))
+	// the year and month default to the same instant, so they cannot straddle a new year
+	now := clock.FromContext(ctx).Now()
+	year, err := util.GetYearFromQueryParam(c.QueryParam("year"), now)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &ErrorResponse{
 			Code:    InvalidRequest,
 			Message: fmt.Sprintf("invalid query param: %v", err),
 		})
 	}
-	month, err := util.GetMonthFromQueryParam(c.QueryParam("month"))
+	month, err := util.GetMonthFromQueryParam(c.QueryParam("month"), now)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &ErrorResponse{
 			Code:    InvalidRequest,
@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"itsfriday/store"
+)
+
+// expectConflict fails unless the response is a 409 with the Conflict code and a part of the message.
+func expectConflict(t *testing.T, rec *httptest.ResponseRecorder, message string) {
+	t.Helper()
+	response := &ErrorResponse{}
+	decodeResponse(t, rec, http.StatusConflict, response)
+	if response.Code != Conflict || !strings.Contains(response.Message, message) {
+		t.Errorf("response is %+v, want the code %d and %q", response, Conflict, message)
+	}
+}
+
+func TestDeleteDineroCategory(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	alice := createTestUser(t, s, "alice", "password")
+	bob := createTestUser(t, s, "bob", "password")
+	var categories []*store.DineroCategory
+	for _, name := range []string{"Food", "Rent", "Books"} {
+		category, err := s.Store.CreateDineroCaterory(ctx, &store.DineroCategory{UserID: alice.ID, Name: name, Priority: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		categories = append(categories, category)
+	}
+	// the category whose id is the id of alice is not the deleted one
+	if categories[0].ID != alice.ID || categories[1].ID == alice.ID {
+		t.Fatalf("the categories are %d and %d, want the first one with the id %d of alice", categories[0].ID, categories[1].ID, alice.ID)
+	}
+	deleteCategory := func(category *store.DineroCategory, userID int32) *httptest.ResponseRecorder {
+		return callHandlerWithID(t, s.DeleteDineroCaterory, http.MethodDelete, fmt.Sprintf("/v1/dinero/categories/%d", category.ID), fmt.Sprint(category.ID), nil, userID)
+	}
+
+	expectErrorResponse(t, deleteCategory(categories[1], bob.ID), http.StatusNotFound, "category not found")
+	decodeResponse(t, deleteCategory(categories[1], alice.ID), http.StatusNoContent, nil)
+
+	list, err := s.Store.ListDineroCategories(ctx, &store.FindDineroCategory{UserID: &alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, category := range list {
+		names = append(names, category.Name)
+	}
+	if len(names) != 2 || names[0] != "Food" || names[1] != "Books" {
+		t.Errorf("the categories of alice are %v after deleting Rent, want Food and Books", names)
+	}
+}
+
+func TestDineroReferences(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "password")
+	category, err := s.Store.CreateDineroCaterory(ctx, &store.DineroCategory{UserID: user.ID, Name: "Food", Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := callHandler(t, s.CreateDineroExpense, http.MethodPost, "/v1/dinero/expenses", &CreateDineroExpenseRequest{CategoryID: category.ID + 1, DateUsed: "2024-12-31", Item: "Lunch", Price: 1}, user.ID)
+	expectConflict(t, rec, fmt.Sprintf("category %d does not exist", category.ID+1))
+	rec = callHandler(t, s.CreateDineroExpense, http.MethodPost, "/v1/dinero/expenses", &CreateDineroExpenseRequest{CategoryID: category.ID, DateUsed: "2024-12-31", Item: "Lunch", Price: 1}, user.ID)
+	decodeResponse(t, rec, http.StatusOK, nil)
+
+	rec = callHandlerWithID(t, s.DeleteDineroCaterory, http.MethodDelete, fmt.Sprintf("/v1/dinero/categories/%d", category.ID), fmt.Sprint(category.ID), nil, user.ID)
+	expectConflict(t, rec, "the category has expenses")
+}
@@ -10,6 +10,9 @@ const (
 	NotFound             ErrorCode = 4
 	PermissionDenied     ErrorCode = 5
 	Unknown              ErrorCode = 6
+	ResourceExhausted    ErrorCode = 7
+	// Conflict is a request refused by the current state, like deleting a book with reviews, sent with 409.
+	Conflict             ErrorCode = 8
 )
 type ErrorResponse struct {
 	Code    ErrorCode    `json:"code"`
@@ -0,0 +1,321 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/archive"
+	"itsfriday/store"
+)
+
+// export service: the data of the user as a zip archive, written in the background and downloaded afterwards
+
+const (
+	// exportTimeout bounds an export, a running one older than this was interrupted by a restart.
+	exportTimeout = 10 * time.Minute
+	// exportRetention is how long a finished export is kept.
+	exportRetention = 24 * time.Hour
+)
+
+type ExportServiceServer interface {
+	CreateExport(echo.Context) error
+	ListExports(echo.Context) error
+	GetExport(echo.Context) error
+	DownloadExport(echo.Context) error
+}
+
+type Export struct {
+	ID           string            `json:"id"`
+	State        store.ExportState `json:"state"`
+	CreatedTime  int64             `json:"createdTime"`
+	FinishedTime int64             `json:"finishedTime,omitempty"`
+	ExpiresTime  int64             `json:"expiresTime,omitempty"`
+	Size         int64             `json:"size,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	// DownloadURL is set when the export is done.
+	DownloadURL string `json:"downloadUrl,omitempty"`
+}
+
+type Exports struct {
+	Exports []*Export `json:"exports"`
+}
+
+// CreateExport starts an export of the data of the user. Only one export runs at a time.
+func (s *APIV1Service) CreateExport(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	userExport := &store.UserSettingExport{
+		ID:        uuid.NewString(),
+		State:     store.ExportStateRunning,
+		CreatedTs: time.Now().Unix(),
+	}
+	running := false
+	if err := s.updateUserExports(ctx, userID, func(userExports []*store.UserSettingExport) []*store.UserSettingExport {
+		for _, e := range userExports {
+			if isExportRunning(e) {
+				running = true
+				return userExports
+			}
+		}
+		return append(userExports, userExport)
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to create export: %v", err),
+		})
+	}
+	if running {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: "an export is running already",
+		})
+	}
+
+	go s.runExport(userID, userExport.ID)
+
+	return c.JSON(http.StatusAccepted, s.convertExportFromStore(userExport))
+}
+
+func (s *APIV1Service) ListExports(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	userExports, err := s.Store.GetUserExports(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get exports: %v", err),
+		})
+	}
+
+	list := make([]*Export, 0)
+	for _, userExport := range userExports {
+		if isExportExpired(userExport) {
+			continue
+		}
+		list = append(list, s.convertExportFromStore(userExport))
+	}
+	return c.JSON(http.StatusOK, &Exports{Exports: list})
+}
+
+func (s *APIV1Service) GetExport(c echo.Context) error {
+	userExport, status, errResponse := s.getUserExportFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+	return c.JSON(http.StatusOK, s.convertExportFromStore(userExport))
+}
+
+// DownloadExport sends the archive of a finished export.
+func (s *APIV1Service) DownloadExport(c echo.Context) error {
+	ctx := c.Request().Context()
+	userExport, status, errResponse := s.getUserExportFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+	if userExport.State != store.ExportStateDone {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: fmt.Sprintf("the export is %s", s.convertExportFromStore(userExport).State),
+		})
+	}
+
+	userID := c.Get(useridContextKey).(int32)
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil || user == nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	name := fmt.Sprintf("itsfriday-%s-%s.zip", user.Username, time.Unix(userExport.CreatedTs, 0).UTC().Format("20060102"))
+	return c.Attachment(getExportPath(s.Profile.Data, userID, userExport.ID), name)
+}
+
+func (s *APIV1Service) getUserExportFromParam(c echo.Context) (*store.UserSettingExport, int, *ErrorResponse) {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		}
+	}
+
+	userExports, err := s.Store.GetUserExports(ctx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get exports: %v", err),
+		}
+	}
+	for _, userExport := range userExports {
+		if userExport.ID == c.Param("id") && !isExportExpired(userExport) {
+			return userExport, http.StatusOK, nil
+		}
+	}
+	return nil, http.StatusNotFound, &ErrorResponse{
+		Code:    NotFound,
+		Message: "export not found",
+	}
+}
+
+// runExport writes the archive of the export and records the result.
+func (s *APIV1Service) runExport(userID int32, exportID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	size, err := s.writeExport(ctx, userID, exportID)
+	if err != nil {
+		slog.Error("failed to export user data", "user", userID, "export", exportID, "error", err)
+	}
+	// the result is recorded even when the export ran out of time
+	if err := s.updateUserExports(context.Background(), userID, func(userExports []*store.UserSettingExport) []*store.UserSettingExport {
+		for _, userExport := range userExports {
+			if userExport.ID != exportID {
+				continue
+			}
+			userExport.FinishedTs = time.Now().Unix()
+			if err != nil {
+				userExport.State = store.ExportStateFailed
+				userExport.Error = err.Error()
+			} else {
+				userExport.State = store.ExportStateDone
+				userExport.Size = size
+			}
+		}
+		return userExports
+	}); err != nil {
+		slog.Error("failed to update export", "user", userID, "export", exportID, "error", err)
+	}
+}
+
+func (s *APIV1Service) writeExport(ctx context.Context, userID int32, exportID string) (int64, error) {
+	path := getExportPath(s.Profile.Data, userID, exportID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, fmt.Errorf("failed to create the export directory: %w", err)
+	}
+	// the archive is written to a temporary file, so a partial one is never downloaded
+	f, err := os.CreateTemp(filepath.Dir(path), exportID+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the archive: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := archive.Export(ctx, s.Store, userID, s.Profile.Version, f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to stat the archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close the archive: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to move the archive: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// updateUserExports changes the exports of the user, the expired ones are dropped with their archives.
+func (s *APIV1Service) updateUserExports(ctx context.Context, userID int32, update func([]*store.UserSettingExport) []*store.UserSettingExport) error {
+	s.exportMutex.Lock()
+	defer s.exportMutex.Unlock()
+
+	userExports, err := s.Store.GetUserExports(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user exports: %w", err)
+	}
+	list := []*store.UserSettingExport{}
+	for _, userExport := range userExports {
+		if isExportExpired(userExport) {
+			if err := os.Remove(getExportPath(s.Profile.Data, userID, userExport.ID)); err != nil && !os.IsNotExist(err) {
+				slog.Error("failed to remove expired export", "user", userID, "export", userExport.ID, "error", err)
+			}
+			continue
+		}
+		list = append(list, userExport)
+	}
+
+	value, err := store.ConvertUserSettingValueToString(&store.UserSettingExports{
+		Exports: update(list),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to convert user setting to string: %v", err)
+	}
+	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: userID,
+		Key:    store.UserSettingKey_EXPORTS,
+		Value:  value,
+	}); err != nil {
+		return fmt.Errorf("failed to upsert user setting: %v", err)
+	}
+	return nil
+}
+
+func isExportRunning(userExport *store.UserSettingExport) bool {
+	return userExport.State == store.ExportStateRunning && time.Now().Before(time.Unix(userExport.CreatedTs, 0).Add(exportTimeout))
+}
+
+func isExportExpired(userExport *store.UserSettingExport) bool {
+	if isExportRunning(userExport) {
+		return false
+	}
+	finishedTs := userExport.FinishedTs
+	if finishedTs == 0 {
+		// interrupted
+		finishedTs = userExport.CreatedTs
+	}
+	return time.Now().After(time.Unix(finishedTs, 0).Add(exportRetention))
+}
+
+func getExportPath(dataDir string, userID int32, exportID string) string {
+	return filepath.Join(archive.ExportDir(dataDir, userID), exportID+".zip")
+}
+
+func (s *APIV1Service) convertExportFromStore(userExport *store.UserSettingExport) *Export {
+	export := &Export{
+		ID:           userExport.ID,
+		State:        userExport.State,
+		CreatedTime:  userExport.CreatedTs,
+		FinishedTime: userExport.FinishedTs,
+		Size:         userExport.Size,
+		Error:        userExport.Error,
+	}
+	if userExport.State == store.ExportStateRunning && !isExportRunning(userExport) {
+		export.State = store.ExportStateFailed
+		export.Error = "the export was interrupted"
+	}
+	if export.FinishedTime != 0 {
+		export.ExpiresTime = time.Unix(export.FinishedTime, 0).Add(exportRetention).Unix()
+	}
+	if export.State == store.ExportStateDone {
+		export.DownloadURL = fmt.Sprintf("%s/v1/user/export/%s/download", s.Profile.ServerURL, export.ID)
+	}
+	return export
+}
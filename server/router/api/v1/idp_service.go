@@ -0,0 +1,748 @@
+package v1
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"itsfriday/internal/idp"
+	"itsfriday/internal/util"
+	"itsfriday/server/keyring"
+	"itsfriday/store"
+)
+
+// identity provider service: single sign-on with OpenID Connect providers
+
+const (
+	// defaultIdentityProviderRedirect is where the browser goes after signing in with an identity provider.
+	defaultIdentityProviderRedirect = "/dashboard"
+	identityProviderTimeout         = 10 * time.Second
+)
+
+var invalidUsernameCharacters = regexp.MustCompile("[^a-z0-9-]+")
+
+type IdentityProviderServiceServer interface {
+	ListIdentityProviders(echo.Context) error
+	CreateIdentityProvider(echo.Context) error
+	UpdateIdentityProvider(echo.Context) error
+	DeleteIdentityProvider(echo.Context) error
+
+	ListSignInIdentityProviders(echo.Context) error
+	AuthorizeIdentityProvider(echo.Context) error
+	IdentityProviderCallback(echo.Context) error
+
+	ListUserIdentities(echo.Context) error
+	LinkIdentityProvider(echo.Context) error
+	UnlinkIdentityProvider(echo.Context) error
+}
+
+type IdentityProvider struct {
+	ID            int32                      `json:"id"`
+	Name          string                     `json:"name"`
+	Type          store.IdentityProviderType `json:"type"`
+	AutoProvision bool                       `json:"autoProvision"`
+	// Config is only shown to admins, without the client secret.
+	Config *store.IdentityProviderConfig `json:"config,omitempty"`
+}
+
+type IdentityProviders struct {
+	IdentityProviders []*IdentityProvider `json:"identityProviders"`
+}
+
+type CreateIdentityProviderRequest struct {
+	Name          string                        `json:"name"`
+	Type          store.IdentityProviderType    `json:"type"`
+	AutoProvision bool                          `json:"autoProvision"`
+	Config        *store.IdentityProviderConfig `json:"config"`
+}
+
+type UpdateIdentityProviderRequest struct {
+	Name          *string `json:"name"`
+	AutoProvision *bool   `json:"autoProvision"`
+	// The client secret is kept when it is empty.
+	Config *store.IdentityProviderConfig `json:"config"`
+}
+
+type UserIdentity struct {
+	IdpID       int32  `json:"idpId"`
+	IdpName     string `json:"idpName"`
+	Subject     string `json:"subject"`
+	CreatedTime int64  `json:"createdTime"`
+}
+
+type UserIdentities struct {
+	UserIdentities []*UserIdentity `json:"userIdentities"`
+}
+
+// OIDCStateClaims is the state of a sign-in with an identity provider, kept in a cookie between the authorize and the callback.
+// The ID is the state parameter sent to the provider.
+type OIDCStateClaims struct {
+	IdpID int32 `json:"idp"`
+	// UserID is set when a signed-in user links the identity provider.
+	UserID       int32  `json:"uid,omitempty"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"verifier"`
+	Redirect     string `json:"redirect"`
+	jwt.RegisteredClaims
+}
+
+func (s *APIV1Service) ListIdentityProviders(c echo.Context) error {
+	ctx := c.Request().Context()
+	identityProviders, err := s.Store.ListIdentityProviders(ctx, &store.FindIdentityProvider{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list identity providers: %v", err),
+		})
+	}
+
+	response := &IdentityProviders{
+		IdentityProviders: make([]*IdentityProvider, 0, len(identityProviders)),
+	}
+	for _, identityProvider := range identityProviders {
+		response.IdentityProviders = append(response.IdentityProviders, convertIdentityProviderFromStore(identityProvider, true))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (s *APIV1Service) CreateIdentityProvider(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(CreateIdentityProviderRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid identity provider request: %v", err),
+		})
+	}
+	if request.Type == "" {
+		request.Type = store.IdentityProviderTypeOIDC
+	}
+	if err := validateIdentityProvider(request.Name, request.Type, request.Config); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+
+	identityProvider, err := s.Store.CreateIdentityProvider(ctx, &store.IdentityProvider{
+		Name:          request.Name,
+		Type:          request.Type,
+		AutoProvision: request.AutoProvision,
+		Config:        request.Config,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to create identity provider: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, convertIdentityProviderFromStore(identityProvider, true))
+}
+
+func (s *APIV1Service) UpdateIdentityProvider(c echo.Context) error {
+	ctx := c.Request().Context()
+	identityProvider, status, errResponse := s.getIdentityProviderFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+	request := new(UpdateIdentityProviderRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid identity provider request: %v", err),
+		})
+	}
+
+	name := identityProvider.Name
+	if request.Name != nil {
+		name = *request.Name
+	}
+	config := identityProvider.Config
+	if request.Config != nil {
+		config = request.Config
+		if config.OIDC != nil && config.OIDC.ClientSecret == "" && identityProvider.Config.OIDC != nil {
+			config.OIDC.ClientSecret = identityProvider.Config.OIDC.ClientSecret
+		}
+	}
+	if err := validateIdentityProvider(name, identityProvider.Type, config); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+
+	updatedIdentityProvider, err := s.Store.UpdateIdentityProvider(ctx, &store.UpdateIdentityProvider{
+		ID:            identityProvider.ID,
+		Name:          &name,
+		AutoProvision: request.AutoProvision,
+		Config:        config,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update identity provider: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, convertIdentityProviderFromStore(updatedIdentityProvider, true))
+}
+
+// DeleteIdentityProvider deletes the provider and unlinks every user from it.
+func (s *APIV1Service) DeleteIdentityProvider(c echo.Context) error {
+	ctx := c.Request().Context()
+	identityProvider, status, errResponse := s.getIdentityProviderFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	if err := s.Store.DeleteIdentityProvider(ctx, &store.DeleteIdentityProvider{ID: identityProvider.ID}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to delete identity provider: %v", err),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListSignInIdentityProviders lists the providers for the login page.
+func (s *APIV1Service) ListSignInIdentityProviders(c echo.Context) error {
+	ctx := c.Request().Context()
+	identityProviders, err := s.Store.ListIdentityProviders(ctx, &store.FindIdentityProvider{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list identity providers: %v", err),
+		})
+	}
+
+	response := &IdentityProviders{
+		IdentityProviders: make([]*IdentityProvider, 0, len(identityProviders)),
+	}
+	for _, identityProvider := range identityProviders {
+		response.IdentityProviders = append(response.IdentityProviders, convertIdentityProviderFromStore(identityProvider, false))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// AuthorizeIdentityProvider redirects the browser to the identity provider to sign in.
+func (s *APIV1Service) AuthorizeIdentityProvider(c echo.Context) error {
+	return s.authorizeIdentityProvider(c, InvalidUserID)
+}
+
+// LinkIdentityProvider redirects the browser to the identity provider to link it to the current user.
+func (s *APIV1Service) LinkIdentityProvider(c echo.Context) error {
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "missing user in the context",
+		})
+	}
+	return s.authorizeIdentityProvider(c, userID)
+}
+
+// IdentityProviderCallback finishes the sign-in or the link started by the authorize endpoints,
+// then redirects the browser back to the web app.
+func (s *APIV1Service) IdentityProviderCallback(c echo.Context) error {
+	ctx := c.Request().Context()
+	identityProvider, status, errResponse := s.getIdentityProviderFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	// The state is single use, whatever happens next.
+	c.Response().Header().Add("Set-Cookie", s.buildOIDCStateCookie("", time.Time{}))
+	cookie, err := c.Cookie(OIDCStateCookieName)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "missing sign-in state, start over from the login page",
+		})
+	}
+	state, err := parseOIDCState(cookie.Value, s.Keyring)
+	if err != nil || state.IdpID != identityProvider.ID || subtle.ConstantTimeCompare([]byte(state.ID), []byte(c.QueryParam("state"))) != 1 {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid or expired sign-in state",
+		})
+	}
+	if providerError := c.QueryParam("error"); providerError != "" {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("identity provider error: %s %s", providerError, c.QueryParam("error_description")),
+		})
+	}
+	code := c.QueryParam("code")
+	if code == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "missing authorization code",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identityProviderTimeout)
+	defer cancel()
+	provider, err := idp.NewOIDC(ctx, identityProvider.Config.OIDC, s.getIdentityProviderRedirectURL(identityProvider.ID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to connect identity provider: %v", err),
+		})
+	}
+	userInfo, err := provider.ExchangeCode(ctx, code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("failed to sign in with identity provider: %v", err),
+		})
+	}
+
+	if state.UserID != InvalidUserID {
+		if status, errResponse := s.linkUserIdentity(ctx, state.UserID, identityProvider.ID, userInfo.Subject); errResponse != nil {
+			return c.JSON(status, errResponse)
+		}
+		return c.Redirect(http.StatusFound, s.Profile.InstanceURL+state.Redirect)
+	}
+
+	user, status, errResponse := s.getUserFromIdentity(ctx, identityProvider, userInfo)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+	if user.RowStatus == store.Archived {
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, "the account is archived")
+		return c.JSON(http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+			Message: fmt.Sprintf("user has been archived with username %s", user.Username),
+		})
+	}
+
+	// The identity provider authenticates the user, its own second factor replaces the TOTP of a password login.
+	tokens, err := s.doSignIn(ctx, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to sign in: %v", err),
+		})
+	}
+	s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeSuccess, fmt.Sprintf("identity provider %s", identityProvider.Name))
+	if err := s.setSignInCookies(c, tokens); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to set sign-in cookies: %v", err),
+		})
+	}
+
+	return c.Redirect(http.StatusFound, s.Profile.InstanceURL+state.Redirect)
+}
+
+func (s *APIV1Service) ListUserIdentities(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "missing user in the context",
+		})
+	}
+
+	userIdentities, err := s.Store.ListUserIdentities(ctx, &store.FindUserIdentity{UserID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list user identities: %v", err),
+		})
+	}
+
+	response := &UserIdentities{
+		UserIdentities: make([]*UserIdentity, 0, len(userIdentities)),
+	}
+	for _, userIdentity := range userIdentities {
+		identityProvider, err := s.Store.GetIdentityProvider(ctx, &store.FindIdentityProvider{ID: &userIdentity.IdpID})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to get identity provider: %v", err),
+			})
+		}
+		if identityProvider == nil {
+			continue
+		}
+		response.UserIdentities = append(response.UserIdentities, &UserIdentity{
+			IdpID:       userIdentity.IdpID,
+			IdpName:     identityProvider.Name,
+			Subject:     userIdentity.Subject,
+			CreatedTime: userIdentity.CreatedTs,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (s *APIV1Service) UnlinkIdentityProvider(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "missing user in the context",
+		})
+	}
+	idpID, err := util.ConvertStringToInt32(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get identity provider id from url",
+		})
+	}
+
+	if err := s.Store.DeleteUserIdentity(ctx, &store.DeleteUserIdentity{
+		UserID: &userID,
+		IdpID:  &idpID,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to unlink identity provider: %v", err),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// authorizeIdentityProvider keeps the state in a cookie and redirects to the provider.
+// linkUserID is the user linking the provider, or InvalidUserID to sign in.
+func (s *APIV1Service) authorizeIdentityProvider(c echo.Context, linkUserID int32) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), identityProviderTimeout)
+	defer cancel()
+	identityProvider, status, errResponse := s.getIdentityProviderFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+	provider, err := idp.NewOIDC(ctx, identityProvider.Config.OIDC, s.getIdentityProviderRedirectURL(identityProvider.ID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to connect identity provider: %v", err),
+		})
+	}
+
+	// Only redirect within the web app.
+	redirect := c.QueryParam("redirect")
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		redirect = defaultIdentityProviderRedirect
+	}
+	expireTime := time.Now().Add(OIDCStateDuration)
+	state := &OIDCStateClaims{
+		IdpID:        identityProvider.ID,
+		UserID:       linkUserID,
+		Nonce:        uuid.NewString(),
+		CodeVerifier: idp.GenerateCodeVerifier(),
+		Redirect:     redirect,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: uuid.NewString(),
+		},
+	}
+	stateToken, err := generateOIDCState(state, expireTime, s.Keyring.Current())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate sign-in state: %v", err),
+		})
+	}
+	c.Response().Header().Add("Set-Cookie", s.buildOIDCStateCookie(stateToken, expireTime))
+
+	return c.Redirect(http.StatusFound, provider.AuthCodeURL(state.ID, state.Nonce, state.CodeVerifier))
+}
+
+// getUserFromIdentity finds the user linked to the subject, or provisions one if the provider allows it.
+func (s *APIV1Service) getUserFromIdentity(ctx context.Context, identityProvider *store.IdentityProvider, userInfo *idp.UserInfo) (*store.User, int, *ErrorResponse) {
+	userIdentity, err := s.Store.GetUserIdentity(ctx, &store.FindUserIdentity{
+		IdpID:   &identityProvider.ID,
+		Subject: &userInfo.Subject,
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user identity: %v", err),
+		}
+	}
+	if userIdentity != nil {
+		user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userIdentity.UserID})
+		if err != nil {
+			return nil, http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to get user: %v", err),
+			}
+		}
+		if user == nil {
+			return nil, http.StatusNotFound, &ErrorResponse{
+				Code:    NotFound,
+				Message: "linked user not found",
+			}
+		}
+		return user, 0, nil
+	}
+	if !identityProvider.AutoProvision {
+		return nil, http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+			Message: fmt.Sprintf("no user is linked to this %s account, sign in and link it first", identityProvider.Name),
+		}
+	}
+
+	user, err := s.provisionUser(ctx, userInfo)
+	if err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to create user: %v", err),
+		}
+	}
+	if _, err := s.Store.CreateUserIdentity(ctx, &store.UserIdentity{
+		UserID:  user.ID,
+		IdpID:   identityProvider.ID,
+		Subject: userInfo.Subject,
+	}); err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to link user identity: %v", err),
+		}
+	}
+	slog.Info("user provisioned by identity provider", "user", user.ID, "idp", identityProvider.ID)
+	return user, 0, nil
+}
+
+// provisionUser creates a user for the identity on its first sign-in.
+// Auto-provisioning is the signup policy of the provider, the workspace signup settings do not apply.
+func (s *APIV1Service) provisionUser(ctx context.Context, userInfo *idp.UserInfo) (*store.User, error) {
+	username, err := s.getAvailableUsername(ctx, userInfo)
+	if err != nil {
+		return nil, err
+	}
+	// The user signs in through the provider, the password can be set by a password reset.
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(uuid.NewString()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	nickname := userInfo.DisplayName
+	if nickname == "" {
+		nickname = username
+	}
+	create := &store.User{
+		Email:        userInfo.Email,
+		Username:     username,
+		Nickname:     nickname,
+		PasswordHash: string(passwordHash),
+		Role:         store.RoleUser,
+	}
+	// The first user of the instance becomes the host.
+	user, err := s.Store.CreateSignUpUser(ctx, create, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setDefaultLocale(ctx, user.ID); err != nil {
+		slog.Error("failed to set default locale", "user", user.ID, "error", err)
+	}
+	if user.Email != "" {
+		if err := s.sendEmailVerification(ctx, user); err != nil {
+			slog.Error("failed to send email verification", "user", user.ID, "error", err)
+		}
+	}
+	return user, nil
+}
+
+// getAvailableUsername derives a free username from the identifier or the email of the identity.
+func (s *APIV1Service) getAvailableUsername(ctx context.Context, userInfo *idp.UserInfo) (string, error) {
+	base := userInfo.Identifier
+	if base == "" {
+		base, _, _ = strings.Cut(userInfo.Email, "@")
+	}
+	base = strings.Trim(invalidUsernameCharacters.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if len(base) > 24 {
+		base = strings.TrimRight(base[:24], "-")
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s-%d", base, i)
+		}
+		if !util.UIDMatcher.MatchString(username) {
+			continue
+		}
+		user, err := s.Store.GetUser(ctx, &store.FindUser{Username: &username})
+		if err != nil {
+			return "", err
+		}
+		if user == nil {
+			return username, nil
+		}
+	}
+	return fmt.Sprintf("%s-%s", base, strings.Split(uuid.NewString(), "-")[0]), nil
+}
+
+func (s *APIV1Service) linkUserIdentity(ctx context.Context, userID int32, idpID int32, subject string) (int, *ErrorResponse) {
+	userIdentity, err := s.Store.GetUserIdentity(ctx, &store.FindUserIdentity{
+		IdpID:   &idpID,
+		Subject: &subject,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user identity: %v", err),
+		}
+	}
+	if userIdentity != nil {
+		if userIdentity.UserID == userID {
+			return 0, nil
+		}
+		return http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: "the account is linked to another user",
+		}
+	}
+	existing, err := s.Store.GetUserIdentity(ctx, &store.FindUserIdentity{
+		UserID: &userID,
+		IdpID:  &idpID,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user identity: %v", err),
+		}
+	}
+	if existing != nil {
+		return http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: "another account of the identity provider is linked, unlink it first",
+		}
+	}
+
+	if _, err := s.Store.CreateUserIdentity(ctx, &store.UserIdentity{
+		UserID:  userID,
+		IdpID:   idpID,
+		Subject: subject,
+	}); err != nil {
+		return http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to link user identity: %v", err),
+		}
+	}
+	return 0, nil
+}
+
+func (s *APIV1Service) getIdentityProviderFromParam(c echo.Context) (*store.IdentityProvider, int, *ErrorResponse) {
+	ctx := c.Request().Context()
+	id, err := util.ConvertStringToInt32(c.Param("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get identity provider id from url",
+		}
+	}
+
+	identityProvider, err := s.Store.GetIdentityProvider(ctx, &store.FindIdentityProvider{ID: &id})
+	if err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get identity provider: %v", err),
+		}
+	}
+	if identityProvider == nil {
+		return nil, http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "identity provider not found",
+		}
+	}
+	return identityProvider, 0, nil
+}
+
+// getIdentityProviderRedirectURL is the redirect URI to register at the identity provider.
+func (s *APIV1Service) getIdentityProviderRedirectURL(id int32) string {
+	return fmt.Sprintf("%s/v1/auth/idps/%d/callback", strings.TrimRight(s.Profile.ServerURL, "/"), id)
+}
+
+// buildOIDCStateCookie builds a Lax cookie, a Strict one would not be sent on the redirect back from the provider.
+func (s *APIV1Service) buildOIDCStateCookie(value string, expireTime time.Time) string {
+	attrs := []string{
+		fmt.Sprintf("%s=%s", OIDCStateCookieName, value),
+		"Path=" + OIDCStateCookiePath,
+		"HttpOnly",
+		"SameSite=Lax",
+	}
+	if expireTime.IsZero() {
+		attrs = append(attrs, "Expires=Thu, 01 Jan 1970 00:00:00 GMT", "Max-Age=0")
+	} else {
+		attrs = append(attrs, "Expires="+expireTime.UTC().Format(http.TimeFormat))
+	}
+	if strings.HasPrefix(s.Profile.ServerURL, "https://") {
+		attrs = append(attrs, "Secure")
+	}
+	return strings.Join(attrs, "; ")
+}
+
+func generateOIDCState(state *OIDCStateClaims, expirationTime time.Time, key *keyring.Key) (string, error) {
+	state.Issuer = Issuer
+	state.Audience = jwt.ClaimStrings{OIDCStateAudienceName}
+	state.IssuedAt = jwt.NewNumericDate(time.Now())
+	state.ExpiresAt = jwt.NewNumericDate(expirationTime)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, state)
+	token.Header["kid"] = key.ID
+	return token.SignedString([]byte(key.Secret))
+}
+
+func parseOIDCState(tokenString string, keyring *keyring.Keyring) (*OIDCStateClaims, error) {
+	state := &OIDCStateClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, state, keyringKeyFunc(keyring), jwt.WithAudience(OIDCStateAudienceName), jwt.WithIssuer(Issuer)); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func validateIdentityProvider(name string, identityProviderType store.IdentityProviderType, config *store.IdentityProviderConfig) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if identityProviderType != store.IdentityProviderTypeOIDC {
+		return fmt.Errorf("unsupported identity provider type: %s", identityProviderType)
+	}
+	if config == nil || config.OIDC == nil {
+		return fmt.Errorf("oidc config is required")
+	}
+	if config.OIDC.IssuerURL == "" || config.OIDC.ClientID == "" {
+		return fmt.Errorf("issuer url and client id are required")
+	}
+	return nil
+}
+
+// convertIdentityProviderFromStore never returns the client secret, the config is only included for admins.
+func convertIdentityProviderFromStore(identityProvider *store.IdentityProvider, withConfig bool) *IdentityProvider {
+	response := &IdentityProvider{
+		ID:            identityProvider.ID,
+		Name:          identityProvider.Name,
+		Type:          identityProvider.Type,
+		AutoProvision: identityProvider.AutoProvision,
+	}
+	if withConfig && identityProvider.Config != nil {
+		config := &store.IdentityProviderConfig{}
+		if v := identityProvider.Config.OIDC; v != nil {
+			oidcConfig := *v
+			oidcConfig.ClientSecret = ""
+			config.OIDC = &oidcConfig
+		}
+		response.Config = config
+	}
+	return response
+}
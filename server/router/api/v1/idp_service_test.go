@@ -0,0 +1,473 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+
+	"itsfriday/store"
+)
+
+const testIssuerClientID = "itsfriday"
+
+type testAuthorization struct {
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+// testIssuer is an OpenID Connect issuer with the discovery, the JWKS and the token endpoint.
+// The sign-in at the provider is done by authorize, it issues the code for the claims.
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]*testAuthorization
+	codes          int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{
+		key:            key,
+		authorizations: map[string]*testAuthorization{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("POST /token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                i.server.URL,
+		"authorization_endpoint":                i.server.URL + "/authorize",
+		"token_endpoint":                        i.server.URL + "/token",
+		"jwks_uri":                              i.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *testIssuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges a code once, for the code verifier of the challenge it was issued for.
+func (i *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	authorization := i.authorizations[r.PostFormValue("code")]
+	delete(i.authorizations, r.PostFormValue("code"))
+	i.mu.Unlock()
+	if authorization == nil || oauth2.S256ChallengeFromVerifier(r.PostFormValue("code_verifier")) != authorization.codeChallenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   i.server.URL,
+		"aud":   testIssuerClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for key, value := range authorization.claims {
+		claims[key] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access-" + idToken[len(idToken)-8:],
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// authorize signs in at the authorization URL with the claims and returns the query of the redirect back.
+func (i *testIssuer) authorize(t *testing.T, authURL string, claims jwt.MapClaims) url.Values {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("client_id") != testIssuerClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	i.mu.Lock()
+	i.codes++
+	code := fmt.Sprintf("code-%d", i.codes)
+	i.authorizations[code] = &testAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		claims:        claims,
+	}
+	i.mu.Unlock()
+	return url.Values{"state": {query.Get("state")}, "code": {code}}
+}
+
+func createTestIdentityProvider(t *testing.T, s *APIV1Service, issuer *testIssuer, autoProvision bool) *store.IdentityProvider {
+	t.Helper()
+	identityProvider, err := s.Store.CreateIdentityProvider(context.Background(), &store.IdentityProvider{
+		Name:          "Test",
+		Type:          store.IdentityProviderTypeOIDC,
+		AutoProvision: autoProvision,
+		Config: &store.IdentityProviderConfig{
+			OIDC: &store.OIDCConfig{
+				IssuerURL:    issuer.server.URL,
+				ClientID:     testIssuerClientID,
+				ClientSecret: "secret",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identityProvider
+}
+
+// callIdentityProviderHandler calls the handler for the provider with the state cookie, on behalf of the user unless userID is zero.
+func callIdentityProviderHandler(t *testing.T, handler echo.HandlerFunc, target string, idpID int32, stateCookie *http.Cookie, userID int32) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if stateCookie != nil {
+		req.AddCookie(stateCookie)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(strconv.Itoa(int(idpID)))
+	if userID != InvalidUserID {
+		c.Set(useridContextKey, userID)
+	}
+	if err := handler(c); err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+	return rec
+}
+
+// startIdentityProviderSignIn returns the state cookie and the authorization URL of a sign-in, or of a link by the user.
+func startIdentityProviderSignIn(t *testing.T, s *APIV1Service, idpID int32, userID int32) (*http.Cookie, string) {
+	t.Helper()
+	handler, target := s.AuthorizeIdentityProvider, fmt.Sprintf("/v1/auth/idps/%d/authorize?redirect=/books", idpID)
+	if userID != InvalidUserID {
+		handler, target = s.LinkIdentityProvider, fmt.Sprintf("/v1/user/idps/%d/link?redirect=/books", idpID)
+	}
+	rec := callIdentityProviderHandler(t, handler, target, idpID, nil, userID)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status is %d, want 302: %s", rec.Code, rec.Body.String())
+	}
+	for _, cookie := range (&http.Response{Header: rec.Header()}).Cookies() {
+		if cookie.Name == OIDCStateCookieName {
+			return cookie, rec.Header().Get(echo.HeaderLocation)
+		}
+	}
+	t.Fatal("no state cookie")
+	return nil, ""
+}
+
+func finishIdentityProviderSignIn(t *testing.T, s *APIV1Service, idpID int32, stateCookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	return callIdentityProviderHandler(t, s.IdentityProviderCallback, fmt.Sprintf("/v1/auth/idps/%d/callback?%s", idpID, query.Encode()), idpID, stateCookie, InvalidUserID)
+}
+
+// signedInUserID returns the user of the access token cookie set by a sign-in.
+func signedInUserID(t *testing.T, s *APIV1Service, rec *httptest.ResponseRecorder) int32 {
+	t.Helper()
+	if rec.Code != http.StatusFound || rec.Header().Get(echo.HeaderLocation) != s.Profile.InstanceURL+"/books" {
+		t.Fatalf("status is %d to %q, want 302 to /books: %s", rec.Code, rec.Header().Get(echo.HeaderLocation), rec.Body.String())
+	}
+	for _, cookie := range (&http.Response{Header: rec.Header()}).Cookies() {
+		if cookie.Name != AccessTokenCookieName {
+			continue
+		}
+		claims := &ClaimsMessage{}
+		if _, err := jwt.ParseWithClaims(cookie.Value, claims, keyringKeyFunc(s.Keyring)); err != nil {
+			t.Fatal(err)
+		}
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessTokens, err := s.Store.GetUserAccessTokens(context.Background(), int32(userID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validateAccessToken(cookie.Value, "", accessTokens) == nil {
+			t.Fatal("the access token is not stored")
+		}
+		return int32(userID)
+	}
+	t.Fatal("no access token cookie")
+	return InvalidUserID
+}
+
+func TestIdentityProviderLink(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	issuer := newTestIssuer(t)
+	identityProvider := createTestIdentityProvider(t, s, issuer, false)
+	alice := createTestUser(t, s, "alice", "password")
+	bob := createTestUser(t, s, "bob", "password")
+	claims := jwt.MapClaims{"sub": "subject-alice", "preferred_username": "alice-at-test"}
+
+	// no user is linked to the subject yet
+	stateCookie, authURL := startIdentityProviderSignIn(t, s, identityProvider.ID, InvalidUserID)
+	rec := finishIdentityProviderSignIn(t, s, identityProvider.ID, stateCookie, issuer.authorize(t, authURL, claims))
+	decodeResponse(t, rec, http.StatusForbidden, nil)
+
+	stateCookie, authURL = startIdentityProviderSignIn(t, s, identityProvider.ID, alice.ID)
+	rec = finishIdentityProviderSignIn(t, s, identityProvider.ID, stateCookie, issuer.authorize(t, authURL, claims))
+	if rec.Code != http.StatusFound || rec.Header().Get(echo.HeaderLocation) != s.Profile.InstanceURL+"/books" {
+		t.Fatalf("link: status is %d to %q, want 302 to /books: %s", rec.Code, rec.Header().Get(echo.HeaderLocation), rec.Body.String())
+	}
+	userIdentities, err := s.Store.ListUserIdentities(ctx, &store.FindUserIdentity{IdpID: &identityProvider.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userIdentities) != 1 || userIdentities[0].UserID != alice.ID || userIdentities[0].Subject != "subject-alice" {
+		t.Fatalf("user identities are %+v, want subject-alice of alice", userIdentities)
+	}
+
+	// the subject signs in as the linked user
+	stateCookie, authURL = startIdentityProviderSignIn(t, s, identityProvider.ID, InvalidUserID)
+	rec = finishIdentityProviderSignIn(t, s, identityProvider.ID, stateCookie, issuer.authorize(t, authURL, claims))
+	if userID := signedInUserID(t, s, rec); userID != alice.ID {
+		t.Errorf("signed in as %d, want alice %d", userID, alice.ID)
+	}
+
+	// another user cannot link the same subject
+	stateCookie, authURL = startIdentityProviderSignIn(t, s, identityProvider.ID, bob.ID)
+	rec = finishIdentityProviderSignIn(t, s, identityProvider.ID, stateCookie, issuer.authorize(t, authURL, claims))
+	decodeResponse(t, rec, http.StatusConflict, nil)
+
+	users, err := s.Store.ListUsers(ctx, &store.FindUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("%d users, want no provisioned one", len(users))
+	}
+}
+
+func TestIdentityProviderAutoProvision(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	issuer := newTestIssuer(t)
+	identityProvider := createTestIdentityProvider(t, s, issuer, true)
+	createTestUser(t, s, "alice", "password")
+
+	for _, tc := range []struct {
+		claims   jwt.MapClaims
+		username string
+		nickname string
+	}{
+		{
+			claims:   jwt.MapClaims{"sub": "subject-1", "preferred_username": "Bob Smith", "name": "Bob", "email": "bob@example.com"},
+			username: "bob-smith",
+			nickname: "Bob",
+		},
+		{
+			claims:   jwt.MapClaims{"sub": "subject-2", "preferred_username": "bob.smith", "email": "other@example.com"},
+			username: "bob-smith-2",
+			nickname: "bob-smith-2",
+		},
+		{
+			claims:   jwt.MapClaims{"sub": "subject-3", "email": "alice@example.org"},
+			username: "alice-2",
+			nickname: "alice-2",
+		},
+	} {
+		stateCookie, authURL := startIdentityProviderSignIn(t, s, identityProvider.ID, InvalidUserID)
+		rec := finishIdentityProviderSignIn(t, s, identityProvider.ID, stateCookie, issuer.authorize(t, authURL, tc.claims))
+		userID := signedInUserID(t, s, rec)
+		user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != tc.username || user.Nickname != tc.nickname || user.Email != tc.claims["email"] || user.Role != store.RoleUser {
+			t.Errorf("provisioned user is %s %q %s %s, want %s %q %s user", user.Username, user.Nickname, user.Email, user.Role, tc.username, tc.nickname, tc.claims["email"])
+		}
+		subject := tc.claims["sub"].(string)
+		userIdentity, err := s.Store.GetUserIdentity(ctx, &store.FindUserIdentity{IdpID: &identityProvider.ID, Subject: &subject})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userIdentity == nil || userIdentity.UserID != userID {
+			t.Errorf("the identity %s is linked as %+v, want to user %d", subject, userIdentity, userID)
+		}
+		if message := s.Mailer.(*testMailer).receive(t); message.To != user.Email || !strings.Contains(message.Body, verifyEmailPath) {
+			t.Errorf("mail is %+v, want the email verification to %s", message, user.Email)
+		}
+
+		// the next sign-in finds the provisioned user
+		stateCookie, authURL = startIdentityProviderSignIn(t, s, identityProvider.ID, InvalidUserID)
+		rec = finishIdentityProviderSignIn(t, s, identityProvider.ID, stateCookie, issuer.authorize(t, authURL, tc.claims))
+		if got := signedInUserID(t, s, rec); got != userID {
+			t.Errorf("second sign-in as %d, want %d", got, userID)
+		}
+	}
+
+	users, err := s.Store.ListUsers(ctx, &store.FindUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 4 {
+		t.Errorf("%d users, want alice and 3 provisioned", len(users))
+	}
+}
+
+func TestIdentityProviderCallbackRejects(t *testing.T) {
+	s := newTestService(t)
+	issuer := newTestIssuer(t)
+	identityProvider := createTestIdentityProvider(t, s, issuer, true)
+	otherIdentityProvider := createTestIdentityProvider(t, s, issuer, true)
+	claims := jwt.MapClaims{"sub": "subject-1", "preferred_username": "bob"}
+
+	for _, tc := range []struct {
+		name string
+		// tamper changes the callback of a sign-in, the other sign-in is started before it
+		tamper  func(authURL string, otherAuthURL string, stateCookie *http.Cookie, otherStateCookie *http.Cookie) (url.Values, *http.Cookie, int32)
+		status  int
+		message string
+	}{
+		{
+			name: "missing state cookie",
+			tamper: func(authURL string, _ string, _ *http.Cookie, _ *http.Cookie) (url.Values, *http.Cookie, int32) {
+				return issuer.authorize(t, authURL, claims), nil, identityProvider.ID
+			},
+			status:  http.StatusBadRequest,
+			message: "missing sign-in state",
+		},
+		{
+			name: "state of another sign-in",
+			tamper: func(authURL string, _ string, _ *http.Cookie, otherStateCookie *http.Cookie) (url.Values, *http.Cookie, int32) {
+				return issuer.authorize(t, authURL, claims), otherStateCookie, identityProvider.ID
+			},
+			status:  http.StatusBadRequest,
+			message: "invalid or expired sign-in state",
+		},
+		{
+			name: "state of another provider",
+			tamper: func(authURL string, _ string, stateCookie *http.Cookie, _ *http.Cookie) (url.Values, *http.Cookie, int32) {
+				return issuer.authorize(t, authURL, claims), stateCookie, otherIdentityProvider.ID
+			},
+			status:  http.StatusBadRequest,
+			message: "invalid or expired sign-in state",
+		},
+		{
+			name: "forged state cookie",
+			tamper: func(authURL string, _ string, stateCookie *http.Cookie, _ *http.Cookie) (url.Values, *http.Cookie, int32) {
+				// one character of the signature differs
+				forged := *stateCookie
+				i := len(forged.Value) - 5
+				replacement := "A"
+				if forged.Value[i] == 'A' {
+					replacement = "B"
+				}
+				forged.Value = forged.Value[:i] + replacement + forged.Value[i+1:]
+				return issuer.authorize(t, authURL, claims), &forged, identityProvider.ID
+			},
+			status:  http.StatusBadRequest,
+			message: "invalid or expired sign-in state",
+		},
+		{
+			name: "code of another sign-in",
+			tamper: func(authURL string, otherAuthURL string, stateCookie *http.Cookie, _ *http.Cookie) (url.Values, *http.Cookie, int32) {
+				query := issuer.authorize(t, authURL, claims)
+				// the code was issued for the PKCE challenge of the other sign-in
+				query.Set("code", issuer.authorize(t, otherAuthURL, claims).Get("code"))
+				return query, stateCookie, identityProvider.ID
+			},
+			status:  http.StatusUnauthorized,
+			message: "failed to exchange the code",
+		},
+		{
+			name: "id token of another nonce",
+			tamper: func(authURL string, _ string, stateCookie *http.Cookie, _ *http.Cookie) (url.Values, *http.Cookie, int32) {
+				u, _ := url.Parse(authURL)
+				query := u.Query()
+				query.Set("nonce", "another-nonce")
+				u.RawQuery = query.Encode()
+				return issuer.authorize(t, u.String(), claims), stateCookie, identityProvider.ID
+			},
+			status:  http.StatusUnauthorized,
+			message: "unmatched nonce",
+		},
+		{
+			name: "provider error",
+			tamper: func(authURL string, _ string, stateCookie *http.Cookie, _ *http.Cookie) (url.Values, *http.Cookie, int32) {
+				query := issuer.authorize(t, authURL, claims)
+				query.Del("code")
+				query.Set("error", "access_denied")
+				return query, stateCookie, identityProvider.ID
+			},
+			status:  http.StatusUnauthorized,
+			message: "access_denied",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			otherStateCookie, otherAuthURL := startIdentityProviderSignIn(t, s, identityProvider.ID, InvalidUserID)
+			stateCookie, authURL := startIdentityProviderSignIn(t, s, identityProvider.ID, InvalidUserID)
+			query, stateCookie, idpID := tc.tamper(authURL, otherAuthURL, stateCookie, otherStateCookie)
+			rec := finishIdentityProviderSignIn(t, s, idpID, stateCookie, query)
+			response := &ErrorResponse{}
+			decodeResponse(t, rec, tc.status, response)
+			if !strings.Contains(response.Message, tc.message) {
+				t.Errorf("message is %q, want %q", response.Message, tc.message)
+			}
+			if cookies := rec.Header().Values("Set-Cookie"); len(cookies) != 1 || !strings.Contains(cookies[0], OIDCStateCookieName+"=;") {
+				t.Errorf("cookies are %v, want the cleared state cookie only", cookies)
+			}
+		})
+	}
+
+	users, err := s.Store.ListUsers(context.Background(), &store.FindUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("%d users were provisioned by rejected sign-ins", len(users))
+	}
+}
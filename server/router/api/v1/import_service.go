@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/archive"
+)
+
+// import service: an archive of the export service is imported into the account of the user
+
+// maxImportSize bounds the size of an uploaded archive.
+const maxImportSize = 32 << 20
+
+type ImportServiceServer interface {
+	ImportArchive(echo.Context) error
+}
+
+// importErrorResponse is a failed import with the report of the records imported before the failure.
+type importErrorResponse struct {
+	ErrorResponse
+	Report *archive.Report `json:"report"`
+}
+
+// ImportArchive imports the archive in the "file" field of the form.
+// The policy query parameter decides what happens to books and expense categories which exist already,
+// with dryRun=true nothing is changed and the report tells what the import would do.
+func (s *APIV1Service) ImportArchive(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	policy, err := archive.ParseConflictPolicy(c.QueryParam("policy"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+	dryRun := c.QueryParam("dryRun") == "true"
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("failed to get the archive: %v", err),
+		})
+	}
+	if fileHeader.Size > maxImportSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("the archive is larger than %d MiB", maxImportSize>>20),
+		})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to open the archive: %v", err),
+		})
+	}
+	defer file.Close()
+
+	a, err := archive.Read(file, fileHeader.Size)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+
+	report, err := archive.Import(ctx, s.Store, userID, a, archive.ImportOptions{
+		Policy: policy,
+		DryRun: dryRun,
+	})
+	if err != nil {
+		// the records imported before the error are kept and listed by the report,
+		// importing again with the skip policy completes the import
+		slog.Error("failed to import archive", "user", userID, "error", err)
+		return c.JSON(http.StatusInternalServerError, &importErrorResponse{
+			ErrorResponse: ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to import the archive: %v", err),
+			},
+			Report: report,
+		})
+	}
+	if !dryRun {
+		slog.Info("archive imported", "user", userID, "policy", policy, "from", a.Manifest.Username)
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -1,12 +1,14 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 
+	"itsfriday/internal/clock"
 	"itsfriday/internal/util"
 	"itsfriday/store"
 )
@@ -120,6 +122,12 @@ func (s *APIV1Service) CreateBook(c echo.Context) error {
 		Genre:       request.Genre,
 	}
 	book, err := s.Store.CreateBook(ctx, create)
+	if errors.Is(err, store.ErrMissingReference) {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: "the user was deleted",
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Internal,
@@ -290,6 +298,12 @@ func (s *APIV1Service) DeleteBook(c echo.Context) error {
 	if err := s.Store.DeleteBook(ctx, &store.DeleteBook{
 		ID: bookId,
 	}); err != nil {
+		if errors.Is(err, store.ErrReferenced) {
+			return c.JSON(http.StatusConflict, &ErrorResponse{
+				Code:    Conflict,
+				Message: "the book has reviews, delete them first",
+			})
+		}
 		return c.JSON(http.StatusNotFound, &ErrorResponse{
 			Code:    Internal,
 			Message: fmt.Sprintf("failed to delete book: %v", err),
@@ -346,6 +360,12 @@ func (s *APIV1Service) CreateBookReview(c echo.Context) error {
 		Review:      request.Review,
 	}
 	bookReview, err := s.Store.CreateBookReview(ctx, create)
+	if errors.Is(err, store.ErrMissingReference) {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: "the book was deleted",
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Internal,
@@ -498,6 +518,12 @@ func (s *APIV1Service) UpdateBookReview(c echo.Context) error {
 	}
 
 	updatedBookReview, err := s.Store.UpdateBookReview(ctx, update)
+	if errors.Is(err, store.ErrMissingReference) {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: fmt.Sprintf("book %d does not exist", request.BookID),
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusNotFound, &ErrorResponse{
 			Code:    Internal,
@@ -569,7 +595,7 @@ func (s *APIV1Service) Dashboard(c echo.Context) error {
 
 func (s *APIV1Service) ReadBook(c echo.Context) error {
 	ctx := c.Request().Context()
-	year, err := util.GetYearFromQueryParam(c.QueryParam("year"))
+	year, err := util.GetYearFromQueryParam(c.QueryParam("year"), clock.FromContext(ctx).Now())
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, &ErrorResponse{
 			Code:    InvalidRequest,
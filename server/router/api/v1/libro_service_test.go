@@ -0,0 +1,28 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"itsfriday/store"
+)
+
+func TestLibroReferences(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "password")
+
+	// the user was deleted after the access token was checked
+	rec := callHandler(t, s.CreateBook, http.MethodPost, "/v1/libro/books", &CreateBookRequest{Title: "Title", Author: "Author", Pages: 100, PubYear: 2000}, user.ID+1)
+	expectConflict(t, rec, "the user was deleted")
+
+	book := &Book{}
+	decodeResponse(t, callHandler(t, s.CreateBook, http.MethodPost, "/v1/libro/books", &CreateBookRequest{Title: "Title", Author: "Author", Pages: 100, PubYear: 2000}, user.ID), http.StatusOK, book)
+	if _, err := s.Store.CreateBookReview(ctx, &store.BookReview{UserID: user.ID, BookID: book.ID, DateRead: "2024-12-31", Rating: 5}); err != nil {
+		t.Fatal(err)
+	}
+	rec = callHandlerWithID(t, s.DeleteBook, http.MethodDelete, fmt.Sprintf("/v1/libro/books/%d", book.ID), fmt.Sprint(book.ID), nil, user.ID)
+	expectConflict(t, rec, "the book has reviews")
+}
@@ -0,0 +1,147 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/store"
+)
+
+// brute-force protection of the login endpoints, the state is kept in the store so it survives restarts.
+
+const (
+	// loginBackoffBase is the delay after the first failure beyond the free attempts, it doubles with every failure.
+	loginBackoffBase = time.Second
+	loginBackoffMax  = 5 * time.Minute
+	// loginAttemptWindow is how long a failure is remembered.
+	loginAttemptWindow = time.Hour
+)
+
+type loginAttemptPolicy struct {
+	// freeAttempts is the number of failures allowed without any delay.
+	freeAttempts int32
+	// lockoutAttempts is the number of failures which locks the subject out.
+	lockoutAttempts int32
+	lockoutDuration time.Duration
+}
+
+// An IP is shared by many users behind a NAT, so it gets more attempts than a username.
+var loginAttemptPolicies = map[store.LoginAttemptKind]loginAttemptPolicy{
+	store.LoginAttemptKindUsername: {
+		freeAttempts:    3,
+		lockoutAttempts: 10,
+		lockoutDuration: 15 * time.Minute,
+	},
+	store.LoginAttemptKindIP: {
+		freeAttempts:    10,
+		lockoutAttempts: 50,
+		lockoutDuration: 15 * time.Minute,
+	},
+}
+
+type loginAttemptSubject struct {
+	Kind    store.LoginAttemptKind
+	Subject string
+}
+
+// getLoginAttemptSubjects returns the username or email being logged in and the client IP.
+func getLoginAttemptSubjects(c echo.Context, identifier string) []*loginAttemptSubject {
+	return []*loginAttemptSubject{
+		{Kind: store.LoginAttemptKindUsername, Subject: strings.ToLower(identifier)},
+		{Kind: store.LoginAttemptKindIP, Subject: c.RealIP()},
+	}
+}
+
+// checkLoginAttempts returns how long the client has to wait before trying again, zero if it may try now.
+func (s *APIV1Service) checkLoginAttempts(ctx context.Context, subjects []*loginAttemptSubject, now time.Time) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, subject := range subjects {
+		loginAttempt, err := s.Store.GetLoginAttempt(ctx, &store.FindLoginAttempt{
+			Kind:    &subject.Kind,
+			Subject: &subject.Subject,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if loginAttempt == nil {
+			continue
+		}
+
+		allowedTime := getLoginAllowedTime(loginAttempt, loginAttemptPolicies[subject.Kind])
+		if wait := allowedTime.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	return retryAfter, nil
+}
+
+// recordLoginFailure counts a failed login for every subject and locks out the ones over the limit.
+// The count is incremented by the store, concurrent failures must not overwrite each other.
+func (s *APIV1Service) recordLoginFailure(ctx context.Context, subjects []*loginAttemptSubject, now time.Time) {
+	for _, subject := range subjects {
+		policy := loginAttemptPolicies[subject.Kind]
+		// Counting starts over when the last failure is forgotten or the lockout is over.
+		loginAttempt, err := s.Store.IncrementLoginAttempt(ctx, &store.IncrementLoginAttempt{
+			Kind:            subject.Kind,
+			Subject:         subject.Subject,
+			FailedTs:        now.Unix(),
+			ResetBeforeTs:   now.Add(-loginAttemptWindow).Unix(),
+			LockoutAttempts: policy.lockoutAttempts,
+			LockedUntilTs:   now.Add(policy.lockoutDuration).Unix(),
+		})
+		if err != nil {
+			slog.Error("failed to record login failure", "kind", subject.Kind, "subject", subject.Subject, "error", err)
+			continue
+		}
+		if loginAttempt.FailedCount == policy.lockoutAttempts {
+			slog.Warn("login locked out", "kind", subject.Kind, "subject", subject.Subject, "failedCount", loginAttempt.FailedCount, "lockedUntil", time.Unix(loginAttempt.LockedUntilTs, 0))
+		}
+	}
+}
+
+// resetLoginAttempts forgets the failures of the username after a successful login.
+// The failures of the IP are kept so that logging into an own account does not allow guessing others.
+func (s *APIV1Service) resetLoginAttempts(ctx context.Context, subjects []*loginAttemptSubject) {
+	for _, subject := range subjects {
+		if subject.Kind != store.LoginAttemptKindUsername {
+			continue
+		}
+		if err := s.Store.DeleteLoginAttempt(ctx, &store.DeleteLoginAttempt{
+			Kind:    subject.Kind,
+			Subject: subject.Subject,
+		}); err != nil {
+			slog.Error("failed to reset login attempts", "subject", subject.Subject, "error", err)
+		}
+	}
+}
+
+// getLoginAllowedTime returns when the next login attempt is allowed.
+func getLoginAllowedTime(loginAttempt *store.LoginAttempt, policy loginAttemptPolicy) time.Time {
+	if loginAttempt.LockedUntilTs != 0 {
+		return time.Unix(loginAttempt.LockedUntilTs, 0)
+	}
+	if loginAttempt.FailedCount < policy.freeAttempts {
+		return time.Time{}
+	}
+
+	exponent := float64(loginAttempt.FailedCount - policy.freeAttempts)
+	backoff := time.Duration(math.Min(float64(loginBackoffBase)*math.Pow(2, exponent), float64(loginBackoffMax)))
+	return time.Unix(loginAttempt.LastFailedTs, 0).Add(backoff)
+}
+
+func tooManyLoginAttempts(c echo.Context, retryAfter time.Duration) error {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	return c.JSON(http.StatusTooManyRequests, &ErrorResponse{
+		Code:    ResourceExhausted,
+		Message: fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds),
+	})
+}
@@ -0,0 +1,72 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"itsfriday/store"
+)
+
+func TestLoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	createTestUser(t, s, "alice", "password")
+	start := time.Unix(1700000000, 0)
+	login := func(password string, elapsed time.Duration) *http.Response {
+		rec := callHandlerAt(t, s.Login, "/v1/user/login", &LoginRequest{Username: "alice", Password: password}, InvalidUserID, start.Add(elapsed))
+		return rec.Result()
+	}
+
+	for _, tc := range []struct {
+		name     string
+		password string
+		elapsed  time.Duration
+		status   int
+		// retryAfter is the Retry-After header of a refused login
+		retryAfter string
+	}{
+		{name: "first free failure", password: "wrong", status: http.StatusInternalServerError},
+		{name: "second free failure", password: "wrong", status: http.StatusInternalServerError},
+		{name: "third free failure", password: "wrong", status: http.StatusInternalServerError},
+		{name: "slowed down", password: "password", status: http.StatusTooManyRequests, retryAfter: "1"},
+		{name: "fourth failure", password: "wrong", elapsed: time.Second, status: http.StatusInternalServerError},
+		{name: "slowed down twice as long", password: "wrong", elapsed: 2 * time.Second, status: http.StatusTooManyRequests, retryAfter: "1"},
+		{name: "fifth failure", password: "wrong", elapsed: 3 * time.Second, status: http.StatusInternalServerError},
+		{name: "sixth failure", password: "wrong", elapsed: 7 * time.Second, status: http.StatusInternalServerError},
+		{name: "seventh failure", password: "wrong", elapsed: 15 * time.Second, status: http.StatusInternalServerError},
+		{name: "eighth failure", password: "wrong", elapsed: 31 * time.Second, status: http.StatusInternalServerError},
+		{name: "ninth failure", password: "wrong", elapsed: 63 * time.Second, status: http.StatusInternalServerError},
+		{name: "tenth failure locks out", password: "wrong", elapsed: 127 * time.Second, status: http.StatusInternalServerError},
+		{name: "locked out", password: "password", elapsed: 127 * time.Second, status: http.StatusTooManyRequests, retryAfter: "900"},
+		{name: "locked out until the end", password: "password", elapsed: 1026 * time.Second, status: http.StatusTooManyRequests, retryAfter: "1"},
+		{name: "lockout over", password: "password", elapsed: 1027 * time.Second, status: http.StatusOK},
+	} {
+		response := login(tc.password, tc.elapsed)
+		if response.StatusCode != tc.status {
+			t.Fatalf("%s: status is %d, want %d", tc.name, response.StatusCode, tc.status)
+		}
+		if retryAfter := response.Header.Get("Retry-After"); retryAfter != tc.retryAfter {
+			t.Errorf("%s: Retry-After is %q, want %q", tc.name, retryAfter, tc.retryAfter)
+		}
+	}
+
+	// the success forgets the failures of the username, not the ones of the IP
+	attempts := map[store.LoginAttemptKind]int32{}
+	for _, kind := range []store.LoginAttemptKind{store.LoginAttemptKindUsername, store.LoginAttemptKindIP} {
+		loginAttempt, err := s.Store.GetLoginAttempt(ctx, &store.FindLoginAttempt{Kind: &kind})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loginAttempt != nil {
+			attempts[kind] = loginAttempt.FailedCount
+		}
+	}
+	if attempts[store.LoginAttemptKindUsername] != 0 || attempts[store.LoginAttemptKindIP] != 10 {
+		t.Errorf("failed attempts are %v after the success, want none of the username and 10 of the IP", attempts)
+	}
+	if response := login("wrong", 1027*time.Second); response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("the failure after the success returned %d, want the wrong password", response.StatusCode)
+	}
+}
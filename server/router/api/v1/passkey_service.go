@@ -0,0 +1,709 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"itsfriday/internal/clock"
+	"itsfriday/internal/util"
+	"itsfriday/server/keyring"
+	"itsfriday/store"
+)
+
+// passkey service: passwordless sign-in with WebAuthn credentials.
+// The relying party is the web app, its id is the host of the instance URL.
+
+const (
+	maxPasskeyNameLength = 64
+	// maxPasskeysPerUser bounds the credentials a user can register.
+	maxPasskeysPerUser = 20
+)
+
+type PasskeyServiceServer interface {
+	BeginPasskeyRegistration(echo.Context) error
+	FinishPasskeyRegistration(echo.Context) error
+	ListPasskeys(echo.Context) error
+	UpdatePasskey(echo.Context) error
+	DeletePasskey(echo.Context) error
+	BeginPasskeyLogin(echo.Context) error
+	FinishPasskeyLogin(echo.Context) error
+}
+
+type BeginPasskeyRegistrationRequest struct {
+	Password string `json:"password"`
+}
+
+// PasskeyCeremony is passed to navigator.credentials.create() or get() by the web app.
+// The session token is sent back with the credential to finish the ceremony.
+type PasskeyCeremony struct {
+	SessionToken string `json:"sessionToken"`
+	ExpiresTime  int64  `json:"expiresTime"`
+	// Options is a protocol.CredentialCreation or a protocol.CredentialAssertion.
+	Options any `json:"options"`
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	SessionToken string `json:"sessionToken"`
+	Name         string `json:"name"`
+	// Credential is the PublicKeyCredential returned by navigator.credentials.create().
+	Credential json.RawMessage `json:"credential"`
+}
+
+type FinishPasskeyLoginRequest struct {
+	SessionToken string `json:"sessionToken"`
+	// Credential is the PublicKeyCredential returned by navigator.credentials.get().
+	Credential json.RawMessage `json:"credential"`
+}
+
+type UpdatePasskeyRequest struct {
+	Name string `json:"name"`
+}
+
+type Passkey struct {
+	ID             int32    `json:"id"`
+	Name           string   `json:"name"`
+	CreatedTime    int64    `json:"createdTime"`
+	LastUsedTime   int64    `json:"lastUsedTime,omitempty"`
+	Transports     []string `json:"transports"`
+	BackupEligible bool     `json:"backupEligible"`
+	BackupState    bool     `json:"backupState"`
+}
+
+type Passkeys struct {
+	Passkeys []*Passkey `json:"passkeys"`
+}
+
+// PasskeyCeremonyClaims keeps the session data of a WebAuthn ceremony between its begin and finish.
+// The subject is the registering user, empty at login where the user is found by the credential.
+type PasskeyCeremonyClaims struct {
+	Session webauthn.SessionData `json:"session"`
+	jwt.RegisteredClaims
+}
+
+// webauthnUser is the user as seen by the WebAuthn library.
+type webauthnUser struct {
+	user     *store.User
+	passkeys []*store.Passkey
+}
+
+// WebAuthnID is the user handle stored in the passkey, it finds the user at a login without a username.
+func (u *webauthnUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(int(u.user.ID)))
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	if u.user.Nickname != "" {
+		return u.user.Nickname
+	}
+	return u.user.Username
+}
+
+func (*webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, passkey := range u.passkeys {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(passkey.Transports))
+		for _, transport := range passkey.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              passkey.CredentialID,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    passkey.AAGUID,
+				SignCount: passkey.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+// BeginPasskeyRegistration starts the registration of a passkey. The password is asked again,
+// so a stolen access token can not add a way to sign in.
+func (s *APIV1Service) BeginPasskeyRegistration(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(BeginPasskeyRegistrationRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid passkey registration request: %v", err),
+		})
+	}
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "unmatched password",
+		})
+	}
+
+	passkeys, err := s.Store.ListPasskeys(ctx, &store.FindPasskey{UserID: &user.ID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list passkeys: %v", err),
+		})
+	}
+	if len(passkeys) >= maxPasskeysPerUser {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    ResourceExhausted,
+			Message: fmt.Sprintf("at most %d passkeys can be registered", maxPasskeysPerUser),
+		})
+	}
+
+	webAuthn, err := s.newWebAuthn()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to configure passkeys: %v", err),
+		})
+	}
+	wu := &webauthnUser{user: user, passkeys: passkeys}
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, credential := range wu.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	// the passkey alone signs in, so it has to be discoverable and verify the user
+	creation, session, err := webAuthn.BeginRegistration(wu,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to begin passkey registration: %v", err),
+		})
+	}
+
+	ceremony, err := s.issuePasskeyCeremony(PasskeyRegistrationAudienceName, user.ID, session, creation)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to issue session token: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyRegistration verifies the new credential and stores it.
+func (s *APIV1Service) FinishPasskeyRegistration(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(FinishPasskeyRegistrationRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid passkey registration request: %v", err),
+		})
+	}
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	name, err := validatePasskeyName(request.Name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+
+	claims, err := parsePasskeyCeremony(request.SessionToken, PasskeyRegistrationAudienceName, s.Keyring)
+	if err != nil || claims.Subject != fmt.Sprint(userID) {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid or expired session token",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(request.Credential))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid credential: %v", err),
+		})
+	}
+	webAuthn, err := s.newWebAuthn()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to configure passkeys: %v", err),
+		})
+	}
+	credential, err := webAuthn.CreateCredential(&webauthnUser{user: user}, claims.Session, parsed)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("failed to verify credential: %v", err),
+		})
+	}
+
+	existing, err := s.Store.GetPasskey(ctx, &store.FindPasskey{CredentialID: credential.ID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get passkey: %v", err),
+		})
+	}
+	if existing != nil {
+		return c.JSON(http.StatusConflict, &ErrorResponse{
+			Code:    Conflict,
+			Message: "the passkey is registered already",
+		})
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	passkey, err := s.Store.CreatePasskey(ctx, &store.Passkey{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to create passkey: %v", err),
+		})
+	}
+	s.recordAuditLog(c, user.ID, store.AuditActionPasskeyAdd, store.AuditOutcomeSuccess, passkey.Name)
+
+	return c.JSON(http.StatusOK, convertPasskeyFromStore(passkey))
+}
+
+func (s *APIV1Service) ListPasskeys(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	passkeys, err := s.Store.ListPasskeys(ctx, &store.FindPasskey{UserID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to list passkeys: %v", err),
+		})
+	}
+	list := make([]*Passkey, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		list = append(list, convertPasskeyFromStore(passkey))
+	}
+	return c.JSON(http.StatusOK, &Passkeys{Passkeys: list})
+}
+
+// UpdatePasskey renames a passkey.
+func (s *APIV1Service) UpdatePasskey(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(UpdatePasskeyRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid passkey request: %v", err),
+		})
+	}
+	name, err := validatePasskeyName(request.Name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: err.Error(),
+		})
+	}
+	passkey, status, errResponse := s.getPasskeyFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	passkey, err = s.Store.UpdatePasskey(ctx, &store.UpdatePasskey{
+		ID:   passkey.ID,
+		Name: &name,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update passkey: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, convertPasskeyFromStore(passkey))
+}
+
+func (s *APIV1Service) DeletePasskey(c echo.Context) error {
+	ctx := c.Request().Context()
+	passkey, status, errResponse := s.getPasskeyFromParam(c)
+	if errResponse != nil {
+		return c.JSON(status, errResponse)
+	}
+
+	if err := s.Store.DeletePasskey(ctx, &store.DeletePasskey{
+		ID:     passkey.ID,
+		UserID: passkey.UserID,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to delete passkey: %v", err),
+		})
+	}
+	s.recordAuditLog(c, passkey.UserID, store.AuditActionPasskeyDelete, store.AuditOutcomeSuccess, passkey.Name)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// BeginPasskeyLogin starts a login without a username, the authenticator offers the passkeys it has for the site.
+func (s *APIV1Service) BeginPasskeyLogin(c echo.Context) error {
+	webAuthn, err := s.newWebAuthn()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to configure passkeys: %v", err),
+		})
+	}
+	assertion, session, err := webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to begin passkey login: %v", err),
+		})
+	}
+
+	ceremony, err := s.issuePasskeyCeremony(PasskeyLoginAudienceName, 0, session, assertion)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to issue session token: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyLogin verifies the assertion and signs the owner of the passkey in.
+// The passkey verifies the user itself, so no second factor is asked.
+func (s *APIV1Service) FinishPasskeyLogin(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(FinishPasskeyLoginRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid passkey login request: %v", err),
+		})
+	}
+	claims, err := parsePasskeyCeremony(request.SessionToken, PasskeyLoginAudienceName, s.Keyring)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid or expired session token",
+		})
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(request.Credential))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid credential: %v", err),
+		})
+	}
+
+	// the passkey tells who signs in, until it is found only the client IP is throttled
+	now := clock.FromContext(ctx).Now()
+	passkey, err := s.Store.GetPasskey(ctx, &store.FindPasskey{CredentialID: parsed.RawID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get passkey: %v", err),
+		})
+	}
+	var user *store.User
+	if passkey != nil {
+		user, err = s.Store.GetUser(ctx, &store.FindUser{ID: &passkey.UserID})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to get user: %v", err),
+			})
+		}
+	}
+	loginAttemptSubjects := []*loginAttemptSubject{{Kind: store.LoginAttemptKindIP, Subject: c.RealIP()}}
+	var auditUserID int32
+	if user != nil {
+		loginAttemptSubjects = getLoginAttemptSubjects(c, user.Username)
+		auditUserID = user.ID
+	}
+	retryAfter, err := s.checkLoginAttempts(ctx, loginAttemptSubjects, now)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to check login attempts: %v", err),
+		})
+	}
+	if retryAfter > 0 {
+		s.recordAuditLog(c, auditUserID, store.AuditActionLogin, store.AuditOutcomeFailure, "too many failed login attempts")
+		return tooManyLoginAttempts(c, retryAfter)
+	}
+	if user == nil {
+		s.recordLoginFailure(ctx, loginAttemptSubjects, now)
+		s.recordAuditLog(c, 0, store.AuditActionLogin, store.AuditOutcomeFailure, "unknown passkey")
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "unknown passkey",
+		})
+	}
+
+	webAuthn, err := s.newWebAuthn()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to configure passkeys: %v", err),
+		})
+	}
+	credential, err := webAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		if string(userHandle) != strconv.Itoa(int(user.ID)) {
+			return nil, errors.New("the user handle does not match the passkey")
+		}
+		return &webauthnUser{user: user, passkeys: []*store.Passkey{passkey}}, nil
+	}, claims.Session, parsed)
+	if err == nil && credential.Authenticator.CloneWarning {
+		err = errors.New("the signature counter went back, the authenticator may be cloned")
+	}
+	if err != nil {
+		s.recordLoginFailure(ctx, loginAttemptSubjects, now)
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, fmt.Sprintf("passkey %q: %v", passkey.Name, err))
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("failed to verify passkey: %v", err),
+		})
+	}
+	if user.RowStatus == store.Archived {
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, "the account is archived")
+		return c.JSON(http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+			Message: "user has been archived",
+		})
+	}
+
+	lastUsedTs := now.Unix()
+	if _, err := s.Store.UpdatePasskey(ctx, &store.UpdatePasskey{
+		ID:          passkey.ID,
+		SignCount:   &credential.Authenticator.SignCount,
+		BackupState: &credential.Flags.BackupState,
+		LastUsedTs:  &lastUsedTs,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update passkey: %v", err),
+		})
+	}
+
+	s.resetLoginAttempts(ctx, loginAttemptSubjects)
+	tokens, err := s.doSignIn(ctx, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("failed to log in: %v", err),
+		})
+	}
+	s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeSuccess, fmt.Sprintf("passkey %q", passkey.Name))
+	if err := s.setSignInCookies(c, tokens); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to set cookie: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, convertAccessTokenInfo(tokens))
+}
+
+func (s *APIV1Service) getPasskeyFromParam(c echo.Context) (*store.Passkey, int, *ErrorResponse) {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		}
+	}
+	id, err := util.ConvertStringToInt32(c.Param("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid passkey id: %v", err),
+		}
+	}
+
+	passkey, err := s.Store.GetPasskey(ctx, &store.FindPasskey{ID: &id, UserID: &userID})
+	if err != nil {
+		return nil, http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get passkey: %v", err),
+		}
+	}
+	if passkey == nil {
+		return nil, http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "passkey not found",
+		}
+	}
+	return passkey, http.StatusOK, nil
+}
+
+// newWebAuthn configures the relying party from the instance URL, where the web app calls the WebAuthn API.
+func (s *APIV1Service) newWebAuthn() (*webauthn.WebAuthn, error) {
+	instanceURL, err := url.Parse(s.Profile.InstanceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance url: %w", err)
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          instanceURL.Hostname(),
+		RPDisplayName: Issuer,
+		RPOrigins:     []string{instanceURL.Scheme + "://" + instanceURL.Host},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login: webauthn.TimeoutConfig{
+				Enforce: true,
+				Timeout: PasskeyCeremonyDuration,
+			},
+			Registration: webauthn.TimeoutConfig{
+				Enforce: true,
+				Timeout: PasskeyCeremonyDuration,
+			},
+		},
+	})
+}
+
+func (s *APIV1Service) issuePasskeyCeremony(audience string, userID int32, session *webauthn.SessionData, options any) (*PasskeyCeremony, error) {
+	expireTime := time.Now().Add(PasskeyCeremonyDuration)
+	claims := &PasskeyCeremonyClaims{
+		Session: *session,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expireTime),
+			ID:        uuid.NewString(),
+		},
+	}
+	if userID != 0 {
+		claims.Subject = fmt.Sprint(userID)
+	}
+	sessionToken, err := generatePasskeyCeremony(claims, s.Keyring.Current())
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{
+		SessionToken: sessionToken,
+		ExpiresTime:  expireTime.Unix(),
+		Options:      options,
+	}, nil
+}
+
+func generatePasskeyCeremony(claims *PasskeyCeremonyClaims, key *keyring.Key) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString([]byte(key.Secret))
+}
+
+func parsePasskeyCeremony(tokenString string, audience string, keyring *keyring.Keyring) (*PasskeyCeremonyClaims, error) {
+	claims := &PasskeyCeremonyClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, keyringKeyFunc(keyring), jwt.WithAudience(audience), jwt.WithIssuer(Issuer)); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func validatePasskeyName(name string) (string, error) {
+	if name == "" {
+		return "Passkey", nil
+	}
+	if len(name) > maxPasskeyNameLength {
+		return "", fmt.Errorf("the name is longer than %d characters", maxPasskeyNameLength)
+	}
+	return name, nil
+}
+
+func convertPasskeyFromStore(passkey *store.Passkey) *Passkey {
+	transports := passkey.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+	return &Passkey{
+		ID:             passkey.ID,
+		Name:           passkey.Name,
+		CreatedTime:    passkey.CreatedTs,
+		LastUsedTime:   passkey.LastUsedTs,
+		Transports:     transports,
+		BackupEligible: passkey.BackupEligible,
+		BackupState:    passkey.BackupState,
+	}
+}
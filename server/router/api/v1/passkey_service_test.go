@@ -0,0 +1,315 @@
+package v1
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"itsfriday/store"
+)
+
+// flags of the authenticator data
+const (
+	authDataUserPresent        byte = 0x01
+	authDataUserVerified       byte = 0x04
+	authDataAttestedCredential byte = 0x40
+)
+
+// softAuthenticator is a passkey authenticator in software. It keeps a P-256 key like a platform authenticator
+// and builds the authenticator data and CBOR by hand, without attestation.
+type softAuthenticator struct {
+	t            *testing.T
+	rpID         string
+	origin       string
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, rpID string, origin string) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, rpID: rpID, origin: origin, credentialID: credentialID, key: key}
+}
+
+// create answers navigator.credentials.create() with a new credential.
+func (a *softAuthenticator) create(challenge string) json.RawMessage {
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	// COSE_Key of an EC2 key: {1: 2 (EC2), 3: -7 (ES256), -1: 1 (P-256), -2: x, -3: y}
+	coseKey := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01}
+	coseKey = append(append(append(coseKey, 0x21), cborBytes(x)...), 0x22)
+	coseKey = append(coseKey, cborBytes(y)...)
+
+	attestedCredential := make([]byte, 16) // the AAGUID is zero
+	attestedCredential = binary.BigEndian.AppendUint16(attestedCredential, uint16(len(a.credentialID)))
+	attestedCredential = append(append(attestedCredential, a.credentialID...), coseKey...)
+	authData := a.authData(authDataUserPresent|authDataUserVerified|authDataAttestedCredential, attestedCredential)
+
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	attestationObject := []byte{0xa3}
+	attestationObject = append(attestationObject, cborText("fmt")...)
+	attestationObject = append(attestationObject, cborText("none")...)
+	attestationObject = append(attestationObject, cborText("attStmt")...)
+	attestationObject = append(attestationObject, 0xa0)
+	attestationObject = append(attestationObject, cborText("authData")...)
+	attestationObject = append(attestationObject, cborBytes(authData)...)
+
+	return a.marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData("webauthn.create", challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// get answers navigator.credentials.get() with an assertion signed with the counter.
+func (a *softAuthenticator) get(challenge string, signCount uint32, userHandle string) json.RawMessage {
+	a.signCount = signCount
+	authData := a.authData(authDataUserPresent|authDataUserVerified, nil)
+	clientData := a.clientData("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString([]byte(userHandle)),
+		},
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte, attestedCredential []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	authData := append(rpIDHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.signCount)
+	return append(authData, attestedCredential...)
+}
+
+func (a *softAuthenticator) clientData(ceremonyType string, challenge string) []byte {
+	return a.marshal(map[string]any{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+}
+
+func (a *softAuthenticator) marshal(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHeader(0x40, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHeader(0x60, len(s)), s...)
+}
+
+func cborHeader(majorType byte, length int) []byte {
+	switch {
+	case length < 24:
+		return []byte{majorType | byte(length)}
+	case length < 256:
+		return []byte{majorType | 24, byte(length)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{majorType | 25}, uint16(length))
+	}
+}
+
+// testPasskeyCeremony is a PasskeyCeremony with the parts of the options the authenticator needs.
+type testPasskeyCeremony struct {
+	SessionToken string `json:"sessionToken"`
+	Options      struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "secret")
+	authenticator := newSoftAuthenticator(t, "localhost", "http://localhost:4321")
+
+	rec := callHandler(t, s.BeginPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/begin", &BeginPasskeyRegistrationRequest{Password: "wrong"}, user.ID)
+	decodeResponse(t, rec, http.StatusBadRequest, nil)
+
+	register := func() *testPasskeyCeremony {
+		ceremony := &testPasskeyCeremony{}
+		rec := callHandler(t, s.BeginPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/begin", &BeginPasskeyRegistrationRequest{Password: "secret"}, user.ID)
+		decodeResponse(t, rec, http.StatusOK, ceremony)
+		return ceremony
+	}
+	ceremony := register()
+	rec = callHandler(t, s.FinishPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/finish", &FinishPasskeyRegistrationRequest{
+		SessionToken: ceremony.SessionToken,
+		Name:         "Laptop",
+		Credential:   authenticator.create(ceremony.Options.PublicKey.Challenge),
+	}, user.ID)
+	passkey := &Passkey{}
+	decodeResponse(t, rec, http.StatusOK, passkey)
+	if passkey.Name != "Laptop" || strings.Join(passkey.Transports, ",") != "internal" {
+		t.Errorf("registered passkey is %+v", passkey)
+	}
+
+	// the ceremony of another user is refused
+	bob := createTestUser(t, s, "bob", "secret")
+	rec = callHandler(t, s.FinishPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/finish", &FinishPasskeyRegistrationRequest{
+		SessionToken: ceremony.SessionToken,
+		Credential:   authenticator.create(ceremony.Options.PublicKey.Challenge),
+	}, bob.ID)
+	decodeResponse(t, rec, http.StatusBadRequest, nil)
+
+	// a credential is registered once
+	ceremony = register()
+	rec = callHandler(t, s.FinishPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/finish", &FinishPasskeyRegistrationRequest{
+		SessionToken: ceremony.SessionToken,
+		Credential:   authenticator.create(ceremony.Options.PublicKey.Challenge),
+	}, user.ID)
+	decodeResponse(t, rec, http.StatusConflict, nil)
+
+	// the response has to answer the challenge of the ceremony
+	ceremony = register()
+	rec = callHandler(t, s.FinishPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/finish", &FinishPasskeyRegistrationRequest{
+		SessionToken: ceremony.SessionToken,
+		Credential:   newSoftAuthenticator(t, "localhost", "http://localhost:4321").create(base64.RawURLEncoding.EncodeToString([]byte("another challenge"))),
+	}, user.ID)
+	decodeResponse(t, rec, http.StatusBadRequest, nil)
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "secret")
+	authenticator := newSoftAuthenticator(t, "localhost", "http://localhost:4321")
+
+	ceremony := &testPasskeyCeremony{}
+	rec := callHandler(t, s.BeginPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/begin", &BeginPasskeyRegistrationRequest{Password: "secret"}, user.ID)
+	decodeResponse(t, rec, http.StatusOK, ceremony)
+	rec = callHandler(t, s.FinishPasskeyRegistration, http.MethodPost, "/v1/user/passkeys/register/finish", &FinishPasskeyRegistrationRequest{
+		SessionToken: ceremony.SessionToken,
+		Credential:   authenticator.create(ceremony.Options.PublicKey.Challenge),
+	}, user.ID)
+	decodeResponse(t, rec, http.StatusOK, nil)
+
+	// a failed login keeps the stored counter, so the next one is compared with the last successful login
+	signIns := 0
+	for _, tc := range []struct {
+		name      string
+		signCount uint32
+		challenge string
+		// userHandle is the ID of the user unless set
+		userHandle string
+		status     int
+		// message is a part of the error of a failed login
+		message string
+	}{
+		{name: "first login", signCount: 1, status: http.StatusOK},
+		{name: "replayed counter", signCount: 1, status: http.StatusUnauthorized, message: "signature counter"},
+		{name: "counter went back", signCount: 0, status: http.StatusUnauthorized, message: "signature counter"},
+		{name: "next login", signCount: 2, status: http.StatusOK},
+		{name: "another challenge", signCount: 3, challenge: base64.RawURLEncoding.EncodeToString([]byte("another challenge")), status: http.StatusUnauthorized, message: "challenge"},
+		{name: "another user handle", signCount: 3, userHandle: "999", status: http.StatusUnauthorized, message: "user handle"},
+	} {
+		ceremony := &testPasskeyCeremony{}
+		rec := callHandler(t, s.BeginPasskeyLogin, http.MethodPost, "/v1/user/login/passkey/begin", nil, InvalidUserID)
+		decodeResponse(t, rec, http.StatusOK, ceremony)
+		challenge := ceremony.Options.PublicKey.Challenge
+		if tc.challenge != "" {
+			challenge = tc.challenge
+		}
+		userHandle := strconv.Itoa(int(user.ID))
+		if tc.userHandle != "" {
+			userHandle = tc.userHandle
+		}
+
+		rec = callHandler(t, s.FinishPasskeyLogin, http.MethodPost, "/v1/user/login/passkey/finish", &FinishPasskeyLoginRequest{
+			SessionToken: ceremony.SessionToken,
+			Credential:   authenticator.get(challenge, tc.signCount, userHandle),
+		}, InvalidUserID)
+		if rec.Code != tc.status {
+			t.Fatalf("%s: status is %d, want %d: %s", tc.name, rec.Code, tc.status, rec.Body.String())
+		}
+		if tc.status != http.StatusOK {
+			if !strings.Contains(rec.Body.String(), tc.message) {
+				t.Errorf("%s: failed with %s, want %q", tc.name, rec.Body.String(), tc.message)
+			}
+			continue
+		}
+		signIns++
+
+		// the login ends like a password login, with a stored access token in a new session
+		accessTokenInfo := &AccessTokenInfo{}
+		decodeResponse(t, rec, http.StatusOK, accessTokenInfo)
+		accessTokens, err := s.Store.GetUserAccessTokens(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validateAccessToken(accessTokenInfo.AccessToken, "", accessTokens) == nil {
+			t.Errorf("%s: the access token is not stored", tc.name)
+		}
+		if cookies := rec.Header().Values("Set-Cookie"); len(cookies) != 2 || !strings.HasPrefix(cookies[0], AccessTokenCookieName+"="+accessTokenInfo.AccessToken) {
+			t.Errorf("%s: cookies are %v", tc.name, cookies)
+		}
+		sessions, err := s.Store.GetUserSessions(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != signIns {
+			t.Errorf("%s: %d sessions, want %d", tc.name, len(sessions), signIns)
+		}
+		passkey, err := s.Store.GetPasskey(ctx, &store.FindPasskey{CredentialID: authenticator.credentialID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if passkey.SignCount != tc.signCount || passkey.LastUsedTs == 0 {
+			t.Errorf("%s: stored passkey has the counter %d and was last used at %d", tc.name, passkey.SignCount, passkey.LastUsedTs)
+		}
+	}
+
+	// the failed logins count for the user
+	kind := store.LoginAttemptKindUsername
+	loginAttempt, err := s.Store.GetLoginAttempt(ctx, &store.FindLoginAttempt{Kind: &kind, Subject: &user.Username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loginAttempt == nil || loginAttempt.FailedCount != 2 {
+		t.Errorf("login attempt after the failures is %+v, want 2 failures", loginAttempt)
+	}
+}
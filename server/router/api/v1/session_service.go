@@ -0,0 +1,199 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/store"
+)
+
+// session service: where the user is signed in, a session is the token family of one sign-in
+
+const (
+	// maxUserAgentLength truncates the user agent stored for a session.
+	maxUserAgentLength = 256
+)
+
+type SessionServiceServer interface {
+	ListSessions(echo.Context) error
+	RevokeSession(echo.Context) error
+	RevokeOtherSessions(echo.Context) error
+}
+
+type Session struct {
+	ID           string `json:"id"`
+	CreatedTime  int64  `json:"createdTime"`
+	LastUsedTime int64  `json:"lastUsedTime"`
+	ExpiresTime  int64  `json:"expiresTime"`
+	ClientIP     string `json:"clientIp"`
+	UserAgent    string `json:"userAgent"`
+	// Current is the session of the request.
+	Current bool `json:"current"`
+}
+
+type Sessions struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+// ListSessions lists the sessions of the user, the most recently used first.
+func (s *APIV1Service) ListSessions(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	currentSessionID, _ := c.Get(sessionIDContextKey).(string)
+
+	userSessions, err := s.Store.GetUserSessions(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get sessions: %v", err),
+		})
+	}
+
+	list := make([]*Session, 0)
+	for _, userSession := range pruneExpiredSessions(userSessions) {
+		list = append(list, &Session{
+			ID:           userSession.ID,
+			CreatedTime:  userSession.CreatedTs,
+			LastUsedTime: userSession.LastUsedTs,
+			ExpiresTime:  userSession.ExpiresTs,
+			ClientIP:     userSession.ClientIP,
+			UserAgent:    userSession.UserAgent,
+			Current:      userSession.ID == currentSessionID,
+		})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return max(list[i].LastUsedTime, list[i].CreatedTime) > max(list[j].LastUsedTime, list[j].CreatedTime)
+	})
+	return c.JSON(http.StatusOK, &Sessions{Sessions: list})
+}
+
+// RevokeSession signs the session out, revoking its access and refresh tokens.
+func (s *APIV1Service) RevokeSession(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	sessionID := c.Param("id")
+
+	userSessions, err := s.Store.GetUserSessions(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get sessions: %v", err),
+		})
+	}
+	found := false
+	for _, userSession := range userSessions {
+		if userSession.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "session not found",
+		})
+	}
+
+	if err := s.revokeTokenFamily(ctx, userID, sessionID); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to revoke session: %v", err),
+		})
+	}
+	s.recordAuditLog(c, userID, store.AuditActionTokenRevoke, store.AuditOutcomeSuccess, fmt.Sprintf("session %s", sessionID))
+	if currentSessionID, _ := c.Get(sessionIDContextKey).(string); currentSessionID == sessionID {
+		if err := s.clearSignInCookies(c); err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to set cookie: %v", err),
+			})
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out of every session except the current one. Personal access tokens are kept.
+func (s *APIV1Service) RevokeOtherSessions(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	currentSessionID, _ := c.Get(sessionIDContextKey).(string)
+	if currentSessionID == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "the request is not made with a session, personal access tokens can not revoke sessions",
+		})
+	}
+
+	if err := s.revokeTokenFamilies(ctx, userID, func(familyID string) bool {
+		return familyID != currentSessionID
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to revoke sessions: %v", err),
+		})
+	}
+	s.recordAuditLog(c, userID, store.AuditActionTokenRevoke, store.AuditOutcomeSuccess, "all sessions but the current one")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// upsertSession starts the session of a sign-in or extends it when its tokens are refreshed.
+func (s *APIV1Service) upsertSession(ctx context.Context, userID int32, sessionID string, expireTime time.Time) error {
+	return s.Store.UpdateUserSessions(ctx, userID, func(userSessions []*store.UserSettingSession) ([]*store.UserSettingSession, error) {
+		now := time.Now().Unix()
+		var current *store.UserSettingSession
+		for _, userSession := range userSessions {
+			if userSession.ID == sessionID {
+				current = userSession
+				break
+			}
+		}
+		if current == nil {
+			current = &store.UserSettingSession{
+				ID:        sessionID,
+				CreatedTs: now,
+			}
+			userSessions = append(userSessions, current)
+		} else {
+			current.LastUsedTs = now
+		}
+		current.ExpiresTs = expireTime.Unix()
+		return pruneExpiredSessions(userSessions), nil
+	})
+}
+
+func pruneExpiredSessions(userSessions []*store.UserSettingSession) []*store.UserSettingSession {
+	now := time.Now().Unix()
+	list := []*store.UserSettingSession{}
+	for _, userSession := range userSessions {
+		if userSession.ExpiresTs < now {
+			continue
+		}
+		list = append(list, userSession)
+	}
+	return list
+}
@@ -0,0 +1,109 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// callAuthenticated calls the handler of the route, e.g. "DELETE /v1/user/sessions/:id", authenticated with the access token.
+func callAuthenticated(t *testing.T, ai *authHandler, handler echo.HandlerFunc, route string, id string, accessToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	method, path, _ := strings.Cut(route, " ")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(method, strings.ReplaceAll(path, ":id", id), nil), rec)
+	c.SetPath(path)
+	if id != "" {
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+	}
+	if _, err := ai.ParseTokenFunc(c, accessToken); err != nil {
+		t.Fatalf("%s: %v", route, err)
+	}
+	if err := handler(c); err != nil {
+		t.Fatalf("%s: %v", route, err)
+	}
+	return rec
+}
+
+func TestRevokeSessions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	ai := NewAuthHandler(s.Store, s.Keyring, "user")
+	user := createTestUser(t, s, "alice", "password")
+	authenticate := func(accessToken string) error {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/v1/user/profile", nil), httptest.NewRecorder())
+		c.SetPath("/v1/user/profile")
+		_, err := ai.ParseTokenFunc(c, accessToken)
+		return err
+	}
+	signIn := func() (*signInTokens, string) {
+		tokens, err := s.doSignIn(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions := &Sessions{}
+		decodeResponse(t, callAuthenticated(t, ai, s.ListSessions, "GET /v1/user/sessions", "", tokens.AccessToken), http.StatusOK, sessions)
+		for _, session := range sessions.Sessions {
+			if session.Current {
+				return tokens, session.ID
+			}
+		}
+		t.Fatal("the session of the sign-in is not listed as the current one")
+		return nil, ""
+	}
+	// expectSignedOut fails unless both the access and the refresh token of the session are refused.
+	expectSignedOut := func(name string, tokens *signInTokens) {
+		t.Helper()
+		if err := authenticate(tokens.AccessToken); err == nil {
+			t.Errorf("the access token of the %s session is accepted", name)
+		}
+		rec, _ := refreshTokens(t, s, tokens.RefreshToken)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("the refresh token of the %s session returned %d, want %d", name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	expectSignedIn := func(name string, accessToken string) {
+		t.Helper()
+		if err := authenticate(accessToken); err != nil {
+			t.Errorf("the access token of the %s session is refused: %v", name, err)
+		}
+	}
+
+	current, currentID := signIn()
+	revoked, revokedID := signIn()
+	other, _ := signIn()
+	personal := &AccessToken{}
+	decodeResponse(t, callHandler(t, s.CreateAccessToken, http.MethodPost, "/v1/user/access-tokens", &CreateAccessTokenRequest{Description: "script", Scopes: []string{ScopeUserRead}}, user.ID), http.StatusOK, personal)
+
+	// a session is revoked from another one
+	rec := callAuthenticated(t, ai, s.RevokeSession, "DELETE /v1/user/sessions/:id", revokedID, current.AccessToken)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoking the session returned %d: %s", rec.Code, rec.Body)
+	}
+	expectSignedOut("revoked", revoked)
+	expectSignedIn("current", current.AccessToken)
+	expectSignedIn("other", other.AccessToken)
+	rec = callAuthenticated(t, ai, s.RevokeSession, "DELETE /v1/user/sessions/:id", revokedID, current.AccessToken)
+	expectErrorResponse(t, rec, http.StatusNotFound, "session not found")
+
+	// the others are revoked, the current session and the personal access token are kept
+	rec = callAuthenticated(t, ai, s.RevokeOtherSessions, "POST /v1/user/sessions/revoke-others", "", current.AccessToken)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoking the other sessions returned %d: %s", rec.Code, rec.Body)
+	}
+	expectSignedOut("other", other)
+	expectSignedIn("current", current.AccessToken)
+	expectSignedIn("personal", personal.AccessToken)
+	sessions := &Sessions{}
+	decodeResponse(t, callAuthenticated(t, ai, s.ListSessions, "GET /v1/user/sessions", "", current.AccessToken), http.StatusOK, sessions)
+	if len(sessions.Sessions) != 1 || sessions.Sessions[0].ID != currentID {
+		t.Errorf("sessions are %+v after revoking the others, want the current one only", sessions.Sessions)
+	}
+	rec, _ = refreshTokens(t, s, current.RefreshToken)
+	decodeResponse(t, rec, http.StatusOK, &AccessTokenInfo{})
+}
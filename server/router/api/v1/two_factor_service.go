@@ -0,0 +1,486 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"itsfriday/internal/clock"
+	"itsfriday/internal/totp"
+	"itsfriday/internal/util"
+	"itsfriday/store"
+)
+
+// two-factor authentication service
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+type TwoFactorServiceServer interface {
+	EnrollTwoFactor(echo.Context) error
+	VerifyTwoFactor(echo.Context) error
+	DisableTwoFactor(echo.Context) error
+	LoginTwoFactor(echo.Context) error
+}
+
+type EnrollTwoFactorRequest struct {
+	Password      string   `json:"password"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+}
+
+type VerifyTwoFactorRequest struct {
+	Code          string   `json:"code"`
+}
+
+type TwoFactorRecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password      string   `json:"password"`
+	Code          string   `json:"code"`
+}
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+	ExpiresTime       int64  `json:"expiresTime"`
+}
+
+type LoginTwoFactorRequest struct {
+	ChallengeToken string  `json:"challengeToken"`
+	Code           string  `json:"code"`
+	RecoveryCode   string  `json:"recoveryCode"`
+}
+
+// EnrollTwoFactor generates a new TOTP secret. It is not active until a code of it is verified.
+func (s *APIV1Service) EnrollTwoFactor(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(EnrollTwoFactorRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid two-factor enrollment request: %v", err),
+		})
+	}
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "unmatched password",
+		})
+	}
+
+	userTOTP, err := s.Store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get two-factor setting: %v", err),
+		})
+	}
+	if userTOTP != nil && userTOTP.Enabled {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate secret: %v", err),
+		})
+	}
+	if err := s.upsertUserTOTP(ctx, user.ID, &store.UserSettingTOTP{
+		Secret:    secret,
+		Enabled:   false,
+		CreatedTs: time.Now().Unix(),
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save two-factor setting: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.BuildURI(Issuer, user.Username, secret),
+	})
+}
+
+// VerifyTwoFactor activates the enrolled secret and returns the one-time recovery codes.
+func (s *APIV1Service) VerifyTwoFactor(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(VerifyTwoFactorRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid two-factor verification request: %v", err),
+		})
+	}
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	recoveryCodes, hashedRecoveryCodes, err := generateRecoveryCodes()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate recovery codes: %v", err),
+		})
+	}
+	// Under the lock of the setting only one of two verifications activates it with its recovery codes.
+	err = s.Store.UpdateUserTOTP(ctx, userID, func(userTOTP *store.UserSettingTOTP) (*store.UserSettingTOTP, error) {
+		if userTOTP == nil {
+			return nil, errTwoFactorNotEnrolled
+		}
+		if userTOTP.Enabled {
+			return nil, errTwoFactorEnabled
+		}
+		step, ok := totp.Validate(userTOTP.Secret, request.Code, clock.FromContext(ctx).Now())
+		if !ok {
+			return nil, errInvalidTwoFactorCode
+		}
+		userTOTP.Enabled = true
+		userTOTP.LastUsedStep = step
+		userTOTP.RecoveryCodes = hashedRecoveryCodes
+		return userTOTP, nil
+	})
+	switch {
+	case errors.Is(err, errTwoFactorNotEnrolled):
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "two-factor authentication is not enrolled",
+		})
+	case errors.Is(err, errTwoFactorEnabled):
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "two-factor authentication is already enabled",
+		})
+	case errors.Is(err, errInvalidTwoFactorCode):
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid two-factor code",
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save two-factor setting: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, &TwoFactorRecoveryCodes{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (s *APIV1Service) DisableTwoFactor(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(DisableTwoFactorRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid disabling two-factor request: %v", err),
+		})
+	}
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "unmatched password",
+		})
+	}
+
+	userTOTP, err := s.Store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get two-factor setting: %v", err),
+		})
+	}
+	if userTOTP == nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if userTOTP.Enabled && !verifyTwoFactorCode(userTOTP, request.Code, "", clock.FromContext(ctx).Now()) {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "invalid two-factor code",
+		})
+	}
+
+	if err := s.Store.DeleteUserSetting(ctx, &store.DeleteUserSetting{
+		UserID: &user.ID,
+		Key:    store.UserSettingKey_TOTP,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to delete two-factor setting: %v", err),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LoginTwoFactor completes a login started with a password by a TOTP code or a recovery code.
+func (s *APIV1Service) LoginTwoFactor(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(LoginTwoFactorRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid two-factor login request: %v", err),
+		})
+	}
+
+	_, claims, err := parseToken(request.ChallengeToken, TwoFactorChallengeAudienceName, s.Keyring)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("invalid or expired challenge token: %v", err),
+		})
+	}
+	userID, err := util.ConvertStringToInt32(claims.Subject)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("malformed ID in the token: %v", err),
+		})
+	}
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil || user.RowStatus == store.Archived {
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "user not found",
+		})
+	}
+
+	userTOTP, err := s.Store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get two-factor setting: %v", err),
+		})
+	}
+	if userTOTP == nil || !userTOTP.Enabled {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "two-factor authentication is not enabled",
+		})
+	}
+
+	now := clock.FromContext(ctx).Now()
+	loginAttemptSubjects := getLoginAttemptSubjects(c, user.Username)
+	retryAfter, err := s.checkLoginAttempts(ctx, loginAttemptSubjects, now)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to check login attempts: %v", err),
+		})
+	}
+	if retryAfter > 0 {
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, "too many failed login attempts")
+		return tooManyLoginAttempts(c, retryAfter)
+	}
+	// The code is checked and marked used under the lock of the setting, so two logins cannot both use it.
+	err = s.Store.UpdateUserTOTP(ctx, user.ID, func(userTOTP *store.UserSettingTOTP) (*store.UserSettingTOTP, error) {
+		if userTOTP == nil || !userTOTP.Enabled {
+			return nil, errTwoFactorNotEnabled
+		}
+		if !verifyTwoFactorCode(userTOTP, request.Code, request.RecoveryCode, now) {
+			return nil, errInvalidTwoFactorCode
+		}
+		return userTOTP, nil
+	})
+	if errors.Is(err, errTwoFactorNotEnabled) {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "two-factor authentication is not enabled",
+		})
+	}
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		s.recordLoginFailure(ctx, loginAttemptSubjects, now)
+		s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeFailure, "invalid two-factor code")
+		return c.JSON(http.StatusUnauthorized, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: "invalid two-factor code",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save two-factor setting: %v", err),
+		})
+	}
+	s.resetLoginAttempts(ctx, loginAttemptSubjects)
+
+	tokens, err := s.doSignIn(ctx, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Unauthenticated,
+			Message: fmt.Sprintf("failed to log in: %v", err),
+		})
+	}
+	detail := "password and two-factor code"
+	if request.Code == "" {
+		detail = "password and recovery code"
+	}
+	s.recordAuditLog(c, user.ID, store.AuditActionLogin, store.AuditOutcomeSuccess, detail)
+	if err := s.setSignInCookies(c, tokens); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to set cookie: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, convertAccessTokenInfo(tokens))
+}
+
+// issueTwoFactorChallenge issues the token which proves that the password of the user has been checked.
+func (s *APIV1Service) issueTwoFactorChallenge(user *store.User) (*TwoFactorChallenge, error) {
+	expireTime := time.Now().Add(TwoFactorChallengeDuration)
+	challengeToken, err := generateToken(user.Username, user.ID, TwoFactorChallengeAudienceName, uuid.NewString(), expireTime, s.Keyring.Current())
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+		ExpiresTime:       expireTime.Unix(),
+	}, nil
+}
+
+func (s *APIV1Service) upsertUserTOTP(ctx context.Context, userID int32, userTOTP *store.UserSettingTOTP) error {
+	value, err := store.ConvertUserSettingValueToString(userTOTP)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: userID,
+		Key:    store.UserSettingKey_TOTP,
+		Value:  value,
+	}); err != nil {
+		return fmt.Errorf("failed to upsert user setting: %v", err)
+	}
+	return nil
+}
+
+var (
+	errTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	errTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	errTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// verifyTwoFactorCode checks a TOTP code at now or a recovery code and marks it as used in the setting,
+// which the caller writes back under the lock of Store.UpdateUserTOTP.
+func verifyTwoFactorCode(userTOTP *store.UserSettingTOTP, code string, recoveryCode string, now time.Time) bool {
+	if code != "" {
+		step, ok := totp.Validate(userTOTP.Secret, code, now)
+		if !ok || step <= userTOTP.LastUsedStep {
+			return false
+		}
+		userTOTP.LastUsedStep = step
+		return true
+	}
+
+	if recoveryCode != "" {
+		hashedRecoveryCode := hashRecoveryCode(recoveryCode)
+		for i, stored := range userTOTP.RecoveryCodes {
+			if stored == hashedRecoveryCode {
+				userTOTP.RecoveryCodes = append(userTOTP.RecoveryCodes[:i], userTOTP.RecoveryCodes[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	hashedRecoveryCodes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		bytes := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(bytes))[:recoveryCodeLength]
+		code = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+		recoveryCodes = append(recoveryCodes, code)
+		hashedRecoveryCodes = append(hashedRecoveryCodes, hashRecoveryCode(code))
+	}
+	return recoveryCodes, hashedRecoveryCodes, nil
+}
+
+func hashRecoveryCode(recoveryCode string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(recoveryCode), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/clock"
+	"itsfriday/internal/totp"
+	"itsfriday/store"
+)
+
+// callHandlerAt is callHandler at the time now. It may be called from other goroutines than the one of the test.
+func callHandlerAt(t *testing.T, handler echo.HandlerFunc, target string, request any, userID int32, now time.Time) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Error(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req = req.WithContext(clock.NewContext(req.Context(), clock.Fixed(now)))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if userID != InvalidUserID {
+		c.Set(useridContextKey, userID)
+	}
+	if err := handler(c); err != nil {
+		t.Errorf("%s: %v", target, err)
+	}
+	return rec
+}
+
+// enableTwoFactor enrolls and verifies two-factor authentication of the user at now,
+// and returns the secret and the recovery codes.
+func enableTwoFactor(t *testing.T, s *APIV1Service, user *store.User, now time.Time) (string, []string) {
+	t.Helper()
+	enrollment := &TwoFactorEnrollment{}
+	decodeResponse(t, callHandlerAt(t, s.EnrollTwoFactor, "/v1/user/2fa/enroll", &EnrollTwoFactorRequest{Password: "password"}, user.ID, now), http.StatusOK, enrollment)
+	code, err := totp.GenerateCode(enrollment.Secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes := &TwoFactorRecoveryCodes{}
+	decodeResponse(t, callHandlerAt(t, s.VerifyTwoFactor, "/v1/user/2fa/verify", &VerifyTwoFactorRequest{Code: code}, user.ID, now), http.StatusOK, recoveryCodes)
+	return enrollment.Secret, recoveryCodes.RecoveryCodes
+}
+
+func TestTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	user := createTestUser(t, s, "alice", "password")
+	now := time.Unix(1111111111, 0)
+
+	enrollment := &TwoFactorEnrollment{}
+	decodeResponse(t, callHandlerAt(t, s.EnrollTwoFactor, "/v1/user/2fa/enroll", &EnrollTwoFactorRequest{Password: "password"}, user.ID, now), http.StatusOK, enrollment)
+	expectErrorResponse(t, callHandlerAt(t, s.VerifyTwoFactor, "/v1/user/2fa/verify", &VerifyTwoFactorRequest{Code: "000000"}, user.ID, now), http.StatusBadRequest, "invalid two-factor code")
+	code, err := totp.GenerateCode(enrollment.Secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes := &TwoFactorRecoveryCodes{}
+	decodeResponse(t, callHandlerAt(t, s.VerifyTwoFactor, "/v1/user/2fa/verify", &VerifyTwoFactorRequest{Code: code}, user.ID, now), http.StatusOK, recoveryCodes)
+	if len(recoveryCodes.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(recoveryCodes.RecoveryCodes), recoveryCodeCount)
+	}
+	expectErrorResponse(t, callHandlerAt(t, s.VerifyTwoFactor, "/v1/user/2fa/verify", &VerifyTwoFactorRequest{Code: code}, user.ID, now), http.StatusBadRequest, "already enabled")
+
+	challenge, err := s.issueTwoFactorChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextCode, err := totp.GenerateCode(enrollment.Secret, now.Add(totp.Period*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := now.Add(totp.Period * time.Second)
+	// a success resets the failed attempts, so the failures in between are not slowed down
+	for _, tc := range []struct {
+		name         string
+		code         string
+		recoveryCode string
+		status       int
+	}{
+		{name: "code of the verification", code: code, status: http.StatusUnauthorized},
+		{name: "next code", code: nextCode, status: http.StatusOK},
+		{name: "used code", code: nextCode, status: http.StatusUnauthorized},
+		{name: "code older than the used one", code: code, status: http.StatusUnauthorized},
+		{name: "recovery code", recoveryCode: recoveryCodes.RecoveryCodes[0], status: http.StatusOK},
+		{name: "used recovery code", recoveryCode: recoveryCodes.RecoveryCodes[0], status: http.StatusUnauthorized},
+		{name: "unknown recovery code", recoveryCode: "aaaaa-aaaaa", status: http.StatusUnauthorized},
+	} {
+		rec := callHandlerAt(t, s.LoginTwoFactor, "/v1/user/login/2fa", &LoginTwoFactorRequest{ChallengeToken: challenge.ChallengeToken, Code: tc.code, RecoveryCode: tc.recoveryCode}, InvalidUserID, later)
+		if tc.status == http.StatusOK {
+			decodeResponse(t, rec, tc.status, &AccessTokenInfo{})
+		} else {
+			expectErrorResponse(t, rec, tc.status, "invalid two-factor code")
+		}
+	}
+
+	userTOTP, err := s.Store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userTOTP.LastUsedStep != later.Unix()/totp.Period || len(userTOTP.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Errorf("the setting has the step %d and %d recovery codes, want the step of the next code and one recovery code used", userTOTP.LastUsedStep, len(userTOTP.RecoveryCodes))
+	}
+}
+
+func TestLoginTwoFactorConcurrently(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	later := now.Add(totp.Period * time.Second)
+	for _, name := range []string{"code", "recovery code"} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestService(t)
+			user := createTestUser(t, s, "alice", "password")
+			secret, recoveryCodes := enableTwoFactor(t, s, user, now)
+			challenge, err := s.issueTwoFactorChallenge(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &LoginTwoFactorRequest{ChallengeToken: challenge.ChallengeToken, RecoveryCode: recoveryCodes[0]}
+			if name == "code" {
+				code, err := totp.GenerateCode(secret, later)
+				if err != nil {
+					t.Fatal(err)
+				}
+				request = &LoginTwoFactorRequest{ChallengeToken: challenge.ChallengeToken, Code: code}
+			}
+
+			// the same code is sent at once, only one of the logins uses it
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			statuses := make(chan int, 32)
+			for range cap(statuses) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					statuses <- callHandlerAt(t, s.LoginTwoFactor, "/v1/user/login/2fa", request, InvalidUserID, later).Code
+				}()
+			}
+			close(start)
+			wg.Wait()
+			close(statuses)
+			signedIn := 0
+			for status := range statuses {
+				if status == http.StatusOK {
+					signedIn++
+				}
+			}
+			if signedIn != 1 {
+				t.Errorf("%d logins with the same %s, want 1", signedIn, name)
+			}
+		})
+	}
+}
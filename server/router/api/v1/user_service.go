@@ -2,23 +2,33 @@ package v1
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
     "golang.org/x/crypto/bcrypt"
 
+	"itsfriday/internal/avatar"
 	"itsfriday/store"
 )
 
 // user service
 
+var errAccessTokenNotFound = errors.New("access token not found")
+
 type UserServiceServer interface {
 	ProfileUser(echo.Context) error
 	UpdateUser(echo.Context) error
 	DeleteUser(echo.Context) error
+
+	ListAccessTokens(echo.Context) error
+	CreateAccessToken(echo.Context) error
+	DeleteAccessToken(echo.Context) error
 }
 
 type User struct {
@@ -29,6 +39,7 @@ type User struct {
 	Username     string            `json:"username"`
 	Role         store.Role        `json:"role"`
 	Email        string            `json:"email"`
+	EmailVerified bool             `json:"emailVerified"`
 	Nickname     string            `json:"nickname"`
 	AvatarURL    string            `json:"avatarUrl"`
 	Description  string            `json:"description"`
@@ -47,6 +58,34 @@ type DeleteUserRequest struct {
 	Password     string `json:"password"`
 }
 
+// AccountDeletion is when a deleted account is purged, it can be restored until then.
+type AccountDeletion struct {
+	RequestedTime int64 `json:"requestedTime"`
+	PurgeTime     int64 `json:"purgeTime"`
+}
+
+type CreateAccessTokenRequest struct {
+	Description     string   `json:"description"`
+	// ExpiresTime is a unix timestamp, zero for a token that never expires.
+	ExpiresTime     int64    `json:"expiresTime"`
+	Scopes          []string `json:"scopes"`
+}
+
+type AccessToken struct {
+	ID              string   `json:"id"`
+	Description     string   `json:"description"`
+	Scopes          []string `json:"scopes"`
+	CreatedTime     int64    `json:"createdTime"`
+	LastUsedTime    int64    `json:"lastUsedTime"`
+	ExpiresTime     int64    `json:"expiresTime"`
+	// AccessToken is returned only once when the token is created.
+	AccessToken     string   `json:"accessToken,omitempty"`
+}
+
+type AccessTokens struct {
+	AccessTokens    []*AccessToken `json:"accessTokens"`
+}
+
 type DeleteUserAccessToken struct {
 	ID           int32
 	AccessToken  string
@@ -77,7 +116,16 @@ func (s *APIV1Service) ProfileUser(c echo.Context) error {
 		})
 	}
 
-	userInfo := convertUserFromStore(user)
+	emailVerification, err := s.Store.GetUserEmailVerification(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get email verification: %v", err),
+		})
+	}
+
+	userInfo := s.convertUserFromStore(user)
+	userInfo.EmailVerified = emailVerification.IsVerified(user.Email)
 	return c.JSON(http.StatusOK, userInfo)
 }
 
@@ -126,6 +174,7 @@ func (s *APIV1Service) UpdateUser(c echo.Context) error {
 	}
 	if request.OldPassword != "" && request.NewPassword != "" {
 		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.OldPassword)); err != nil {
+			s.recordAuditLog(c, user.ID, store.AuditActionPasswordChange, store.AuditOutcomeFailure, "wrong old password")
 			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 				Code:    InvalidRequest,
 				Message: fmt.Sprintf("unmatched old password: %v", err),
@@ -154,7 +203,18 @@ func (s *APIV1Service) UpdateUser(c echo.Context) error {
 		})
 	}
 
-	userInfo := convertUserFromStore(updatedUser)
+	if update.PasswordHash != nil {
+		s.recordAuditLog(c, user.ID, store.AuditActionPasswordChange, store.AuditOutcomeSuccess, "")
+	}
+
+	// A new email has to be verified again.
+	if updatedUser.Email != "" && updatedUser.Email != user.Email {
+		if err := s.sendEmailVerification(ctx, updatedUser); err != nil {
+			slog.Error("failed to send email verification", "user", updatedUser.ID, "error", err)
+		}
+	}
+
+	userInfo := s.convertUserFromStore(updatedUser)
 	return c.JSON(http.StatusOK, userInfo)
 }
 
@@ -190,34 +250,237 @@ func (s *APIV1Service) DeleteUser(c echo.Context) error {
 		})
 	}
 	if user.Username != request.Username {
+		s.recordAuditLog(c, user.ID, store.AuditActionAccountDelete, store.AuditOutcomeFailure, "wrong username")
 		return c.JSON(http.StatusNotFound, &ErrorResponse{
 			Code:    PermissionDenied,
 			Message: "permission denied",
 		})
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)); err != nil {
+		s.recordAuditLog(c, user.ID, store.AuditActionAccountDelete, store.AuditOutcomeFailure, "wrong password")
 		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    InvalidRequest,
 		    Message: fmt.Sprintf("unmatched username and password: %v", err),
 		})
 	}
 
-	if err := s.Store.DeleteUserSetting(ctx, &store.DeleteUserSetting{
-		UserID:  &user.ID,
-		Key:     store.UserSettingKey_ACCESS_TOKENS,
+	// the account is archived now and purged with all of its data after the grace period
+	now := time.Now()
+	deletion := &store.UserSettingDeletion{
+		RequestedTs: now.Unix(),
+		PurgeTs:     now.Add(accountDeletionGracePeriod).Unix(),
+	}
+	value, err := store.ConvertUserSettingValueToString(deletion)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to convert user setting to string: %v", err),
+		})
+	}
+	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: user.ID,
+		Key:    store.UserSettingKey_DELETION,
+		Value:  value,
 	}); err != nil {
-		slog.Error("failed to delete access tokens before deleting user", "error", err)
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to upsert user setting: %v", err),
+		})
 	}
-
-	if err := s.Store.DeleteUser(ctx, &store.DeleteUser{
-		ID: user.ID,
+	rowStatus := store.Archived
+	currentTs := now.Unix()
+	if _, err := s.Store.UpdateUser(ctx, &store.UpdateUser{
+		ID:        user.ID,
+		UpdatedTs: &currentTs,
+		RowStatus: &rowStatus,
 	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to archive user: %v", err),
+		})
+	}
+	if err := s.revokeAllTokens(ctx, user.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to revoke tokens: %v", err),
+		})
+	}
+	if err := s.clearSignInCookies(c); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to set cookie: %v", err),
+		})
+	}
+	slog.Info("user deletion scheduled", "user", user.ID, "purge", time.Unix(deletion.PurgeTs, 0))
+	s.recordAuditLog(c, user.ID, store.AuditActionAccountDelete, store.AuditOutcomeSuccess, fmt.Sprintf("purge at %s", time.Unix(deletion.PurgeTs, 0).UTC().Format(time.RFC3339)))
+
+	return c.JSON(http.StatusOK, convertAccountDeletionFromStore(deletion))
+}
+
+func (s *APIV1Service) ListAccessTokens(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+	    return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	userAccessTokens, err := s.Store.GetUserAccessTokens(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get access tokens: %v", err),
+		})
+	}
+
+	list := make([]*AccessToken, 0)
+	for _, userAccessToken := range pruneExpiredAccessTokens(userAccessTokens) {
+		if !userAccessToken.IsPersonal() {
+			continue
+		}
+		list = append(list, convertAccessTokenFromStore(userAccessToken))
+	}
+	return c.JSON(http.StatusOK, &AccessTokens{AccessTokens: list})
+}
+
+func (s *APIV1Service) CreateAccessToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(CreateAccessTokenRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+		    Message: fmt.Sprintf("invalid creating access token request: %v", err),
+		})
+	}
+	if request.Description == "" {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+		    Message: "description is required",
+		})
+	}
+	now := time.Now()
+	if request.ExpiresTime != 0 && request.ExpiresTime <= now.Unix() {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+		    Message: "expiresTime should be in the future",
+		})
+	}
+	if len(request.Scopes) == 0 {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+		    Message: "at least one scope is required",
+		})
+	}
+	for _, scope := range request.Scopes {
+		if !isValidScope(scope) {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid scope: %s", scope),
+			})
+		}
+	}
+
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+	    return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	user, err := s.Store.GetUser(ctx, &store.FindUser{ID: &userID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user: %v", err),
+		})
+	}
+	if user == nil {
 		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "user not found",
+		})
+	}
+
+	tokenID := uuid.NewString()
+	var expireTime time.Time
+	if request.ExpiresTime != 0 {
+		expireTime = time.Unix(request.ExpiresTime, 0)
+	}
+	accessToken, err := GenerateAccessToken(user.Username, user.ID, tokenID, expireTime, s.Keyring.Current())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
 			Code:    Internal,
-			Message: fmt.Sprintf("failed to delete user: %v", err),
+			Message: fmt.Sprintf("failed to generate access token: %v", err),
+		})
+	}
+	userAccessToken := &store.UserSettingAccessToken{
+		ID:          tokenID,
+		Type:        store.AccessTokenTypePersonal,
+		Description: request.Description,
+		Scopes:      request.Scopes,
+		CreatedTs:   now.Unix(),
+		ExpiresTs:   request.ExpiresTime,
+	}
+	if err := userAccessToken.SetAccessToken(accessToken); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to hash access token: %v", err),
+		})
+	}
+	if err := s.UpsertAccessTokenToStore(ctx, user, userAccessToken); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save access token: %v", err),
 		})
 	}
 
+	accessTokenInfo := convertAccessTokenFromStore(userAccessToken)
+	accessTokenInfo.AccessToken = accessToken
+	return c.JSON(http.StatusOK, accessTokenInfo)
+}
+
+func (s *APIV1Service) DeleteAccessToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	tokenID := c.Param("id")
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+	    return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	err := s.Store.UpdateUserAccessTokens(ctx, userID, func(userAccessTokens []*store.UserSettingAccessToken) ([]*store.UserSettingAccessToken, error) {
+		found := false
+		updatedUserAccessTokens := []*store.UserSettingAccessToken{}
+		for _, userAccessToken := range userAccessTokens {
+			if userAccessToken.ID == tokenID && userAccessToken.IsPersonal() {
+				found = true
+				continue
+			}
+			updatedUserAccessTokens = append(updatedUserAccessTokens, userAccessToken)
+		}
+		if !found {
+			return nil, errAccessTokenNotFound
+		}
+		return updatedUserAccessTokens, nil
+	})
+	if errors.Is(err, errAccessTokenNotFound) {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "access token not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to delete access token: %v", err),
+		})
+	}
+	s.recordAuditLog(c, userID, store.AuditActionTokenRevoke, store.AuditOutcomeSuccess, fmt.Sprintf("personal access token %s", tokenID))
+
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -226,58 +489,133 @@ func (s *APIV1Service) DeleteUserAccessToken(ctx context.Context, request *Delet
 	if err != nil {
 		return "", fmt.Errorf("failed to list access tokens: %v", err)
 	}
-	updatedUserAccessTokens := []*store.UserSettingAccessToken{}
+	// Signing out of a session revokes its refresh tokens as well.
 	for _, userAccessToken := range userAccessTokens {
-		if userAccessToken.AccessToken == request.AccessToken {
-			continue
+		if userAccessToken.Matches(request.AccessToken) && userAccessToken.FamilyID != "" {
+			return "", s.revokeTokenFamily(ctx, request.ID, userAccessToken.FamilyID)
 		}
-		updatedUserAccessTokens = append(updatedUserAccessTokens, userAccessToken)
 	}
-	println(updatedUserAccessTokens)
-	value, err := store.ConvertUserSettingValueToString(&store.UserSettingAccessTokens{
-		AccessTokens: updatedUserAccessTokens,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to convert user setting to string: %v", err)
-	}
-	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
-		UserID: request.ID,
-		Key:    store.UserSettingKey_ACCESS_TOKENS,
-		Value: value,
+
+	if err := s.Store.UpdateUserAccessTokens(ctx, request.ID, func(userAccessTokens []*store.UserSettingAccessToken) ([]*store.UserSettingAccessToken, error) {
+		updatedUserAccessTokens := []*store.UserSettingAccessToken{}
+		for _, userAccessToken := range userAccessTokens {
+			if userAccessToken.Matches(request.AccessToken) {
+				continue
+			}
+			updatedUserAccessTokens = append(updatedUserAccessTokens, userAccessToken)
+		}
+		return updatedUserAccessTokens, nil
 	}); err != nil {
-		return "", fmt.Errorf("failed to upsert user setting: %v", err)
+		return "", fmt.Errorf("failed to update user access tokens: %w", err)
 	}
 
 	return "", nil
 }
 
-func (s *APIV1Service) UpsertAccessTokenToStore(ctx context.Context, user *store.User, accessToken, description string) error {
-    userAccessTokens, err := s.Store.GetUserAccessTokens(ctx, user.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get user access tokens: %w", err)
+func (s *APIV1Service) UpsertAccessTokenToStore(ctx context.Context, user *store.User, userAccessToken *store.UserSettingAccessToken) error {
+	return s.Store.UpdateUserAccessTokens(ctx, user.ID, func(userAccessTokens []*store.UserSettingAccessToken) ([]*store.UserSettingAccessToken, error) {
+		return append(pruneExpiredAccessTokens(userAccessTokens), userAccessToken), nil
+	})
+}
+
+func (s *APIV1Service) UpsertRefreshTokenToStore(ctx context.Context, user *store.User, userRefreshToken *store.UserSettingRefreshToken) error {
+	return s.Store.UpdateUserRefreshTokens(ctx, user.ID, func(userRefreshTokens []*store.UserSettingRefreshToken) ([]*store.UserSettingRefreshToken, error) {
+		return append(pruneExpiredRefreshTokens(userRefreshTokens), userRefreshToken), nil
+	})
+}
+
+// revokeAllTokens deletes every access token, including personal ones, and refresh token of the user.
+func (s *APIV1Service) revokeAllTokens(ctx context.Context, userID int32) error {
+	if err := s.Store.UpdateUserAccessTokens(ctx, userID, func([]*store.UserSettingAccessToken) ([]*store.UserSettingAccessToken, error) {
+		return []*store.UserSettingAccessToken{}, nil
+	}); err != nil {
+		return err
 	}
-	userAccessToken := store.UserSettingAccessToken{
-		AccessToken: accessToken,
-		Description: description,
+	if err := s.Store.UpdateUserRefreshTokens(ctx, userID, func([]*store.UserSettingRefreshToken) ([]*store.UserSettingRefreshToken, error) {
+		return []*store.UserSettingRefreshToken{}, nil
+	}); err != nil {
+		return err
 	}
-	userAccessTokens = append(userAccessTokens, &userAccessToken)
-	value, err := store.ConvertUserSettingValueToString(&store.UserSettingAccessTokens{
-		AccessTokens: userAccessTokens,
+	return s.Store.UpdateUserSessions(ctx, userID, func([]*store.UserSettingSession) ([]*store.UserSettingSession, error) {
+		return []*store.UserSettingSession{}, nil
 	})
-	if err != nil {
-		return fmt.Errorf("failed to convert user setting to string: %v", err)
+}
+
+// revokeTokenFamily deletes every access token and refresh token issued for one sign-in.
+func (s *APIV1Service) revokeTokenFamily(ctx context.Context, userID int32, familyID string) error {
+	return s.revokeTokenFamilies(ctx, userID, func(id string) bool {
+		return id == familyID
+	})
+}
+
+// revokeTokenFamilies signs out of every session whose family matches, personal access tokens are kept.
+func (s *APIV1Service) revokeTokenFamilies(ctx context.Context, userID int32, match func(familyID string) bool) error {
+	if err := s.Store.UpdateUserAccessTokens(ctx, userID, func(userAccessTokens []*store.UserSettingAccessToken) ([]*store.UserSettingAccessToken, error) {
+		updatedUserAccessTokens := []*store.UserSettingAccessToken{}
+		for _, userAccessToken := range userAccessTokens {
+			if userAccessToken.FamilyID != "" && match(userAccessToken.FamilyID) {
+				continue
+			}
+			updatedUserAccessTokens = append(updatedUserAccessTokens, userAccessToken)
+		}
+		return updatedUserAccessTokens, nil
+	}); err != nil {
+		return fmt.Errorf("failed to update user access tokens: %w", err)
 	}
-	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
-		UserID: user.ID,
-		Key:    store.UserSettingKey_ACCESS_TOKENS,
-		Value:  value,
+
+	if err := s.Store.UpdateUserRefreshTokens(ctx, userID, func(userRefreshTokens []*store.UserSettingRefreshToken) ([]*store.UserSettingRefreshToken, error) {
+		updatedUserRefreshTokens := []*store.UserSettingRefreshToken{}
+		for _, userRefreshToken := range userRefreshTokens {
+			if match(userRefreshToken.FamilyID) {
+				continue
+			}
+			updatedUserRefreshTokens = append(updatedUserRefreshTokens, userRefreshToken)
+		}
+		return updatedUserRefreshTokens, nil
 	}); err != nil {
-		return fmt.Errorf("failed to upsert user setting: %v", err)
+		return fmt.Errorf("failed to update user refresh tokens: %w", err)
+	}
+
+	if err := s.Store.UpdateUserSessions(ctx, userID, func(userSessions []*store.UserSettingSession) ([]*store.UserSettingSession, error) {
+		updatedUserSessions := []*store.UserSettingSession{}
+		for _, userSession := range pruneExpiredSessions(userSessions) {
+			if match(userSession.ID) {
+				continue
+			}
+			updatedUserSessions = append(updatedUserSessions, userSession)
+		}
+		return updatedUserSessions, nil
+	}); err != nil {
+		return fmt.Errorf("failed to update user sessions: %w", err)
 	}
 	return nil
 }
 
-func convertUserFromStore(user *store.User) *User {
+func pruneExpiredAccessTokens(userAccessTokens []*store.UserSettingAccessToken) []*store.UserSettingAccessToken {
+	now := time.Now().Unix()
+	list := []*store.UserSettingAccessToken{}
+	for _, userAccessToken := range userAccessTokens {
+		if userAccessToken.ExpiresTs != 0 && userAccessToken.ExpiresTs < now {
+			continue
+		}
+		list = append(list, userAccessToken)
+	}
+	return list
+}
+
+func pruneExpiredRefreshTokens(userRefreshTokens []*store.UserSettingRefreshToken) []*store.UserSettingRefreshToken {
+	now := time.Now().Unix()
+	list := []*store.UserSettingRefreshToken{}
+	for _, userRefreshToken := range userRefreshTokens {
+		if userRefreshToken.ExpiresTs < now {
+			continue
+		}
+		list = append(list, userRefreshToken)
+	}
+	return list
+}
+
+func (s *APIV1Service) convertUserFromStore(user *store.User) *User {
     userInfo := &User{
         ID: user.ID,
 		State: user.RowStatus,
@@ -290,5 +628,31 @@ func convertUserFromStore(user *store.User) *User {
 		AvatarURL: user.AvatarURL,
 		Description: user.Description,
 	}
+	// an uploaded avatar is kept as the path it is served at
+	if _, ok := avatar.KeyFromURL(user.AvatarURL); ok {
+		userInfo.AvatarURL = strings.TrimRight(s.Profile.ServerURL, "/") + user.AvatarURL
+	}
 	return userInfo
 }
+
+func convertAccessTokenFromStore(userAccessToken *store.UserSettingAccessToken) *AccessToken {
+	scopes := userAccessToken.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &AccessToken{
+		ID:           userAccessToken.ID,
+		Description:  userAccessToken.Description,
+		Scopes:       scopes,
+		CreatedTime:  userAccessToken.CreatedTs,
+		LastUsedTime: userAccessToken.LastUsedTs,
+		ExpiresTime:  userAccessToken.ExpiresTs,
+	}
+}
+
+func convertAccountDeletionFromStore(deletion *store.UserSettingDeletion) *AccountDeletion {
+	return &AccountDeletion{
+		RequestedTime: deletion.RequestedTs,
+		PurgeTime:     deletion.PurgeTs,
+	}
+}
@@ -0,0 +1,276 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+
+	"itsfriday/store"
+)
+
+// user setting service: typed preferences of the user, defaults are returned for the unset ones
+
+type UserSettingServiceServer interface {
+	GetUserSettings(echo.Context) error
+	UpdateUserSettings(echo.Context) error
+}
+
+type UserSettings struct {
+	// Locale is a BCP 47 language tag, e.g. ko-KR.
+	Locale string `json:"locale"`
+	// Timezone is an IANA timezone, e.g. Asia/Seoul.
+	Timezone string `json:"timezone"`
+	// Currency is an ISO 4217 currency code, e.g. KRW.
+	Currency   string                         `json:"currency"`
+	WeekStart  store.WeekStart                `json:"weekStart"`
+	Appearance store.Appearance               `json:"appearance"`
+	HomeLayout []*store.UserSettingHomeWidget `json:"homeLayout"`
+}
+
+// UpdateUserSettingsRequest updates the given settings only, unknown settings are rejected.
+type UpdateUserSettingsRequest struct {
+	Locale     *string                        `json:"locale"`
+	Timezone   *string                        `json:"timezone"`
+	Currency   *string                        `json:"currency"`
+	WeekStart  *store.WeekStart               `json:"weekStart"`
+	Appearance *store.Appearance              `json:"appearance"`
+	HomeLayout []*store.UserSettingHomeWidget `json:"homeLayout"`
+}
+
+func (s *APIV1Service) GetUserSettings(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	userSettings, err := s.getUserSettings(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user settings: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, userSettings)
+}
+
+func (s *APIV1Service) UpdateUserSettings(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+
+	request := &UpdateUserSettingsRequest{}
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid request: %v", err),
+		})
+	}
+
+	// validate every setting before storing any of them
+	update := []*store.UserSetting{}
+	if v := request.Locale; v != nil {
+		locale, err := parseLocale(*v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: err.Error(),
+			})
+		}
+		update = append(update, &store.UserSetting{Key: store.UserSettingKey_LOCALE, Value: locale})
+	}
+	if v := request.Timezone; v != nil {
+		timezone, err := parseTimezone(*v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: err.Error(),
+			})
+		}
+		update = append(update, &store.UserSetting{Key: store.UserSettingKey_TIMEZONE, Value: timezone})
+	}
+	if v := request.Currency; v != nil {
+		unit, err := currency.ParseISO(strings.ToUpper(strings.TrimSpace(*v)))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid currency %q, an ISO 4217 code is expected", *v),
+			})
+		}
+		update = append(update, &store.UserSetting{Key: store.UserSettingKey_CURRENCY, Value: unit.String()})
+	}
+	if v := request.WeekStart; v != nil {
+		if !slices.Contains([]store.WeekStart{store.WeekStartMonday, store.WeekStartSunday, store.WeekStartSaturday}, *v) {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid week start %q, one of MONDAY, SUNDAY and SATURDAY is expected", *v),
+			})
+		}
+		update = append(update, &store.UserSetting{Key: store.UserSettingKey_WEEK_START, Value: string(*v)})
+	}
+	if v := request.Appearance; v != nil {
+		if !slices.Contains([]store.Appearance{store.AppearanceSystem, store.AppearanceLight, store.AppearanceDark}, *v) {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid appearance %q, one of SYSTEM, LIGHT and DARK is expected", *v),
+			})
+		}
+		update = append(update, &store.UserSetting{Key: store.UserSettingKey_APPEARANCE, Value: string(*v)})
+	}
+	if v := request.HomeLayout; v != nil {
+		if err := validateHomeLayout(v); err != nil {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: err.Error(),
+			})
+		}
+		value, err := store.ConvertUserSettingValueToString(&store.UserSettingHomeLayout{Widgets: v})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to convert user setting to string: %v", err),
+			})
+		}
+		update = append(update, &store.UserSetting{Key: store.UserSettingKey_HOME_LAYOUT, Value: value})
+	}
+
+	for _, userSetting := range update {
+		userSetting.UserID = userID
+		if _, err := s.Store.UpsertUserSetting(ctx, userSetting); err != nil {
+			return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+				Code:    Internal,
+				Message: fmt.Sprintf("failed to upsert user setting: %v", err),
+			})
+		}
+	}
+
+	userSettings, err := s.getUserSettings(ctx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get user settings: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, userSettings)
+}
+
+// getUserSettings reads the settings of the user, the unset ones fall back to the defaults.
+func (s *APIV1Service) getUserSettings(ctx context.Context, userID int32) (*UserSettings, error) {
+	generalSetting, err := s.Store.GetWorkspaceGeneralSetting(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userSettings := &UserSettings{
+		Locale:     generalSetting.DefaultLocale,
+		Timezone:   store.DefaultTimezone,
+		Currency:   store.DefaultCurrency,
+		WeekStart:  store.DefaultWeekStart,
+		Appearance: store.DefaultAppearance,
+		HomeLayout: store.DefaultHomeLayout().Widgets,
+	}
+
+	list, err := s.Store.ListUserSettings(ctx, &store.FindUserSetting{
+		UserID: &userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, userSetting := range list {
+		switch userSetting.Key {
+		case store.UserSettingKey_LOCALE:
+			if userSetting.Value != "" {
+				userSettings.Locale = userSetting.Value
+			}
+		case store.UserSettingKey_TIMEZONE:
+			userSettings.Timezone = userSetting.Value
+		case store.UserSettingKey_CURRENCY:
+			userSettings.Currency = userSetting.Value
+		case store.UserSettingKey_WEEK_START:
+			userSettings.WeekStart = store.WeekStart(userSetting.Value)
+		case store.UserSettingKey_APPEARANCE:
+			userSettings.Appearance = store.Appearance(userSetting.Value)
+		case store.UserSettingKey_HOME_LAYOUT:
+			homeLayout, err := userSetting.GetHomeLayout()
+			if err != nil {
+				return nil, err
+			}
+			userSettings.HomeLayout = completeHomeLayout(homeLayout.Widgets)
+		}
+	}
+	return userSettings, nil
+}
+
+func parseLocale(locale string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(locale))
+	if err != nil || tag == language.Und {
+		return "", fmt.Errorf("invalid locale %q, a BCP 47 language tag is expected", locale)
+	}
+	return tag.String(), nil
+}
+
+func parseTimezone(timezone string) (string, error) {
+	timezone = strings.TrimSpace(timezone)
+	// LoadLocation takes "" as UTC and "Local" as the timezone of the server
+	if timezone == "" || timezone == "Local" {
+		return "", fmt.Errorf("invalid timezone %q, an IANA timezone is expected", timezone)
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return "", fmt.Errorf("invalid timezone %q, an IANA timezone is expected", timezone)
+	}
+	return timezone, nil
+}
+
+func validateHomeLayout(widgets []*store.UserSettingHomeWidget) error {
+	seen := map[string]bool{}
+	for _, widget := range widgets {
+		if widget == nil {
+			return errors.New("invalid home layout, a widget is empty")
+		}
+		if !slices.Contains(store.HomeWidgets, widget.Widget) {
+			return fmt.Errorf("invalid home layout, unknown widget %q", widget.Widget)
+		}
+		if seen[widget.Widget] {
+			return fmt.Errorf("invalid home layout, duplicated widget %q", widget.Widget)
+		}
+		seen[widget.Widget] = true
+	}
+	return nil
+}
+
+// completeHomeLayout drops the widgets that no longer exist and appends the ones added after the layout was saved.
+func completeHomeLayout(widgets []*store.UserSettingHomeWidget) []*store.UserSettingHomeWidget {
+	list := []*store.UserSettingHomeWidget{}
+	seen := map[string]bool{}
+	for _, widget := range widgets {
+		if widget == nil || seen[widget.Widget] || !slices.Contains(store.HomeWidgets, widget.Widget) {
+			continue
+		}
+		seen[widget.Widget] = true
+		list = append(list, widget)
+	}
+	for _, widget := range store.HomeWidgets {
+		if !seen[widget] {
+			list = append(list, &store.UserSettingHomeWidget{Widget: widget, Visible: true})
+		}
+	}
+	return list
+}
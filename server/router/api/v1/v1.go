@@ -1,28 +1,53 @@
 package v1
 
 import (
+	"sync"
+
     "github.com/labstack/echo/v4"
 
+	"itsfriday/server/blobstore"
+	"itsfriday/server/keyring"
+	"itsfriday/server/mailer"
 	"itsfriday/server/profile"
 	"itsfriday/store"
 )
 
 type APIV1Service struct {
-    Secret  string
-	Profile *profile.Profile
-	Store   *store.Store
+	Keyring   *keyring.Keyring
+	Mailer    mailer.Mailer
+	BlobStore blobstore.BlobStore
+	Profile   *profile.Profile
+	Store     *store.Store
+
+	// exportMutex serializes the updates of the exports of the users.
+	exportMutex sync.Mutex
 }
 
-func NewAPIV1Service(secret string, profile *profile.Profile, store *store.Store, echoServer *echo.Echo) *APIV1Service {
+func NewAPIV1Service(keyring *keyring.Keyring, mailer mailer.Mailer, blobStore blobstore.BlobStore, profile *profile.Profile, store *store.Store, echoServer *echo.Echo) *APIV1Service {
     apiv1Service := &APIV1Service{
-		Secret:     secret,
+		Keyring:    keyring,
+		Mailer:     mailer,
+		BlobStore:  blobStore,
 		Profile:    profile,
 		Store:      store,
 	}
 
 	group := echoServer.Group("/v1")
 	RegisterAuthServiceHandler(group, apiv1Service)
+	RegisterCSRFServiceHandler(group, apiv1Service)
 	RegisterUserServiceHandler(group, apiv1Service)
+	RegisterAvatarServiceHandler(group, apiv1Service)
+	RegisterTwoFactorServiceHandler(group, apiv1Service)
+	RegisterPasskeyServiceHandler(group, apiv1Service)
+	RegisterSessionServiceHandler(group, apiv1Service)
+	RegisterUserSettingServiceHandler(group, apiv1Service)
+	RegisterExportServiceHandler(group, apiv1Service)
+	RegisterImportServiceHandler(group, apiv1Service)
+	RegisterAccountServiceHandler(group, apiv1Service)
+	RegisterAdminServiceHandler(group, apiv1Service)
+	RegisterAuditLogServiceHandler(group, apiv1Service)
+	RegisterWorkspaceServiceHandler(group, apiv1Service)
+	RegisterIdentityProviderServiceHandler(group, apiv1Service)
 	RegisterLibroServiceHandler(group, apiv1Service)
 	RegisterDineroServiceHandler(group, apiv1Service)
 	RegisterFitnessServiceHandler(group, apiv1Service)
@@ -35,12 +60,116 @@ func RegisterAuthServiceHandler(group *echo.Group, srv AuthServiceServer) {
     group.POST("/user/signup", srv.SignUp)
 	group.POST("/user/login", srv.Login)
 	group.POST("/user/logout", srv.Logout)
+	group.POST("/auth/refresh", srv.RefreshToken)
+}
+
+func RegisterCSRFServiceHandler(group *echo.Group, srv CSRFServiceServer) {
+	group.GET("/auth/csrf-token", srv.GetCSRFToken)
 }
 
 func RegisterUserServiceHandler(group *echo.Group, srv UserServiceServer) {
 	group.GET("/user/profile", srv.ProfileUser)
 	group.PUT("/user/update-user", srv.UpdateUser)
 	group.DELETE("/user/delete-user", srv.DeleteUser)
+
+	group.GET("/user/access-tokens", srv.ListAccessTokens)
+	group.POST("/user/access-tokens", srv.CreateAccessToken)
+	group.DELETE("/user/access-tokens/:id", srv.DeleteAccessToken)
+}
+
+func RegisterAvatarServiceHandler(group *echo.Group, srv AvatarServiceServer) {
+	group.PUT("/user/avatar", srv.UploadAvatar)
+	group.DELETE("/user/avatar", srv.DeleteAvatar)
+	group.GET("/avatars/:id/:name", srv.GetAvatar)
+}
+
+func RegisterTwoFactorServiceHandler(group *echo.Group, srv TwoFactorServiceServer) {
+	group.POST("/user/2fa/enroll", srv.EnrollTwoFactor)
+	group.POST("/user/2fa/verify", srv.VerifyTwoFactor)
+	group.POST("/user/2fa/disable", srv.DisableTwoFactor)
+	group.POST("/user/login/2fa", srv.LoginTwoFactor)
+}
+
+func RegisterPasskeyServiceHandler(group *echo.Group, srv PasskeyServiceServer) {
+	group.POST("/user/passkeys/register/begin", srv.BeginPasskeyRegistration)
+	group.POST("/user/passkeys/register/finish", srv.FinishPasskeyRegistration)
+	group.GET("/user/passkeys", srv.ListPasskeys)
+	group.PUT("/user/passkeys/:id", srv.UpdatePasskey)
+	group.DELETE("/user/passkeys/:id", srv.DeletePasskey)
+	group.POST("/user/login/passkey/begin", srv.BeginPasskeyLogin)
+	group.POST("/user/login/passkey/finish", srv.FinishPasskeyLogin)
+}
+
+func RegisterSessionServiceHandler(group *echo.Group, srv SessionServiceServer) {
+	group.GET("/user/sessions", srv.ListSessions)
+	group.DELETE("/user/sessions/:id", srv.RevokeSession)
+	group.POST("/user/sessions/revoke-others", srv.RevokeOtherSessions)
+}
+
+func RegisterUserSettingServiceHandler(group *echo.Group, srv UserSettingServiceServer) {
+	group.GET("/user/settings", srv.GetUserSettings)
+	group.PUT("/user/settings", srv.UpdateUserSettings)
+}
+
+func RegisterExportServiceHandler(group *echo.Group, srv ExportServiceServer) {
+	group.POST("/user/export", srv.CreateExport)
+	group.GET("/user/export", srv.ListExports)
+	group.GET("/user/export/:id", srv.GetExport)
+	group.GET("/user/export/:id/download", srv.DownloadExport)
+}
+
+func RegisterImportServiceHandler(group *echo.Group, srv ImportServiceServer) {
+	group.POST("/user/import", srv.ImportArchive)
+}
+
+func RegisterAccountServiceHandler(group *echo.Group, srv AccountServiceServer) {
+	group.POST("/auth/email/verify", srv.VerifyEmail)
+	group.POST("/user/email/verification", srv.SendEmailVerification)
+	group.POST("/auth/password/forgot", srv.ForgotPassword)
+	group.POST("/auth/password/reset", srv.ResetPassword)
+	group.POST("/auth/account/restore", srv.RestoreAccount)
+}
+
+func RegisterAdminServiceHandler(group *echo.Group, srv AdminServiceServer) {
+	group.GET("/admin/users", srv.ListUsers)
+	group.GET("/admin/users/:id", srv.GetUser)
+	group.POST("/admin/users/:id/archive", srv.ArchiveUser)
+	group.POST("/admin/users/:id/unarchive", srv.UnarchiveUser)
+	group.PUT("/admin/users/:id/role", srv.UpdateUserRole)
+	group.POST("/admin/users/:id/logout", srv.LogoutUser)
+
+	group.GET("/admin/login-attempts", srv.ListLoginAttempts)
+	group.POST("/admin/login-attempts/unlock", srv.UnlockLogin)
+}
+
+func RegisterAuditLogServiceHandler(group *echo.Group, srv AuditLogServiceServer) {
+	group.GET("/user/audit-log", srv.ListUserAuditLogs)
+	group.GET("/admin/audit-log", srv.ListAuditLogs)
+}
+
+func RegisterWorkspaceServiceHandler(group *echo.Group, srv WorkspaceServiceServer) {
+	group.GET("/workspace/profile", srv.GetWorkspaceProfile)
+	group.GET("/admin/workspace/setting", srv.GetWorkspaceSetting)
+	group.PUT("/admin/workspace/setting", srv.UpdateWorkspaceSetting)
+
+	group.GET("/admin/workspace/invite-codes", srv.ListInviteCodes)
+	group.POST("/admin/workspace/invite-codes", srv.CreateInviteCode)
+	group.DELETE("/admin/workspace/invite-codes/:code", srv.DeleteInviteCode)
+}
+
+func RegisterIdentityProviderServiceHandler(group *echo.Group, srv IdentityProviderServiceServer) {
+	group.GET("/admin/idps", srv.ListIdentityProviders)
+	group.POST("/admin/idps", srv.CreateIdentityProvider)
+	group.PUT("/admin/idps/:id", srv.UpdateIdentityProvider)
+	group.DELETE("/admin/idps/:id", srv.DeleteIdentityProvider)
+
+	group.GET("/auth/idps", srv.ListSignInIdentityProviders)
+	group.GET("/auth/idps/:id/authorize", srv.AuthorizeIdentityProvider) // ?redirect=/dashboard
+	group.GET("/auth/idps/:id/callback", srv.IdentityProviderCallback)
+
+	group.GET("/user/idps", srv.ListUserIdentities)
+	group.GET("/user/idps/:id/link", srv.LinkIdentityProvider)
+	group.DELETE("/user/idps/:id", srv.UnlinkIdentityProvider)
 }
 
 func RegisterLibroServiceHandler(group *echo.Group, srv LibroServiceServer) {
@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"itsfriday/server/keyring"
+	"itsfriday/server/mailer"
+	"itsfriday/server/profile"
+	"itsfriday/store"
+	"itsfriday/store/db/memory"
+)
+
+// testMailer keeps the sent mails for the test to receive.
+type testMailer struct {
+	messages chan *mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, message *mailer.Message) error {
+	select {
+	case m.messages <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receive waits for the next mail, the service sends them in the background.
+func (m *testMailer) receive(t *testing.T) *mailer.Message {
+	t.Helper()
+	select {
+	case message := <-m.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail was sent")
+		return nil
+	}
+}
+
+// newTestService returns a service on the in-memory driver with a keyring in a temporary data directory.
+// The mails are kept by a testMailer.
+func newTestService(t *testing.T) *APIV1Service {
+	t.Helper()
+	profile := &profile.Profile{
+		Mode:        "dev",
+		Data:        t.TempDir(),
+		Driver:      "memory",
+		Secret:      "test-secret",
+		InstanceURL: "http://localhost:4321",
+		ServerURL:   "http://localhost:8088",
+	}
+	keyring, err := keyring.Load(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &APIV1Service{
+		Keyring: keyring,
+		Mailer:  &testMailer{messages: make(chan *mailer.Message, 16)},
+		Profile: profile,
+		Store:   store.New(memory.NewDB(), profile),
+	}
+}
+
+// createTestUser creates a user who signs in with the password.
+func createTestUser(t *testing.T, s *APIV1Service, username string, password string) *store.User {
+	t.Helper()
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.Store.CreateUser(context.Background(), &store.User{
+		Username:     username,
+		Role:         store.RoleUser,
+		Email:        username + "@example.com",
+		Nickname:     username,
+		PasswordHash: string(passwordHash),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// callHandler calls the handler with the request as JSON, on behalf of the user unless userID is zero.
+func callHandler(t *testing.T, handler echo.HandlerFunc, method string, target string, request any, userID int32) *httptest.ResponseRecorder {
+	t.Helper()
+	return callHandlerWithID(t, handler, method, target, "", request, userID)
+}
+
+// callHandlerWithID is callHandler on a route with the id path parameter, like /v1/books/:id.
+func callHandlerWithID(t *testing.T, handler echo.HandlerFunc, method string, target string, id string, request any, userID int32) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	if request != nil {
+		if err := json.NewEncoder(&body).Encode(request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if id != "" {
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+	}
+	if userID != InvalidUserID {
+		c.Set(useridContextKey, userID)
+	}
+	if err := handler(c); err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	return rec
+}
+
+// decodeResponse decodes the JSON response into v and fails unless the status is the wanted one.
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status is %d, want %d: %s", rec.Code, status, rec.Body.String())
+	}
+	if v == nil {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode %s: %v", rec.Body.String(), err)
+	}
+}
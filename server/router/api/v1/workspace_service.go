@@ -0,0 +1,388 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"itsfriday/internal/clock"
+	"itsfriday/store"
+)
+
+// workspace service: instance-level settings
+
+const inviteCodeLength = 12
+
+var errInviteCodeNotFound = errors.New("invite code not found")
+
+type WorkspaceServiceServer interface {
+	GetWorkspaceProfile(echo.Context) error
+	GetWorkspaceSetting(echo.Context) error
+	UpdateWorkspaceSetting(echo.Context) error
+
+	ListInviteCodes(echo.Context) error
+	CreateInviteCode(echo.Context) error
+	DeleteInviteCode(echo.Context) error
+}
+
+// WorkspaceProfile is what the web app needs before anyone signs in.
+type WorkspaceProfile struct {
+	Version             string   `json:"version"`
+	InstanceName        string   `json:"instanceName"`
+	DefaultLocale       string   `json:"defaultLocale"`
+	DisallowSignUp      bool     `json:"disallowSignUp"`
+	InviteOnly          bool     `json:"inviteOnly"`
+	AllowedEmailDomains []string `json:"allowedEmailDomains"`
+}
+
+type WorkspaceSetting struct {
+	InstanceName        string   `json:"instanceName"`
+	DefaultLocale       string   `json:"defaultLocale"`
+	DisallowSignUp      bool     `json:"disallowSignUp"`
+	InviteOnly          bool     `json:"inviteOnly"`
+	AllowedEmailDomains []string `json:"allowedEmailDomains"`
+}
+
+type CreateInviteCodeRequest struct {
+	Description     string `json:"description"`
+	// MaxUses is the number of signups the code allows, zero for unlimited.
+	MaxUses         int32  `json:"maxUses"`
+	// ExpiresTime is a unix timestamp, zero for a code that never expires.
+	ExpiresTime     int64  `json:"expiresTime"`
+}
+
+type InviteCode struct {
+	Code            string `json:"code"`
+	Description     string `json:"description"`
+	MaxUses         int32  `json:"maxUses"`
+	Uses            int32  `json:"uses"`
+	CreatorID       int32  `json:"creatorId"`
+	CreatedTime     int64  `json:"createdTime"`
+	ExpiresTime     int64  `json:"expiresTime"`
+}
+
+type InviteCodes struct {
+	InviteCodes     []*InviteCode `json:"inviteCodes"`
+}
+
+func (s *APIV1Service) GetWorkspaceProfile(c echo.Context) error {
+	ctx := c.Request().Context()
+	generalSetting, err := s.Store.GetWorkspaceGeneralSetting(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get workspace setting: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, &WorkspaceProfile{
+		Version:             s.Profile.Version,
+		InstanceName:        generalSetting.InstanceName,
+		DefaultLocale:       generalSetting.DefaultLocale,
+		DisallowSignUp:      generalSetting.DisallowSignUp,
+		InviteOnly:          generalSetting.InviteOnly,
+		AllowedEmailDomains: generalSetting.AllowedEmailDomains,
+	})
+}
+
+func (s *APIV1Service) GetWorkspaceSetting(c echo.Context) error {
+	ctx := c.Request().Context()
+	generalSetting, err := s.Store.GetWorkspaceGeneralSetting(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get workspace setting: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, convertWorkspaceSettingFromStore(generalSetting))
+}
+
+func (s *APIV1Service) UpdateWorkspaceSetting(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(WorkspaceSetting)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid workspace setting request: %v", err),
+		})
+	}
+
+	generalSetting := &store.WorkspaceGeneralSetting{
+		InstanceName:        strings.TrimSpace(request.InstanceName),
+		DefaultLocale:       strings.TrimSpace(request.DefaultLocale),
+		DisallowSignUp:      request.DisallowSignUp,
+		InviteOnly:          request.InviteOnly,
+		AllowedEmailDomains: []string{},
+	}
+	for _, domain := range request.AllowedEmailDomains {
+		domain = normalizeEmailDomain(domain)
+		if domain == "" || strings.ContainsAny(domain, "@ ") {
+			return c.JSON(http.StatusBadRequest, &ErrorResponse{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("invalid email domain: %q", domain),
+			})
+		}
+		if !slices.Contains(generalSetting.AllowedEmailDomains, domain) {
+			generalSetting.AllowedEmailDomains = append(generalSetting.AllowedEmailDomains, domain)
+		}
+	}
+
+	value, err := store.ConvertUserSettingValueToString(generalSetting)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to marshal workspace setting: %v", err),
+		})
+	}
+	if _, err := s.Store.UpsertWorkspaceSetting(ctx, &store.WorkspaceSetting{
+		Key:   store.WorkspaceSettingKey_GENERAL,
+		Value: value,
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to update workspace setting: %v", err),
+		})
+	}
+
+	updatedSetting, err := s.Store.GetWorkspaceGeneralSetting(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get workspace setting: %v", err),
+		})
+	}
+	return c.JSON(http.StatusOK, convertWorkspaceSettingFromStore(updatedSetting))
+}
+
+func (s *APIV1Service) ListInviteCodes(c echo.Context) error {
+	ctx := c.Request().Context()
+	inviteCodes, err := s.Store.GetWorkspaceInviteCodes(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get invite codes: %v", err),
+		})
+	}
+
+	response := &InviteCodes{
+		InviteCodes: make([]*InviteCode, 0, len(inviteCodes)),
+	}
+	for _, inviteCode := range inviteCodes {
+		response.InviteCodes = append(response.InviteCodes, convertInviteCodeFromStore(inviteCode))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (s *APIV1Service) CreateInviteCode(c echo.Context) error {
+	ctx := c.Request().Context()
+	request := new(CreateInviteCodeRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("invalid create invite code request: %v", err),
+		})
+	}
+	userID, ok := c.Get(useridContextKey).(int32)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "failed to get userid from access token",
+		})
+	}
+	now := time.Now().Unix()
+	if request.MaxUses < 0 {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "max uses should not be negative",
+		})
+	}
+	if request.ExpiresTime != 0 && request.ExpiresTime <= now {
+		return c.JSON(http.StatusBadRequest, &ErrorResponse{
+			Code:    InvalidRequest,
+			Message: "expires time should be in the future",
+		})
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to generate invite code: %v", err),
+		})
+	}
+	inviteCode := &store.WorkspaceInviteCode{
+		Code:        code,
+		Description: request.Description,
+		MaxUses:     request.MaxUses,
+		CreatorID:   userID,
+		CreatedTs:   now,
+		ExpiresTs:   request.ExpiresTime,
+	}
+	if err := s.Store.UpdateWorkspaceInviteCodes(ctx, func(inviteCodes []*store.WorkspaceInviteCode) ([]*store.WorkspaceInviteCode, error) {
+		return append(inviteCodes, inviteCode), nil
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to save invite code: %v", err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, convertInviteCodeFromStore(inviteCode))
+}
+
+func (s *APIV1Service) DeleteInviteCode(c echo.Context) error {
+	ctx := c.Request().Context()
+	code := c.Param("code")
+	err := s.Store.UpdateWorkspaceInviteCodes(ctx, func(inviteCodes []*store.WorkspaceInviteCode) ([]*store.WorkspaceInviteCode, error) {
+		updatedInviteCodes := make([]*store.WorkspaceInviteCode, 0, len(inviteCodes))
+		for _, inviteCode := range inviteCodes {
+			if inviteCode.Code != code {
+				updatedInviteCodes = append(updatedInviteCodes, inviteCode)
+			}
+		}
+		if len(updatedInviteCodes) == len(inviteCodes) {
+			return nil, errInviteCodeNotFound
+		}
+		return updatedInviteCodes, nil
+	})
+	if errors.Is(err, errInviteCodeNotFound) {
+		return c.JSON(http.StatusNotFound, &ErrorResponse{
+			Code:    NotFound,
+			Message: "invite code not found",
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to delete invite code: %v", err),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkSignUpAllowed applies the workspace setting to a signup, the first user of the instance is always allowed.
+// An invite code is used up at once, it returns the code to be given back by releaseInviteCode if the user is not created.
+func (s *APIV1Service) checkSignUpAllowed(ctx context.Context, request *SignUpRequest) (string, int, *ErrorResponse) {
+	generalSetting, err := s.Store.GetWorkspaceGeneralSetting(ctx)
+	if err != nil {
+		return "", http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to get workspace setting: %v", err),
+		}
+	}
+
+	if generalSetting.DisallowSignUp {
+		return "", http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+			Message: "signup is disabled",
+		}
+	}
+	if len(generalSetting.AllowedEmailDomains) > 0 {
+		_, domain, found := strings.Cut(request.Email, "@")
+		if !found || !slices.Contains(generalSetting.AllowedEmailDomains, normalizeEmailDomain(domain)) {
+			return "", http.StatusForbidden, &ErrorResponse{
+				Code:    PermissionDenied,
+				Message: fmt.Sprintf("signup is limited to emails of %s", strings.Join(generalSetting.AllowedEmailDomains, ", ")),
+			}
+		}
+	}
+	if !generalSetting.InviteOnly {
+		return "", 0, nil
+	}
+
+	now := clock.FromContext(ctx).Now().Unix()
+	err = s.Store.UpdateWorkspaceInviteCodes(ctx, func(inviteCodes []*store.WorkspaceInviteCode) ([]*store.WorkspaceInviteCode, error) {
+		for _, inviteCode := range inviteCodes {
+			if request.InviteCode != "" && inviteCode.Code == request.InviteCode && inviteCode.IsUsable(now) {
+				inviteCode.Uses++
+				return inviteCodes, nil
+			}
+		}
+		return nil, errInviteCodeNotFound
+	})
+	if errors.Is(err, errInviteCodeNotFound) {
+		return "", http.StatusForbidden, &ErrorResponse{
+			Code:    PermissionDenied,
+			Message: "a valid invite code is required to sign up",
+		}
+	}
+	if err != nil {
+		return "", http.StatusInternalServerError, &ErrorResponse{
+			Code:    Internal,
+			Message: fmt.Sprintf("failed to use invite code: %v", err),
+		}
+	}
+	return request.InviteCode, 0, nil
+}
+
+// releaseInviteCode gives back the use of an invite code by a signup which failed.
+func (s *APIV1Service) releaseInviteCode(ctx context.Context, code string) error {
+	return s.Store.UpdateWorkspaceInviteCodes(ctx, func(inviteCodes []*store.WorkspaceInviteCode) ([]*store.WorkspaceInviteCode, error) {
+		for _, inviteCode := range inviteCodes {
+			if inviteCode.Code == code && inviteCode.Uses > 0 {
+				inviteCode.Uses--
+			}
+		}
+		return inviteCodes, nil
+	})
+}
+
+// setDefaultLocale gives a new user the default locale of the workspace.
+func (s *APIV1Service) setDefaultLocale(ctx context.Context, userID int32) error {
+	generalSetting, err := s.Store.GetWorkspaceGeneralSetting(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Store.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: userID,
+		Key:    store.UserSettingKey_LOCALE,
+		Value:  generalSetting.DefaultLocale,
+	}); err != nil {
+		return fmt.Errorf("failed to upsert user setting: %v", err)
+	}
+	return nil
+}
+
+func generateInviteCode() (string, error) {
+	bytes := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(bytes)[:inviteCodeLength], nil
+}
+
+func normalizeEmailDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+}
+
+func convertWorkspaceSettingFromStore(generalSetting *store.WorkspaceGeneralSetting) *WorkspaceSetting {
+	return &WorkspaceSetting{
+		InstanceName:        generalSetting.InstanceName,
+		DefaultLocale:       generalSetting.DefaultLocale,
+		DisallowSignUp:      generalSetting.DisallowSignUp,
+		InviteOnly:          generalSetting.InviteOnly,
+		AllowedEmailDomains: generalSetting.AllowedEmailDomains,
+	}
+}
+
+func convertInviteCodeFromStore(inviteCode *store.WorkspaceInviteCode) *InviteCode {
+	return &InviteCode{
+		Code:        inviteCode.Code,
+		Description: inviteCode.Description,
+		MaxUses:     inviteCode.MaxUses,
+		Uses:        inviteCode.Uses,
+		CreatorID:   inviteCode.CreatorID,
+		CreatedTime: inviteCode.CreatedTs,
+		ExpiresTime: inviteCode.ExpiresTs,
+	}
+}
@@ -0,0 +1,106 @@
+// Package userpurge purges the accounts whose scheduled deletion is due.
+package userpurge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"itsfriday/internal/archive"
+	"itsfriday/internal/avatar"
+	"itsfriday/server/blobstore"
+	"itsfriday/store"
+)
+
+const runInterval = time.Hour
+
+type Runner struct {
+	Store     *store.Store
+	BlobStore blobstore.BlobStore
+}
+
+func NewRunner(store *store.Store, blobStore blobstore.BlobStore) *Runner {
+	return &Runner{
+		Store:     store,
+		BlobStore: blobStore,
+	}
+}
+
+// Run purges the due accounts every hour until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(runInterval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce purges the accounts whose grace period is over. The ones restored in the meantime are not archived anymore.
+func (r *Runner) RunOnce(ctx context.Context) {
+	list, err := r.Store.ListUserSettings(ctx, &store.FindUserSetting{
+		Key: store.UserSettingKey_DELETION,
+	})
+	if err != nil {
+		slog.Error("failed to list user deletions", "error", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, userSetting := range list {
+		deletion, err := userSetting.GetDeletion()
+		if err != nil {
+			slog.Error("failed to get user deletion", "user", userSetting.UserID, "error", err)
+			continue
+		}
+		if deletion.PurgeTs > now {
+			continue
+		}
+		user, err := r.Store.GetUser(ctx, &store.FindUser{ID: &userSetting.UserID})
+		if err != nil {
+			slog.Error("failed to get user", "user", userSetting.UserID, "error", err)
+			continue
+		}
+		if user == nil {
+			// the deletion of a user who is gone already
+			if err := r.Store.DeleteUserSetting(ctx, &store.DeleteUserSetting{
+				UserID: &userSetting.UserID,
+				Key:    store.UserSettingKey_DELETION,
+			}); err != nil {
+				slog.Error("failed to delete user setting", "user", userSetting.UserID, "error", err)
+			}
+			continue
+		}
+		if user.RowStatus != store.Archived {
+			continue
+		}
+		if err := r.Store.DeleteUser(ctx, &store.DeleteUser{ID: userSetting.UserID}); err != nil {
+			slog.Error("failed to purge user", "user", userSetting.UserID, "error", err)
+			continue
+		}
+		if err := os.RemoveAll(archive.ExportDir(r.Store.Profile.Data, userSetting.UserID)); err != nil {
+			slog.Error("failed to remove the exports of the purged user", "user", userSetting.UserID, "error", err)
+		}
+		if key, ok := avatar.KeyFromURL(user.AvatarURL); ok {
+			if err := r.BlobStore.Delete(ctx, key); err != nil {
+				slog.Error("failed to delete the avatar of the purged user", "user", userSetting.UserID, "error", err)
+			}
+		}
+		if _, err := r.Store.CreateAuditLog(ctx, &store.AuditLog{
+			UserID:  userSetting.UserID,
+			Action:  store.AuditActionAccountPurge,
+			Outcome: store.AuditOutcomeSuccess,
+			Detail:  fmt.Sprintf("deletion requested at %s", time.Unix(deletion.RequestedTs, 0).UTC().Format(time.RFC3339)),
+		}); err != nil {
+			slog.Error("failed to record audit log", "user", userSetting.UserID, "error", err)
+		}
+		slog.Info("user purged", "user", userSetting.UserID)
+	}
+}
@@ -13,16 +13,24 @@ import (
 	echojwt "github.com/labstack/echo-jwt/v4"
 
 	apiv1 "itsfriday/server/router/api/v1"
+	"itsfriday/server/runner/userpurge"
+	"itsfriday/server/blobstore"
+	"itsfriday/server/keyring"
+	"itsfriday/server/mailer"
 	"itsfriday/server/profile"
 	"itsfriday/store"
 )
 
 type Server struct {
-	Secret     string
+	Keyring    *keyring.Keyring
+	Mailer     mailer.Mailer
+	BlobStore  blobstore.BlobStore
 	Profile    *profile.Profile
 	Store      *store.Store
 
 	echoServer *echo.Echo
+	// runnerCancel stops the background runners before the store is closed.
+	runnerCancel context.CancelFunc
 }
 
 func NewServer(ctx context.Context, profile *profile.Profile, store *store.Store) (*Server, error) {
@@ -31,13 +39,34 @@ func NewServer(ctx context.Context, profile *profile.Profile, store *store.Store
 		Profile: profile,
 	}
 
-	secret := "itsfriday"
-	s.Secret = secret
+	keyring, err := keyring.Load(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring: %w", err)
+	}
+	s.Keyring = keyring
+
+	mailer, err := mailer.New(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mailer: %w", err)
+	}
+	s.Mailer = mailer
+
+	blobStore, err := blobstore.New(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob store: %w", err)
+	}
+	s.BlobStore = blobStore
 
 	echoServer := echo.New()
 	echoServer.Debug = true
 	echoServer.HideBanner = true
 	echoServer.HidePort = true
+	ipExtractor, err := newIPExtractor(profile)
+	if err != nil {
+		return nil, err
+	}
+	// c.RealIP() is used for the login limits, the sessions and the audit log, so it must not trust headers of any client.
+	echoServer.IPExtractor = ipExtractor
 	
 	echoServer.Use(middleware.Recover())
 	echoServer.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
@@ -65,10 +94,11 @@ func NewServer(ctx context.Context, profile *profile.Profile, store *store.Store
 	}))
 	echoServer.Use(middleware.CORSWithConfig(middleware.CORSConfig{
         AllowOrigins:     []string{"http://localhost:4321"},
-        AllowMethods:     []string{http.MethodGet, http.MethodPost},
+        AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+        AllowHeaders:     []string{echo.HeaderContentType, echo.HeaderAuthorization, apiv1.CSRFTokenHeaderName},
         AllowCredentials: true,
     }))
-	authHandler := apiv1.NewAuthHandler(store, secret, "user")
+	authHandler := apiv1.NewAuthHandler(store, keyring, "user")
 	echoServer.Use(echojwt.WithConfig(echojwt.Config{
 		ContextKey: authHandler.ContextKey,
 		ContinueOnIgnoredError: true,
@@ -82,11 +112,29 @@ func NewServer(ctx context.Context, profile *profile.Profile, store *store.Store
 		return c.JSON(http.StatusOK, "{\"status\":\"UP\"}")
 	})
 
-	apiv1.NewAPIV1Service(s.Secret, profile, store, echoServer)
+	apiv1.NewAPIV1Service(s.Keyring, s.Mailer, s.BlobStore, profile, store, echoServer)
 
 	return s, nil
 }
 
+// newIPExtractor takes the client IP from the connection, or from X-Forwarded-For when the connection is from a trusted proxy.
+// Private and loopback addresses are not trusted unless configured, a header from any other client could fake every IP.
+func newIPExtractor(profile *profile.Profile) (echo.IPExtractor, error) {
+	trustedProxies, err := profile.TrustedProxyNets()
+	if err != nil {
+		return nil, err
+	}
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, ipNet := range trustedProxies {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	address := fmt.Sprintf("%s:%d", s.Profile.Addr, s.Profile.Port)
 	listener, err := net.Listen("tcp", address)
@@ -94,6 +142,10 @@ func (s *Server) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 
+	runnerCtx, runnerCancel := context.WithCancel(ctx)
+	s.runnerCancel = runnerCancel
+	go userpurge.NewRunner(s.Store, s.BlobStore).Run(runnerCtx)
+
 	go func() {
 		s.echoServer.Listener = listener
 		if err := s.echoServer.Start(address); err != nil {
@@ -107,6 +159,10 @@ func (s *Server) Shutdown(ctx context.Context) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	if s.runnerCancel != nil {
+		s.runnerCancel()
+	}
+
 	// Shutdown echo server.
 	if err := s.echoServer.Shutdown(ctx); err != nil {
 		slog.Error("failed to shutdown server", slog.String("error", err.Error()))
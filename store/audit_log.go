@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+)
+
+type AuditAction string
+
+const (
+	AuditActionLogin          AuditAction = "LOGIN"
+	AuditActionLogout         AuditAction = "LOGOUT"
+	AuditActionPasswordChange AuditAction = "PASSWORD_CHANGE"
+	AuditActionPasswordReset  AuditAction = "PASSWORD_RESET"
+	// AuditActionTokenRevoke is the revocation of sessions, refresh token families or personal access tokens.
+	AuditActionTokenRevoke    AuditAction = "TOKEN_REVOKE"
+	AuditActionAccountDelete  AuditAction = "ACCOUNT_DELETE"
+	AuditActionAccountRestore AuditAction = "ACCOUNT_RESTORE"
+	AuditActionAccountPurge   AuditAction = "ACCOUNT_PURGE"
+	AuditActionPasskeyAdd     AuditAction = "PASSKEY_ADD"
+	AuditActionPasskeyDelete  AuditAction = "PASSKEY_DELETE"
+)
+
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "SUCCESS"
+	AuditOutcomeFailure AuditOutcome = "FAILURE"
+)
+
+// AuditLog is an entry of the security audit log. Entries are only ever appended.
+type AuditLog struct {
+	ID        int32
+	CreatedTs int64
+	// UserID is the account the entry is about, zero when a login names an unknown user.
+	UserID int32
+	// ActorID is the user who acted, e.g. an admin signing out a user. Zero for the server itself.
+	ActorID   int32
+	Action    AuditAction
+	Outcome   AuditOutcome
+	ClientIP  string
+	UserAgent string
+	// Detail tells more about the entry, e.g. why a login failed.
+	Detail string
+}
+
+type FindAuditLog struct {
+	UserID  *int32
+	Action  *AuditAction
+	Outcome *AuditOutcome
+	Limit   *int
+	Offset  *int
+}
+
+func (s *Store) CreateAuditLog(ctx context.Context, create *AuditLog) (*AuditLog, error) {
+	return s.driver.CreateAuditLog(ctx, create)
+}
+
+// ListAuditLogs lists the entries, the latest first.
+func (s *Store) ListAuditLogs(ctx context.Context, find *FindAuditLog) ([]*AuditLog, error) {
+	return s.driver.ListAuditLogs(ctx, find)
+}
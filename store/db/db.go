@@ -6,6 +6,8 @@ import (
 
 	"itsfriday/server/profile"
 	"itsfriday/store"
+	"itsfriday/store/db/mysql"
+	"itsfriday/store/db/postgres"
 	"itsfriday/store/db/sqlite"
 )
 
@@ -16,6 +18,10 @@ func NewDBDriver(profile *profile.Profile) (store.Driver, error) {
 	switch profile.Driver {
 	case "sqlite":
 		driver, err = sqlite.NewDB(profile)
+	case "postgres":
+		driver, err = postgres.NewDB(profile)
+	case "mysql":
+		driver, err = mysql.NewDB(profile)
 	default:
 		return nil, errors.New("unknown db driver")
 	}
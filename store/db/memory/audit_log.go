@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateAuditLog(_ context.Context, create *store.AuditLog) (*store.AuditLog, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	create.ID = d.nextID("audit_log")
+	create.CreatedTs = now()
+	auditLog := *create
+	d.auditLogs = append(d.auditLogs, &auditLog)
+	return create, nil
+}
+
+func (d *DB) ListAuditLogs(_ context.Context, find *store.FindAuditLog) ([]*store.AuditLog, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.AuditLog, 0)
+	// newest first, the ids grow with every entry
+	for i := len(d.auditLogs) - 1; i >= 0; i-- {
+		auditLog := d.auditLogs[i]
+		if v := find.UserID; v != nil && auditLog.UserID != *v {
+			continue
+		}
+		if v := find.Action; v != nil && auditLog.Action != *v {
+			continue
+		}
+		if v := find.Outcome; v != nil && auditLog.Outcome != *v {
+			continue
+		}
+		copied := *auditLog
+		list = append(list, &copied)
+	}
+	return limit(list, find.Limit, find.Offset), nil
+}
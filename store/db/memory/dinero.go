@@ -0,0 +1,232 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateDineroCategory(_ context.Context, create *store.DineroCategory) (*store.DineroCategory, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.findDineroCategory(create.UserID, create.Name) != nil {
+		return nil, uniqueConstraintError("expense_category.user_id, expense_category.name")
+	}
+	if !d.userExists(create.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "expense_category.user_id")
+	}
+	create.ID = d.nextID("expense_category")
+	category := *create
+	d.dineroCategories = append(d.dineroCategories, &category)
+	return create, nil
+}
+
+func (d *DB) ListDineroCategories(_ context.Context, find *store.FindDineroCategory) ([]*store.DineroCategory, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.DineroCategory, 0)
+	for _, category := range d.dineroCategories {
+		if v := find.ID; v != nil && category.ID != *v {
+			continue
+		}
+		if v := find.UserID; v != nil && category.UserID != *v {
+			continue
+		}
+		if v := find.Name; v != nil && category.Name != *v {
+			continue
+		}
+		copied := *category
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Priority < list[j].Priority
+	})
+	return list, nil
+}
+
+func (d *DB) UpdateDineroCategory(_ context.Context, update *store.UpdateDineroCategory) (*store.DineroCategory, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, category := range d.dineroCategories {
+		if category.ID != update.ID {
+			continue
+		}
+		if v := update.Name; v != nil {
+			if other := d.findDineroCategory(category.UserID, *v); other != nil && other.ID != category.ID {
+				return nil, uniqueConstraintError("expense_category.user_id, expense_category.name")
+			}
+			category.Name = *v
+		}
+		if v := update.Priority; v != nil {
+			category.Priority = *v
+		}
+		copied := *category
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (d *DB) DeleteDineroCategory(_ context.Context, delete *store.DeleteDineroCategory) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if slices.ContainsFunc(d.dineroExpenses, func(expense *store.DineroExpense) bool { return expense.CategoryID == delete.ID }) {
+		return foreignKeyError(store.ErrReferenced, "expense.category_id")
+	}
+	d.dineroCategories = remove(d.dineroCategories, func(category *store.DineroCategory) bool {
+		return category.ID == delete.ID
+	})
+	return nil
+}
+
+func (d *DB) dineroCategoryExists(id int32) bool {
+	return slices.ContainsFunc(d.dineroCategories, func(category *store.DineroCategory) bool {
+		return category.ID == id
+	})
+}
+
+func (d *DB) findDineroCategory(userID int32, name string) *store.DineroCategory {
+	for _, category := range d.dineroCategories {
+		if category.UserID == userID && category.Name == name {
+			return category
+		}
+	}
+	return nil
+}
+
+func (d *DB) CreateDineroExpense(_ context.Context, create *store.DineroExpense) (*store.DineroExpense, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.userExists(create.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "expense.user_id")
+	}
+	if !d.dineroCategoryExists(create.CategoryID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "expense.category_id")
+	}
+	create.ID = d.nextID("expense")
+	create.CreatedTs = now()
+	expense := *create
+	d.dineroExpenses = append(d.dineroExpenses, &expense)
+	return create, nil
+}
+
+func (d *DB) ListDineroExpenses(_ context.Context, find *store.FindDineroExpense) ([]*store.DineroExpense, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.DineroExpense, 0)
+	for _, expense := range d.dineroExpenses {
+		if v := find.ID; v != nil && expense.ID != *v {
+			continue
+		}
+		if !matchDineroExpense(expense, find) {
+			continue
+		}
+		copied := *expense
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].DateUsed < list[j].DateUsed
+	})
+	return list, nil
+}
+
+func (d *DB) UpdateDineroExpense(_ context.Context, update *store.UpdateDineroExpense) (*store.DineroExpense, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, expense := range d.dineroExpenses {
+		if expense.ID != update.ID {
+			continue
+		}
+		if v := update.CategoryID; v != nil && !d.dineroCategoryExists(*v) {
+			return nil, foreignKeyError(store.ErrMissingReference, "expense.category_id")
+		}
+		if v := update.CategoryID; v != nil {
+			expense.CategoryID = *v
+		}
+		if v := update.DateUsed; v != nil {
+			expense.DateUsed = *v
+		}
+		if v := update.Item; v != nil {
+			expense.Item = *v
+		}
+		if v := update.Price; v != nil {
+			expense.Price = *v
+		}
+		copied := *expense
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (d *DB) DeleteDineroExpense(_ context.Context, delete *store.DeleteDineroExpense) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.dineroExpenses = remove(d.dineroExpenses, func(expense *store.DineroExpense) bool {
+		return expense.ID == delete.ID
+	})
+	return nil
+}
+
+// GetTotalCostByCategory sums the matching expenses per category, categories without any are left out.
+func (d *DB) GetTotalCostByCategory(_ context.Context, find *store.FindDineroExpense) ([]*store.TotalCostPerCategory, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	categories := make([]*store.DineroCategory, 0)
+	costs := map[int32]int32{}
+	for _, category := range d.dineroCategories {
+		found := false
+		for _, expense := range d.dineroExpenses {
+			if expense.CategoryID != category.ID || !matchDineroExpense(expense, &store.FindDineroExpense{UserID: find.UserID, Year: find.Year, Month: find.Month}) {
+				continue
+			}
+			found = true
+			costs[category.ID] += expense.Price
+		}
+		if found {
+			categories = append(categories, category)
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		return categories[i].Priority < categories[j].Priority
+	})
+
+	list := make([]*store.TotalCostPerCategory, 0, len(categories))
+	for _, category := range categories {
+		list = append(list, &store.TotalCostPerCategory{
+			Name: category.Name,
+			Cost: costs[category.ID],
+		})
+	}
+	return list, nil
+}
+
+// matchDineroExpense filters by user, category and month like the SQL drivers,
+// which compare date_used with the first day of the month and of the month after as text.
+func matchDineroExpense(expense *store.DineroExpense, find *store.FindDineroExpense) bool {
+	if v := find.UserID; v != nil && expense.UserID != *v {
+		return false
+	}
+	if v := find.CategoryID; v != nil && expense.CategoryID != *v {
+		return false
+	}
+	if find.Year != nil && find.Month != nil {
+		start := fmt.Sprintf("%04d-%02d-01", *find.Year, *find.Month)
+		end := fmt.Sprintf("%04d-%02d-01", *find.Year, *find.Month+1)
+		if expense.DateUsed < start || expense.DateUsed >= end {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateEvent(_ context.Context, create *store.Event) (*store.Event, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.userExists(create.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "event.user_id")
+	}
+	create.ID = d.nextID("event")
+	create.CreatedTs = now()
+	event := *create
+	d.events = append(d.events, &event)
+	return create, nil
+}
+
+func (d *DB) ListEvents(_ context.Context, find *store.FindEvent) ([]*store.Event, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.Event, 0)
+	for _, event := range d.events {
+		if v := find.ID; v != nil && event.ID != *v {
+			continue
+		}
+		if v := find.UserID; v != nil && event.UserID != *v {
+			continue
+		}
+		copied := *event
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].StartTs < list[j].StartTs
+	})
+	return list, nil
+}
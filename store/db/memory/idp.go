@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+
+	"itsfriday/store"
+)
+
+// identityProvider keeps the config as JSON like the config column of the SQL drivers,
+// so a listed identity provider never shares its config with the caller.
+type identityProvider struct {
+	store.IdentityProvider
+	config string
+}
+
+func (d *DB) CreateIdentityProvider(_ context.Context, create *store.IdentityProvider) (*store.IdentityProvider, error) {
+	config, err := json.Marshal(create.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	create.ID = d.nextID("idp")
+	create.CreatedTs = now()
+	d.identityProviders = append(d.identityProviders, &identityProvider{
+		IdentityProvider: *create,
+		config:           string(config),
+	})
+	return create, nil
+}
+
+func (d *DB) ListIdentityProviders(_ context.Context, find *store.FindIdentityProvider) ([]*store.IdentityProvider, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.IdentityProvider, 0)
+	for _, idp := range d.identityProviders {
+		if v := find.ID; v != nil && idp.ID != *v {
+			continue
+		}
+		identityProvider, err := idp.convert()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, identityProvider)
+	}
+	return list, nil
+}
+
+func (d *DB) UpdateIdentityProvider(_ context.Context, update *store.UpdateIdentityProvider) (*store.IdentityProvider, error) {
+	if update.Name == nil && update.AutoProvision == nil && update.Config == nil {
+		return nil, errors.New("nothing to update")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, idp := range d.identityProviders {
+		if idp.ID != update.ID {
+			continue
+		}
+		if v := update.Name; v != nil {
+			idp.Name = *v
+		}
+		if v := update.AutoProvision; v != nil {
+			idp.AutoProvision = *v
+		}
+		if v := update.Config; v != nil {
+			config, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			idp.config = string(config)
+		}
+		return idp.convert()
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (d *DB) DeleteIdentityProvider(_ context.Context, delete *store.DeleteIdentityProvider) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.identityProviders = remove(d.identityProviders, func(idp *identityProvider) bool {
+		return idp.ID == delete.ID
+	})
+	// ON DELETE CASCADE
+	d.userIdentities = remove(d.userIdentities, func(userIdentity *store.UserIdentity) bool {
+		return userIdentity.IdpID == delete.ID
+	})
+	return nil
+}
+
+func (d *DB) CreateUserIdentity(_ context.Context, create *store.UserIdentity) (*store.UserIdentity, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, userIdentity := range d.userIdentities {
+		if userIdentity.IdpID == create.IdpID && userIdentity.Subject == create.Subject {
+			return nil, uniqueConstraintError("user_identity.idp_id, user_identity.subject")
+		}
+		if userIdentity.UserID == create.UserID && userIdentity.IdpID == create.IdpID {
+			return nil, uniqueConstraintError("user_identity.user_id, user_identity.idp_id")
+		}
+	}
+	if !d.userExists(create.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "user_identity.user_id")
+	}
+	if !slices.ContainsFunc(d.identityProviders, func(idp *identityProvider) bool { return idp.ID == create.IdpID }) {
+		return nil, foreignKeyError(store.ErrMissingReference, "user_identity.idp_id")
+	}
+	create.CreatedTs = now()
+	userIdentity := *create
+	d.userIdentities = append(d.userIdentities, &userIdentity)
+	return create, nil
+}
+
+func (d *DB) ListUserIdentities(_ context.Context, find *store.FindUserIdentity) ([]*store.UserIdentity, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.UserIdentity, 0)
+	for _, userIdentity := range d.userIdentities {
+		if v := find.UserID; v != nil && userIdentity.UserID != *v {
+			continue
+		}
+		if v := find.IdpID; v != nil && userIdentity.IdpID != *v {
+			continue
+		}
+		if v := find.Subject; v != nil && userIdentity.Subject != *v {
+			continue
+		}
+		copied := *userIdentity
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedTs < list[j].CreatedTs
+	})
+	return list, nil
+}
+
+func (d *DB) DeleteUserIdentity(_ context.Context, delete *store.DeleteUserIdentity) error {
+	if delete.UserID == nil && delete.IdpID == nil {
+		return errors.New("user id or idp id is required")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.userIdentities = remove(d.userIdentities, func(userIdentity *store.UserIdentity) bool {
+		if v := delete.UserID; v != nil && userIdentity.UserID != *v {
+			return false
+		}
+		if v := delete.IdpID; v != nil && userIdentity.IdpID != *v {
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+func (idp *identityProvider) convert() (*store.IdentityProvider, error) {
+	identityProvider := idp.IdentityProvider
+	identityProvider.Config = &store.IdentityProviderConfig{}
+	if err := json.Unmarshal([]byte(idp.config), identityProvider.Config); err != nil {
+		return nil, err
+	}
+	return &identityProvider, nil
+}
@@ -0,0 +1,318 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	"itsfriday/store"
+)
+
+// book
+
+func (d *DB) CreateBook(_ context.Context, create *store.Book) (*store.Book, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.findBook(create.Title, create.Author) != nil {
+		return nil, uniqueConstraintError("book.title, book.author")
+	}
+	if !d.userExists(create.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "book.user_id")
+	}
+	create.ID = d.nextID("book")
+	create.CreatedTs = now()
+	book := *create
+	d.books = append(d.books, &book)
+	return create, nil
+}
+
+func (d *DB) UpdateBook(_ context.Context, update *store.UpdateBook) (*store.Book, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, book := range d.books {
+		if book.ID != update.ID {
+			continue
+		}
+		title, author := book.Title, book.Author
+		if v := update.Title; v != nil {
+			title = *v
+		}
+		if v := update.Author; v != nil {
+			author = *v
+		}
+		if other := d.findBook(title, author); other != nil && other.ID != book.ID {
+			return nil, uniqueConstraintError("book.title, book.author")
+		}
+		if v := update.UserID; v != nil && !d.userExists(*v) {
+			return nil, foreignKeyError(store.ErrMissingReference, "book.user_id")
+		}
+
+		if v := update.UserID; v != nil {
+			book.UserID = *v
+		}
+		book.Title, book.Author = title, author
+		if v := update.Translator; v != nil {
+			book.Translator = *v
+		}
+		if v := update.Pages; v != nil {
+			book.Pages = *v
+		}
+		if v := update.PubYear; v != nil {
+			book.PubYear = *v
+		}
+		if v := update.Genre; v != nil {
+			book.Genre = *v
+		}
+		copied := *book
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (d *DB) ListBooks(_ context.Context, find *store.FindBook) ([]*store.Book, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.Book, 0)
+	for _, book := range d.books {
+		if v := find.ID; v != nil && book.ID != *v {
+			continue
+		}
+		if v := find.UserID; v != nil && book.UserID != *v {
+			continue
+		}
+		if v := find.Title; v != nil && book.Title != *v {
+			continue
+		}
+		if v := find.Author; v != nil && book.Author != *v {
+			continue
+		}
+		copied := *book
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].CreatedTs != list[j].CreatedTs {
+			return list[i].CreatedTs > list[j].CreatedTs
+		}
+		return list[i].ID > list[j].ID
+	})
+	return limit(list, find.Limit, nil), nil
+}
+
+func (d *DB) DeleteBook(_ context.Context, delete *store.DeleteBook) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if slices.ContainsFunc(d.bookReviews, func(bookReview *store.BookReview) bool { return bookReview.BookID == delete.ID }) {
+		return foreignKeyError(store.ErrReferenced, "book_review.book_id")
+	}
+	d.books = remove(d.books, func(book *store.Book) bool {
+		return book.ID == delete.ID
+	})
+	return nil
+}
+
+func (d *DB) bookExists(id int32) bool {
+	return slices.ContainsFunc(d.books, func(book *store.Book) bool {
+		return book.ID == id
+	})
+}
+
+func (d *DB) findBook(title string, author string) *store.Book {
+	for _, book := range d.books {
+		if book.Title == title && book.Author == author {
+			return book
+		}
+	}
+	return nil
+}
+
+// book_review
+
+func (d *DB) CreateBookReview(_ context.Context, create *store.BookReview) (*store.BookReview, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.findBookReview(create.UserID, create.BookID, create.DateRead) != nil {
+		return nil, uniqueConstraintError("book_review.user_id, book_review.book_id, book_review.date_read")
+	}
+	if err := d.checkBookReviewReferences(create.UserID, create.BookID); err != nil {
+		return nil, err
+	}
+	create.ID = d.nextID("book_review")
+	create.CreatedTs = now()
+	bookReview := *create
+	d.bookReviews = append(d.bookReviews, &bookReview)
+	return create, nil
+}
+
+func (d *DB) UpdateBookReview(_ context.Context, update *store.UpdateBookReview) (*store.BookReview, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, bookReview := range d.bookReviews {
+		if bookReview.ID != update.ID {
+			continue
+		}
+		userID, bookID, dateRead := bookReview.UserID, bookReview.BookID, bookReview.DateRead
+		if v := update.UserID; v != nil {
+			userID = *v
+		}
+		if v := update.BookID; v != nil {
+			bookID = *v
+		}
+		if v := update.DateRead; v != nil {
+			dateRead = *v
+		}
+		if other := d.findBookReview(userID, bookID, dateRead); other != nil && other.ID != bookReview.ID {
+			return nil, uniqueConstraintError("book_review.user_id, book_review.book_id, book_review.date_read")
+		}
+		if err := d.checkBookReviewReferences(userID, bookID); err != nil {
+			return nil, err
+		}
+
+		bookReview.UserID, bookReview.BookID, bookReview.DateRead = userID, bookID, dateRead
+		if v := update.Rating; v != nil {
+			bookReview.Rating = *v
+		}
+		if v := update.Review; v != nil {
+			bookReview.Review = *v
+		}
+		copied := *bookReview
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (d *DB) ListBookReviews(_ context.Context, find *store.FindBookReview) ([]*store.BookReview, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.BookReview, 0)
+	for _, bookReview := range d.bookReviews {
+		if v := find.ID; v != nil && bookReview.ID != *v {
+			continue
+		}
+		if v := find.UserID; v != nil && bookReview.UserID != *v {
+			continue
+		}
+		if v := find.BookID; v != nil && bookReview.BookID != *v {
+			continue
+		}
+		if v := find.DateRead; v != nil && bookReview.DateRead != *v {
+			continue
+		}
+		if v := find.Rating; v != nil && bookReview.Rating != *v {
+			continue
+		}
+		copied := *bookReview
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].CreatedTs != list[j].CreatedTs {
+			return list[i].CreatedTs > list[j].CreatedTs
+		}
+		return list[i].ID > list[j].ID
+	})
+	return limit(list, find.Limit, nil), nil
+}
+
+func (d *DB) DeleteBookReview(_ context.Context, delete *store.DeleteBookReview) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.bookReviews = remove(d.bookReviews, func(bookReview *store.BookReview) bool {
+		return bookReview.ID == delete.ID
+	})
+	return nil
+}
+
+func (d *DB) checkBookReviewReferences(userID int32, bookID int32) error {
+	if !d.userExists(userID) {
+		return foreignKeyError(store.ErrMissingReference, "book_review.user_id")
+	}
+	if !d.bookExists(bookID) {
+		return foreignKeyError(store.ErrMissingReference, "book_review.book_id")
+	}
+	return nil
+}
+
+func (d *DB) findBookReview(userID int32, bookID int32, dateRead string) *store.BookReview {
+	for _, bookReview := range d.bookReviews {
+		if bookReview.UserID == userID && bookReview.BookID == bookID && bookReview.DateRead == dateRead {
+			return bookReview
+		}
+	}
+	return nil
+}
+
+func (d *DB) ListBooksReadInYear(_ context.Context, userID int32, year int32) ([]*store.BookRead, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	start := fmt.Sprintf("%04d-01-01", year)
+	end := fmt.Sprintf("%04d-12-31", year)
+	list := make([]*store.BookRead, 0)
+	for _, bookReview := range d.bookReviews {
+		if bookReview.UserID != userID || bookReview.DateRead < start || bookReview.DateRead > end {
+			continue
+		}
+		for _, book := range d.books {
+			if book.ID != bookReview.BookID {
+				continue
+			}
+			list = append(list, &store.BookRead{
+				BookID:     book.ID,
+				ReviewID:   bookReview.ID,
+				Title:      book.Title,
+				Author:     book.Author,
+				Translator: book.Translator,
+				Pages:      book.Pages,
+				PubYear:    book.PubYear,
+				Genre:      book.Genre,
+				DateRead:   bookReview.DateRead,
+				Rating:     bookReview.Rating,
+				Review:     bookReview.Review,
+			})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].DateRead < list[j].DateRead
+	})
+	return list, nil
+}
+
+func (d *DB) ReportBook(_ context.Context, userID int32) ([]*store.ReportBook, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	counts := map[int32]int32{}
+	for _, bookReview := range d.bookReviews {
+		if bookReview.UserID != userID || len(bookReview.DateRead) < 4 {
+			continue
+		}
+		// date_read is YYYY-MM-DD text, the year is its first four characters
+		year, err := strconv.Atoi(bookReview.DateRead[:4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid date read %q: %w", bookReview.DateRead, err)
+		}
+		counts[int32(year)]++
+	}
+
+	list := make([]*store.ReportBook, 0, len(counts))
+	for year, count := range counts {
+		list = append(list, &store.ReportBook{
+			Year:  year,
+			Count: count,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Year < list[j].Year
+	})
+	return list, nil
+}
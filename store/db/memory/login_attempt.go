@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertLoginAttempt(_ context.Context, upsert *store.LoginAttempt) (*store.LoginAttempt, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, loginAttempt := range d.loginAttempts {
+		if loginAttempt.Kind == upsert.Kind && loginAttempt.Subject == upsert.Subject {
+			*loginAttempt = *upsert
+			return upsert, nil
+		}
+	}
+	loginAttempt := *upsert
+	d.loginAttempts = append(d.loginAttempts, &loginAttempt)
+	return upsert, nil
+}
+
+func (d *DB) IncrementLoginAttempt(_ context.Context, increment *store.IncrementLoginAttempt) (*store.LoginAttempt, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var loginAttempt *store.LoginAttempt
+	for _, l := range d.loginAttempts {
+		if l.Kind == increment.Kind && l.Subject == increment.Subject {
+			loginAttempt = l
+			break
+		}
+	}
+	if loginAttempt == nil {
+		loginAttempt = &store.LoginAttempt{Kind: increment.Kind, Subject: increment.Subject}
+		d.loginAttempts = append(d.loginAttempts, loginAttempt)
+	} else if loginAttempt.LastFailedTs < increment.ResetBeforeTs ||
+		(loginAttempt.LockedUntilTs != 0 && loginAttempt.LockedUntilTs <= increment.FailedTs) {
+		loginAttempt.FailedCount = 0
+		loginAttempt.LockedUntilTs = 0
+	}
+
+	loginAttempt.FailedCount++
+	loginAttempt.LastFailedTs = increment.FailedTs
+	if loginAttempt.LockedUntilTs == 0 && loginAttempt.FailedCount >= increment.LockoutAttempts {
+		loginAttempt.LockedUntilTs = increment.LockedUntilTs
+	}
+	copied := *loginAttempt
+	return &copied, nil
+}
+
+func (d *DB) ListLoginAttempts(_ context.Context, find *store.FindLoginAttempt) ([]*store.LoginAttempt, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.LoginAttempt, 0)
+	for _, loginAttempt := range d.loginAttempts {
+		if v := find.Kind; v != nil && loginAttempt.Kind != *v {
+			continue
+		}
+		if v := find.Subject; v != nil && loginAttempt.Subject != *v {
+			continue
+		}
+		if v := find.LockedAfterTs; v != nil && loginAttempt.LockedUntilTs <= *v {
+			continue
+		}
+		copied := *loginAttempt
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].LastFailedTs > list[j].LastFailedTs
+	})
+	return list, nil
+}
+
+func (d *DB) DeleteLoginAttempt(_ context.Context, delete *store.DeleteLoginAttempt) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.loginAttempts = remove(d.loginAttempts, func(loginAttempt *store.LoginAttempt) bool {
+		return loginAttempt.Kind == delete.Kind && loginAttempt.Subject == delete.Subject
+	})
+	return nil
+}
@@ -0,0 +1,85 @@
+// Package memory is a store.Driver which keeps everything in memory, for tests of the handlers.
+// It has no schema to migrate, so the store is used without Migrate.
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"itsfriday/store"
+)
+
+type DB struct {
+	mutex sync.Mutex
+	// sequences are the last ids given per table, ids are not reused like AUTOINCREMENT of sqlite
+	sequences map[string]int32
+
+	migrationHistories []*store.MigrationHistory
+	users              []*store.User
+	userSettings       []*store.UserSetting
+	workspaceSettings  []*store.WorkspaceSetting
+	loginAttempts      []*store.LoginAttempt
+	auditLogs          []*store.AuditLog
+	identityProviders  []*identityProvider
+	userIdentities     []*store.UserIdentity
+	passkeys           []*store.Passkey
+	books              []*store.Book
+	bookReviews        []*store.BookReview
+	dineroCategories   []*store.DineroCategory
+	dineroExpenses     []*store.DineroExpense
+	events             []*store.Event
+}
+
+func NewDB() store.Driver {
+	return &DB{
+		sequences: map[string]int32{},
+	}
+}
+
+// GetDB returns nil, there is no database behind the driver.
+func (*DB) GetDB() *sql.DB {
+	return nil
+}
+
+func (*DB) Close() error {
+	return nil
+}
+
+func (d *DB) nextID(table string) int32 {
+	d.sequences[table]++
+	return d.sequences[table]
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// uniqueConstraintError is the error of a row which would break a unique constraint of the schema.
+func uniqueConstraintError(columns string) error {
+	return fmt.Errorf("UNIQUE constraint failed: %s", columns)
+}
+
+// foreignKeyError is the error of a row which would break a foreign key of the schema,
+// target is store.ErrMissingReference or store.ErrReferenced.
+func foreignKeyError(target error, reference string) error {
+	return fmt.Errorf("%w: FOREIGN KEY constraint failed: %s", target, reference)
+}
+
+// limit applies LIMIT and OFFSET to a list, the offset only counts with a limit like in the SQL drivers.
+func limit[T any](list []T, limit *int, offset *int) []T {
+	if limit == nil {
+		return list
+	}
+	if offset != nil {
+		if *offset >= len(list) {
+			return list[:0]
+		}
+		list = list[*offset:]
+	}
+	if *limit < len(list) {
+		list = list[:*limit]
+	}
+	return list
+}
@@ -0,0 +1,12 @@
+package memory_test
+
+import (
+	"testing"
+
+	"itsfriday/store/db/memory"
+	"itsfriday/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.TestDriver(t, memory.NewDB())
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"itsfriday/store"
+)
+
+func (d *DB) FindMigrationHistoryList(_ context.Context, _ *store.FindMigrationHistory) ([]*store.MigrationHistory, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.MigrationHistory, 0)
+	for _, migrationHistory := range d.migrationHistories {
+		copied := *migrationHistory
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedTs > list[j].CreatedTs
+	})
+	return list, nil
+}
+
+func (d *DB) UpsertMigrationHistory(_ context.Context, upsert *store.UpsertMigrationHistory) (*store.MigrationHistory, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, migrationHistory := range d.migrationHistories {
+		if migrationHistory.Version == upsert.Version {
+			copied := *migrationHistory
+			return &copied, nil
+		}
+	}
+	migrationHistory := &store.MigrationHistory{
+		Version:   upsert.Version,
+		CreatedTs: now(),
+	}
+	d.migrationHistories = append(d.migrationHistories, migrationHistory)
+	copied := *migrationHistory
+	return &copied, nil
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreatePasskey(_ context.Context, create *store.Passkey) (*store.Passkey, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, passkey := range d.passkeys {
+		if bytes.Equal(passkey.CredentialID, create.CredentialID) {
+			return nil, uniqueConstraintError("passkey.credential_id")
+		}
+	}
+	if !d.userExists(create.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "passkey.user_id")
+	}
+	create.ID = d.nextID("passkey")
+	create.CreatedTs = now()
+	create.LastUsedTs = 0
+	d.passkeys = append(d.passkeys, copyPasskey(create))
+	return create, nil
+}
+
+func (d *DB) UpdatePasskey(_ context.Context, update *store.UpdatePasskey) (*store.Passkey, error) {
+	if update.Name == nil && update.SignCount == nil && update.BackupState == nil && update.LastUsedTs == nil {
+		return nil, errors.New("nothing to update")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, passkey := range d.passkeys {
+		if passkey.ID != update.ID {
+			continue
+		}
+		if v := update.Name; v != nil {
+			passkey.Name = *v
+		}
+		if v := update.SignCount; v != nil {
+			passkey.SignCount = *v
+		}
+		if v := update.BackupState; v != nil {
+			passkey.BackupState = *v
+		}
+		if v := update.LastUsedTs; v != nil {
+			passkey.LastUsedTs = *v
+		}
+		return copyPasskey(passkey), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (d *DB) ListPasskeys(_ context.Context, find *store.FindPasskey) ([]*store.Passkey, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.Passkey, 0)
+	for _, passkey := range d.passkeys {
+		if v := find.ID; v != nil && passkey.ID != *v {
+			continue
+		}
+		if v := find.UserID; v != nil && passkey.UserID != *v {
+			continue
+		}
+		if v := find.CredentialID; v != nil && !bytes.Equal(passkey.CredentialID, v) {
+			continue
+		}
+		list = append(list, copyPasskey(passkey))
+	}
+	return list, nil
+}
+
+func (d *DB) DeletePasskey(_ context.Context, delete *store.DeletePasskey) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.passkeys = remove(d.passkeys, func(passkey *store.Passkey) bool {
+		return passkey.ID == delete.ID && passkey.UserID == delete.UserID
+	})
+	return nil
+}
+
+// copyPasskey copies the passkey with its byte slices, which the caller could change.
+func copyPasskey(passkey *store.Passkey) *store.Passkey {
+	copied := *passkey
+	copied.CredentialID = bytes.Clone(passkey.CredentialID)
+	copied.PublicKey = bytes.Clone(passkey.PublicKey)
+	copied.AAGUID = bytes.Clone(passkey.AAGUID)
+	copied.Transports = slices.Clone(passkey.Transports)
+	return &copied
+}
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateUser(_ context.Context, create *store.User) (*store.User, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.findUser(create.Username) != nil {
+		return nil, uniqueConstraintError("user.username")
+	}
+	ts := now()
+	create.ID = d.nextID("user")
+	create.AvatarURL = ""
+	create.Description = ""
+	create.CreatedTs = ts
+	create.UpdatedTs = ts
+	create.RowStatus = store.Normal
+	user := *create
+	d.users = append(d.users, &user)
+	return create, nil
+}
+
+func (d *DB) UpdateUser(_ context.Context, update *store.UpdateUser) (*store.User, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var user *store.User
+	for _, u := range d.users {
+		if u.ID == update.ID {
+			user = u
+		}
+	}
+	if user == nil {
+		return nil, sql.ErrNoRows
+	}
+	if v := update.Username; v != nil {
+		if other := d.findUser(*v); other != nil && other.ID != user.ID {
+			return nil, uniqueConstraintError("user.username")
+		}
+	}
+
+	if v := update.UpdatedTs; v != nil {
+		user.UpdatedTs = *v
+	}
+	if v := update.RowStatus; v != nil {
+		user.RowStatus = *v
+	}
+	if v := update.Username; v != nil {
+		user.Username = *v
+	}
+	if v := update.Role; v != nil {
+		user.Role = *v
+	}
+	if v := update.Email; v != nil {
+		user.Email = *v
+	}
+	if v := update.Nickname; v != nil {
+		user.Nickname = *v
+	}
+	if v := update.AvatarURL; v != nil {
+		user.AvatarURL = *v
+	}
+	if v := update.PasswordHash; v != nil {
+		user.PasswordHash = *v
+	}
+	if v := update.Description; v != nil {
+		user.Description = *v
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (d *DB) ListUsers(_ context.Context, find *store.FindUser) ([]*store.User, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.User, 0)
+	for _, user := range d.users {
+		if v := find.ID; v != nil && user.ID != *v {
+			continue
+		}
+		if v := find.Username; v != nil && user.Username != *v {
+			continue
+		}
+		if v := find.Role; v != nil && user.Role != *v {
+			continue
+		}
+		if v := find.Email; v != nil && user.Email != *v {
+			continue
+		}
+		if v := find.Nickname; v != nil && user.Nickname != *v {
+			continue
+		}
+		if v := find.RowStatus; v != nil && user.RowStatus != *v {
+			continue
+		}
+		if v := find.Search; v != nil && !containsFold(user.Username, *v) && !containsFold(user.Email, *v) && !containsFold(user.Nickname, *v) {
+			continue
+		}
+		copied := *user
+		list = append(list, &copied)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].CreatedTs != list[j].CreatedTs {
+			return list[i].CreatedTs > list[j].CreatedTs
+		}
+		if list[i].RowStatus != list[j].RowStatus {
+			return list[i].RowStatus > list[j].RowStatus
+		}
+		return list[i].ID > list[j].ID
+	})
+	return limit(list, find.Limit, find.Offset), nil
+}
+
+// DeleteUser deletes the user and the rows of every module owned by the user.
+// Books reviewed by other users are kept without their owner.
+func (d *DB) DeleteUser(_ context.Context, delete *store.DeleteUser) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var user *store.User
+	for _, u := range d.users {
+		if u.ID == delete.ID {
+			user = u
+		}
+	}
+	if user == nil {
+		return sql.ErrNoRows
+	}
+
+	d.bookReviews = remove(d.bookReviews, func(bookReview *store.BookReview) bool {
+		return bookReview.UserID == delete.ID
+	})
+	d.books = remove(d.books, func(book *store.Book) bool {
+		if book.UserID != delete.ID {
+			return false
+		}
+		for _, bookReview := range d.bookReviews {
+			if bookReview.BookID == book.ID {
+				book.UserID = 0
+				return false
+			}
+		}
+		return true
+	})
+	d.dineroExpenses = remove(d.dineroExpenses, func(expense *store.DineroExpense) bool {
+		return expense.UserID == delete.ID
+	})
+	d.dineroCategories = remove(d.dineroCategories, func(category *store.DineroCategory) bool {
+		return category.UserID == delete.ID
+	})
+	d.events = remove(d.events, func(event *store.Event) bool {
+		return event.UserID == delete.ID
+	})
+	d.userIdentities = remove(d.userIdentities, func(userIdentity *store.UserIdentity) bool {
+		return userIdentity.UserID == delete.ID
+	})
+	d.passkeys = remove(d.passkeys, func(passkey *store.Passkey) bool {
+		return passkey.UserID == delete.ID
+	})
+	d.userSettings = remove(d.userSettings, func(userSetting *store.UserSetting) bool {
+		return userSetting.UserID == delete.ID
+	})
+	d.users = remove(d.users, func(u *store.User) bool {
+		return u.ID == delete.ID
+	})
+	username := strings.ToLower(user.Username)
+	d.loginAttempts = remove(d.loginAttempts, func(loginAttempt *store.LoginAttempt) bool {
+		return loginAttempt.Kind == store.LoginAttemptKindUsername && loginAttempt.Subject == username
+	})
+	return nil
+}
+
+func (d *DB) findUser(username string) *store.User {
+	for _, user := range d.users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func (d *DB) userExists(id int32) bool {
+	return slices.ContainsFunc(d.users, func(user *store.User) bool {
+		return user.ID == id
+	})
+}
+
+// containsFold matches like LIKE '%substr%' of sqlite, which ignores the case of ascii letters.
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// remove drops the rows matching the condition, keeping the order of the others.
+func remove[T any](list []T, match func(T) bool) []T {
+	kept := list[:0]
+	for _, row := range list {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
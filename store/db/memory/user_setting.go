@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertUserSetting(_ context.Context, upsert *store.UserSetting) (*store.UserSetting, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, userSetting := range d.userSettings {
+		if userSetting.UserID == upsert.UserID && userSetting.Key == upsert.Key {
+			userSetting.Value = upsert.Value
+			return upsert, nil
+		}
+	}
+	if !d.userExists(upsert.UserID) {
+		return nil, foreignKeyError(store.ErrMissingReference, "user_setting.user_id")
+	}
+	userSetting := *upsert
+	d.userSettings = append(d.userSettings, &userSetting)
+	return upsert, nil
+}
+
+func (d *DB) DeleteUserSetting(_ context.Context, delete *store.DeleteUserSetting) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.userSettings = remove(d.userSettings, func(userSetting *store.UserSetting) bool {
+		return userSetting.UserID == *delete.UserID && userSetting.Key == delete.Key
+	})
+	return nil
+}
+
+func (d *DB) ListUserSettings(_ context.Context, find *store.FindUserSetting) ([]*store.UserSetting, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.UserSetting, 0)
+	for _, userSetting := range d.userSettings {
+		if v := find.Key; v != store.UserSettingKey_USER_SETTING_KEY_UNSPECIFIED && userSetting.Key != v {
+			continue
+		}
+		if v := find.UserID; v != nil && userSetting.UserID != *v {
+			continue
+		}
+		copied := *userSetting
+		list = append(list, &copied)
+	}
+	return list, nil
+}
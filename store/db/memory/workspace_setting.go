@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertWorkspaceSetting(_ context.Context, upsert *store.WorkspaceSetting) (*store.WorkspaceSetting, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, workspaceSetting := range d.workspaceSettings {
+		if workspaceSetting.Key == upsert.Key {
+			workspaceSetting.Value = upsert.Value
+			return upsert, nil
+		}
+	}
+	workspaceSetting := *upsert
+	d.workspaceSettings = append(d.workspaceSettings, &workspaceSetting)
+	return upsert, nil
+}
+
+func (d *DB) ListWorkspaceSettings(_ context.Context, find *store.FindWorkspaceSetting) ([]*store.WorkspaceSetting, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]*store.WorkspaceSetting, 0)
+	for _, workspaceSetting := range d.workspaceSettings {
+		if v := find.Key; v != "" && workspaceSetting.Key != v {
+			continue
+		}
+		copied := *workspaceSetting
+		list = append(list, &copied)
+	}
+	return list, nil
+}
+
+func (d *DB) DeleteWorkspaceSetting(_ context.Context, delete *store.DeleteWorkspaceSetting) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.workspaceSettings = remove(d.workspaceSettings, func(workspaceSetting *store.WorkspaceSetting) bool {
+		return workspaceSetting.Key == delete.Key
+	})
+	return nil
+}
@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateEvent(ctx context.Context, create *store.Event) (*store.Event, error) {
+	fields := []string{"`user_id`", "`title`", "`place`", "`start_ts`", "`end_ts`"}
+	placeholder := []string{"?", "?", "?", "?", "?"}
+	args := []any{create.UserID, create.Title, create.Place, create.StartTs, create.EndTs}
+	stmt := "INSERT INTO event (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(placeholder, ", ") + ")"
+	result, err := d.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, foreignKeyError(err, store.ErrMissingReference)
+	}
+	if create.ID, err = lastInsertID(result); err != nil {
+		return nil, err
+	}
+	if err := d.db.QueryRowContext(ctx, `
+		SELECT created_ts FROM event WHERE id = ?
+	`, create.ID).Scan(
+		&create.CreatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return create, nil
+}
+
+func (d *DB) ListEvents(ctx context.Context, find *store.FindEvent) ([]*store.Event, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.ID; v != nil {
+		where, args = append(where, "id = ?"), append(args, *v)
+	}
+	if v := find.UserID; v != nil {
+		where, args = append(where, "user_id = ?"), append(args, *v)
+	}
+
+	query := `
+		SELECT
+			id,
+			created_ts,
+			user_id,
+			title,
+			place,
+			start_ts,
+			end_ts
+		FROM event
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY start_ts ASC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.Event, 0)
+	for rows.Next() {
+		var event store.Event
+		if err := rows.Scan(
+			&event.ID,
+			&event.CreatedTs,
+			&event.UserID,
+			&event.Title,
+			&event.Place,
+			&event.StartTs,
+			&event.EndTs,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
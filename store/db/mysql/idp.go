@@ -0,0 +1,243 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateIdentityProvider(ctx context.Context, create *store.IdentityProvider) (*store.IdentityProvider, error) {
+	config, err := json.Marshal(create.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{"`name`", "`type`", "`auto_provision`", "`config`"}
+	placeholder := []string{"?", "?", "?", "?"}
+	args := []any{create.Name, create.Type, create.AutoProvision, string(config)}
+	stmt := "INSERT INTO idp (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(placeholder, ", ") + ")"
+	result, err := d.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	if create.ID, err = lastInsertID(result); err != nil {
+		return nil, err
+	}
+	if err := d.db.QueryRowContext(ctx, `
+		SELECT created_ts FROM idp WHERE id = ?
+	`, create.ID).Scan(
+		&create.CreatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return create, nil
+}
+
+func (d *DB) ListIdentityProviders(ctx context.Context, find *store.FindIdentityProvider) ([]*store.IdentityProvider, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.ID; v != nil {
+		where, args = append(where, "id = ?"), append(args, *v)
+	}
+
+	query := `
+		SELECT
+			id,
+			created_ts,
+			name,
+			type,
+			auto_provision,
+			config
+		FROM idp
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id ASC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.IdentityProvider, 0)
+	for rows.Next() {
+		identityProvider, err := scanIdentityProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, identityProvider)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) UpdateIdentityProvider(ctx context.Context, update *store.UpdateIdentityProvider) (*store.IdentityProvider, error) {
+	set, args := []string{}, []any{}
+	if v := update.Name; v != nil {
+		set, args = append(set, "name = ?"), append(args, *v)
+	}
+	if v := update.AutoProvision; v != nil {
+		set, args = append(set, "auto_provision = ?"), append(args, *v)
+	}
+	if v := update.Config; v != nil {
+		config, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		set, args = append(set, "config = ?"), append(args, string(config))
+	}
+	if len(set) == 0 {
+		return nil, errors.New("nothing to update")
+	}
+	args = append(args, update.ID)
+
+	query := `
+		UPDATE idp
+		SET ` + strings.Join(set, ", ") + `
+		WHERE id = ?
+	`
+	if _, err := d.db.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+
+	list, err := d.ListIdentityProviders(ctx, &store.FindIdentityProvider{ID: &update.ID})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+func (d *DB) DeleteIdentityProvider(ctx context.Context, delete *store.DeleteIdentityProvider) error {
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM idp WHERE id = ?
+	`, delete.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *DB) CreateUserIdentity(ctx context.Context, create *store.UserIdentity) (*store.UserIdentity, error) {
+	fields := []string{"`user_id`", "`idp_id`", "`subject`"}
+	placeholder := []string{"?", "?", "?"}
+	args := []any{create.UserID, create.IdpID, create.Subject}
+	stmt := "INSERT INTO user_identity (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(placeholder, ", ") + ")"
+	if _, err := d.db.ExecContext(ctx, stmt, args...); err != nil {
+		return nil, foreignKeyError(err, store.ErrMissingReference)
+	}
+	if err := d.db.QueryRowContext(ctx, `
+		SELECT created_ts FROM user_identity WHERE user_id = ? AND idp_id = ?
+	`, create.UserID, create.IdpID).Scan(
+		&create.CreatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return create, nil
+}
+
+func (d *DB) ListUserIdentities(ctx context.Context, find *store.FindUserIdentity) ([]*store.UserIdentity, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.UserID; v != nil {
+		where, args = append(where, "user_id = ?"), append(args, *v)
+	}
+	if v := find.IdpID; v != nil {
+		where, args = append(where, "idp_id = ?"), append(args, *v)
+	}
+	if v := find.Subject; v != nil {
+		where, args = append(where, "subject = ?"), append(args, *v)
+	}
+
+	query := `
+		SELECT
+			user_id,
+			idp_id,
+			subject,
+			created_ts
+		FROM user_identity
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY created_ts ASC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.UserIdentity, 0)
+	for rows.Next() {
+		var userIdentity store.UserIdentity
+		if err := rows.Scan(
+			&userIdentity.UserID,
+			&userIdentity.IdpID,
+			&userIdentity.Subject,
+			&userIdentity.CreatedTs,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &userIdentity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) DeleteUserIdentity(ctx context.Context, delete *store.DeleteUserIdentity) error {
+	where, args := []string{}, []any{}
+	if v := delete.UserID; v != nil {
+		where, args = append(where, "user_id = ?"), append(args, *v)
+	}
+	if v := delete.IdpID; v != nil {
+		where, args = append(where, "idp_id = ?"), append(args, *v)
+	}
+	if len(where) == 0 {
+		return errors.New("user id or idp id is required")
+	}
+
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM user_identity WHERE `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanIdentityProvider(row rowScanner) (*store.IdentityProvider, error) {
+	identityProvider := &store.IdentityProvider{}
+	var config string
+	if err := row.Scan(
+		&identityProvider.ID,
+		&identityProvider.CreatedTs,
+		&identityProvider.Name,
+		&identityProvider.Type,
+		&identityProvider.AutoProvision,
+		&config,
+	); err != nil {
+		return nil, err
+	}
+
+	identityProvider.Config = &store.IdentityProviderConfig{}
+	if err := json.Unmarshal([]byte(config), identityProvider.Config); err != nil {
+		return nil, err
+	}
+	return identityProvider, nil
+}
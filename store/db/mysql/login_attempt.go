@@ -0,0 +1,142 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertLoginAttempt(ctx context.Context, upsert *store.LoginAttempt) (*store.LoginAttempt, error) {
+	stmt := `
+		INSERT INTO login_attempt (
+			kind, subject, failed_count, last_failed_ts, locked_until_ts
+		)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			failed_count = VALUES(failed_count),
+			last_failed_ts = VALUES(last_failed_ts),
+			locked_until_ts = VALUES(locked_until_ts)
+	`
+	if _, err := d.db.ExecContext(ctx, stmt, upsert.Kind, upsert.Subject, upsert.FailedCount, upsert.LastFailedTs, upsert.LockedUntilTs); err != nil {
+		return nil, err
+	}
+	return upsert, nil
+}
+
+// IncrementLoginAttempt counts the failure with one upsert and reads the row back in the same transaction.
+// MySQL assigns the columns from left to right and later assignments see the new values: failed_count is
+// assigned first from the old row, so locked_until_ts knows of a reset by the count starting over at 1.
+func (d *DB) IncrementLoginAttempt(ctx context.Context, increment *store.IncrementLoginAttempt) (*store.LoginAttempt, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		INSERT INTO login_attempt (
+			kind, subject, failed_count, last_failed_ts, locked_until_ts
+		)
+		VALUES (?, ?, 1, ?, CASE WHEN 1 >= ? THEN ? ELSE 0 END)
+		ON DUPLICATE KEY UPDATE
+			failed_count = CASE
+				WHEN last_failed_ts < ? OR (locked_until_ts != 0 AND locked_until_ts <= VALUES(last_failed_ts)) THEN 1
+				ELSE failed_count + 1
+			END,
+			locked_until_ts = CASE
+				WHEN failed_count = 1 THEN VALUES(locked_until_ts)
+				WHEN locked_until_ts != 0 THEN locked_until_ts
+				WHEN failed_count >= ? THEN ?
+				ELSE 0
+			END,
+			last_failed_ts = VALUES(last_failed_ts)
+	`
+	if _, err := tx.ExecContext(ctx, stmt,
+		increment.Kind, increment.Subject, increment.FailedTs, increment.LockoutAttempts, increment.LockedUntilTs,
+		increment.ResetBeforeTs, increment.LockoutAttempts, increment.LockedUntilTs,
+	); err != nil {
+		return nil, err
+	}
+
+	loginAttempt := &store.LoginAttempt{}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT kind, subject, failed_count, last_failed_ts, locked_until_ts
+		FROM login_attempt
+		WHERE kind = ? AND subject = ?
+	`, increment.Kind, increment.Subject).Scan(
+		&loginAttempt.Kind,
+		&loginAttempt.Subject,
+		&loginAttempt.FailedCount,
+		&loginAttempt.LastFailedTs,
+		&loginAttempt.LockedUntilTs,
+	); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return loginAttempt, nil
+}
+
+func (d *DB) ListLoginAttempts(ctx context.Context, find *store.FindLoginAttempt) ([]*store.LoginAttempt, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.Kind; v != nil {
+		where, args = append(where, "kind = ?"), append(args, *v)
+	}
+	if v := find.Subject; v != nil {
+		where, args = append(where, "subject = ?"), append(args, *v)
+	}
+	if v := find.LockedAfterTs; v != nil {
+		where, args = append(where, "locked_until_ts > ?"), append(args, *v)
+	}
+
+	query := `
+		SELECT
+			kind,
+			subject,
+			failed_count,
+			last_failed_ts,
+			locked_until_ts
+		FROM login_attempt
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY last_failed_ts DESC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.LoginAttempt, 0)
+	for rows.Next() {
+		var loginAttempt store.LoginAttempt
+		if err := rows.Scan(
+			&loginAttempt.Kind,
+			&loginAttempt.Subject,
+			&loginAttempt.FailedCount,
+			&loginAttempt.LastFailedTs,
+			&loginAttempt.LockedUntilTs,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &loginAttempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) DeleteLoginAttempt(ctx context.Context, delete *store.DeleteLoginAttempt) error {
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM login_attempt WHERE kind = ? AND subject = ?
+	`, delete.Kind, delete.Subject)
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+)
+
+type DB struct {
+	db      *sql.DB
+	profile *profile.Profile
+}
+
+func NewDB(profile *profile.Profile) (store.Driver, error) {
+	if profile.DSN == "" {
+		return nil, errors.New("dsn required")
+	}
+
+	config, err := mysql.ParseDSN(profile.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn: %w", err)
+	}
+	// the migration files are executed as one statement list
+	config.MultiStatements = true
+
+	mysqlDB, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db with dsn: %w", err)
+	}
+
+	driver := DB{db: mysqlDB, profile: profile}
+
+	return &driver, nil
+}
+
+func (d *DB) GetDB() *sql.DB {
+	return d.db
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// lastInsertID is the id given to the row of an insert, mysql has no RETURNING to read it with the insert.
+func lastInsertID(result sql.Result) (int32, error) {
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int32(id), nil
+}
+
+// foreignKeyError wraps a violated foreign key in target, store.ErrMissingReference or store.ErrReferenced.
+func foreignKeyError(err error, target error) error {
+	var mysqlErr *mysql.MySQLError
+	// ER_ROW_IS_REFERENCED_2 and ER_NO_REFERENCED_ROW_2
+	if errors.As(err, &mysqlErr) && (mysqlErr.Number == 1451 || mysqlErr.Number == 1452) {
+		return fmt.Errorf("%w: %v", target, err)
+	}
+	return err
+}
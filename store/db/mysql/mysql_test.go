@@ -0,0 +1,66 @@
+package mysql_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+	tcmysql "github.com/testcontainers/testcontainers-go/modules/mysql"
+
+	"itsfriday/server/profile"
+	"itsfriday/store/db/mysql"
+	"itsfriday/store/storetest"
+)
+
+// TestConformance runs on a throwaway MySQL started in a Docker container,
+// or on a new MySQL or MariaDB database in ITSFRIDAY_TEST_MYSQL_DSN, e.g. itsfriday:secret@tcp(localhost:3306)/itsfriday_test.
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("ITSFRIDAY_TEST_MYSQL_DSN")
+	if dsn == "" {
+		dsn = startMySQL(t)
+	}
+	profile := &profile.Profile{
+		Mode:   "dev",
+		Driver: "mysql",
+		DSN:    dsn,
+	}
+	driver, err := mysql.NewDB(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { driver.Close() })
+	storetest.TestDatabase(t, driver, profile)
+}
+
+// startMySQL starts a MySQL container, removed after the test, and returns the DSN of its new database.
+func startMySQL(t *testing.T) string {
+	ctx := context.Background()
+	container, err := runMySQL(ctx)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		storetest.DatabaseUnavailable(t, "failed to start MySQL: %v", err)
+	}
+	dsn, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dsn
+}
+
+// runMySQL runs the container, and returns an error rather than the panic of testcontainers when Docker is missing.
+// The migrations create triggers, which a user without SUPER may only create with log_bin_trust_function_creators.
+func runMySQL(ctx context.Context) (container *tcmysql.MySQLContainer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return tcmysql.Run(ctx, "mysql:8.0",
+		tcmysql.WithDatabase("itsfriday_test"),
+		tcmysql.WithUsername("itsfriday"),
+		tcmysql.WithPassword("secret"),
+		testcontainers.WithCmd("mysqld", "--log-bin-trust-function-creators=1"),
+	)
+}
@@ -0,0 +1,156 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreatePasskey(ctx context.Context, create *store.Passkey) (*store.Passkey, error) {
+	transports, err := json.Marshal(create.Transports)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{"`user_id`", "`name`", "`credential_id`", "`public_key`", "`attestation_type`", "`aaguid`", "`sign_count`", "`transports`", "`backup_eligible`", "`backup_state`"}
+	placeholder := []string{"?", "?", "?", "?", "?", "?", "?", "?", "?", "?"}
+	args := []any{create.UserID, create.Name, create.CredentialID, create.PublicKey, create.AttestationType, create.AAGUID, create.SignCount, string(transports), create.BackupEligible, create.BackupState}
+
+	stmt := "INSERT INTO passkey (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(placeholder, ", ") + ")"
+	result, err := d.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, foreignKeyError(err, store.ErrMissingReference)
+	}
+	if create.ID, err = lastInsertID(result); err != nil {
+		return nil, err
+	}
+	if err := d.db.QueryRowContext(ctx, `
+		SELECT created_ts, last_used_ts FROM passkey WHERE id = ?
+	`, create.ID).Scan(
+		&create.CreatedTs,
+		&create.LastUsedTs,
+	); err != nil {
+		return nil, err
+	}
+	return create, nil
+}
+
+func (d *DB) UpdatePasskey(ctx context.Context, update *store.UpdatePasskey) (*store.Passkey, error) {
+	set, args := []string{}, []any{}
+	if v := update.Name; v != nil {
+		set, args = append(set, "name = ?"), append(args, *v)
+	}
+	if v := update.SignCount; v != nil {
+		set, args = append(set, "sign_count = ?"), append(args, *v)
+	}
+	if v := update.BackupState; v != nil {
+		set, args = append(set, "backup_state = ?"), append(args, *v)
+	}
+	if v := update.LastUsedTs; v != nil {
+		set, args = append(set, "last_used_ts = ?"), append(args, *v)
+	}
+	if len(set) == 0 {
+		return nil, errors.New("nothing to update")
+	}
+	args = append(args, update.ID)
+
+	query := `
+		UPDATE passkey
+		SET ` + strings.Join(set, ", ") + `
+		WHERE id = ?
+	`
+	if _, err := d.db.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+
+	list, err := d.ListPasskeys(ctx, &store.FindPasskey{ID: &update.ID})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+func (d *DB) ListPasskeys(ctx context.Context, find *store.FindPasskey) ([]*store.Passkey, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.ID; v != nil {
+		where, args = append(where, "id = ?"), append(args, *v)
+	}
+	if v := find.UserID; v != nil {
+		where, args = append(where, "user_id = ?"), append(args, *v)
+	}
+	if v := find.CredentialID; v != nil {
+		where, args = append(where, "credential_id = ?"), append(args, v)
+	}
+
+	query := `
+		SELECT ` + passkeyColumns + `
+		FROM passkey
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id ASC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.Passkey, 0)
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) DeletePasskey(ctx context.Context, delete *store.DeletePasskey) error {
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM passkey WHERE id = ? AND user_id = ?
+	`, delete.ID, delete.UserID)
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
+
+const passkeyColumns = "id, created_ts, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, last_used_ts"
+
+func scanPasskey(row rowScanner) (*store.Passkey, error) {
+	passkey := &store.Passkey{}
+	var transports string
+	if err := row.Scan(
+		&passkey.ID,
+		&passkey.CreatedTs,
+		&passkey.UserID,
+		&passkey.Name,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&passkey.AttestationType,
+		&passkey.AAGUID,
+		&passkey.SignCount,
+		&transports,
+		&passkey.BackupEligible,
+		&passkey.BackupState,
+		&passkey.LastUsedTs,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(transports), &passkey.Transports); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertUserSetting(ctx context.Context, upsert *store.UserSetting) (*store.UserSetting, error) {
+	// key is a reserved word of mysql
+	stmt := "INSERT INTO user_setting (user_id, `key`, value) VALUES (?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE value = VALUES(value)"
+	if _, err := d.db.ExecContext(ctx, stmt, upsert.UserID, upsert.Key.String(), upsert.Value); err != nil {
+		return nil, foreignKeyError(err, store.ErrMissingReference)
+	}
+	return upsert, nil
+}
+
+func (d *DB) DeleteUserSetting(ctx context.Context, delete *store.DeleteUserSetting) error {
+	result, err := d.db.ExecContext(ctx, "DELETE FROM user_setting WHERE user_id = ? AND `key` = ?", *delete.UserID, delete.Key.String())
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *DB) ListUserSettings(ctx context.Context, find *store.FindUserSetting) ([]*store.UserSetting, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.Key; v != store.UserSettingKey_USER_SETTING_KEY_UNSPECIFIED {
+		where, args = append(where, "`key` = ?"), append(args, v.String())
+	}
+	if v := find.UserID; v != nil {
+		where, args = append(where, "user_id = ?"), append(args, *find.UserID)
+	}
+
+	query := "SELECT user_id, `key`, value FROM user_setting WHERE " + strings.Join(where, " AND ")
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userSettingList := make([]*store.UserSetting, 0)
+	for rows.Next() {
+		userSetting := &store.UserSetting{}
+		var keyString string
+		if err := rows.Scan(
+			&userSetting.UserID,
+			&keyString,
+			&userSetting.Value,
+		); err != nil {
+			return nil, err
+		}
+		userSetting.Key = store.UserSettingKey(store.UserSettingKey_value[keyString])
+		userSettingList = append(userSettingList, userSetting)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userSettingList, nil
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreatePasskey(ctx context.Context, create *store.Passkey) (*store.Passkey, error) {
+	transports, err := json.Marshal(create.Transports)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{"user_id", "name", "credential_id", "public_key", "attestation_type", "aaguid", "sign_count", "transports", "backup_eligible", "backup_state"}
+	args := []any{create.UserID, create.Name, create.CredentialID, create.PublicKey, create.AttestationType, create.AAGUID, create.SignCount, string(transports), create.BackupEligible, create.BackupState}
+
+	stmt := "INSERT INTO passkey (" + strings.Join(fields, ", ") + ") VALUES (" + placeholders(len(args)) + ") RETURNING id, created_ts, last_used_ts"
+	if err := d.db.QueryRowContext(ctx, stmt, args...).Scan(
+		&create.ID,
+		&create.CreatedTs,
+		&create.LastUsedTs,
+	); err != nil {
+		return nil, foreignKeyError(err, store.ErrMissingReference)
+	}
+	return create, nil
+}
+
+func (d *DB) UpdatePasskey(ctx context.Context, update *store.UpdatePasskey) (*store.Passkey, error) {
+	set, args := []string{}, []any{}
+	if v := update.Name; v != nil {
+		set, args = append(set, "name = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.SignCount; v != nil {
+		set, args = append(set, "sign_count = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.BackupState; v != nil {
+		set, args = append(set, "backup_state = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.LastUsedTs; v != nil {
+		set, args = append(set, "last_used_ts = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if len(set) == 0 {
+		return nil, errors.New("nothing to update")
+	}
+	args = append(args, update.ID)
+
+	query := `
+		UPDATE passkey
+		SET ` + strings.Join(set, ", ") + `
+		WHERE id = ` + placeholder(len(args)) + `
+		RETURNING ` + passkeyColumns
+	return scanPasskey(d.db.QueryRowContext(ctx, query, args...))
+}
+
+func (d *DB) ListPasskeys(ctx context.Context, find *store.FindPasskey) ([]*store.Passkey, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.ID; v != nil {
+		where, args = append(where, "id = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.UserID; v != nil {
+		where, args = append(where, "user_id = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.CredentialID; v != nil {
+		where, args = append(where, "credential_id = "+placeholder(len(args)+1)), append(args, v)
+	}
+
+	query := `
+		SELECT ` + passkeyColumns + `
+		FROM passkey
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id ASC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.Passkey, 0)
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) DeletePasskey(ctx context.Context, delete *store.DeletePasskey) error {
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM passkey WHERE id = $1 AND user_id = $2
+	`, delete.ID, delete.UserID)
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
+
+const passkeyColumns = "id, created_ts, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, last_used_ts"
+
+func scanPasskey(row rowScanner) (*store.Passkey, error) {
+	passkey := &store.Passkey{}
+	var transports string
+	if err := row.Scan(
+		&passkey.ID,
+		&passkey.CreatedTs,
+		&passkey.UserID,
+		&passkey.Name,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&passkey.AttestationType,
+		&passkey.AAGUID,
+		&passkey.SignCount,
+		&transports,
+		&passkey.BackupEligible,
+		&passkey.BackupState,
+		&passkey.LastUsedTs,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(transports), &passkey.Transports); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
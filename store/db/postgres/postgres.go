@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+)
+
+type DB struct {
+	db      *sql.DB
+	profile *profile.Profile
+}
+
+func NewDB(profile *profile.Profile) (store.Driver, error) {
+	if profile.DSN == "" {
+		return nil, errors.New("dsn required")
+	}
+
+	postgresDB, err := sql.Open("postgres", profile.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db with dsn: %w", err)
+	}
+
+	driver := DB{db: postgresDB, profile: profile}
+
+	return &driver, nil
+}
+
+func (d *DB) GetDB() *sql.DB {
+	return d.db
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// placeholder is the n-th parameter of a statement, postgres numbers them from $1.
+func placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// placeholders are the parameters $1 to $n of an insert.
+func placeholders(n int) string {
+	list := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, placeholder(i))
+	}
+	return strings.Join(list, ", ")
+}
+
+// foreignKeyError wraps a violated foreign key in target, store.ErrMissingReference or store.ErrReferenced.
+func foreignKeyError(err error, target error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return fmt.Errorf("%w: %v", target, err)
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateUser(ctx context.Context, create *store.User) (*store.User, error) {
+	fields := []string{"username", "role", "email", "nickname", "password_hash"}
+	args := []any{create.Username, create.Role, create.Email, create.Nickname, create.PasswordHash}
+	stmt := `INSERT INTO "user" (` + strings.Join(fields, ", ") + ") VALUES (" + placeholders(len(args)) + ") RETURNING id, avatar_url, description, created_ts, updated_ts, row_status"
+	if err := d.db.QueryRowContext(ctx, stmt, args...).Scan(
+		&create.ID,
+		&create.AvatarURL,
+		&create.Description,
+		&create.CreatedTs,
+		&create.UpdatedTs,
+		&create.RowStatus,
+	); err != nil {
+		return nil, err
+	}
+
+	return create, nil
+}
+
+func (d *DB) UpdateUser(ctx context.Context, update *store.UpdateUser) (*store.User, error) {
+	set, args := []string{}, []any{}
+	if v := update.UpdatedTs; v != nil {
+		set, args = append(set, "updated_ts = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.RowStatus; v != nil {
+		set, args = append(set, "row_status = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.Username; v != nil {
+		set, args = append(set, "username = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.Role; v != nil {
+		set, args = append(set, "role = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.Email; v != nil {
+		set, args = append(set, "email = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.Nickname; v != nil {
+		set, args = append(set, "nickname = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.AvatarURL; v != nil {
+		set, args = append(set, "avatar_url = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.PasswordHash; v != nil {
+		set, args = append(set, "password_hash = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := update.Description; v != nil {
+		set, args = append(set, "description = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	args = append(args, update.ID)
+
+	query := `
+		UPDATE "user"
+		SET ` + strings.Join(set, ", ") + `
+		WHERE id = ` + placeholder(len(args)) + `
+		RETURNING id, username, role, email, nickname, password_hash, avatar_url, description, created_ts, updated_ts, row_status
+	`
+	user := &store.User{}
+	if err := d.db.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Role,
+		&user.Email,
+		&user.Nickname,
+		&user.PasswordHash,
+		&user.AvatarURL,
+		&user.Description,
+		&user.CreatedTs,
+		&user.UpdatedTs,
+		&user.RowStatus,
+	); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (d *DB) ListUsers(ctx context.Context, find *store.FindUser) ([]*store.User, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.ID; v != nil {
+		where, args = append(where, "id = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.Username; v != nil {
+		where, args = append(where, "username = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.Role; v != nil {
+		where, args = append(where, "role = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.Email; v != nil {
+		where, args = append(where, "email = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.Nickname; v != nil {
+		where, args = append(where, "nickname = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.RowStatus; v != nil {
+		where, args = append(where, "row_status = "+placeholder(len(args)+1)), append(args, *v)
+	}
+	if v := find.Search; v != nil {
+		// LIKE of sqlite ignores the case of ascii letters, ILIKE keeps the search the same
+		pattern := "%" + *v + "%"
+		p := placeholder(len(args) + 1)
+		where, args = append(where, "(username ILIKE "+p+" OR email ILIKE "+p+" OR nickname ILIKE "+p+")"), append(args, pattern)
+	}
+
+	orderBy := []string{"created_ts DESC", "row_status DESC"}
+	query := `
+		SELECT
+			id,
+			username,
+			role,
+			email,
+			nickname,
+			password_hash,
+			avatar_url,
+			description,
+			created_ts,
+			updated_ts,
+			row_status
+		FROM "user"
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY ` + strings.Join(orderBy, ", ")
+	if v := find.Limit; v != nil {
+		query += fmt.Sprintf(" LIMIT %d", *v)
+		if v := find.Offset; v != nil {
+			query += fmt.Sprintf(" OFFSET %d", *v)
+		}
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.User, 0)
+	for rows.Next() {
+		var user store.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Role,
+			&user.Email,
+			&user.Nickname,
+			&user.PasswordHash,
+			&user.AvatarURL,
+			&user.Description,
+			&user.CreatedTs,
+			&user.UpdatedTs,
+			&user.RowStatus,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// DeleteUser deletes the user and the rows of every module owned by the user in one transaction.
+// Books reviewed by other users are kept without their owner.
+func (d *DB) DeleteUser(ctx context.Context, delete *store.DeleteUser) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT username FROM "user" WHERE id = $1
+	`, delete.ID).Scan(&username); err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM book_review WHERE user_id = $1",
+		"DELETE FROM book WHERE user_id = $1 AND id NOT IN (SELECT book_id FROM book_review)",
+		"UPDATE book SET user_id = NULL WHERE user_id = $1",
+		"DELETE FROM expense WHERE user_id = $1",
+		"DELETE FROM expense_category WHERE user_id = $1",
+		"DELETE FROM event WHERE user_id = $1",
+		"DELETE FROM user_identity WHERE user_id = $1",
+		"DELETE FROM passkey WHERE user_id = $1",
+		"DELETE FROM user_setting WHERE user_id = $1",
+		`DELETE FROM "user" WHERE id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, delete.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM login_attempt WHERE kind = 'USERNAME' AND subject = $1
+	`, strings.ToLower(username)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertWorkspaceSetting(ctx context.Context, upsert *store.WorkspaceSetting) (*store.WorkspaceSetting, error) {
+	stmt := `
+		INSERT INTO workspace_setting (
+			key, value
+		)
+		VALUES ($1, $2)
+		ON CONFLICT(key) DO UPDATE 
+		SET value = EXCLUDED.value
+	`
+	if _, err := d.db.ExecContext(ctx, stmt, upsert.Key.String(), upsert.Value); err != nil {
+		return nil, err
+	}
+	return upsert, nil
+}
+
+func (d *DB) ListWorkspaceSettings(ctx context.Context, find *store.FindWorkspaceSetting) ([]*store.WorkspaceSetting, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.Key; v != "" {
+		where, args = append(where, "key = "+placeholder(len(args)+1)), append(args, v.String())
+	}
+
+	query := `
+		SELECT
+			key,
+			value
+		FROM workspace_setting
+		WHERE ` + strings.Join(where, " AND ")
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.WorkspaceSetting, 0)
+	for rows.Next() {
+		workspaceSetting := &store.WorkspaceSetting{}
+		if err := rows.Scan(
+			&workspaceSetting.Key,
+			&workspaceSetting.Value,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, workspaceSetting)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) DeleteWorkspaceSetting(ctx context.Context, delete *store.DeleteWorkspaceSetting) error {
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM workspace_setting WHERE key = $1
+	`, delete.Key.String())
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
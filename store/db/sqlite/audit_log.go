@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) CreateAuditLog(ctx context.Context, create *store.AuditLog) (*store.AuditLog, error) {
+	stmt := `
+		INSERT INTO audit_log (
+			user_id, actor_id, action, outcome, client_ip, user_agent, detail
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_ts
+	`
+	if err := d.db.QueryRowContext(ctx, stmt,
+		create.UserID, create.ActorID, create.Action, create.Outcome, create.ClientIP, create.UserAgent, create.Detail,
+	).Scan(
+		&create.ID,
+		&create.CreatedTs,
+	); err != nil {
+		return nil, err
+	}
+	return create, nil
+}
+
+func (d *DB) ListAuditLogs(ctx context.Context, find *store.FindAuditLog) ([]*store.AuditLog, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.UserID; v != nil {
+		where, args = append(where, "user_id = ?"), append(args, *v)
+	}
+	if v := find.Action; v != nil {
+		where, args = append(where, "action = ?"), append(args, *v)
+	}
+	if v := find.Outcome; v != nil {
+		where, args = append(where, "outcome = ?"), append(args, *v)
+	}
+
+	query := `
+		SELECT
+			id,
+			created_ts,
+			user_id,
+			actor_id,
+			action,
+			outcome,
+			client_ip,
+			user_agent,
+			detail
+		FROM audit_log
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id DESC`
+	if v := find.Limit; v != nil {
+		query += fmt.Sprintf(" LIMIT %d", *v)
+		if v := find.Offset; v != nil {
+			query += fmt.Sprintf(" OFFSET %d", *v)
+		}
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.AuditLog, 0)
+	for rows.Next() {
+		var auditLog store.AuditLog
+		if err := rows.Scan(
+			&auditLog.ID,
+			&auditLog.CreatedTs,
+			&auditLog.UserID,
+			&auditLog.ActorID,
+			&auditLog.Action,
+			&auditLog.Outcome,
+			&auditLog.ClientIP,
+			&auditLog.UserAgent,
+			&auditLog.Detail,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &auditLog)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
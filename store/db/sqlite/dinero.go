@@ -16,7 +16,7 @@ func (d *DB) CreateDineroCategory(ctx context.Context, create *store.DineroCateg
 	if err := d.db.QueryRowContext(ctx, stmt, args...).Scan(
 		&create.ID,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return create, nil
@@ -106,7 +106,7 @@ func (d *DB) DeleteDineroCategory(ctx context.Context, delete *store.DeleteDiner
 		DELETE FROM expense_category WHERE id = ?
 	`, delete.ID)
 	if err != nil {
-		return err
+		return foreignKeyError(err, store.ErrReferenced)
 	}
 	if _, err := result.RowsAffected(); err != nil {
 		return err
@@ -123,7 +123,7 @@ func (d *DB) CreateDineroExpense(ctx context.Context, create *store.DineroExpens
 		&create.ID,
 		&create.CreatedTs,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return create, nil
@@ -223,7 +223,7 @@ func (d *DB) UpdateDineroExpense(ctx context.Context, update *store.UpdateDinero
 		&expense.Price,
 		&expense.CreatedTs,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return expense, nil
@@ -19,7 +19,7 @@ func (d *DB) CreateBook(ctx context.Context, create *store.Book) (*store.Book, e
 		&create.ID,
 		&create.CreatedTs,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return create, nil
@@ -54,7 +54,7 @@ func (d *DB) UpdateBook(ctx context.Context, update *store.UpdateBook) (*store.B
 		UPDATE book
 		SET ` + strings.Join(set, ", ") + `
 		WHERE id = ?
-		RETURNING id, user_id, title, author, translator, pages, pub_year, genre, created_ts
+		RETURNING id, COALESCE(user_id, 0), title, author, translator, pages, pub_year, genre, created_ts
 	`
 	book := &store.Book{}
 	if err := d.db.QueryRowContext(ctx, query, args...).Scan(
@@ -68,7 +68,7 @@ func (d *DB) UpdateBook(ctx context.Context, update *store.UpdateBook) (*store.B
 		&book.Genre,
 		&book.CreatedTs,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return book, nil
@@ -94,7 +94,7 @@ func (d *DB) ListBooks(ctx context.Context, find *store.FindBook) ([]*store.Book
 	query := `
 		SELECT 
 			id,
-			user_id,
+			COALESCE(user_id, 0),
 			title,
 			author,
 			translator,
@@ -145,7 +145,7 @@ func (d *DB) DeleteBook(ctx context.Context, delete *store.DeleteBook) error {
 		DELETE FROM book WHERE id = ?
 	`, delete.ID)
 	if err != nil {
-		return err
+		return foreignKeyError(err, store.ErrReferenced)
 	}
 	if _, err := result.RowsAffected(); err != nil {
 		return err
@@ -164,7 +164,7 @@ func (d *DB) CreateBookReview(ctx context.Context, create *store.BookReview) (*s
 		&create.ID,
 		&create.CreatedTs,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return create, nil
@@ -205,7 +205,7 @@ func (d *DB) UpdateBookReview(ctx context.Context, update *store.UpdateBookRevie
 		&bookReview.Review,
 		&bookReview.CreatedTs,
 	); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 
 	return bookReview, nil
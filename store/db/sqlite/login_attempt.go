@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func (d *DB) UpsertLoginAttempt(ctx context.Context, upsert *store.LoginAttempt) (*store.LoginAttempt, error) {
+	stmt := `
+		INSERT INTO login_attempt (
+			kind, subject, failed_count, last_failed_ts, locked_until_ts
+		)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, subject) DO UPDATE
+		SET failed_count = EXCLUDED.failed_count,
+			last_failed_ts = EXCLUDED.last_failed_ts,
+			locked_until_ts = EXCLUDED.locked_until_ts
+	`
+	if _, err := d.db.ExecContext(ctx, stmt, upsert.Kind, upsert.Subject, upsert.FailedCount, upsert.LastFailedTs, upsert.LockedUntilTs); err != nil {
+		return nil, err
+	}
+	return upsert, nil
+}
+
+// IncrementLoginAttempt counts the failure with one upsert, the current row is read by the statement itself.
+func (d *DB) IncrementLoginAttempt(ctx context.Context, increment *store.IncrementLoginAttempt) (*store.LoginAttempt, error) {
+	reset := `login_attempt.last_failed_ts < ?4 OR (login_attempt.locked_until_ts != 0 AND login_attempt.locked_until_ts <= ?3)`
+	stmt := `
+		INSERT INTO login_attempt (
+			kind, subject, failed_count, last_failed_ts, locked_until_ts
+		)
+		VALUES (?1, ?2, 1, ?3, CASE WHEN 1 >= ?5 THEN ?6 ELSE 0 END)
+		ON CONFLICT(kind, subject) DO UPDATE
+		SET failed_count = CASE WHEN ` + reset + ` THEN 1 ELSE login_attempt.failed_count + 1 END,
+			last_failed_ts = EXCLUDED.last_failed_ts,
+			locked_until_ts = CASE
+				WHEN ` + reset + ` THEN EXCLUDED.locked_until_ts
+				WHEN login_attempt.locked_until_ts != 0 THEN login_attempt.locked_until_ts
+				WHEN login_attempt.failed_count + 1 >= ?5 THEN ?6
+				ELSE 0
+			END
+		RETURNING kind, subject, failed_count, last_failed_ts, locked_until_ts
+	`
+	loginAttempt := &store.LoginAttempt{}
+	if err := d.db.QueryRowContext(ctx, stmt, increment.Kind, increment.Subject, increment.FailedTs, increment.ResetBeforeTs, increment.LockoutAttempts, increment.LockedUntilTs).Scan(
+		&loginAttempt.Kind,
+		&loginAttempt.Subject,
+		&loginAttempt.FailedCount,
+		&loginAttempt.LastFailedTs,
+		&loginAttempt.LockedUntilTs,
+	); err != nil {
+		return nil, err
+	}
+	return loginAttempt, nil
+}
+
+func (d *DB) ListLoginAttempts(ctx context.Context, find *store.FindLoginAttempt) ([]*store.LoginAttempt, error) {
+	where, args := []string{"1 = 1"}, []any{}
+
+	if v := find.Kind; v != nil {
+		where, args = append(where, "kind = ?"), append(args, *v)
+	}
+	if v := find.Subject; v != nil {
+		where, args = append(where, "subject = ?"), append(args, *v)
+	}
+	if v := find.LockedAfterTs; v != nil {
+		where, args = append(where, "locked_until_ts > ?"), append(args, *v)
+	}
+
+	query := `
+		SELECT
+			kind,
+			subject,
+			failed_count,
+			last_failed_ts,
+			locked_until_ts
+		FROM login_attempt
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY last_failed_ts DESC`
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*store.LoginAttempt, 0)
+	for rows.Next() {
+		var loginAttempt store.LoginAttempt
+		if err := rows.Scan(
+			&loginAttempt.Kind,
+			&loginAttempt.Subject,
+			&loginAttempt.FailedCount,
+			&loginAttempt.LastFailedTs,
+			&loginAttempt.LockedUntilTs,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &loginAttempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DB) DeleteLoginAttempt(ctx context.Context, delete *store.DeleteLoginAttempt) error {
+	result, err := d.db.ExecContext(ctx, `
+		DELETE FROM login_attempt WHERE kind = ? AND subject = ?
+	`, delete.Kind, delete.Subject)
+	if err != nil {
+		return err
+	}
+	if _, err := result.RowsAffected(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 
 	"itsfriday/server/profile"
 	"itsfriday/store"
@@ -21,7 +23,7 @@ func NewDB(profile *profile.Profile) (store.Driver, error) {
 		return nil, errors.New("dsn required")
 	}
 
-	sqliteDB, err := sql.Open("sqlite", profile.DSN+"?_pragma=foreign_keys(0)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	sqliteDB, err := sql.Open("sqlite", profile.DSN+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open db with dsn: %s", profile.DSN)
 	}
@@ -38,3 +40,19 @@ func (d *DB) GetDB() *sql.DB {
 func (d *DB) Close() error {
 	return d.db.Close()
 }
+
+// foreignKeyError wraps a violated foreign key in target, store.ErrMissingReference or store.ErrReferenced.
+// SQLite reports ON DELETE RESTRICT as a failed trigger.
+func foreignKeyError(err error, target error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY, sqlite3.SQLITE_CONSTRAINT_TRIGGER:
+		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+			return fmt.Errorf("%w: %v", target, err)
+		}
+	}
+	return err
+}
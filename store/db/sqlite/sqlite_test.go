@@ -0,0 +1,24 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"itsfriday/server/profile"
+	"itsfriday/store/db/sqlite"
+	"itsfriday/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	profile := &profile.Profile{
+		Mode:   "dev",
+		Driver: "sqlite",
+		DSN:    filepath.Join(t.TempDir(), "itsfriday_test.db"),
+	}
+	driver, err := sqlite.NewDB(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { driver.Close() })
+	storetest.TestDatabase(t, driver, profile)
+}
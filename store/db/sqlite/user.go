@@ -38,6 +38,9 @@ func (d *DB) UpdateUser(ctx context.Context, update *store.UpdateUser) (*store.U
 	if v := update.Username; v != nil {
 		set, args = append(set, "username = ?"), append(args, *v)
 	}
+	if v := update.Role; v != nil {
+		set, args = append(set, "role = ?"), append(args, *v)
+	}
 	if v := update.Email; v != nil {
 		set, args = append(set, "email = ?"), append(args, *v)
 	}
@@ -99,6 +102,13 @@ func (d *DB) ListUsers(ctx context.Context, find *store.FindUser) ([]*store.User
 	if v := find.Nickname; v != nil {
 		where, args = append(where, "nickname = ?"), append(args, *v)
 	}
+	if v := find.RowStatus; v != nil {
+		where, args = append(where, "row_status = ?"), append(args, *v)
+	}
+	if v := find.Search; v != nil {
+		pattern := "%" + *v + "%"
+		where, args = append(where, "(username LIKE ? OR email LIKE ? OR nickname LIKE ?)"), append(args, pattern, pattern, pattern)
+	}
 
 	orderBy := []string{"created_ts DESC", "row_status DESC"}
 	query := `
@@ -118,6 +128,9 @@ func (d *DB) ListUsers(ctx context.Context, find *store.FindUser) ([]*store.User
 		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY ` + strings.Join(orderBy, ", ")
 	if v := find.Limit; v != nil {
 		query += fmt.Sprintf(" LIMIT %d", *v)
+		if v := find.Offset; v != nil {
+			query += fmt.Sprintf(" OFFSET %d", *v)
+		}
 	}
 
 	rows, err := d.db.QueryContext(ctx, query, args...)
@@ -154,15 +167,43 @@ func (d *DB) ListUsers(ctx context.Context, find *store.FindUser) ([]*store.User
 	return list, nil
 }
 
+// DeleteUser deletes the user and the rows of every module owned by the user in one transaction.
+// Books reviewed by other users are kept without their owner.
 func (d *DB) DeleteUser(ctx context.Context, delete *store.DeleteUser) error {
-	result, err := d.db.ExecContext(ctx, `
-		DELETE FROM user WHERE id = ?
-	`, delete.ID)
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if _, err := result.RowsAffected(); err != nil {
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT username FROM user WHERE id = ?
+	`, delete.ID).Scan(&username); err != nil {
 		return err
 	}
-	return nil
+
+	for _, stmt := range []string{
+		"DELETE FROM `book_review` WHERE `user_id` = ?",
+		"DELETE FROM `book` WHERE `user_id` = ? AND `id` NOT IN (SELECT `book_id` FROM `book_review`)",
+		"UPDATE `book` SET `user_id` = NULL WHERE `user_id` = ?",
+		"DELETE FROM `expense` WHERE `user_id` = ?",
+		"DELETE FROM `expense_category` WHERE `user_id` = ?",
+		"DELETE FROM `event` WHERE `user_id` = ?",
+		"DELETE FROM `user_identity` WHERE `user_id` = ?",
+		"DELETE FROM `passkey` WHERE `user_id` = ?",
+		"DELETE FROM `user_setting` WHERE `user_id` = ?",
+		"DELETE FROM `user` WHERE `id` = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, delete.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM login_attempt WHERE kind = 'USERNAME' AND subject = ?
+	`, strings.ToLower(username)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -17,7 +17,7 @@ func (d *DB) UpsertUserSetting(ctx context.Context, upsert *store.UserSetting) (
 		SET value = EXCLUDED.value
 	`
 	if _, err := d.db.ExecContext(ctx, stmt, upsert.UserID, upsert.Key.String(), upsert.Value); err != nil {
-		return nil, err
+		return nil, foreignKeyError(err, store.ErrMissingReference)
 	}
 	return upsert, nil
 }
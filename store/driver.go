@@ -22,6 +22,33 @@ type Driver interface {
 	ListUserSettings(ctx context.Context, find *FindUserSetting) ([]*UserSetting, error)
 	DeleteUserSetting(ctx context.Context, delete *DeleteUserSetting) error
 
+	// workspace service
+	UpsertWorkspaceSetting(ctx context.Context, upsert *WorkspaceSetting) (*WorkspaceSetting, error)
+	ListWorkspaceSettings(ctx context.Context, find *FindWorkspaceSetting) ([]*WorkspaceSetting, error)
+	DeleteWorkspaceSetting(ctx context.Context, delete *DeleteWorkspaceSetting) error
+
+	UpsertLoginAttempt(ctx context.Context, upsert *LoginAttempt) (*LoginAttempt, error)
+	IncrementLoginAttempt(ctx context.Context, increment *IncrementLoginAttempt) (*LoginAttempt, error)
+	ListLoginAttempts(ctx context.Context, find *FindLoginAttempt) ([]*LoginAttempt, error)
+	DeleteLoginAttempt(ctx context.Context, delete *DeleteLoginAttempt) error
+
+	CreateAuditLog(ctx context.Context, create *AuditLog) (*AuditLog, error)
+	ListAuditLogs(ctx context.Context, find *FindAuditLog) ([]*AuditLog, error)
+
+	CreateIdentityProvider(ctx context.Context, create *IdentityProvider) (*IdentityProvider, error)
+	UpdateIdentityProvider(ctx context.Context, update *UpdateIdentityProvider) (*IdentityProvider, error)
+	ListIdentityProviders(ctx context.Context, find *FindIdentityProvider) ([]*IdentityProvider, error)
+	DeleteIdentityProvider(ctx context.Context, delete *DeleteIdentityProvider) error
+
+	CreateUserIdentity(ctx context.Context, create *UserIdentity) (*UserIdentity, error)
+	ListUserIdentities(ctx context.Context, find *FindUserIdentity) ([]*UserIdentity, error)
+	DeleteUserIdentity(ctx context.Context, delete *DeleteUserIdentity) error
+
+	CreatePasskey(ctx context.Context, create *Passkey) (*Passkey, error)
+	UpdatePasskey(ctx context.Context, update *UpdatePasskey) (*Passkey, error)
+	ListPasskeys(ctx context.Context, find *FindPasskey) ([]*Passkey, error)
+	DeletePasskey(ctx context.Context, delete *DeletePasskey) error
+
 	// libro service
 	CreateBook(ctx context.Context, create *Book) (*Book, error)
 	UpdateBook(ctx context.Context, update *UpdateBook) (*Book, error)
@@ -46,4 +73,8 @@ type Driver interface {
 	ListDineroExpenses(ctx context.Context, find *FindDineroExpense) ([]*DineroExpense, error)
 	DeleteDineroExpense(ctx context.Context, delete *DeleteDineroExpense) error
 	GetTotalCostByCategory(ctx context.Context, find *FindDineroExpense) ([]*TotalCostPerCategory, error)
+
+	// evento service
+	CreateEvent(ctx context.Context, create *Event) (*Event, error)
+	ListEvents(ctx context.Context, find *FindEvent) ([]*Event, error)
 }
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+)
+
+type Event struct {
+	ID        int32
+	CreatedTs int64
+
+	UserID  int32
+	Title   string
+	Place   string
+	StartTs int64
+	EndTs   int64
+}
+
+type FindEvent struct {
+	ID *int32
+
+	UserID *int32
+}
+
+func (s *Store) CreateEvent(ctx context.Context, create *Event) (*Event, error) {
+	return s.driver.CreateEvent(ctx, create)
+}
+
+func (s *Store) ListEvents(ctx context.Context, find *FindEvent) ([]*Event, error) {
+	return s.driver.ListEvents(ctx, find)
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+)
+
+type IdentityProviderType string
+
+const (
+	// IdentityProviderTypeOIDC is an OpenID Connect provider.
+	IdentityProviderTypeOIDC IdentityProviderType = "OIDC"
+)
+
+type IdentityProvider struct {
+	ID        int32
+	CreatedTs int64
+
+	Name string
+	Type IdentityProviderType
+	// AutoProvision creates a user on the first login of an unknown subject.
+	AutoProvision bool
+	Config        *IdentityProviderConfig
+}
+
+type IdentityProviderConfig struct {
+	OIDC *OIDCConfig `json:"oidc,omitempty"`
+}
+
+type OIDCConfig struct {
+	// IssuerURL is discovered at <IssuerURL>/.well-known/openid-configuration.
+	IssuerURL    string        `json:"issuerUrl"`
+	ClientID     string        `json:"clientId"`
+	ClientSecret string        `json:"clientSecret"`
+	Scopes       []string      `json:"scopes"`
+	FieldMapping *FieldMapping `json:"fieldMapping"`
+}
+
+// FieldMapping maps the claims of the provider to the user fields.
+type FieldMapping struct {
+	Identifier  string `json:"identifier"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+}
+
+type UpdateIdentityProvider struct {
+	ID int32
+
+	Name          *string
+	AutoProvision *bool
+	Config        *IdentityProviderConfig
+}
+
+type FindIdentityProvider struct {
+	ID *int32
+}
+
+type DeleteIdentityProvider struct {
+	ID int32
+}
+
+func (s *Store) CreateIdentityProvider(ctx context.Context, create *IdentityProvider) (*IdentityProvider, error) {
+	identityProvider, err := s.driver.CreateIdentityProvider(ctx, create)
+	if err != nil {
+		return nil, err
+	}
+
+	s.identityProviderCache.Store(identityProvider.ID, identityProvider)
+	return identityProvider, nil
+}
+
+func (s *Store) ListIdentityProviders(ctx context.Context, find *FindIdentityProvider) ([]*IdentityProvider, error) {
+	list, err := s.driver.ListIdentityProviders(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identityProvider := range list {
+		s.identityProviderCache.Store(identityProvider.ID, identityProvider)
+	}
+	return list, nil
+}
+
+func (s *Store) GetIdentityProvider(ctx context.Context, find *FindIdentityProvider) (*IdentityProvider, error) {
+	if find.ID != nil {
+		if cache, ok := s.identityProviderCache.Load(*find.ID); ok {
+			identityProvider, ok := cache.(*IdentityProvider)
+			if ok {
+				return identityProvider, nil
+			}
+		}
+	}
+
+	list, err := s.ListIdentityProviders(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (s *Store) UpdateIdentityProvider(ctx context.Context, update *UpdateIdentityProvider) (*IdentityProvider, error) {
+	identityProvider, err := s.driver.UpdateIdentityProvider(ctx, update)
+	if err != nil {
+		return nil, err
+	}
+
+	s.identityProviderCache.Store(identityProvider.ID, identityProvider)
+	return identityProvider, nil
+}
+
+// DeleteIdentityProvider deletes the provider together with the identities linked to it.
+func (s *Store) DeleteIdentityProvider(ctx context.Context, delete *DeleteIdentityProvider) error {
+	if err := s.driver.DeleteUserIdentity(ctx, &DeleteUserIdentity{IdpID: &delete.ID}); err != nil {
+		return err
+	}
+	if err := s.driver.DeleteIdentityProvider(ctx, delete); err != nil {
+		return err
+	}
+
+	s.identityProviderCache.Delete(delete.ID)
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+)
+
+type LoginAttemptKind string
+
+const (
+	// LoginAttemptKindUsername tracks the failed logins for a username or email.
+	LoginAttemptKindUsername LoginAttemptKind = "USERNAME"
+	// LoginAttemptKindIP tracks the failed logins from a client IP.
+	LoginAttemptKindIP LoginAttemptKind = "IP"
+)
+
+// LoginAttempt is the failed login state of a username or a client IP.
+type LoginAttempt struct {
+	Kind         LoginAttemptKind
+	Subject      string
+	FailedCount  int32
+	LastFailedTs int64
+	// LockedUntilTs is zero unless the subject is locked out.
+	LockedUntilTs int64
+}
+
+type FindLoginAttempt struct {
+	Kind    *LoginAttemptKind
+	Subject *string
+	// LockedAfterTs finds the attempts which are locked out after the timestamp.
+	LockedAfterTs *int64
+}
+
+// IncrementLoginAttempt counts a failed login of the subject in one statement, so that concurrent failures are all counted.
+type IncrementLoginAttempt struct {
+	Kind     LoginAttemptKind
+	Subject  string
+	FailedTs int64
+	// ResetBeforeTs forgets the failures before it, counting starts over as it does after an expired lockout.
+	ResetBeforeTs int64
+	// LockoutAttempts is the failed count from which the subject is locked out until LockedUntilTs.
+	LockoutAttempts int32
+	LockedUntilTs   int64
+}
+
+type DeleteLoginAttempt struct {
+	Kind    LoginAttemptKind
+	Subject string
+}
+
+func (s *Store) UpsertLoginAttempt(ctx context.Context, upsert *LoginAttempt) (*LoginAttempt, error) {
+	return s.driver.UpsertLoginAttempt(ctx, upsert)
+}
+
+// IncrementLoginAttempt counts a failed login and returns the updated state of the subject.
+func (s *Store) IncrementLoginAttempt(ctx context.Context, increment *IncrementLoginAttempt) (*LoginAttempt, error) {
+	return s.driver.IncrementLoginAttempt(ctx, increment)
+}
+
+func (s *Store) ListLoginAttempts(ctx context.Context, find *FindLoginAttempt) ([]*LoginAttempt, error) {
+	return s.driver.ListLoginAttempts(ctx, find)
+}
+
+func (s *Store) GetLoginAttempt(ctx context.Context, find *FindLoginAttempt) (*LoginAttempt, error) {
+	list, err := s.ListLoginAttempts(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (s *Store) DeleteLoginAttempt(ctx context.Context, delete *DeleteLoginAttempt) error {
+	return s.driver.DeleteLoginAttempt(ctx, delete)
+}
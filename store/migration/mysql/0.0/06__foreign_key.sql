@@ -0,0 +1,106 @@
+-- The constraints fail on the rows which refer to missing rows, `itsfriday migrate repair` deletes them.
+-- MySQL commits every ALTER TABLE on its own, so a failed run leaves the constraints added before the failure.
+-- Each constraint is added only when information_schema does not have it yet, so the migration can be run again after a repair.
+
+-- the owner of a book kept after its owner was purged was 0, it is NULL now
+ALTER TABLE book MODIFY user_id INT NULL;
+UPDATE book SET user_id = NULL WHERE user_id NOT IN (SELECT id FROM user);
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'book' AND CONSTRAINT_NAME = 'fk_book_user_id') = 0,
+  'ALTER TABLE book ADD CONSTRAINT fk_book_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE SET NULL',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'expense_category' AND CONSTRAINT_NAME = 'fk_expense_category_user_id') = 0,
+  'ALTER TABLE expense_category ADD CONSTRAINT fk_expense_category_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'book_review' AND CONSTRAINT_NAME = 'fk_book_review_user_id') = 0,
+  'ALTER TABLE book_review ADD CONSTRAINT fk_book_review_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'book_review' AND CONSTRAINT_NAME = 'fk_book_review_book_id') = 0,
+  'ALTER TABLE book_review ADD CONSTRAINT fk_book_review_book_id FOREIGN KEY (book_id) REFERENCES book (id) ON DELETE RESTRICT',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'expense' AND CONSTRAINT_NAME = 'fk_expense_user_id') = 0,
+  'ALTER TABLE expense ADD CONSTRAINT fk_expense_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'expense' AND CONSTRAINT_NAME = 'fk_expense_category_id') = 0,
+  'ALTER TABLE expense ADD CONSTRAINT fk_expense_category_id FOREIGN KEY (category_id) REFERENCES expense_category (id) ON DELETE RESTRICT',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'event' AND CONSTRAINT_NAME = 'fk_event_user_id') = 0,
+  'ALTER TABLE event ADD CONSTRAINT fk_event_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'user_setting' AND CONSTRAINT_NAME = 'fk_user_setting_user_id') = 0,
+  'ALTER TABLE user_setting ADD CONSTRAINT fk_user_setting_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'user_identity' AND CONSTRAINT_NAME = 'fk_user_identity_user_id') = 0,
+  'ALTER TABLE user_identity ADD CONSTRAINT fk_user_identity_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'user_identity' AND CONSTRAINT_NAME = 'fk_user_identity_idp_id') = 0,
+  'ALTER TABLE user_identity ADD CONSTRAINT fk_user_identity_idp_id FOREIGN KEY (idp_id) REFERENCES idp (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+  (SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = 'passkey' AND CONSTRAINT_NAME = 'fk_passkey_user_id') = 0,
+  'ALTER TABLE passkey ADD CONSTRAINT fk_passkey_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE',
+  'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
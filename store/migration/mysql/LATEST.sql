@@ -0,0 +1,187 @@
+-- migration_history
+CREATE TABLE IF NOT EXISTS migration_history (
+  version VARCHAR(32) NOT NULL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP())
+);
+
+-- user
+CREATE TABLE IF NOT EXISTS user (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  updated_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  row_status VARCHAR(16) NOT NULL CHECK (row_status IN ('NORMAL', 'ARCHIVED')) DEFAULT 'NORMAL',
+  username VARCHAR(256) NOT NULL UNIQUE,
+  role VARCHAR(16) NOT NULL CHECK (role IN ('HOST', 'ADMIN', 'USER')) DEFAULT 'USER',
+  email VARCHAR(256) NOT NULL,
+  nickname VARCHAR(256) NOT NULL,
+  password_hash VARCHAR(256) NOT NULL,
+  avatar_url VARCHAR(1024) NOT NULL DEFAULT '',
+  description VARCHAR(1024) NOT NULL DEFAULT '',
+  INDEX idx_user_username (username)
+);
+
+-- user_setting
+CREATE TABLE IF NOT EXISTS user_setting (
+  user_id INT NOT NULL,
+  `key` VARCHAR(256) NOT NULL,
+  value LONGTEXT NOT NULL,
+  UNIQUE(user_id, `key`),
+  CONSTRAINT fk_user_setting_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
+
+-- workspace_setting
+CREATE TABLE IF NOT EXISTS workspace_setting (
+  `key` VARCHAR(256) NOT NULL UNIQUE,
+  value LONGTEXT NOT NULL
+);
+
+-- login_attempt
+CREATE TABLE IF NOT EXISTS login_attempt (
+  kind VARCHAR(16) NOT NULL CHECK (kind IN ('USERNAME', 'IP')),
+  subject VARCHAR(256) NOT NULL,
+  failed_count INT NOT NULL DEFAULT 0,
+  last_failed_ts BIGINT NOT NULL DEFAULT 0,
+  locked_until_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(kind, subject)
+);
+
+-- audit_log
+-- append-only, entries are kept after the account is purged
+CREATE TABLE IF NOT EXISTS audit_log (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  user_id INT NOT NULL DEFAULT 0,
+  actor_id INT NOT NULL DEFAULT 0,
+  action VARCHAR(64) NOT NULL,
+  outcome VARCHAR(16) NOT NULL CHECK (outcome IN ('SUCCESS', 'FAILURE')),
+  client_ip VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent VARCHAR(1024) NOT NULL DEFAULT '',
+  detail TEXT NOT NULL,
+  INDEX idx_audit_log_user_id (user_id)
+);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+-- idp
+CREATE TABLE IF NOT EXISTS idp (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  name VARCHAR(256) NOT NULL,
+  type VARCHAR(16) NOT NULL CHECK (type IN ('OIDC')),
+  auto_provision BOOLEAN NOT NULL DEFAULT FALSE,
+  config TEXT NOT NULL
+);
+
+-- user_identity
+CREATE TABLE IF NOT EXISTS user_identity (
+  user_id INT NOT NULL,
+  idp_id INT NOT NULL,
+  subject VARCHAR(256) NOT NULL,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  UNIQUE(idp_id, subject),
+  UNIQUE(user_id, idp_id),
+  CONSTRAINT fk_user_identity_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+  CONSTRAINT fk_user_identity_idp_id FOREIGN KEY (idp_id) REFERENCES idp (id) ON DELETE CASCADE
+);
+
+-- passkey
+CREATE TABLE IF NOT EXISTS passkey (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  user_id INT NOT NULL,
+  name VARCHAR(256) NOT NULL,
+  credential_id VARBINARY(1023) NOT NULL,
+  public_key BLOB NOT NULL,
+  attestation_type VARCHAR(64) NOT NULL DEFAULT '',
+  aaguid VARBINARY(16) NOT NULL DEFAULT '',
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  transports VARCHAR(256) NOT NULL DEFAULT '[]',
+  backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+  backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(credential_id),
+  INDEX idx_passkey_user_id (user_id),
+  CONSTRAINT fk_passkey_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
+
+-- LIBERO service --
+
+-- book
+-- a book reviewed by other users is kept without its owner when the owner is purged
+CREATE TABLE IF NOT EXISTS book (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  user_id INT NULL,
+  title VARCHAR(256) NOT NULL,
+  author VARCHAR(256) NOT NULL,
+  translator VARCHAR(256) NOT NULL DEFAULT '',
+  pages INT NOT NULL,
+  pub_year INT NOT NULL,
+  genre VARCHAR(64) NOT NULL DEFAULT '',
+  UNIQUE(title, author),
+  CONSTRAINT fk_book_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE SET NULL
+);
+
+-- book_review
+CREATE TABLE IF NOT EXISTS book_review (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  user_id INT NOT NULL,
+  book_id INT NOT NULL,
+  date_read VARCHAR(10) NOT NULL CHECK (length(date_read) = 10 AND substr(date_read, 5, 1) = '-' AND substr(date_read, 8, 1) = '-'), -- YYYY-MM-DD
+  rating REAL NOT NULL CHECK (rating >= 0 AND rating <= 5),
+  review TEXT NOT NULL,
+  public BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE(user_id, book_id, date_read),
+  INDEX idx_book_review_user_id_date_read (user_id, date_read),
+  INDEX idx_book_review_book_id_date_read (book_id, date_read),
+  CONSTRAINT fk_book_review_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+  CONSTRAINT fk_book_review_book_id FOREIGN KEY (book_id) REFERENCES book (id) ON DELETE RESTRICT
+);
+
+-- DINERO service --
+
+-- category
+CREATE TABLE IF NOT EXISTS expense_category (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  user_id INT NOT NULL,
+  name VARCHAR(256) NOT NULL,
+  priority INT NOT NULL DEFAULT 1,
+  UNIQUE(user_id, name),
+  INDEX idx_expense_category_user_id (user_id),
+  CONSTRAINT fk_expense_category_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
+
+-- expense
+CREATE TABLE IF NOT EXISTS expense (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  user_id INT NOT NULL,
+  category_id INT NOT NULL,
+  date_used VARCHAR(10) NOT NULL CHECK (length(date_used) = 10 AND substr(date_used, 5, 1) = '-' AND substr(date_used, 8, 1) = '-'), -- YYYY-MM-DD
+  item VARCHAR(256) NOT NULL,
+  price INT NOT NULL,
+  INDEX idx_expense_user_id (user_id),
+  INDEX idx_expense_user_id_category_id_date_used (user_id, category_id, date_used),
+  CONSTRAINT fk_expense_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE,
+  CONSTRAINT fk_expense_category_id FOREIGN KEY (category_id) REFERENCES expense_category (id) ON DELETE RESTRICT
+);
+
+-- EVENTO service --
+
+-- event
+CREATE TABLE IF NOT EXISTS event (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  user_id INT NOT NULL,
+  title VARCHAR(256) NOT NULL,
+  place VARCHAR(256) NOT NULL DEFAULT '',
+  start_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  end_ts BIGINT NOT NULL DEFAULT (UNIX_TIMESTAMP()),
+  INDEX idx_event_user_id_start_ts (user_id, start_ts),
+  CONSTRAINT fk_event_user_id FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+-- The constraints fail on the rows which refer to missing rows, `itsfriday migrate repair` deletes them.
+
+-- the owner of a book kept after its owner was purged was 0, it is NULL now
+ALTER TABLE book ALTER COLUMN user_id DROP NOT NULL;
+UPDATE book SET user_id = NULL WHERE user_id NOT IN (SELECT id FROM "user");
+ALTER TABLE book ADD CONSTRAINT book_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE SET NULL;
+ALTER TABLE expense_category ADD CONSTRAINT expense_category_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+ALTER TABLE book_review ADD CONSTRAINT book_review_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+ALTER TABLE book_review ADD CONSTRAINT book_review_book_id_fkey FOREIGN KEY (book_id) REFERENCES book (id) ON DELETE RESTRICT;
+ALTER TABLE expense ADD CONSTRAINT expense_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+ALTER TABLE expense ADD CONSTRAINT expense_category_id_fkey FOREIGN KEY (category_id) REFERENCES expense_category (id) ON DELETE RESTRICT;
+ALTER TABLE event ADD CONSTRAINT event_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+ALTER TABLE user_setting ADD CONSTRAINT user_setting_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+ALTER TABLE user_identity ADD CONSTRAINT user_identity_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
+ALTER TABLE user_identity ADD CONSTRAINT user_identity_idp_id_fkey FOREIGN KEY (idp_id) REFERENCES idp (id) ON DELETE CASCADE;
+ALTER TABLE passkey ADD CONSTRAINT passkey_user_id_fkey FOREIGN KEY (user_id) REFERENCES "user" (id) ON DELETE CASCADE;
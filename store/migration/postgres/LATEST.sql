@@ -0,0 +1,189 @@
+-- migration_history
+CREATE TABLE IF NOT EXISTS migration_history (
+  version TEXT NOT NULL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT)
+);
+
+-- user
+CREATE TABLE IF NOT EXISTS "user" (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  updated_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  row_status TEXT NOT NULL CHECK (row_status IN ('NORMAL', 'ARCHIVED')) DEFAULT 'NORMAL',
+  username TEXT NOT NULL UNIQUE,
+  role TEXT NOT NULL CHECK (role IN ('HOST', 'ADMIN', 'USER')) DEFAULT 'USER',
+  email TEXT NOT NULL,
+  nickname TEXT NOT NULL,
+  password_hash TEXT NOT NULL,
+  avatar_url TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_username ON "user" (username);
+
+-- user_setting
+CREATE TABLE IF NOT EXISTS user_setting (
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  value TEXT NOT NULL,
+  UNIQUE(user_id, key)
+);
+
+-- workspace_setting
+CREATE TABLE IF NOT EXISTS workspace_setting (
+  key TEXT NOT NULL UNIQUE,
+  value TEXT NOT NULL
+);
+
+-- login_attempt
+CREATE TABLE IF NOT EXISTS login_attempt (
+  kind TEXT NOT NULL CHECK (kind IN ('USERNAME', 'IP')),
+  subject TEXT NOT NULL,
+  failed_count INTEGER NOT NULL DEFAULT 0,
+  last_failed_ts BIGINT NOT NULL DEFAULT 0,
+  locked_until_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(kind, subject)
+);
+
+-- audit_log
+-- append-only, entries are kept after the account is purged
+CREATE TABLE IF NOT EXISTS audit_log (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  user_id INTEGER NOT NULL DEFAULT 0,
+  actor_id INTEGER NOT NULL DEFAULT 0,
+  action TEXT NOT NULL,
+  outcome TEXT NOT NULL CHECK (outcome IN ('SUCCESS', 'FAILURE')),
+  client_ip TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- idp
+CREATE TABLE IF NOT EXISTS idp (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  name TEXT NOT NULL,
+  type TEXT NOT NULL CHECK (type IN ('OIDC')),
+  auto_provision BOOLEAN NOT NULL DEFAULT FALSE,
+  config TEXT NOT NULL DEFAULT '{}'
+);
+
+-- user_identity
+CREATE TABLE IF NOT EXISTS user_identity (
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  idp_id INTEGER NOT NULL REFERENCES idp (id) ON DELETE CASCADE,
+  subject TEXT NOT NULL,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  UNIQUE(idp_id, subject),
+  UNIQUE(user_id, idp_id)
+);
+
+-- passkey
+CREATE TABLE IF NOT EXISTS passkey (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  credential_id BYTEA NOT NULL,
+  public_key BYTEA NOT NULL,
+  attestation_type TEXT NOT NULL DEFAULT '',
+  aaguid BYTEA NOT NULL DEFAULT '',
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  transports TEXT NOT NULL DEFAULT '[]',
+  backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+  backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(credential_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkey_user_id ON passkey (user_id);
+
+-- LIBERO service --
+
+-- book
+-- a book reviewed by other users is kept without its owner when the owner is purged
+CREATE TABLE IF NOT EXISTS book (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  user_id INTEGER REFERENCES "user" (id) ON DELETE SET NULL,
+  title TEXT NOT NULL,
+  author TEXT NOT NULL,
+  translator TEXT NOT NULL DEFAULT '',
+  pages INTEGER NOT NULL,
+  pub_year INTEGER NOT NULL,
+  genre TEXT NOT NULL DEFAULT '',
+  UNIQUE(title, author)
+);
+
+-- book_review
+CREATE TABLE IF NOT EXISTS book_review (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  book_id INTEGER NOT NULL REFERENCES book (id) ON DELETE RESTRICT,
+  date_read TEXT NOT NULL CHECK (length(date_read) = 10 AND substr(date_read, 5, 1) = '-' AND substr(date_read, 8, 1) = '-'), -- YYYY-MM-DD
+  rating REAL NOT NULL CHECK (rating >= 0 AND rating <= 5),
+  review TEXT NOT NULL DEFAULT '',
+  public BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE(user_id, book_id, date_read)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_review_user_id_date_read ON book_review (user_id, date_read);
+CREATE INDEX IF NOT EXISTS idx_book_review_book_id_date_read ON book_review (book_id, date_read);
+
+-- DINERO service --
+
+-- category
+CREATE TABLE IF NOT EXISTS expense_category (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  priority INTEGER NOT NULL DEFAULT 1,
+  UNIQUE(user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_category_user_id ON expense_category (user_id);
+
+-- expense
+CREATE TABLE IF NOT EXISTS expense (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  category_id INTEGER NOT NULL REFERENCES expense_category (id) ON DELETE RESTRICT,
+  date_used TEXT NOT NULL CHECK (length(date_used) = 10 AND substr(date_used, 5, 1) = '-' AND substr(date_used, 8, 1) = '-'), -- YYYY-MM-DD
+  item TEXT NOT NULL,
+  price INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_expense_user_id ON expense (user_id);
+CREATE INDEX IF NOT EXISTS idx_expense_user_id_category_id_date_used ON expense (user_id, category_id, date_used);
+
+-- EVENTO service --
+
+-- event
+CREATE TABLE IF NOT EXISTS event (
+  id SERIAL PRIMARY KEY,
+  created_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  place TEXT NOT NULL DEFAULT '',
+  start_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT),
+  end_ts BIGINT NOT NULL DEFAULT CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT)
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_user_id_start_ts ON event (user_id, start_ts);
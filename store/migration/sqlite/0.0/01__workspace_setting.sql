@@ -0,0 +1,5 @@
+-- workspace_setting
+CREATE TABLE IF NOT EXISTS workspace_setting (
+  key TEXT NOT NULL UNIQUE,
+  value TEXT NOT NULL
+);
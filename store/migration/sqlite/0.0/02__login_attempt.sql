@@ -0,0 +1,9 @@
+-- login_attempt
+CREATE TABLE IF NOT EXISTS login_attempt (
+  kind TEXT NOT NULL CHECK (kind IN ('USERNAME', 'IP')),
+  subject TEXT NOT NULL,
+  failed_count INTEGER NOT NULL DEFAULT 0,
+  last_failed_ts BIGINT NOT NULL DEFAULT 0,
+  locked_until_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(kind, subject)
+);
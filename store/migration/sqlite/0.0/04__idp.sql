@@ -0,0 +1,19 @@
+-- idp
+CREATE TABLE IF NOT EXISTS idp (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  name TEXT NOT NULL,
+  type TEXT NOT NULL CHECK (type IN ('OIDC')),
+  auto_provision INTEGER NOT NULL DEFAULT 0,
+  config TEXT NOT NULL DEFAULT '{}'
+);
+
+-- user_identity
+CREATE TABLE IF NOT EXISTS user_identity (
+  user_id INTEGER NOT NULL,
+  idp_id INTEGER NOT NULL,
+  subject TEXT NOT NULL,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  UNIQUE(idp_id, subject),
+  UNIQUE(user_id, idp_id)
+);
@@ -0,0 +1,19 @@
+-- passkey
+CREATE TABLE IF NOT EXISTS passkey (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  credential_id BLOB NOT NULL,
+  public_key BLOB NOT NULL,
+  attestation_type TEXT NOT NULL DEFAULT '',
+  aaguid BLOB NOT NULL DEFAULT x'',
+  sign_count INTEGER NOT NULL DEFAULT 0,
+  transports TEXT NOT NULL DEFAULT '[]',
+  backup_eligible INTEGER NOT NULL DEFAULT 0,
+  backup_state INTEGER NOT NULL DEFAULT 0,
+  last_used_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(credential_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkey_user_id ON passkey (user_id);
@@ -0,0 +1,162 @@
+-- SQLite cannot add a foreign key to a table, so the tables are rebuilt, the referenced ones first.
+-- The copies fail on the rows which refer to missing rows, `itsfriday migrate repair` deletes them.
+-- The sequences of the ids are kept, the ids of deleted rows are not used again.
+
+-- book
+-- the owner of a book kept after its owner was purged was 0, it is NULL now
+CREATE TABLE book_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER REFERENCES user (id) ON DELETE SET NULL,
+  title TEXT NOT NULL,
+  author TEXT NOT NULL,
+  translator TEXT NOT NULL DEFAULT '',
+  pages INTEGER NOT NULL,
+  pub_year INTEGER NOT NULL,
+  genre TEXT NOT NULL DEFAULT '',
+  UNIQUE(title, author)
+);
+
+INSERT INTO book_new (id, created_ts, user_id, title, author, translator, pages, pub_year, genre)
+SELECT id, created_ts, CASE WHEN user_id IN (SELECT id FROM user) THEN user_id END, title, author, translator, pages, pub_year, genre FROM book;
+DELETE FROM sqlite_sequence WHERE name = 'book_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'book_new', seq FROM sqlite_sequence WHERE name = 'book';
+DROP TABLE book;
+ALTER TABLE book_new RENAME TO book;
+
+-- expense_category
+CREATE TABLE expense_category_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  priority INTEGER NOT NULL DEFAULT 1,
+  UNIQUE(user_id, name)
+);
+
+INSERT INTO expense_category_new (id, user_id, name, priority)
+SELECT id, user_id, name, priority FROM expense_category;
+DELETE FROM sqlite_sequence WHERE name = 'expense_category_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'expense_category_new', seq FROM sqlite_sequence WHERE name = 'expense_category';
+DROP TABLE expense_category;
+ALTER TABLE expense_category_new RENAME TO expense_category;
+
+CREATE INDEX IF NOT EXISTS idx_expense_category_user_id ON expense_category (user_id);
+
+-- book_review
+CREATE TABLE book_review_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  book_id INTEGER NOT NULL REFERENCES book (id) ON DELETE RESTRICT,
+  date_read TEXT NOT NULL CHECK (length(date_read) = 10 AND substr(date_read, 5, 1) = '-' AND substr(date_read, 8, 1) = '-'), -- YYYY-MM-DD
+  rating REAL NOT NULL CHECK (rating >= 0 AND rating <= 5),
+  review TEXT NOT NULL DEFAULT '',
+  public INTEGER NOT NULL DEFAULT 0,
+  UNIQUE(user_id, book_id, date_read)
+);
+
+INSERT INTO book_review_new (id, created_ts, user_id, book_id, date_read, rating, review, public)
+SELECT id, created_ts, user_id, book_id, date_read, rating, review, public FROM book_review;
+DELETE FROM sqlite_sequence WHERE name = 'book_review_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'book_review_new', seq FROM sqlite_sequence WHERE name = 'book_review';
+DROP TABLE book_review;
+ALTER TABLE book_review_new RENAME TO book_review;
+
+CREATE INDEX IF NOT EXISTS idx_book_review_user_id_date_read ON book_review (user_id, date_read);
+CREATE INDEX IF NOT EXISTS idx_book_review_book_id_date_read ON book_review (book_id, date_read);
+
+-- expense
+CREATE TABLE expense_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  category_id INTEGER NOT NULL REFERENCES expense_category (id) ON DELETE RESTRICT,
+  date_used TEXT NOT NULL CHECK (length(date_used) = 10 AND substr(date_used, 5, 1) = '-' AND substr(date_used, 8, 1) = '-'), -- YYYY-MM-DD
+  item TEXT NOT NULL,
+  price INTEGER NOT NULL
+);
+
+INSERT INTO expense_new (id, created_ts, user_id, category_id, date_used, item, price)
+SELECT id, created_ts, user_id, category_id, date_used, item, price FROM expense;
+DELETE FROM sqlite_sequence WHERE name = 'expense_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'expense_new', seq FROM sqlite_sequence WHERE name = 'expense';
+DROP TABLE expense;
+ALTER TABLE expense_new RENAME TO expense;
+
+CREATE INDEX IF NOT EXISTS idx_expense_user_id ON expense (user_id);
+CREATE INDEX IF NOT EXISTS idx_expense_user_id_category_id_date_used ON expense (user_id, category_id, date_used);
+
+-- event
+CREATE TABLE event_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  place TEXT NOT NULL DEFAULT '',
+  start_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  end_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now'))
+);
+
+INSERT INTO event_new (id, created_ts, user_id, title, place, start_ts, end_ts)
+SELECT id, created_ts, user_id, title, place, start_ts, end_ts FROM event;
+DELETE FROM sqlite_sequence WHERE name = 'event_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'event_new', seq FROM sqlite_sequence WHERE name = 'event';
+DROP TABLE event;
+ALTER TABLE event_new RENAME TO event;
+
+CREATE INDEX IF NOT EXISTS idx_event_user_id_start_ts ON event (user_id, start_ts);
+
+-- user_setting
+CREATE TABLE user_setting_new (
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  value TEXT NOT NULL,
+  UNIQUE(user_id, key)
+);
+
+INSERT INTO user_setting_new (user_id, key, value)
+SELECT user_id, key, value FROM user_setting;
+DROP TABLE user_setting;
+ALTER TABLE user_setting_new RENAME TO user_setting;
+
+-- user_identity
+CREATE TABLE user_identity_new (
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  idp_id INTEGER NOT NULL REFERENCES idp (id) ON DELETE CASCADE,
+  subject TEXT NOT NULL,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  UNIQUE(idp_id, subject),
+  UNIQUE(user_id, idp_id)
+);
+
+INSERT INTO user_identity_new (user_id, idp_id, subject, created_ts)
+SELECT user_id, idp_id, subject, created_ts FROM user_identity;
+DROP TABLE user_identity;
+ALTER TABLE user_identity_new RENAME TO user_identity;
+
+-- passkey
+CREATE TABLE passkey_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  credential_id BLOB NOT NULL,
+  public_key BLOB NOT NULL,
+  attestation_type TEXT NOT NULL DEFAULT '',
+  aaguid BLOB NOT NULL DEFAULT x'',
+  sign_count INTEGER NOT NULL DEFAULT 0,
+  transports TEXT NOT NULL DEFAULT '[]',
+  backup_eligible INTEGER NOT NULL DEFAULT 0,
+  backup_state INTEGER NOT NULL DEFAULT 0,
+  last_used_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(credential_id)
+);
+
+INSERT INTO passkey_new (id, created_ts, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, last_used_ts)
+SELECT id, created_ts, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, last_used_ts FROM passkey;
+DELETE FROM sqlite_sequence WHERE name = 'passkey_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'passkey_new', seq FROM sqlite_sequence WHERE name = 'passkey';
+DROP TABLE passkey;
+ALTER TABLE passkey_new RENAME TO passkey;
+
+CREATE INDEX IF NOT EXISTS idx_passkey_user_id ON passkey (user_id);
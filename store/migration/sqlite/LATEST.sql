@@ -23,19 +23,102 @@ CREATE INDEX IF NOT EXISTS idx_user_username ON user (username);
 
 -- user_setting
 CREATE TABLE IF NOT EXISTS user_setting (
-  user_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
   key TEXT NOT NULL,
   value TEXT NOT NULL,
   UNIQUE(user_id, key)
 );
 
+-- workspace_setting
+CREATE TABLE IF NOT EXISTS workspace_setting (
+  key TEXT NOT NULL UNIQUE,
+  value TEXT NOT NULL
+);
+
+-- login_attempt
+CREATE TABLE IF NOT EXISTS login_attempt (
+  kind TEXT NOT NULL CHECK (kind IN ('USERNAME', 'IP')),
+  subject TEXT NOT NULL,
+  failed_count INTEGER NOT NULL DEFAULT 0,
+  last_failed_ts BIGINT NOT NULL DEFAULT 0,
+  locked_until_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(kind, subject)
+);
+
+-- audit_log
+-- append-only, entries are kept after the account is purged
+CREATE TABLE IF NOT EXISTS audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL DEFAULT 0,
+  actor_id INTEGER NOT NULL DEFAULT 0,
+  action TEXT NOT NULL,
+  outcome TEXT NOT NULL CHECK (outcome IN ('SUCCESS', 'FAILURE')),
+  client_ip TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+-- idp
+CREATE TABLE IF NOT EXISTS idp (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  name TEXT NOT NULL,
+  type TEXT NOT NULL CHECK (type IN ('OIDC')),
+  auto_provision INTEGER NOT NULL DEFAULT 0,
+  config TEXT NOT NULL DEFAULT '{}'
+);
+
+-- user_identity
+CREATE TABLE IF NOT EXISTS user_identity (
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  idp_id INTEGER NOT NULL REFERENCES idp (id) ON DELETE CASCADE,
+  subject TEXT NOT NULL,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  UNIQUE(idp_id, subject),
+  UNIQUE(user_id, idp_id)
+);
+
+-- passkey
+CREATE TABLE IF NOT EXISTS passkey (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  credential_id BLOB NOT NULL,
+  public_key BLOB NOT NULL,
+  attestation_type TEXT NOT NULL DEFAULT '',
+  aaguid BLOB NOT NULL DEFAULT x'',
+  sign_count INTEGER NOT NULL DEFAULT 0,
+  transports TEXT NOT NULL DEFAULT '[]',
+  backup_eligible INTEGER NOT NULL DEFAULT 0,
+  backup_state INTEGER NOT NULL DEFAULT 0,
+  last_used_ts BIGINT NOT NULL DEFAULT 0,
+  UNIQUE(credential_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_passkey_user_id ON passkey (user_id);
+
 -- LIBERO service --
 
 -- book
+-- a book reviewed by other users is kept without its owner when the owner is purged
 CREATE TABLE IF NOT EXISTS book (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
-  user_id INTEGER NOT NULL,
+  user_id INTEGER REFERENCES user (id) ON DELETE SET NULL,
   title TEXT NOT NULL,
   author TEXT NOT NULL,
   translator TEXT NOT NULL DEFAULT '',
@@ -49,8 +132,8 @@ CREATE TABLE IF NOT EXISTS book (
 CREATE TABLE IF NOT EXISTS book_review (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
-  user_id INTEGER NOT NULL,
-  book_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  book_id INTEGER NOT NULL REFERENCES book (id) ON DELETE RESTRICT,
   date_read TEXT NOT NULL CHECK (length(date_read) = 10 AND substr(date_read, 5, 1) = '-' AND substr(date_read, 8, 1) = '-'), -- YYYY-MM-DD
   rating REAL NOT NULL CHECK (rating >= 0 AND rating <= 5),
   review TEXT NOT NULL DEFAULT '',
@@ -66,7 +149,7 @@ CREATE INDEX IF NOT EXISTS idx_book_review_book_id_date_read ON book_review (boo
 -- category
 CREATE TABLE IF NOT EXISTS expense_category (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
-  user_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
   name TEXT NOT NULL,
   priority INTEGER NOT NULL DEFAULT 1,
   UNIQUE(user_id, name)
@@ -78,8 +161,8 @@ CREATE INDEX IF NOT EXISTS idx_expense_category_user_id ON expense_category (use
 CREATE TABLE IF NOT EXISTS expense (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
-  user_id INTEGER NOT NULL,
-  category_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  category_id INTEGER NOT NULL REFERENCES expense_category (id) ON DELETE RESTRICT,
   date_used TEXT NOT NULL CHECK (length(date_used) = 10 AND substr(date_used, 5, 1) = '-' AND substr(date_used, 8, 1) = '-'), -- YYYY-MM-DD
   item TEXT NOT NULL,
   price INTEGER NOT NULL
@@ -106,7 +189,7 @@ CREATE INDEX IF NOT EXISTS idx_expense_user_id_category_id_date_used ON expense
 CREATE TABLE IF NOT EXISTS event (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   created_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
-  user_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES user (id) ON DELETE CASCADE,
   title TEXT NOT NULL,
   place TEXT NOT NULL DEFAULT '',
   start_ts BIGINT NOT NULL DEFAULT (strftime('%s', 'now')),
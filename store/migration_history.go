@@ -1,5 +1,9 @@
 package store
 
+import (
+	"strings"
+)
+
 type MigrationHistory struct {
 	Version   string
 	CreatedTs int64
@@ -11,3 +15,25 @@ type UpsertMigrationHistory struct {
 
 type FindMigrationHistory struct {
 }
+
+// Migration is a file under migration/<driver>/<minor>/ which changes the schema to its version.
+type Migration struct {
+	Version  string
+	Name     string
+	FileName string
+}
+
+// MinorVersion is the directory of the migration, e.g. 0.1 of 0.1.2.
+func (m *Migration) MinorVersion() string {
+	return m.Version[:strings.LastIndex(m.Version, ".")]
+}
+
+type MigrationStatus struct {
+	// SchemaVersion is the schema version of this binary.
+	SchemaVersion string
+	// DatabaseVersion is the newest migration applied to the database, empty for a new database.
+	DatabaseVersion string
+	Applied         []*MigrationHistory
+	// Pending are the migrations Migrate would apply.
+	Pending []*Migration
+}
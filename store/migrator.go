@@ -4,7 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
 
 	"itsfriday/server/version"
 )
@@ -17,38 +23,127 @@ const (
 	TestDataFileName = "TEST_DATA.sql"
 )
 
+// ErrDatabaseNewer is returned by Migrate when the database was migrated by a newer binary.
+var ErrDatabaseNewer = errors.New("the database schema is newer than this binary")
+
+// Migrate brings the schema of the database to the version of this binary.
+// A new database gets LATEST.sql, an existing one the migrations newer than its version, each in a transaction.
+// A database migrated by a newer binary is refused, its schema may not work with this one.
 func (s *Store) Migrate(ctx context.Context) error {
-	migrationHistoryList, err := s.driver.FindMigrationHistoryList(ctx, &FindMigrationHistory{})
-	if err != nil || len(migrationHistoryList) == 0 {
-		filePath := s.getMigrationBasePath() + LatestSchemaFileName
-		bytes, err := migrationFS.ReadFile(filePath)
-		if err != nil {
-			return fmt.Errorf("failed to read latest schema file: %w", err)
-		}
-		schemaVersion, err := s.GetCurrentSchemaVersion()
-		if err != nil {
-			return fmt.Errorf("failed to get current schema version: %w", err)
+	status, err := s.GetMigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.DatabaseVersion == "" {
+		if err := s.applyLatestSchema(ctx, status.SchemaVersion); err != nil {
+			return err
 		}
-	
-		tx, err := s.driver.GetDB().Begin()
-		if err != nil {
-			return fmt.Errorf("failed to start transaction: %w", err)
+	} else {
+		if status.IsDatabaseNewer() {
+			return fmt.Errorf("%w: the database is at %s, this binary at %s", ErrDatabaseNewer, status.DatabaseVersion, status.SchemaVersion)
 		}
-		defer tx.Rollback()
-		if err := s.execute(ctx, tx, string(bytes)); err != nil {
-			return fmt.Errorf("failed to execute SQL file %s, err %w", filePath, err)
+		for _, migration := range status.Pending {
+			if err := s.applyMigration(ctx, migration); err != nil {
+				if s.hasOrphans(ctx) {
+					return fmt.Errorf("%w, some rows refer to rows which do not exist, delete them with `itsfriday migrate repair`", err)
+				}
+				return err
+			}
+			slog.Info("applied migration", "version", migration.Version, "file", migration.FileName)
 		}
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if err := s.MigrateAccessTokens(ctx); err != nil {
+		return fmt.Errorf("failed to migrate access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetMigrationStatus compares the migration history of the database with the migrations of this binary.
+func (s *Store) GetMigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	migrations, err := s.listMigrations()
+	if err != nil {
+		return nil, err
+	}
+	schemaVersion, err := s.GetCurrentSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current schema version: %w", err)
+	}
+	status := &MigrationStatus{
+		SchemaVersion: schemaVersion,
+		Applied:       []*MigrationHistory{},
+		Pending:       []*Migration{},
+	}
+
+	// the history table does not exist before LATEST.sql is applied
+	migrationHistoryList, err := s.driver.FindMigrationHistoryList(ctx, &FindMigrationHistory{})
+	if err != nil || len(migrationHistoryList) == 0 {
+		return status, nil
+	}
+	status.Applied = migrationHistoryList
+	sort.SliceStable(status.Applied, func(i, j int) bool {
+		return isVersionNewer(status.Applied[j].Version, status.Applied[i].Version)
+	})
+	for _, migrationHistory := range migrationHistoryList {
+		if status.DatabaseVersion == "" || isVersionNewer(migrationHistory.Version, status.DatabaseVersion) {
+			status.DatabaseVersion = migrationHistory.Version
 		}
-		if _, err := s.driver.UpsertMigrationHistory(ctx, &UpsertMigrationHistory{
-			Version: schemaVersion,
-		}); err != nil {
-			return fmt.Errorf("failed to upsert migration history: %w", err)
+	}
+	for _, migration := range migrations {
+		if isVersionNewer(migration.Version, status.DatabaseVersion) && !isVersionNewer(migration.Version, schemaVersion) {
+			status.Pending = append(status.Pending, migration)
 		}
 	}
+	return status, nil
+}
 
-    return nil
+func (s *Store) applyLatestSchema(ctx context.Context, schemaVersion string) error {
+	filePath := s.getMigrationBasePath() + LatestSchemaFileName
+	bytes, err := migrationFS.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read latest schema file: %w", err)
+	}
+
+	tx, err := s.driver.GetDB().Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := s.execute(ctx, tx, string(bytes)); err != nil {
+		return fmt.Errorf("failed to execute SQL file %s, err %w", filePath, err)
+	}
+	if err := s.insertMigrationHistory(ctx, tx, schemaVersion); err != nil {
+		return fmt.Errorf("failed to insert migration history: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, migration *Migration) error {
+	filePath := s.getMigrationBasePath() + migration.FileName
+	bytes, err := migrationFS.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read migration file %s: %w", filePath, err)
+	}
+
+	tx, err := s.driver.GetDB().Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := s.execute(ctx, tx, string(bytes)); err != nil {
+		return fmt.Errorf("failed to execute SQL file %s, err %w", filePath, err)
+	}
+	if err := s.insertMigrationHistory(ctx, tx, migration.Version); err != nil {
+		return fmt.Errorf("failed to insert migration history: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 func (s *Store) InsertTestData(ctx context.Context) error {
@@ -76,6 +171,19 @@ func (s *Store) getMigrationBasePath() string {
 	return fmt.Sprintf("migration/%s/", s.Profile.Driver)
 }
 
+// insertMigrationHistory records the version in the transaction of its migration,
+// so that a crash after the commit cannot leave an applied migration which is run again on the next start.
+func (s *Store) insertMigrationHistory(ctx context.Context, tx *sql.Tx, version string) error {
+	stmt := "INSERT INTO migration_history (version) VALUES (?)"
+	if s.Profile.Driver == "postgres" {
+		stmt = "INSERT INTO migration_history (version) VALUES ($1)"
+	}
+	if _, err := tx.ExecContext(ctx, stmt, version); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (*Store) execute(ctx context.Context, tx *sql.Tx, stmt string) error {
 	if _, err := tx.ExecContext(ctx, stmt); err != nil {
 		return fmt.Errorf("failed to execute statement: %s", err)
@@ -83,8 +191,82 @@ func (*Store) execute(ctx context.Context, tx *sql.Tx, stmt string) error {
 	return nil
 }
 
+// GetCurrentSchemaVersion is the version of the newest migration up to the minor version of the binary,
+// <minor>.0 if there is none.
 func (s *Store) GetCurrentSchemaVersion() (string, error) {
 	currentVersion := version.GetCurrentVersion(s.Profile.Mode)
 	minorVersion := version.GetMinorVersion(currentVersion)
-	return fmt.Sprintf("%s.0", minorVersion), nil
+	schemaVersion := fmt.Sprintf("%s.0", minorVersion)
+	migrations, err := s.listMigrations()
+	if err != nil {
+		return "", err
+	}
+	for _, migration := range migrations {
+		if isVersionNewer(migration.Version, schemaVersion) && !isVersionNewer(migration.MinorVersion(), minorVersion) {
+			schemaVersion = migration.Version
+		}
+	}
+	return schemaVersion, nil
+}
+
+// listMigrations lists the migrations of the driver in the order they are applied.
+// They are named <minor>/<NN>__<description>.sql and NN is the patch of their version, e.g. 0.1/02__passkey.sql is 0.1.2.
+func (s *Store) listMigrations() ([]*Migration, error) {
+	basePath := s.getMigrationBasePath()
+	dirs, err := fs.ReadDir(migrationFS, strings.TrimSuffix(basePath, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration directory: %w", err)
+	}
+	migrations := []*Migration{}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		files, err := fs.ReadDir(migrationFS, basePath+dir.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration directory: %w", err)
+		}
+		for _, file := range files {
+			patch, name, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), "__")
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".sql") || !ok {
+				return nil, fmt.Errorf("unexpected migration file %s/%s", dir.Name(), file.Name())
+			}
+			patchNumber, err := strconv.Atoi(patch)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected migration file %s/%s", dir.Name(), file.Name())
+			}
+			migrations = append(migrations, &Migration{
+				Version:  fmt.Sprintf("%s.%d", dir.Name(), patchNumber),
+				Name:     name,
+				FileName: dir.Name() + "/" + file.Name(),
+			})
+		}
+	}
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return isVersionNewer(migrations[j].Version, migrations[i].Version)
+	})
+	return migrations, nil
+}
+
+// IsDatabaseNewer reports if the database was migrated by a newer binary.
+func (status *MigrationStatus) IsDatabaseNewer() bool {
+	return status.DatabaseVersion != "" && isVersionNewer(status.DatabaseVersion, status.SchemaVersion)
+}
+
+// isVersionNewer compares two versions like 0.1.2 part by part.
+func isVersionNewer(version string, than string) bool {
+	a, b := strings.Split(version, "."), strings.Split(than, ".")
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x, _ = strconv.Atoi(a[i])
+		}
+		if i < len(b) {
+			y, _ = strconv.Atoi(b[i])
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
 }
@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+	"itsfriday/store/db/sqlite"
+)
+
+// newOldSQLiteStore returns a store on a SQLite database with the schema of 0.0.0,
+// the first released one, from testdata/sqlite_0.0.0.sql.
+func newOldSQLiteStore(t *testing.T) (*store.Store, store.Driver) {
+	t.Helper()
+	profile := &profile.Profile{
+		Mode:   "dev",
+		Driver: "sqlite",
+		DSN:    filepath.Join(t.TempDir(), "itsfriday_test.db"),
+	}
+	driver, err := sqlite.NewDB(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { driver.Close() })
+	schema, err := os.ReadFile(filepath.Join("testdata", "sqlite_0.0.0.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.GetDB().Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.GetDB().Exec("INSERT INTO migration_history (version) VALUES ('0.0.0')"); err != nil {
+		t.Fatal(err)
+	}
+	return store.New(driver, profile), driver
+}
+
+// migrationHistoryVersions lists the versions of the migration history from the oldest.
+func migrationHistoryVersions(t *testing.T, s *store.Store) []string {
+	t.Helper()
+	status, err := s.GetMigrationStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []string{}
+	for _, migrationHistory := range status.Applied {
+		versions = append(versions, migrationHistory.Version)
+	}
+	return versions
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	ctx := context.Background()
+	s, driver := newOldSQLiteStore(t)
+
+	status, err := s.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every migration since 0.0.0 is pending, up to the newest one
+	want := []string{"0.0.0"}
+	for _, migration := range status.Pending {
+		want = append(want, migration.Version)
+	}
+	if status.DatabaseVersion != "0.0.0" || len(want) < 7 || want[len(want)-1] != status.SchemaVersion {
+		t.Fatalf("status is %s to %s with the pending migrations %v", status.DatabaseVersion, status.SchemaVersion, want[1:])
+	}
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if versions := migrationHistoryVersions(t, s); !slices.Equal(versions, want) {
+		t.Errorf("migration history is %v, want %v", versions, want)
+	}
+
+	// a second run applies nothing
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if versions := migrationHistoryVersions(t, s); !slices.Equal(versions, want) {
+		t.Errorf("migration history is %v after a second run, want %v", versions, want)
+	}
+
+	// a database stamped by a newer binary is refused and left alone
+	if _, err := driver.GetDB().Exec("INSERT INTO migration_history (version) VALUES ('99.0.0')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(ctx); !errors.Is(err, store.ErrDatabaseNewer) {
+		t.Errorf("migrate returned %v, want %v", err, store.ErrDatabaseNewer)
+	}
+	want = append(want, "99.0.0")
+	if versions := migrationHistoryVersions(t, s); !slices.Equal(versions, want) {
+		t.Errorf("migration history is %v after the refused run, want %v", versions, want)
+	}
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+)
+
+// Passkey is a WebAuthn credential a user signs in with.
+type Passkey struct {
+	ID        int32
+	CreatedTs int64
+	UserID    int32
+	// Name is given by the user to tell the passkeys apart.
+	Name string
+	// CredentialID is the id the authenticator chose for the credential.
+	CredentialID []byte
+	// PublicKey is the COSE encoded public key of the credential.
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	// SignCount is the last signature counter of the authenticator, zero if it does not count.
+	SignCount uint32
+	// Transports are the ways the authenticator can be reached, e.g. usb or internal.
+	Transports     []string
+	BackupEligible bool
+	BackupState    bool
+	// LastUsedTs is zero until the passkey signs in.
+	LastUsedTs int64
+}
+
+type FindPasskey struct {
+	ID           *int32
+	UserID       *int32
+	CredentialID []byte
+}
+
+type UpdatePasskey struct {
+	ID          int32
+	Name        *string
+	SignCount   *uint32
+	BackupState *bool
+	LastUsedTs  *int64
+}
+
+type DeletePasskey struct {
+	ID     int32
+	UserID int32
+}
+
+func (s *Store) CreatePasskey(ctx context.Context, create *Passkey) (*Passkey, error) {
+	return s.driver.CreatePasskey(ctx, create)
+}
+
+func (s *Store) UpdatePasskey(ctx context.Context, update *UpdatePasskey) (*Passkey, error) {
+	return s.driver.UpdatePasskey(ctx, update)
+}
+
+func (s *Store) ListPasskeys(ctx context.Context, find *FindPasskey) ([]*Passkey, error) {
+	return s.driver.ListPasskeys(ctx, find)
+}
+
+func (s *Store) GetPasskey(ctx context.Context, find *FindPasskey) (*Passkey, error) {
+	list, err := s.ListPasskeys(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (s *Store) DeletePasskey(ctx context.Context, delete *DeletePasskey) error {
+	return s.driver.DeletePasskey(ctx, delete)
+}
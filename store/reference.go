@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMissingReference is returned by the drivers when a created or updated row refers to a row which does not exist,
+	// like a review of a deleted book.
+	ErrMissingReference = errors.New("the referenced row does not exist")
+	// ErrReferenced is returned by the drivers when a deleted row is still referred to,
+	// like a book with reviews or a category with expenses.
+	ErrReferenced = errors.New("the row is still referred to")
+)
+
+// Reference is a foreign key of the schema, a column which refers to the id of a row of another table.
+type Reference struct {
+	Table           string
+	Column          string
+	ReferencedTable string
+	// OnDelete is what happens to the row when the referenced one is deleted: CASCADE or RESTRICT.
+	OnDelete string
+}
+
+// Orphans are the rows whose reference points to a row which does not exist.
+// They are left by the databases migrated before 0.0.6, which had no foreign keys.
+type Orphans struct {
+	*Reference
+	Count int64
+}
+
+// references are the foreign keys which cannot be missing, in the order their orphans are repaired:
+// the orphans of a category are deleted before the expenses are checked.
+// A book keeps its owner as NULL, which the migration to foreign keys sets for the owners which do not exist.
+var references = []*Reference{
+	{Table: "expense_category", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+	{Table: "book_review", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+	{Table: "book_review", Column: "book_id", ReferencedTable: "book", OnDelete: "RESTRICT"},
+	{Table: "expense", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+	{Table: "expense", Column: "category_id", ReferencedTable: "expense_category", OnDelete: "RESTRICT"},
+	{Table: "event", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+	{Table: "user_setting", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+	{Table: "user_identity", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+	{Table: "user_identity", Column: "idp_id", ReferencedTable: "idp", OnDelete: "CASCADE"},
+	{Table: "passkey", Column: "user_id", ReferencedTable: "user", OnDelete: "CASCADE"},
+}
+
+// FindOrphans counts the orphans of every reference.
+func (s *Store) FindOrphans(ctx context.Context) ([]*Orphans, error) {
+	db := s.driver.GetDB()
+	if db == nil {
+		return nil, errors.New("the driver has no database to check")
+	}
+	list := []*Orphans{}
+	for _, reference := range references {
+		orphans := &Orphans{Reference: reference}
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+s.orphanCondition(reference)).Scan(&orphans.Count); err != nil {
+			return nil, fmt.Errorf("failed to count the orphans of %s.%s: %w", reference.Table, reference.Column, err)
+		}
+		list = append(list, orphans)
+	}
+	return list, nil
+}
+
+// RepairOrphans deletes the orphans in one transaction.
+// It is run offline on a database whose migration to foreign keys fails on them.
+func (s *Store) RepairOrphans(ctx context.Context) ([]*Orphans, error) {
+	db := s.driver.GetDB()
+	if db == nil {
+		return nil, errors.New("the driver has no database to repair")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	list := []*Orphans{}
+	for _, reference := range references {
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+s.orphanCondition(reference))
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete the orphans of %s.%s: %w", reference.Table, reference.Column, err)
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &Orphans{Reference: reference, Count: count})
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return list, nil
+}
+
+// hasOrphans reports if there are orphans, to explain a failed migration.
+func (s *Store) hasOrphans(ctx context.Context) bool {
+	list, err := s.FindOrphans(ctx)
+	if err != nil {
+		return false
+	}
+	for _, orphans := range list {
+		if orphans.Count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) orphanCondition(reference *Reference) string {
+	table, referencedTable := reference.Table, reference.ReferencedTable
+	// user is a reserved word of postgres
+	if s.Profile.Driver == "postgres" {
+		table, referencedTable = `"`+table+`"`, `"`+referencedTable+`"`
+	}
+	return fmt.Sprintf("%s WHERE %s NOT IN (SELECT id FROM %s)", table, reference.Column, referencedTable)
+}
@@ -0,0 +1,115 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"strings"
+	"testing"
+
+	"itsfriday/store"
+)
+
+// insertOrphans fills a database of 0.0.0, which had no foreign keys, with a user and their rows,
+// and with an expense, a book review and a user setting which refer to rows which do not exist.
+// A book of a missing owner is not an orphan, the migration to foreign keys keeps it without an owner.
+func insertOrphans(t *testing.T, db *sql.DB) {
+	t.Helper()
+	for _, stmt := range []string{
+		"INSERT INTO user (id, username, email, nickname, password_hash) VALUES (1, 'alice', 'alice@example.com', 'alice', '')",
+		"INSERT INTO user_setting (user_id, key, value) VALUES (1, 'TIMEZONE', 'Asia/Seoul')",
+		"INSERT INTO expense_category (id, user_id, name) VALUES (1, 1, 'Food')",
+		"INSERT INTO expense (user_id, category_id, date_used, item, price) VALUES (1, 1, '2024-12-31', 'kept', 1)",
+		"INSERT INTO book (id, user_id, title, author, pages, pub_year) VALUES (1, 1, 'Kept', 'Author', 100, 2000)",
+		"INSERT INTO book (id, user_id, title, author, pages, pub_year) VALUES (2, 2, 'Ownerless', 'Author', 100, 2000)",
+		"INSERT INTO book_review (user_id, book_id, date_read, rating) VALUES (1, 1, '2024-12-31', 5)",
+		// the orphans
+		"INSERT INTO expense (user_id, category_id, date_used, item, price) VALUES (1, 2, '2024-12-31', 'dangling', 1)",
+		"INSERT INTO book_review (user_id, book_id, date_read, rating) VALUES (1, 3, '2024-12-31', 5)",
+		"INSERT INTO user_setting (user_id, key, value) VALUES (2, 'TIMEZONE', 'Asia/Seoul')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %s: %v", stmt, err)
+		}
+	}
+}
+
+// orphanCounts maps table.column to the orphans of the reference which has any.
+func orphanCounts(list []*store.Orphans) map[string]int64 {
+	counts := map[string]int64{}
+	for _, orphans := range list {
+		if orphans.Count > 0 {
+			counts[orphans.Table+"."+orphans.Column] = orphans.Count
+		}
+	}
+	return counts
+}
+
+func expectOrphanCounts(t *testing.T, what string, list []*store.Orphans, want map[string]int64) {
+	t.Helper()
+	if counts := orphanCounts(list); !maps.Equal(counts, want) {
+		t.Errorf("%s: orphans are %v, want %v", what, counts, want)
+	}
+}
+
+func TestRepairOrphans(t *testing.T) {
+	ctx := context.Background()
+	s, driver := newOldSQLiteStore(t)
+	db := driver.GetDB()
+	insertOrphans(t, db)
+	want := map[string]int64{
+		"expense.category_id":  1,
+		"book_review.book_id":  1,
+		"user_setting.user_id": 1,
+	}
+
+	// the migration to foreign keys fails on the orphans and points to the repair
+	err := s.Migrate(ctx)
+	if err == nil || !strings.Contains(err.Error(), "06__foreign_key.sql") || !strings.Contains(err.Error(), "itsfriday migrate repair") {
+		t.Fatalf("migrate returned %v, want the failed migration to foreign keys with the repair", err)
+	}
+	status, err := s.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Pending) != 1 || status.Pending[0].Name != "foreign_key" {
+		t.Fatalf("%d migrations are pending after the failure, want the one to foreign keys", len(status.Pending))
+	}
+
+	list, err := s.FindOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrphanCounts(t, "found", list, want)
+	list, err = s.RepairOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrphanCounts(t, "deleted", list, want)
+	list, err = s.FindOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOrphanCounts(t, "left", list, map[string]int64{})
+
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the rows of alice and the ownerless book are kept
+	for table, want := range map[string]int64{"user_setting": 1, "expense": 1, "book_review": 1, "book": 2} {
+		var count int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Errorf("%d rows of %s after the repair, want %d", count, table, want)
+		}
+	}
+	var ownerID sql.NullInt32
+	if err := db.QueryRow("SELECT user_id FROM book WHERE id = 2").Scan(&ownerID); err != nil {
+		t.Fatal(err)
+	}
+	if ownerID.Valid {
+		t.Errorf("the owner of the ownerless book is %d, want NULL", ownerID.Int32)
+	}
+}
@@ -12,6 +12,14 @@ type Store struct {
 
 	userCache             sync.Map
 	userSettingCache      sync.Map
+	workspaceSettingCache sync.Map
+	identityProviderCache sync.Map
+	// userTokenLocks holds a *sync.Mutex per user, see lockUserTokens.
+	userTokenLocks        sync.Map
+	// signUpLock serializes the signups, see CreateSignUpUser.
+	signUpLock            sync.Mutex
+	// inviteCodesLock serializes the updates of the invite codes, see UpdateWorkspaceInviteCodes.
+	inviteCodesLock       sync.Mutex
 }
 
 func New(driver Driver, profile *profile.Profile) *Store {
@@ -0,0 +1,248 @@
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"itsfriday/store"
+)
+
+func checkDineroCategories(c *checker) error {
+	walter, err := c.createUser("walter", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	created := []*store.DineroCategory{}
+	for _, category := range []*store.DineroCategory{
+		{UserID: walter.ID, Name: "rent", Priority: 2},
+		{UserID: walter.ID, Name: "food", Priority: 1},
+		{UserID: walter.ID, Name: "fun", Priority: 3},
+	} {
+		category, err := c.driver.CreateDineroCategory(c.ctx, category)
+		if err != nil {
+			return err
+		}
+		if category.ID == 0 {
+			c.errorf("created expense category has no id")
+		}
+		created = append(created, category)
+	}
+
+	list, err := c.driver.ListDineroCategories(c.ctx, &store.FindDineroCategory{UserID: &walter.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "expense categories by priority", categoryNames(list), "food,rent,fun")
+	list, err = c.driver.ListDineroCategories(c.ctx, &store.FindDineroCategory{UserID: &walter.ID, Name: ptr("rent")})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing an expense category by name found %d", len(list))
+	}
+	expect(c, "listed expense category", *list[0], *created[0])
+	list, err = c.driver.ListDineroCategories(c.ctx, &store.FindDineroCategory{ID: &created[1].ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "expense categories found by id", categoryNames(list), "food")
+
+	updated, err := c.driver.UpdateDineroCategory(c.ctx, &store.UpdateDineroCategory{ID: created[2].ID, Name: ptr("games"), Priority: ptr(int32(0))})
+	if err != nil {
+		return err
+	}
+	expect(c, "updated expense category", *updated, store.DineroCategory{ID: created[2].ID, UserID: walter.ID, Name: "games", Priority: 0})
+	_, err = c.driver.UpdateDineroCategory(c.ctx, &store.UpdateDineroCategory{ID: -1, Name: ptr("missing")})
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("updating a missing expense category returned %v, want sql.ErrNoRows", err)
+	}
+
+	if err := c.driver.DeleteDineroCategory(c.ctx, &store.DeleteDineroCategory{ID: created[0].ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListDineroCategories(c.ctx, &store.FindDineroCategory{UserID: &walter.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "expense categories after deleting one", categoryNames(list), "games,food")
+
+	_, err = c.driver.CreateDineroCategory(c.ctx, &store.DineroCategory{UserID: -1, Name: "rent"})
+	c.expectMissingReference("creating an expense category of a missing user", err)
+	return nil
+}
+
+// dineroFixture creates a user with expenses on the edges of the months of a leap year.
+func dineroFixture(c *checker, username string) (*store.User, []*store.DineroCategory, []*store.DineroExpense, error) {
+	user, err := c.createUser(username, store.RoleUser)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	categories := []*store.DineroCategory{}
+	for _, category := range []*store.DineroCategory{
+		{UserID: user.ID, Name: "travel", Priority: 3},
+		{UserID: user.ID, Name: "food", Priority: 1},
+		{UserID: user.ID, Name: "books", Priority: 2},
+		{UserID: user.ID, Name: "unused", Priority: 0},
+	} {
+		category, err := c.driver.CreateDineroCategory(c.ctx, category)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		categories = append(categories, category)
+	}
+	travel, food, books := categories[0].ID, categories[1].ID, categories[2].ID
+	expenses := []*store.DineroExpense{}
+	for _, expense := range []*store.DineroExpense{
+		{UserID: user.ID, CategoryID: food, DateUsed: "2024-02-29", Item: "cake", Price: 12},
+		{UserID: user.ID, CategoryID: food, DateUsed: "2024-01-31", Item: "bread", Price: 3},
+		{UserID: user.ID, CategoryID: travel, DateUsed: "2024-02-01", Item: "train", Price: 40},
+		{UserID: user.ID, CategoryID: food, DateUsed: "2024-02-01", Item: "milk", Price: 2},
+		{UserID: user.ID, CategoryID: books, DateUsed: "2024-03-01", Item: "novel", Price: 20},
+		{UserID: user.ID, CategoryID: books, DateUsed: "2024-12-15", Item: "atlas", Price: 35},
+	} {
+		expense, err := c.driver.CreateDineroExpense(c.ctx, expense)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	return user, categories, expenses, nil
+}
+
+func checkDineroExpenses(c *checker) error {
+	yvonne, categories, created, err := dineroFixture(c, "yvonne")
+	if err != nil {
+		return err
+	}
+	for _, expense := range created {
+		if expense.ID == 0 || expense.CreatedTs <= 0 {
+			c.errorf("created expense has no id or created ts")
+		}
+	}
+
+	list, err := c.driver.ListDineroExpenses(c.ctx, &store.FindDineroExpense{ID: &created[0].ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing an expense by id found %d", len(list))
+	}
+	expect(c, "listed expense", *list[0], *created[0])
+
+	for _, tc := range []struct {
+		what string
+		find *store.FindDineroExpense
+		want string
+	}{
+		{"user", &store.FindDineroExpense{UserID: &yvonne.ID}, "2024-01-31 2024-02-01 2024-02-01 2024-02-29 2024-03-01 2024-12-15"},
+		{"category", &store.FindDineroExpense{UserID: &yvonne.ID, CategoryID: &categories[1].ID}, "2024-01-31 2024-02-01 2024-02-29"},
+		{"february", &store.FindDineroExpense{UserID: &yvonne.ID, Year: ptr(int32(2024)), Month: ptr(int32(2))}, "2024-02-01 2024-02-01 2024-02-29"},
+		{"december", &store.FindDineroExpense{UserID: &yvonne.ID, Year: ptr(int32(2024)), Month: ptr(int32(12))}, "2024-12-15"},
+		{"a month without expenses", &store.FindDineroExpense{UserID: &yvonne.ID, Year: ptr(int32(2023)), Month: ptr(int32(2))}, ""},
+		{"a year without a month", &store.FindDineroExpense{UserID: &yvonne.ID, Year: ptr(int32(2023))}, "2024-01-31 2024-02-01 2024-02-01 2024-02-29 2024-03-01 2024-12-15"},
+		{"category and month", &store.FindDineroExpense{CategoryID: &categories[1].ID, Year: ptr(int32(2024)), Month: ptr(int32(1))}, "2024-01-31"},
+	} {
+		list, err := c.driver.ListDineroExpenses(c.ctx, tc.find)
+		if err != nil {
+			return err
+		}
+		expect(c, "dates of the expenses found by "+tc.what, expenseDates(list), tc.want)
+	}
+
+	updated, err := c.driver.UpdateDineroExpense(c.ctx, &store.UpdateDineroExpense{
+		ID:         created[1].ID,
+		CategoryID: &categories[2].ID,
+		DateUsed:   ptr("2024-02-02"),
+		Item:       ptr("cookbook"),
+		Price:      ptr(int32(25)),
+	})
+	if err != nil {
+		return err
+	}
+	want := *created[1]
+	want.CategoryID, want.DateUsed, want.Item, want.Price = categories[2].ID, "2024-02-02", "cookbook", 25
+	expect(c, "updated expense", *updated, want)
+	_, err = c.driver.UpdateDineroExpense(c.ctx, &store.UpdateDineroExpense{ID: -1, Item: ptr("missing")})
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("updating a missing expense returned %v, want sql.ErrNoRows", err)
+	}
+
+	if err := c.driver.DeleteDineroExpense(c.ctx, &store.DeleteDineroExpense{ID: created[5].ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListDineroExpenses(c.ctx, &store.FindDineroExpense{UserID: &yvonne.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "dates of the expenses after deleting one", expenseDates(list), "2024-02-01 2024-02-01 2024-02-02 2024-02-29 2024-03-01")
+
+	_, err = c.driver.CreateDineroExpense(c.ctx, &store.DineroExpense{UserID: yvonne.ID, CategoryID: -1, DateUsed: "2024-04-01", Item: "lost", Price: 1})
+	c.expectMissingReference("creating an expense in a missing category", err)
+	_, err = c.driver.UpdateDineroExpense(c.ctx, &store.UpdateDineroExpense{ID: created[0].ID, CategoryID: ptr(int32(-1))})
+	c.expectMissingReference("moving an expense to a missing category", err)
+	c.expectReferenced("deleting an expense category with expenses", c.driver.DeleteDineroCategory(c.ctx, &store.DeleteDineroCategory{ID: categories[1].ID}))
+	if err := c.driver.DeleteDineroCategory(c.ctx, &store.DeleteDineroCategory{ID: categories[3].ID}); err != nil {
+		c.errorf("deleting an expense category without expenses failed: %v", err)
+	}
+	return nil
+}
+
+// checkTotalCostByCategory checks the costs of a month, which only lists the categories
+// with expenses in it. The store adds the others.
+func checkTotalCostByCategory(c *checker) error {
+	zoe, _, _, err := dineroFixture(c, "zoe")
+	if err != nil {
+		return err
+	}
+	if _, _, _, err := dineroFixture(c, "zack"); err != nil {
+		return err
+	}
+
+	for _, tc := range []struct {
+		month int32
+		want  string
+	}{
+		{1, "food=3"},
+		{2, "food=14 travel=40"},
+		{3, "books=20"},
+		{12, "books=35"},
+		{11, ""},
+	} {
+		list, err := c.driver.GetTotalCostByCategory(c.ctx, &store.FindDineroExpense{UserID: &zoe.ID, Year: ptr(int32(2024)), Month: &tc.month})
+		if err != nil {
+			return err
+		}
+		got := ""
+		for i, totalCost := range list {
+			if i > 0 {
+				got += " "
+			}
+			got += fmt.Sprintf("%s=%d", totalCost.Name, totalCost.Cost)
+		}
+		expect(c, fmt.Sprintf("cost per category in 2024-%02d", tc.month), got, tc.want)
+	}
+	return nil
+}
+
+func categoryNames(list []*store.DineroCategory) string {
+	names := ""
+	for i, category := range list {
+		if i > 0 {
+			names += ","
+		}
+		names += category.Name
+	}
+	return names
+}
+
+func expenseDates(list []*store.DineroExpense) string {
+	dates := ""
+	for i, expense := range list {
+		if i > 0 {
+			dates += " "
+		}
+		dates += expense.DateUsed
+	}
+	return dates
+}
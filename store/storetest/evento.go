@@ -0,0 +1,52 @@
+package storetest
+
+import (
+	"fmt"
+
+	"itsfriday/store"
+)
+
+func checkEvents(c *checker) error {
+	uma, err := c.createUser("uma", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	created := map[string]*store.Event{}
+	for _, event := range []*store.Event{
+		{UserID: uma.ID, Title: "dinner", Place: "home", StartTs: 300, EndTs: 400},
+		{UserID: uma.ID, Title: "breakfast", StartTs: 100, EndTs: 150},
+		{UserID: uma.ID, Title: "lunch", Place: "office", StartTs: 200, EndTs: 250},
+	} {
+		event, err := c.driver.CreateEvent(c.ctx, event)
+		if err != nil {
+			return err
+		}
+		if event.ID == 0 || event.CreatedTs <= 0 {
+			c.errorf("created event has no id or created ts")
+		}
+		created[event.Title] = event
+	}
+
+	list, err := c.driver.ListEvents(c.ctx, &store.FindEvent{UserID: &uma.ID})
+	if err != nil {
+		return err
+	}
+	titles := []string{}
+	for _, event := range list {
+		titles = append(titles, event.Title)
+	}
+	expect(c, "events by start ts", fmt.Sprint(titles), "[breakfast lunch dinner]")
+
+	list, err = c.driver.ListEvents(c.ctx, &store.FindEvent{ID: &created["dinner"].ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing an event by id found %d", len(list))
+	}
+	expect(c, "listed event", *list[0], *created["dinner"])
+
+	_, err = c.driver.CreateEvent(c.ctx, &store.Event{UserID: -1, Title: "nobody's", StartTs: 100, EndTs: 200})
+	c.expectMissingReference("creating an event of a missing user", err)
+	return nil
+}
@@ -0,0 +1,262 @@
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"itsfriday/store"
+)
+
+func checkBooks(c *checker) error {
+	peggy, err := c.createUser("peggy", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	created := []*store.Book{}
+	for _, book := range []*store.Book{
+		{UserID: peggy.ID, Title: "Dune", Author: "Frank Herbert", Pages: 412, PubYear: 1965, Genre: "SF"},
+		{UserID: peggy.ID, Title: "Emma", Author: "Jane Austen", Pages: 474, PubYear: 1815},
+		{UserID: peggy.ID, Title: "Persuasion", Author: "Jane Austen", Translator: "nobody", Pages: 249, PubYear: 1817, Genre: "Novel"},
+	} {
+		book, err := c.driver.CreateBook(c.ctx, book)
+		if err != nil {
+			return err
+		}
+		if book.ID == 0 || book.CreatedTs <= 0 {
+			c.errorf("created book has no id or created ts")
+		}
+		created = append(created, book)
+	}
+
+	list, err := c.driver.ListBooks(c.ctx, &store.FindBook{ID: &created[2].ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing a book by id found %d", len(list))
+	}
+	expect(c, "listed book", *list[0], *created[2])
+
+	for _, tc := range []struct {
+		what string
+		find *store.FindBook
+		want int
+	}{
+		{"user", &store.FindBook{UserID: &peggy.ID}, 3},
+		{"title", &store.FindBook{Title: ptr("Emma")}, 1},
+		{"author", &store.FindBook{Author: ptr("Jane Austen")}, 2},
+		{"author and limit", &store.FindBook{Author: ptr("Jane Austen"), Limit: ptr(1)}, 1},
+		{"user and limit", &store.FindBook{UserID: &peggy.ID, Limit: ptr(2)}, 2},
+	} {
+		list, err := c.driver.ListBooks(c.ctx, tc.find)
+		if err != nil {
+			return err
+		}
+		expect(c, "number of books found by "+tc.what, len(list), tc.want)
+	}
+	list, err = c.driver.ListBooks(c.ctx, &store.FindBook{UserID: &peggy.ID})
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].CreatedTs < list[i].CreatedTs {
+			c.errorf("books are not ordered by created ts descending")
+		}
+	}
+
+	updated, err := c.driver.UpdateBook(c.ctx, &store.UpdateBook{
+		ID:         created[1].ID,
+		Title:      ptr("Emma."),
+		Translator: ptr("someone"),
+		Pages:      ptr(int32(475)),
+		PubYear:    ptr(int32(1816)),
+		Genre:      ptr("Novel"),
+	})
+	if err != nil {
+		return err
+	}
+	want := *created[1]
+	want.Title, want.Translator, want.Pages, want.PubYear, want.Genre = "Emma.", "someone", 475, 1816, "Novel"
+	expect(c, "updated book", *updated, want)
+	_, err = c.driver.UpdateBook(c.ctx, &store.UpdateBook{ID: -1, Title: ptr("missing")})
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("updating a missing book returned %v, want sql.ErrNoRows", err)
+	}
+
+	if err := c.driver.DeleteBook(c.ctx, &store.DeleteBook{ID: created[0].ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListBooks(c.ctx, &store.FindBook{UserID: &peggy.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of books after deleting one", len(list), 2)
+	return nil
+}
+
+func checkBookReviews(c *checker) error {
+	rupert, err := c.createUser("rupert", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	sybil, err := c.createUser("sybil", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	book, err := c.driver.CreateBook(c.ctx, &store.Book{UserID: rupert.ID, Title: "Ulysses", Author: "James Joyce", Pages: 730, PubYear: 1922})
+	if err != nil {
+		return err
+	}
+	created := []*store.BookReview{}
+	for _, review := range []*store.BookReview{
+		{UserID: rupert.ID, BookID: book.ID, DateRead: "2024-03-01", Rating: 4.5, Review: "long"},
+		{UserID: sybil.ID, BookID: book.ID, DateRead: "2024-03-02", Rating: 2},
+		{UserID: rupert.ID, BookID: book.ID, DateRead: "2024-05-01", Rating: 5, Review: "again"},
+	} {
+		review, err := c.driver.CreateBookReview(c.ctx, review)
+		if err != nil {
+			return err
+		}
+		if review.ID == 0 || review.CreatedTs <= 0 {
+			c.errorf("created book review has no id or created ts")
+		}
+		created = append(created, review)
+	}
+
+	list, err := c.driver.ListBookReviews(c.ctx, &store.FindBookReview{ID: &created[0].ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing a book review by id found %d", len(list))
+	}
+	expect(c, "listed book review", *list[0], *created[0])
+
+	for _, tc := range []struct {
+		what string
+		find *store.FindBookReview
+		want int
+	}{
+		{"book", &store.FindBookReview{BookID: &book.ID}, 3},
+		{"user", &store.FindBookReview{UserID: &rupert.ID}, 2},
+		{"date read", &store.FindBookReview{DateRead: ptr("2024-03-02")}, 1},
+		{"rating", &store.FindBookReview{BookID: &book.ID, Rating: ptr(float32(4.5))}, 1},
+		{"book and limit", &store.FindBookReview{BookID: &book.ID, Limit: ptr(2)}, 2},
+	} {
+		list, err := c.driver.ListBookReviews(c.ctx, tc.find)
+		if err != nil {
+			return err
+		}
+		expect(c, "number of book reviews found by "+tc.what, len(list), tc.want)
+	}
+
+	updated, err := c.driver.UpdateBookReview(c.ctx, &store.UpdateBookReview{
+		ID:       created[1].ID,
+		DateRead: ptr("2024-03-03"),
+		Rating:   ptr(float32(2.5)),
+		Review:   ptr("not for me"),
+	})
+	if err != nil {
+		return err
+	}
+	want := *created[1]
+	want.DateRead, want.Rating, want.Review = "2024-03-03", 2.5, "not for me"
+	expect(c, "updated book review", *updated, want)
+	_, err = c.driver.UpdateBookReview(c.ctx, &store.UpdateBookReview{ID: -1, Review: ptr("missing")})
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("updating a missing book review returned %v, want sql.ErrNoRows", err)
+	}
+
+	if err := c.driver.DeleteBookReview(c.ctx, &store.DeleteBookReview{ID: created[1].ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListBookReviews(c.ctx, &store.FindBookReview{BookID: &book.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of book reviews after deleting one", len(list), 2)
+
+	_, err = c.driver.CreateBookReview(c.ctx, &store.BookReview{UserID: sybil.ID, BookID: -1, DateRead: "2024-03-04", Rating: 3})
+	c.expectMissingReference("reviewing a missing book", err)
+	_, err = c.driver.UpdateBookReview(c.ctx, &store.UpdateBookReview{ID: created[0].ID, BookID: ptr(int32(-1))})
+	c.expectMissingReference("moving a book review to a missing book", err)
+	c.expectReferenced("deleting a reviewed book", c.driver.DeleteBook(c.ctx, &store.DeleteBook{ID: book.ID}))
+	list, err = c.driver.ListBookReviews(c.ctx, &store.FindBookReview{BookID: &book.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of book reviews after failing to delete their book", len(list), 2)
+	return nil
+}
+
+// checkBooksReadInYear checks the reads of a year and the report of the reads per year,
+// with reviews on the edges of the years.
+func checkBooksReadInYear(c *checker) error {
+	trent, err := c.createUser("trent", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	victor, err := c.createUser("victor", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	book, err := c.driver.CreateBook(c.ctx, &store.Book{UserID: trent.ID, Title: "Middlemarch", Author: "George Eliot", Translator: "none", Pages: 880, PubYear: 1871, Genre: "Novel"})
+	if err != nil {
+		return err
+	}
+	reviews := map[string]*store.BookReview{}
+	for _, dateRead := range []string{"2024-06-15", "2023-12-31", "2025-01-01", "2024-12-31", "2024-01-01"} {
+		review, err := c.driver.CreateBookReview(c.ctx, &store.BookReview{UserID: trent.ID, BookID: book.ID, DateRead: dateRead, Rating: 4, Review: "read " + dateRead})
+		if err != nil {
+			return err
+		}
+		reviews[dateRead] = review
+	}
+	if _, err := c.driver.CreateBookReview(c.ctx, &store.BookReview{UserID: victor.ID, BookID: book.ID, DateRead: "2024-02-02", Rating: 1}); err != nil {
+		return err
+	}
+
+	list, err := c.driver.ListBooksReadInYear(c.ctx, trent.ID, 2024)
+	if err != nil {
+		return err
+	}
+	dates := []string{}
+	for _, bookRead := range list {
+		dates = append(dates, bookRead.DateRead)
+	}
+	expect(c, "dates of the books read in 2024", fmt.Sprint(dates), "[2024-01-01 2024-06-15 2024-12-31]")
+	if len(list) > 0 {
+		review := reviews[list[0].DateRead]
+		want := store.BookRead{
+			BookID:     book.ID,
+			ReviewID:   review.ID,
+			Title:      book.Title,
+			Author:     book.Author,
+			Translator: book.Translator,
+			Pages:      book.Pages,
+			PubYear:    book.PubYear,
+			Genre:      book.Genre,
+			DateRead:   review.DateRead,
+			Rating:     review.Rating,
+			Review:     review.Review,
+		}
+		expect(c, "book read", *list[0], want)
+	}
+	list, err = c.driver.ListBooksReadInYear(c.ctx, trent.ID, 2022)
+	if err != nil {
+		return err
+	}
+	expect(c, "number of books read in 2022", len(list), 0)
+
+	report, err := c.driver.ReportBook(c.ctx, trent.ID)
+	if err != nil {
+		return err
+	}
+	got := []store.ReportBook{}
+	for _, reportBook := range report {
+		got = append(got, *reportBook)
+	}
+	expect(c, "report of the books read per year", fmt.Sprint(got), fmt.Sprint([]store.ReportBook{{Year: 2023, Count: 1}, {Year: 2024, Count: 3}, {Year: 2025, Count: 1}}))
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package storetest is the conformance suite of store.Driver.
+// The SQLite driver is the reference, every driver has to behave like it to be used by the store.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+)
+
+// TestDriver runs every check on the driver as a subtest, its database has to be migrated and empty.
+// The checks create rows and leave them behind.
+func TestDriver(t *testing.T, driver store.Driver) {
+	ctx := context.Background()
+	users, err := driver.ListUsers(ctx, &store.FindUser{})
+	if err != nil {
+		t.Fatalf("failed to list users: %v", err)
+	}
+	if len(users) != 0 {
+		t.Fatal("the database is not empty")
+	}
+
+	for _, check := range []struct {
+		name string
+		run  func(*checker) error
+	}{
+		{"MigrationHistory", checkMigrationHistory},
+		{"Users", checkUsers},
+		{"DeleteUser", checkDeleteUser},
+		{"UserSettings", checkUserSettings},
+		{"WorkspaceSettings", checkWorkspaceSettings},
+		{"LoginAttempts", checkLoginAttempts},
+		{"IncrementLoginAttempt", checkIncrementLoginAttempt},
+		{"AuditLogs", checkAuditLogs},
+		{"IdentityProviders", checkIdentityProviders},
+		{"UserIdentities", checkUserIdentities},
+		{"Passkeys", checkPasskeys},
+		{"Books", checkBooks},
+		{"BookReviews", checkBookReviews},
+		{"BooksReadInYear", checkBooksReadInYear},
+		{"DineroCategories", checkDineroCategories},
+		{"DineroExpenses", checkDineroExpenses},
+		{"TotalCostByCategory", checkTotalCostByCategory},
+		{"Events", checkEvents},
+	} {
+		t.Run(check.name, func(t *testing.T) {
+			if err := check.run(&checker{t: t, ctx: ctx, driver: driver}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestDatabase migrates the database of the driver, which has to be a new one, twice to check that a second run
+// is a no-op, and runs TestDriver on it.
+func TestDatabase(t *testing.T, driver store.Driver, profile *profile.Profile) {
+	ctx := context.Background()
+	storeInstance := store.New(driver, profile)
+	status, err := storeInstance.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.DatabaseVersion != "" {
+		t.Fatal("the database is not new, the conformance suite needs an empty one")
+	}
+	if err := storeInstance.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := storeInstance.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second run finds the database up to date and applies nothing
+	if err := storeInstance.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate a migrated database: %v", err)
+	}
+	status, err = storeInstance.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.DatabaseVersion != migrated.DatabaseVersion || len(status.Applied) != len(migrated.Applied) || len(status.Pending) != 0 {
+		t.Fatalf("a second migration changed the database from %s with %d migrations to %s with %d, %d pending",
+			migrated.DatabaseVersion, len(migrated.Applied), status.DatabaseVersion, len(status.Applied), len(status.Pending))
+	}
+	TestDriver(t, driver)
+}
+
+// DatabaseUnavailable stops the test of a driver whose database cannot be reached.
+// Every driver is required to pass the suite, so it fails in CI, where CI is set, and is only skipped elsewhere.
+func DatabaseUnavailable(t *testing.T, format string, args ...any) {
+	t.Helper()
+	if os.Getenv("CI") != "" {
+		t.Fatalf(format, args...)
+	}
+	t.Skipf(format+", and it is only required in CI", args...)
+}
+
+// checker reports the failures of a check. A check returns an error when it cannot go on,
+// and reports with errorf what it can check further.
+type checker struct {
+	t      *testing.T
+	ctx    context.Context
+	driver store.Driver
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.t.Helper()
+	c.t.Errorf(format, args...)
+}
+
+func expect[T comparable](c *checker, what string, got T, want T) {
+	c.t.Helper()
+	if got != want {
+		c.errorf("%s is %v, want %v", what, got, want)
+	}
+}
+
+// expectError reports when a call which has to fail did not.
+func (c *checker) expectError(what string, err error) {
+	c.t.Helper()
+	if err == nil {
+		c.errorf("%s did not fail", what)
+	}
+}
+
+func (c *checker) createUser(username string, role store.Role) (*store.User, error) {
+	user, err := c.driver.CreateUser(c.ctx, &store.User{
+		Username:     username,
+		Role:         role,
+		Email:        username + "@example.com",
+		Nickname:     username,
+		PasswordHash: "hash",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user %s: %w", username, err)
+	}
+	return user, nil
+}
+
+func (c *checker) createIdentityProvider(name string) (*store.IdentityProvider, error) {
+	idp, err := c.driver.CreateIdentityProvider(c.ctx, &store.IdentityProvider{Name: name, Type: store.IdentityProviderTypeOIDC, Config: &store.IdentityProviderConfig{}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity provider %s: %w", name, err)
+	}
+	return idp, nil
+}
+
+// expectMissingReference reports when a call which refers to a missing row did not fail with store.ErrMissingReference.
+func (c *checker) expectMissingReference(what string, err error) {
+	if !errors.Is(err, store.ErrMissingReference) {
+		c.errorf("%s failed with %v, want %v", what, err, store.ErrMissingReference)
+	}
+}
+
+// expectReferenced reports when deleting a row which is referred to did not fail with store.ErrReferenced.
+func (c *checker) expectReferenced(what string, err error) {
+	if !errors.Is(err, store.ErrReferenced) {
+		c.errorf("%s failed with %v, want %v", what, err, store.ErrReferenced)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
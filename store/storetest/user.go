@@ -0,0 +1,795 @@
+package storetest
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"itsfriday/store"
+)
+
+func checkMigrationHistory(c *checker) error {
+	before, err := c.driver.FindMigrationHistoryList(c.ctx, &store.FindMigrationHistory{})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		migrationHistory, err := c.driver.UpsertMigrationHistory(c.ctx, &store.UpsertMigrationHistory{Version: "0.0.0"})
+		if err != nil {
+			return err
+		}
+		expect(c, "upserted version", migrationHistory.Version, "0.0.0")
+		if migrationHistory.CreatedTs <= 0 {
+			c.errorf("upserted migration history has no created ts")
+		}
+	}
+
+	after, err := c.driver.FindMigrationHistoryList(c.ctx, &store.FindMigrationHistory{})
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, migrationHistory := range after {
+		if migrationHistory.Version == "0.0.0" {
+			count++
+		}
+	}
+	expect(c, "number of 0.0.0 versions after upserting it twice", count, 1)
+	if !slices.ContainsFunc(before, func(m *store.MigrationHistory) bool { return m.Version == "0.0.0" }) {
+		expect(c, "number of versions", len(after), len(before)+1)
+	}
+	for i := 1; i < len(after); i++ {
+		if after[i-1].CreatedTs < after[i].CreatedTs {
+			c.errorf("migration history is not ordered by created ts descending")
+		}
+	}
+	return nil
+}
+
+func checkUsers(c *checker) error {
+	alice, err := c.createUser("alice", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	bob, err := c.createUser("bob", store.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if _, err := c.createUser("carol", store.RoleUser); err != nil {
+		return err
+	}
+	if alice.ID == 0 || alice.ID == bob.ID {
+		c.errorf("created users have the ids %d and %d", alice.ID, bob.ID)
+	}
+	expect(c, "row status of a created user", alice.RowStatus, store.Normal)
+	if alice.CreatedTs <= 0 || alice.UpdatedTs <= 0 {
+		c.errorf("created user has no created or updated ts")
+	}
+	_, err = c.createUser("alice", store.RoleUser)
+	c.expectError("creating a user with a taken username", err)
+
+	list, err := c.driver.ListUsers(c.ctx, &store.FindUser{ID: &alice.ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing the user by id found %d users", len(list))
+	}
+	if *list[0] != *alice {
+		c.errorf("listed user is %+v, want %+v", *list[0], *alice)
+	}
+
+	for _, tc := range []struct {
+		what string
+		find *store.FindUser
+		want []string
+	}{
+		{"username", &store.FindUser{Username: ptr("bob")}, []string{"bob"}},
+		{"role", &store.FindUser{Role: ptr(store.RoleAdmin)}, []string{"bob"}},
+		{"email", &store.FindUser{Email: ptr("carol@example.com")}, []string{"carol"}},
+		{"nickname", &store.FindUser{Nickname: ptr("alice")}, []string{"alice"}},
+		{"search ignoring case", &store.FindUser{Search: ptr("ALI")}, []string{"alice"}},
+		{"search of emails", &store.FindUser{Search: ptr("example.com")}, []string{"alice", "bob", "carol"}},
+	} {
+		list, err := c.driver.ListUsers(c.ctx, tc.find)
+		if err != nil {
+			return err
+		}
+		expect(c, "users found by "+tc.what, strings.Join(sortedUsernames(list), ","), strings.Join(tc.want, ","))
+	}
+
+	all, err := c.driver.ListUsers(c.ctx, &store.FindUser{})
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].CreatedTs < all[i].CreatedTs {
+			c.errorf("users are not ordered by created ts descending")
+		}
+	}
+	page, err := c.driver.ListUsers(c.ctx, &store.FindUser{Limit: ptr(2)})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of users with limit 2", len(page), 2)
+	page, err = c.driver.ListUsers(c.ctx, &store.FindUser{Limit: ptr(2), Offset: ptr(2)})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of users with limit 2 and offset 2", len(page), 1)
+
+	updated, err := c.driver.UpdateUser(c.ctx, &store.UpdateUser{
+		ID:          alice.ID,
+		UpdatedTs:   ptr(alice.UpdatedTs + 10),
+		RowStatus:   ptr(store.Archived),
+		Role:        ptr(store.RoleAdmin),
+		Email:       ptr("alice@example.org"),
+		Nickname:    ptr("Alice"),
+		AvatarURL:   ptr("/avatars/alice.webp"),
+		Description: ptr("reader"),
+	})
+	if err != nil {
+		return err
+	}
+	want := *alice
+	want.UpdatedTs, want.RowStatus, want.Role, want.Email = alice.UpdatedTs+10, store.Archived, store.RoleAdmin, "alice@example.org"
+	want.Nickname, want.AvatarURL, want.Description = "Alice", "/avatars/alice.webp", "reader"
+	if *updated != want {
+		c.errorf("updated user is %+v, want %+v", *updated, want)
+	}
+	list, err = c.driver.ListUsers(c.ctx, &store.FindUser{RowStatus: ptr(store.Archived)})
+	if err != nil {
+		return err
+	}
+	expect(c, "archived users", strings.Join(sortedUsernames(list), ","), "alice")
+
+	_, err = c.driver.UpdateUser(c.ctx, &store.UpdateUser{ID: alice.ID, Username: ptr("bob")})
+	c.expectError("updating a user to a taken username", err)
+	_, err = c.driver.UpdateUser(c.ctx, &store.UpdateUser{ID: -1, Nickname: ptr("nobody")})
+	if !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("updating a missing user returned %v, want sql.ErrNoRows", err)
+	}
+	return nil
+}
+
+// checkDeleteUser checks that a deleted user takes every row it owns along,
+// except books reviewed by other users, which lose their owner.
+func checkDeleteUser(c *checker) error {
+	dave, err := c.createUser("dave", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	erin, err := c.createUser("erin", store.RoleUser)
+	if err != nil {
+		return err
+	}
+
+	ownBook, err := c.driver.CreateBook(c.ctx, &store.Book{UserID: dave.ID, Title: "Dave's own", Author: "Dave", Pages: 100, PubYear: 2020})
+	if err != nil {
+		return err
+	}
+	sharedBook, err := c.driver.CreateBook(c.ctx, &store.Book{UserID: dave.ID, Title: "Dave's shared", Author: "Dave", Pages: 100, PubYear: 2020})
+	if err != nil {
+		return err
+	}
+	for _, review := range []*store.BookReview{
+		{UserID: dave.ID, BookID: ownBook.ID, DateRead: "2024-01-01", Rating: 3},
+		{UserID: dave.ID, BookID: sharedBook.ID, DateRead: "2024-01-02", Rating: 4},
+		{UserID: erin.ID, BookID: sharedBook.ID, DateRead: "2024-01-03", Rating: 5},
+	} {
+		if _, err := c.driver.CreateBookReview(c.ctx, review); err != nil {
+			return err
+		}
+	}
+	category, err := c.driver.CreateDineroCategory(c.ctx, &store.DineroCategory{UserID: dave.ID, Name: "food", Priority: 1})
+	if err != nil {
+		return err
+	}
+	if _, err := c.driver.CreateDineroExpense(c.ctx, &store.DineroExpense{UserID: dave.ID, CategoryID: category.ID, DateUsed: "2024-01-01", Item: "bread", Price: 3}); err != nil {
+		return err
+	}
+	if _, err := c.driver.CreateEvent(c.ctx, &store.Event{UserID: dave.ID, Title: "party", StartTs: 1, EndTs: 2}); err != nil {
+		return err
+	}
+	if _, err := c.driver.UpsertUserSetting(c.ctx, &store.UserSetting{UserID: dave.ID, Key: store.UserSettingKey_LOCALE, Value: "en"}); err != nil {
+		return err
+	}
+	idp, err := c.createIdentityProvider("Dave's")
+	if err != nil {
+		return err
+	}
+	if _, err := c.driver.CreateUserIdentity(c.ctx, &store.UserIdentity{UserID: dave.ID, IdpID: idp.ID, Subject: "dave"}); err != nil {
+		return err
+	}
+	if _, err := c.driver.CreatePasskey(c.ctx, &store.Passkey{UserID: dave.ID, Name: "key", CredentialID: []byte("dave"), PublicKey: []byte("key"), AAGUID: []byte{}}); err != nil {
+		return err
+	}
+	if _, err := c.driver.UpsertLoginAttempt(c.ctx, &store.LoginAttempt{Kind: store.LoginAttemptKindUsername, Subject: "dave", FailedCount: 1, LastFailedTs: 1}); err != nil {
+		return err
+	}
+
+	if err := c.driver.DeleteUser(c.ctx, &store.DeleteUser{ID: dave.ID}); err != nil {
+		return err
+	}
+
+	users, err := c.driver.ListUsers(c.ctx, &store.FindUser{ID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of users left with the id of the deleted one", len(users), 0)
+	books, err := c.driver.ListBooks(c.ctx, &store.FindBook{Author: ptr("Dave")})
+	if err != nil {
+		return err
+	}
+	if len(books) != 1 || books[0].ID != sharedBook.ID {
+		c.errorf("books left of the deleted user are %v, want only the one reviewed by another user", books)
+	} else {
+		expect(c, "owner of the book reviewed by another user", books[0].UserID, 0)
+	}
+	reviews, err := c.driver.ListBookReviews(c.ctx, &store.FindBookReview{BookID: &sharedBook.ID})
+	if err != nil {
+		return err
+	}
+	if len(reviews) != 1 || reviews[0].UserID != erin.ID {
+		c.errorf("reviews left of the shared book are %v, want only the one of the other user", reviews)
+	}
+
+	left := map[string]int{}
+	categories, err := c.driver.ListDineroCategories(c.ctx, &store.FindDineroCategory{UserID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	left["expense categories"] = len(categories)
+	expenses, err := c.driver.ListDineroExpenses(c.ctx, &store.FindDineroExpense{UserID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	left["expenses"] = len(expenses)
+	events, err := c.driver.ListEvents(c.ctx, &store.FindEvent{UserID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	left["events"] = len(events)
+	userSettings, err := c.driver.ListUserSettings(c.ctx, &store.FindUserSetting{UserID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	left["user settings"] = len(userSettings)
+	userIdentities, err := c.driver.ListUserIdentities(c.ctx, &store.FindUserIdentity{UserID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	left["user identities"] = len(userIdentities)
+	passkeys, err := c.driver.ListPasskeys(c.ctx, &store.FindPasskey{UserID: &dave.ID})
+	if err != nil {
+		return err
+	}
+	left["passkeys"] = len(passkeys)
+	loginAttempts, err := c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{Subject: ptr("dave")})
+	if err != nil {
+		return err
+	}
+	left["login attempts"] = len(loginAttempts)
+	for what, count := range left {
+		expect(c, what+" left of the deleted user", count, 0)
+	}
+
+	c.expectError("deleting a missing user", c.driver.DeleteUser(c.ctx, &store.DeleteUser{ID: dave.ID}))
+	// the identity provider is not owned by the user, IdentityProviders lists them all
+	return c.driver.DeleteIdentityProvider(c.ctx, &store.DeleteIdentityProvider{ID: idp.ID})
+}
+
+func checkUserSettings(c *checker) error {
+	frank, err := c.createUser("frank", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	grace, err := c.createUser("grace", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	for _, userSetting := range []*store.UserSetting{
+		{UserID: frank.ID, Key: store.UserSettingKey_LOCALE, Value: "en"},
+		{UserID: frank.ID, Key: store.UserSettingKey_TIMEZONE, Value: "UTC"},
+		{UserID: frank.ID, Key: store.UserSettingKey_LOCALE, Value: "ko"},
+		{UserID: grace.ID, Key: store.UserSettingKey_LOCALE, Value: "fr"},
+	} {
+		if _, err := c.driver.UpsertUserSetting(c.ctx, userSetting); err != nil {
+			return err
+		}
+	}
+
+	list, err := c.driver.ListUserSettings(c.ctx, &store.FindUserSetting{UserID: &frank.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of settings of a user", len(list), 2)
+	list, err = c.driver.ListUserSettings(c.ctx, &store.FindUserSetting{UserID: &frank.ID, Key: store.UserSettingKey_LOCALE})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing a setting of a user found %d settings", len(list))
+	}
+	expect(c, "upserted setting", *list[0], store.UserSetting{UserID: frank.ID, Key: store.UserSettingKey_LOCALE, Value: "ko"})
+	list, err = c.driver.ListUserSettings(c.ctx, &store.FindUserSetting{Key: store.UserSettingKey_LOCALE})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of settings with a key", len(list), 2)
+
+	if err := c.driver.DeleteUserSetting(c.ctx, &store.DeleteUserSetting{UserID: &frank.ID, Key: store.UserSettingKey_LOCALE}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListUserSettings(c.ctx, &store.FindUserSetting{Key: store.UserSettingKey_LOCALE})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 || list[0].UserID != grace.ID {
+		c.errorf("deleting a setting of a user left %v", list)
+	}
+
+	_, err = c.driver.UpsertUserSetting(c.ctx, &store.UserSetting{UserID: -1, Key: store.UserSettingKey_LOCALE, Value: "en"})
+	c.expectMissingReference("upserting a setting of a missing user", err)
+	return nil
+}
+
+func checkWorkspaceSettings(c *checker) error {
+	for _, workspaceSetting := range []*store.WorkspaceSetting{
+		{Key: store.WorkspaceSettingKey_GENERAL, Value: `{"instanceName":"a"}`},
+		{Key: store.WorkspaceSettingKey_INVITE_CODES, Value: `{}`},
+		{Key: store.WorkspaceSettingKey_GENERAL, Value: `{"instanceName":"b"}`},
+	} {
+		if _, err := c.driver.UpsertWorkspaceSetting(c.ctx, workspaceSetting); err != nil {
+			return err
+		}
+	}
+
+	list, err := c.driver.ListWorkspaceSettings(c.ctx, &store.FindWorkspaceSetting{})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of workspace settings", len(list), 2)
+	list, err = c.driver.ListWorkspaceSettings(c.ctx, &store.FindWorkspaceSetting{Key: store.WorkspaceSettingKey_GENERAL})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing a workspace setting found %d settings", len(list))
+	}
+	expect(c, "upserted workspace setting", *list[0], store.WorkspaceSetting{Key: store.WorkspaceSettingKey_GENERAL, Value: `{"instanceName":"b"}`})
+
+	if err := c.driver.DeleteWorkspaceSetting(c.ctx, &store.DeleteWorkspaceSetting{Key: store.WorkspaceSettingKey_INVITE_CODES}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListWorkspaceSettings(c.ctx, &store.FindWorkspaceSetting{})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of workspace settings after deleting one", len(list), 1)
+	return nil
+}
+
+func checkLoginAttempts(c *checker) error {
+	for _, loginAttempt := range []*store.LoginAttempt{
+		{Kind: store.LoginAttemptKindUsername, Subject: "heidi", FailedCount: 1, LastFailedTs: 100},
+		{Kind: store.LoginAttemptKindIP, Subject: "10.0.0.1", FailedCount: 1, LastFailedTs: 200},
+		{Kind: store.LoginAttemptKindIP, Subject: "10.0.0.2", FailedCount: 1, LastFailedTs: 150},
+		{Kind: store.LoginAttemptKindUsername, Subject: "heidi", FailedCount: 2, LastFailedTs: 300, LockedUntilTs: 1000},
+	} {
+		if _, err := c.driver.UpsertLoginAttempt(c.ctx, loginAttempt); err != nil {
+			return err
+		}
+	}
+
+	list, err := c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{})
+	if err != nil {
+		return err
+	}
+	subjects := []string{}
+	for _, loginAttempt := range list {
+		subjects = append(subjects, loginAttempt.Subject)
+	}
+	expect(c, "login attempts by last failed ts descending", strings.Join(subjects, ","), "heidi,10.0.0.1,10.0.0.2")
+
+	list, err = c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{Kind: ptr(store.LoginAttemptKindUsername), Subject: ptr("heidi")})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing a login attempt found %d", len(list))
+	}
+	expect(c, "upserted login attempt", *list[0], store.LoginAttempt{Kind: store.LoginAttemptKindUsername, Subject: "heidi", FailedCount: 2, LastFailedTs: 300, LockedUntilTs: 1000})
+	list, err = c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{Kind: ptr(store.LoginAttemptKindIP)})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of login attempts of ips", len(list), 2)
+	for _, tc := range []struct {
+		lockedAfterTs int64
+		want          int
+	}{{999, 1}, {1000, 0}} {
+		list, err = c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{LockedAfterTs: &tc.lockedAfterTs})
+		if err != nil {
+			return err
+		}
+		expect(c, fmt.Sprintf("number of login attempts locked after %d", tc.lockedAfterTs), len(list), tc.want)
+	}
+
+	if err := c.driver.DeleteLoginAttempt(c.ctx, &store.DeleteLoginAttempt{Kind: store.LoginAttemptKindUsername, Subject: "heidi"}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of login attempts after deleting one", len(list), 2)
+	return nil
+}
+
+func checkIncrementLoginAttempt(c *checker) error {
+	increment := func(failedTs int64) (*store.LoginAttempt, error) {
+		return c.driver.IncrementLoginAttempt(c.ctx, &store.IncrementLoginAttempt{
+			Kind:            store.LoginAttemptKindUsername,
+			Subject:         "judy",
+			FailedTs:        failedTs,
+			ResetBeforeTs:   failedTs - 100,
+			LockoutAttempts: 3,
+			LockedUntilTs:   failedTs + 50,
+		})
+	}
+	for i, tc := range []struct {
+		failedTs int64
+		want     store.LoginAttempt
+	}{
+		{1000, store.LoginAttempt{FailedCount: 1, LastFailedTs: 1000}},
+		{1010, store.LoginAttempt{FailedCount: 2, LastFailedTs: 1010}},
+		// the lockout starts at the third failure and is not extended by the next ones
+		{1020, store.LoginAttempt{FailedCount: 3, LastFailedTs: 1020, LockedUntilTs: 1070}},
+		{1030, store.LoginAttempt{FailedCount: 4, LastFailedTs: 1030, LockedUntilTs: 1070}},
+		// counting starts over after the lockout
+		{1070, store.LoginAttempt{FailedCount: 1, LastFailedTs: 1070}},
+		{1080, store.LoginAttempt{FailedCount: 2, LastFailedTs: 1080}},
+		// and after the failures are forgotten
+		{1181, store.LoginAttempt{FailedCount: 1, LastFailedTs: 1181}},
+	} {
+		loginAttempt, err := increment(tc.failedTs)
+		if err != nil {
+			return err
+		}
+		tc.want.Kind, tc.want.Subject = store.LoginAttemptKindUsername, "judy"
+		expect(c, fmt.Sprintf("login attempt after increment %d", i+1), *loginAttempt, tc.want)
+		list, err := c.driver.ListLoginAttempts(c.ctx, &store.FindLoginAttempt{Subject: ptr("judy")})
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 {
+			return fmt.Errorf("listing the incremented login attempt found %d", len(list))
+		}
+		expect(c, fmt.Sprintf("stored login attempt after increment %d", i+1), *list[0], tc.want)
+	}
+	return c.driver.DeleteLoginAttempt(c.ctx, &store.DeleteLoginAttempt{Kind: store.LoginAttemptKindUsername, Subject: "judy"})
+}
+
+func checkAuditLogs(c *checker) error {
+	ivan, err := c.createUser("ivan", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	judy, err := c.createUser("judy", store.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	created := []*store.AuditLog{}
+	for _, auditLog := range []*store.AuditLog{
+		{UserID: ivan.ID, ActorID: ivan.ID, Action: store.AuditActionLogin, Outcome: store.AuditOutcomeFailure, ClientIP: "10.0.0.1", UserAgent: "test", Detail: "wrong password"},
+		{UserID: ivan.ID, ActorID: ivan.ID, Action: store.AuditActionLogin, Outcome: store.AuditOutcomeSuccess, ClientIP: "10.0.0.1", UserAgent: "test"},
+		{UserID: judy.ID, ActorID: judy.ID, Action: store.AuditActionLogin, Outcome: store.AuditOutcomeSuccess},
+		{UserID: ivan.ID, ActorID: judy.ID, Action: store.AuditActionTokenRevoke, Outcome: store.AuditOutcomeSuccess},
+	} {
+		auditLog, err := c.driver.CreateAuditLog(c.ctx, auditLog)
+		if err != nil {
+			return err
+		}
+		if auditLog.ID == 0 || auditLog.CreatedTs <= 0 {
+			c.errorf("created audit log has no id or created ts")
+		}
+		created = append(created, auditLog)
+	}
+
+	list, err := c.driver.ListAuditLogs(c.ctx, &store.FindAuditLog{UserID: &ivan.ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 3 {
+		return fmt.Errorf("listing the audit logs of a user found %d", len(list))
+	}
+	expect(c, "newest audit log of a user", *list[0], *created[3])
+	expect(c, "oldest audit log of a user", *list[2], *created[0])
+
+	for _, tc := range []struct {
+		what string
+		find *store.FindAuditLog
+		want int
+	}{
+		{"action", &store.FindAuditLog{Action: ptr(store.AuditActionLogin)}, 3},
+		{"outcome", &store.FindAuditLog{Outcome: ptr(store.AuditOutcomeFailure)}, 1},
+		{"user and action", &store.FindAuditLog{UserID: &ivan.ID, Action: ptr(store.AuditActionLogin)}, 2},
+		{"limit", &store.FindAuditLog{Limit: ptr(3)}, 3},
+		{"limit and offset", &store.FindAuditLog{Limit: ptr(3), Offset: ptr(2)}, 2},
+	} {
+		list, err := c.driver.ListAuditLogs(c.ctx, tc.find)
+		if err != nil {
+			return err
+		}
+		expect(c, "number of audit logs found by "+tc.what, len(list), tc.want)
+	}
+	list, err = c.driver.ListAuditLogs(c.ctx, &store.FindAuditLog{Limit: ptr(1), Offset: ptr(1)})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 || list[0].ID != created[2].ID {
+		c.errorf("second newest audit log is %v, want the id %d", list, created[2].ID)
+	}
+	return nil
+}
+
+func checkIdentityProviders(c *checker) error {
+	config := &store.IdentityProviderConfig{OIDC: &store.OIDCConfig{
+		IssuerURL:    "https://accounts.example.com",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "email"},
+		FieldMapping: &store.FieldMapping{Identifier: "sub", DisplayName: "name", Email: "email"},
+	}}
+	idp, err := c.driver.CreateIdentityProvider(c.ctx, &store.IdentityProvider{
+		Name:          "Example",
+		Type:          store.IdentityProviderTypeOIDC,
+		AutoProvision: true,
+		Config:        config,
+	})
+	if err != nil {
+		return err
+	}
+	if idp.ID == 0 || idp.CreatedTs <= 0 {
+		c.errorf("created identity provider has no id or created ts")
+	}
+	other, err := c.driver.CreateIdentityProvider(c.ctx, &store.IdentityProvider{Name: "Other", Type: store.IdentityProviderTypeOIDC, Config: &store.IdentityProviderConfig{}})
+	if err != nil {
+		return err
+	}
+
+	list, err := c.driver.ListIdentityProviders(c.ctx, &store.FindIdentityProvider{})
+	if err != nil {
+		return err
+	}
+	if len(list) != 2 || list[0].ID != idp.ID || list[1].ID != other.ID {
+		return fmt.Errorf("identity providers are %v, want the created ones by id", list)
+	}
+	expect(c, "name of the listed identity provider", list[0].Name, "Example")
+	expect(c, "auto provision of the listed identity provider", list[0].AutoProvision, true)
+	expect(c, "config of the listed identity provider", describeConfig(list[0].Config), describeConfig(config))
+
+	updated, err := c.driver.UpdateIdentityProvider(c.ctx, &store.UpdateIdentityProvider{
+		ID:            idp.ID,
+		Name:          ptr("Renamed"),
+		AutoProvision: ptr(false),
+		Config:        &store.IdentityProviderConfig{OIDC: &store.OIDCConfig{IssuerURL: "https://id.example.com", Scopes: []string{"openid"}}},
+	})
+	if err != nil {
+		return err
+	}
+	expect(c, "updated name", updated.Name, "Renamed")
+	expect(c, "updated auto provision", updated.AutoProvision, false)
+	expect(c, "updated issuer url", updated.Config.OIDC.IssuerURL, "https://id.example.com")
+	_, err = c.driver.UpdateIdentityProvider(c.ctx, &store.UpdateIdentityProvider{ID: idp.ID})
+	c.expectError("updating nothing of an identity provider", err)
+	_, err = c.driver.UpdateIdentityProvider(c.ctx, &store.UpdateIdentityProvider{ID: -1, Name: ptr("missing")})
+	c.expectError("updating a missing identity provider", err)
+
+	if err := c.driver.DeleteIdentityProvider(c.ctx, &store.DeleteIdentityProvider{ID: other.ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListIdentityProviders(c.ctx, &store.FindIdentityProvider{ID: &other.ID})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of identity providers with the deleted id", len(list), 0)
+	return nil
+}
+
+func checkUserIdentities(c *checker) error {
+	mallory, err := c.createUser("mallory", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	niaj, err := c.createUser("niaj", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	first, err := c.createIdentityProvider("First")
+	if err != nil {
+		return err
+	}
+	second, err := c.createIdentityProvider("Second")
+	if err != nil {
+		return err
+	}
+	for _, userIdentity := range []*store.UserIdentity{
+		{UserID: mallory.ID, IdpID: first.ID, Subject: "m1"},
+		{UserID: mallory.ID, IdpID: second.ID, Subject: "m2"},
+		{UserID: niaj.ID, IdpID: first.ID, Subject: "n1"},
+	} {
+		created, err := c.driver.CreateUserIdentity(c.ctx, userIdentity)
+		if err != nil {
+			return err
+		}
+		if created.CreatedTs <= 0 {
+			c.errorf("created user identity has no created ts")
+		}
+	}
+	_, err = c.driver.CreateUserIdentity(c.ctx, &store.UserIdentity{UserID: niaj.ID, IdpID: second.ID, Subject: "m2"})
+	c.expectError("linking a subject linked to another user", err)
+	_, err = c.driver.CreateUserIdentity(c.ctx, &store.UserIdentity{UserID: niaj.ID, IdpID: first.ID, Subject: "n2"})
+	c.expectError("linking a user twice to an identity provider", err)
+	_, err = c.driver.CreateUserIdentity(c.ctx, &store.UserIdentity{UserID: niaj.ID, IdpID: -1, Subject: "n3"})
+	c.expectMissingReference("linking a user to a missing identity provider", err)
+	_, err = c.driver.CreateUserIdentity(c.ctx, &store.UserIdentity{UserID: -1, IdpID: second.ID, Subject: "n3"})
+	c.expectMissingReference("linking a missing user", err)
+
+	for _, tc := range []struct {
+		what string
+		find *store.FindUserIdentity
+		want int
+	}{
+		{"user", &store.FindUserIdentity{UserID: &mallory.ID}, 2},
+		{"identity provider", &store.FindUserIdentity{IdpID: &first.ID}, 2},
+		{"identity provider and subject", &store.FindUserIdentity{IdpID: &first.ID, Subject: ptr("n1")}, 1},
+	} {
+		list, err := c.driver.ListUserIdentities(c.ctx, tc.find)
+		if err != nil {
+			return err
+		}
+		expect(c, "number of user identities found by "+tc.what, len(list), tc.want)
+	}
+
+	c.expectError("deleting user identities without user or identity provider", c.driver.DeleteUserIdentity(c.ctx, &store.DeleteUserIdentity{}))
+	if err := c.driver.DeleteUserIdentity(c.ctx, &store.DeleteUserIdentity{UserID: &mallory.ID, IdpID: &first.ID}); err != nil {
+		return err
+	}
+	if err := c.driver.DeleteUserIdentity(c.ctx, &store.DeleteUserIdentity{IdpID: &first.ID}); err != nil {
+		return err
+	}
+	list, err := c.driver.ListUserIdentities(c.ctx, &store.FindUserIdentity{})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 || list[0].Subject != "m2" {
+		c.errorf("user identities left are %v, want only m2", list)
+	}
+
+	if err := c.driver.DeleteIdentityProvider(c.ctx, &store.DeleteIdentityProvider{ID: second.ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListUserIdentities(c.ctx, &store.FindUserIdentity{})
+	if err != nil {
+		return err
+	}
+	expect(c, "number of user identities left of a deleted identity provider", len(list), 0)
+	return nil
+}
+
+func checkPasskeys(c *checker) error {
+	olivia, err := c.createUser("olivia", store.RoleUser)
+	if err != nil {
+		return err
+	}
+	first, err := c.driver.CreatePasskey(c.ctx, &store.Passkey{
+		UserID:          olivia.ID,
+		Name:            "laptop",
+		CredentialID:    []byte{1, 2, 3},
+		PublicKey:       []byte{4, 5, 6},
+		AttestationType: "none",
+		AAGUID:          bytes.Repeat([]byte{7}, 16),
+		SignCount:       5,
+		Transports:      []string{"internal", "hybrid"},
+		BackupEligible:  true,
+		BackupState:     true,
+	})
+	if err != nil {
+		return err
+	}
+	if first.ID == 0 || first.CreatedTs <= 0 {
+		c.errorf("created passkey has no id or created ts")
+	}
+	expect(c, "last used ts of a created passkey", first.LastUsedTs, 0)
+	second, err := c.driver.CreatePasskey(c.ctx, &store.Passkey{UserID: olivia.ID, Name: "phone", CredentialID: []byte{9}, PublicKey: []byte{9}, AAGUID: []byte{}, Transports: []string{}})
+	if err != nil {
+		return err
+	}
+	_, err = c.driver.CreatePasskey(c.ctx, &store.Passkey{UserID: olivia.ID, Name: "copy", CredentialID: []byte{1, 2, 3}, PublicKey: []byte{1}, AAGUID: []byte{}})
+	c.expectError("creating a passkey with a taken credential id", err)
+
+	list, err := c.driver.ListPasskeys(c.ctx, &store.FindPasskey{CredentialID: []byte{1, 2, 3}})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("listing a passkey by credential id found %d", len(list))
+	}
+	got := list[0]
+	expect(c, "listed passkey", describePasskey(got), describePasskey(first))
+	list, err = c.driver.ListPasskeys(c.ctx, &store.FindPasskey{UserID: &olivia.ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+		c.errorf("passkeys of the user are %v, want both by id", list)
+	}
+
+	updated, err := c.driver.UpdatePasskey(c.ctx, &store.UpdatePasskey{
+		ID:          first.ID,
+		Name:        ptr("work laptop"),
+		SignCount:   ptr(uint32(6)),
+		BackupState: ptr(false),
+		LastUsedTs:  ptr(int64(1234)),
+	})
+	if err != nil {
+		return err
+	}
+	want := *first
+	want.Name, want.SignCount, want.BackupState, want.LastUsedTs = "work laptop", 6, false, 1234
+	expect(c, "updated passkey", describePasskey(updated), describePasskey(&want))
+	_, err = c.driver.UpdatePasskey(c.ctx, &store.UpdatePasskey{ID: first.ID})
+	c.expectError("updating nothing of a passkey", err)
+	_, err = c.driver.UpdatePasskey(c.ctx, &store.UpdatePasskey{ID: -1, Name: ptr("missing")})
+	c.expectError("updating a missing passkey", err)
+
+	// a passkey is only deleted by its owner
+	if err := c.driver.DeletePasskey(c.ctx, &store.DeletePasskey{ID: first.ID, UserID: olivia.ID + 1000}); err != nil {
+		return err
+	}
+	if err := c.driver.DeletePasskey(c.ctx, &store.DeletePasskey{ID: second.ID, UserID: olivia.ID}); err != nil {
+		return err
+	}
+	list, err = c.driver.ListPasskeys(c.ctx, &store.FindPasskey{UserID: &olivia.ID})
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 || list[0].ID != first.ID {
+		c.errorf("passkeys left are %v, want only the one deleted with another user id", list)
+	}
+	return nil
+}
+
+func sortedUsernames(list []*store.User) []string {
+	usernames := []string{}
+	for _, user := range list {
+		usernames = append(usernames, user.Username)
+	}
+	slices.Sort(usernames)
+	return usernames
+}
+
+func describeConfig(config *store.IdentityProviderConfig) string {
+	if config == nil || config.OIDC == nil {
+		return "<none>"
+	}
+	oidc := config.OIDC
+	s := fmt.Sprintf("%s %s %s %v", oidc.IssuerURL, oidc.ClientID, oidc.ClientSecret, oidc.Scopes)
+	if oidc.FieldMapping != nil {
+		s += fmt.Sprintf(" %+v", *oidc.FieldMapping)
+	}
+	return s
+}
+
+// describePasskey formats a passkey to be compared, an empty and a nil byte slice are the same.
+func describePasskey(passkey *store.Passkey) string {
+	return fmt.Sprintf("%d %d %d %s %x %x %s %x %d %v %t %t %d",
+		passkey.ID, passkey.CreatedTs, passkey.UserID, passkey.Name, passkey.CredentialID, passkey.PublicKey,
+		passkey.AttestationType, passkey.AAGUID, passkey.SignCount, passkey.Transports,
+		passkey.BackupEligible, passkey.BackupState, passkey.LastUsedTs)
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"strings"
 )
 
 type Role string
@@ -55,9 +56,12 @@ type FindUser struct {
 	Role      *Role
 	Email     *string
 	Nickname  *string
+	// Search matches a part of the username, email or nickname.
+	Search    *string
 
 	// The maximum number of users to return.
-	Limit *int
+	Limit  *int
+	Offset *int
 }
 
 type DeleteUser struct {
@@ -74,6 +78,31 @@ func (s *Store) CreateUser(ctx context.Context, create *User) (*User, error) {
 	return user, nil
 }
 
+// CreateSignUpUser creates a user who signs up, as the host if the instance has no user yet.
+// admit, if not nil, is called with whether the user is the first one before the user is created,
+// its error is returned and no user is created.
+// Signups are serialized by the server process, so two first signups cannot both become the host.
+func (s *Store) CreateSignUpUser(ctx context.Context, create *User, admit func(first bool) error) (*User, error) {
+	s.signUpLock.Lock()
+	defer s.signUpLock.Unlock()
+
+	limit := 1
+	existingUsers, err := s.ListUsers(ctx, &FindUser{Limit: &limit})
+	if err != nil {
+		return nil, err
+	}
+	first := len(existingUsers) == 0
+	if admit != nil {
+		if err := admit(first); err != nil {
+			return nil, err
+		}
+	}
+	if first {
+		create.Role = RoleHost
+	}
+	return s.CreateUser(ctx, create)
+}
+
 func (s *Store) UpdateUser(ctx context.Context, update *UpdateUser) (*User, error) {
 	user, err := s.driver.UpdateUser(ctx, update)
 	if err != nil {
@@ -119,6 +148,7 @@ func (s *Store) GetUser(ctx context.Context, find *FindUser) (*User, error) {
 	return user, nil
 }
 
+// DeleteUser purges the user with every row the user owns.
 func (s *Store) DeleteUser(ctx context.Context, delete *DeleteUser) error {
 	err := s.driver.DeleteUser(ctx, delete)
 	if err != nil {
@@ -126,5 +156,12 @@ func (s *Store) DeleteUser(ctx context.Context, delete *DeleteUser) error {
 	}
 
 	s.userCache.Delete(delete.ID)
+	prefix := getUserSettingCacheKey(delete.ID, "")
+	s.userSettingCache.Range(func(key, _ any) bool {
+		if k, ok := key.(string); ok && strings.HasPrefix(k, prefix) {
+			s.userSettingCache.Delete(key)
+		}
+		return true
+	})
 	return nil
 }
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+)
+
+// UserIdentity links the subject of an identity provider to a user.
+type UserIdentity struct {
+	UserID    int32
+	IdpID     int32
+	Subject   string
+	CreatedTs int64
+}
+
+type FindUserIdentity struct {
+	UserID  *int32
+	IdpID   *int32
+	Subject *string
+}
+
+// DeleteUserIdentity deletes the identities of a user, of a provider or both.
+type DeleteUserIdentity struct {
+	UserID *int32
+	IdpID  *int32
+}
+
+func (s *Store) CreateUserIdentity(ctx context.Context, create *UserIdentity) (*UserIdentity, error) {
+	return s.driver.CreateUserIdentity(ctx, create)
+}
+
+func (s *Store) ListUserIdentities(ctx context.Context, find *FindUserIdentity) ([]*UserIdentity, error) {
+	return s.driver.ListUserIdentities(ctx, find)
+}
+
+func (s *Store) GetUserIdentity(ctx context.Context, find *FindUserIdentity) (*UserIdentity, error) {
+	list, err := s.ListUserIdentities(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (s *Store) DeleteUserIdentity(ctx context.Context, delete *DeleteUserIdentity) error {
+	return s.driver.DeleteUserIdentity(ctx, delete)
+}
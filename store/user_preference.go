@@ -0,0 +1,58 @@
+package store
+
+// Preferences of the user. Locale, timezone, currency, week start and appearance are stored as plain strings,
+// the home layout as JSON.
+
+const (
+	DefaultTimezone = "UTC"
+	DefaultCurrency = "USD"
+)
+
+type WeekStart string
+
+const (
+	WeekStartMonday   WeekStart = "MONDAY"
+	WeekStartSunday   WeekStart = "SUNDAY"
+	WeekStartSaturday WeekStart = "SATURDAY"
+
+	DefaultWeekStart = WeekStartMonday
+)
+
+type Appearance string
+
+const (
+	// AppearanceSystem follows the color scheme of the device.
+	AppearanceSystem Appearance = "SYSTEM"
+	AppearanceLight  Appearance = "LIGHT"
+	AppearanceDark   Appearance = "DARK"
+
+	DefaultAppearance = AppearanceSystem
+)
+
+// HomeWidgets are the widgets of the home dashboard in their default order.
+var HomeWidgets = []string{
+	"libro",
+	"dinero",
+	"fitness",
+}
+
+type UserSettingHomeLayout struct {
+	Widgets []*UserSettingHomeWidget `json:"widgets"`
+}
+
+type UserSettingHomeWidget struct {
+	Widget  string `json:"widget"`
+	Visible bool   `json:"visible"`
+}
+
+// DefaultHomeLayout shows every widget in the default order.
+func DefaultHomeLayout() *UserSettingHomeLayout {
+	homeLayout := &UserSettingHomeLayout{}
+	for _, widget := range HomeWidgets {
+		homeLayout.Widgets = append(homeLayout.Widgets, &UserSettingHomeWidget{
+			Widget:  widget,
+			Visible: true,
+		})
+	}
+	return homeLayout
+}
@@ -2,11 +2,20 @@ package store
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
 )
 
+const accessTokenSaltLength = 16
+
 type UserSetting struct {
 	UserID int32
 	Key    UserSettingKey
@@ -22,12 +31,85 @@ func (us *UserSetting) GetAccessTokens() (*UserSettingAccessTokens, error) {
 	return &tokens, nil
 }
 
-func ConvertUserSettingValueToString(accessTokens *UserSettingAccessTokens) (string, error) {
-    value, err := json.Marshal(accessTokens)
+func (us *UserSetting) GetRefreshTokens() (*UserSettingRefreshTokens, error) {
+	var tokens UserSettingRefreshTokens
+	err := json.Unmarshal([]byte(us.Value), &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &tokens, nil
+}
+
+func (us *UserSetting) GetTOTP() (*UserSettingTOTP, error) {
+	var totp UserSettingTOTP
+	err := json.Unmarshal([]byte(us.Value), &totp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &totp, nil
+}
+
+func (us *UserSetting) GetEmailVerification() (*UserSettingEmailVerification, error) {
+	var emailVerification UserSettingEmailVerification
+	err := json.Unmarshal([]byte(us.Value), &emailVerification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &emailVerification, nil
+}
+
+func (us *UserSetting) GetSessions() (*UserSettingSessions, error) {
+	var sessions UserSettingSessions
+	err := json.Unmarshal([]byte(us.Value), &sessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &sessions, nil
+}
+
+func (us *UserSetting) GetDeletion() (*UserSettingDeletion, error) {
+	var deletion UserSettingDeletion
+	err := json.Unmarshal([]byte(us.Value), &deletion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &deletion, nil
+}
+
+func (us *UserSetting) GetExports() (*UserSettingExports, error) {
+	var exports UserSettingExports
+	err := json.Unmarshal([]byte(us.Value), &exports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &exports, nil
+}
+
+func (us *UserSetting) GetHomeLayout() (*UserSettingHomeLayout, error) {
+	var homeLayout UserSettingHomeLayout
+	err := json.Unmarshal([]byte(us.Value), &homeLayout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &homeLayout, nil
+}
+
+func (us *UserSetting) GetPasswordReset() (*UserSettingPasswordReset, error) {
+	var passwordReset UserSettingPasswordReset
+	err := json.Unmarshal([]byte(us.Value), &passwordReset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &passwordReset, nil
+}
+
+// ConvertUserSettingValueToString marshals a structured user setting value, e.g. *UserSettingAccessTokens.
+func ConvertUserSettingValueToString(value any) (string, error) {
+	bytes, err := json.Marshal(value)
 	if err != nil {
-		return "",  fmt.Errorf("failed to marshal accessTokens: %v", err)
+		return "", fmt.Errorf("failed to marshal user setting value: %v", err)
 	}
-	return string(value), nil
+	return string(bytes), nil
 }
 
 type FindUserSetting struct {
@@ -48,6 +130,30 @@ const (
 	UserSettingKey_ACCESS_TOKENS UserSettingKey = 1
 	// The locale of the user.
 	UserSettingKey_LOCALE UserSettingKey = 2
+	// Refresh tokens for the user.
+	UserSettingKey_REFRESH_TOKENS UserSettingKey = 3
+	// TOTP two-factor authentication secret and recovery codes of the user.
+	UserSettingKey_TOTP UserSettingKey = 4
+	// Verification state of the email address of the user.
+	UserSettingKey_EMAIL_VERIFICATION UserSettingKey = 5
+	// Outstanding password reset of the user.
+	UserSettingKey_PASSWORD_RESET UserSettingKey = 6
+	// Signed-in sessions of the user and the devices they are used from.
+	UserSettingKey_SESSIONS UserSettingKey = 7
+	// The IANA timezone of the user, e.g. Asia/Seoul.
+	UserSettingKey_TIMEZONE UserSettingKey = 8
+	// The ISO 4217 base currency of the user, e.g. KRW.
+	UserSettingKey_CURRENCY UserSettingKey = 9
+	// The first day of the week of the user, see WeekStart.
+	UserSettingKey_WEEK_START UserSettingKey = 10
+	// The color scheme of the web app, see Appearance.
+	UserSettingKey_APPEARANCE UserSettingKey = 11
+	// The order and visibility of the widgets on the home dashboard, see UserSettingHomeLayout.
+	UserSettingKey_HOME_LAYOUT UserSettingKey = 12
+	// The scheduled deletion of the account, see UserSettingDeletion.
+	UserSettingKey_DELETION UserSettingKey = 13
+	// The data exports of the user, see UserSettingExports.
+	UserSettingKey_EXPORTS UserSettingKey = 14
 )
 
 var (
@@ -55,11 +161,35 @@ var (
 		0: "USER_SETTING_KEY_UNSPECIFIED",
 		1: "ACCESS_TOKENS",
 		2: "LOCALE",
+		3: "REFRESH_TOKENS",
+		4: "TOTP",
+		5: "EMAIL_VERIFICATION",
+		6: "PASSWORD_RESET",
+		7: "SESSIONS",
+		8: "TIMEZONE",
+		9: "CURRENCY",
+		10: "WEEK_START",
+		11: "APPEARANCE",
+		12: "HOME_LAYOUT",
+		13: "DELETION",
+		14: "EXPORTS",
 	}
 	UserSettingKey_value = map[string]int32{
 		"USER_SETTING_KEY_UNSPECIFIED": 0,
 		"ACCESS_TOKENS":                1,
 		"LOCALE":                       2,
+		"REFRESH_TOKENS":               3,
+		"TOTP":                         4,
+		"EMAIL_VERIFICATION":           5,
+		"PASSWORD_RESET":               6,
+		"SESSIONS":                     7,
+		"TIMEZONE":                     8,
+		"CURRENCY":                     9,
+		"WEEK_START":                   10,
+		"APPEARANCE":                   11,
+		"HOME_LAYOUT":                  12,
+		"DELETION":                     13,
+		"EXPORTS":                      14,
 	}
 )
 
@@ -74,9 +204,151 @@ type UserSettingAccessTokens struct {
 	AccessTokens []*UserSettingAccessToken `json:"accessTokens"`
 }
 
+type AccessTokenType string
+
+const (
+	// AccessTokenTypeSession is a short-lived token issued when signing in.
+	AccessTokenTypeSession AccessTokenType = "SESSION"
+	// AccessTokenTypePersonal is a named token created by the user for scripts, limited by scopes.
+	AccessTokenTypePersonal AccessTokenType = "PERSONAL"
+)
+
 type UserSettingAccessToken struct {
-    AccessToken string `json:"accessToken"`
-	Description string `json:"description"`
+	ID          string          `json:"id,omitempty"`
+	Type        AccessTokenType `json:"type,omitempty"`
+	// Salt and TokenHash identify the access token, the token itself is never stored.
+	Salt        string          `json:"salt,omitempty"`
+	TokenHash   string          `json:"tokenHash,omitempty"`
+	// AccessToken is the plaintext token of rows written by older versions, see MigrateAccessTokens.
+	AccessToken string          `json:"accessToken,omitempty"`
+	Description string          `json:"description"`
+	// FamilyID groups the access and refresh tokens issued for one sign-in.
+	FamilyID    string          `json:"familyId,omitempty"`
+	Scopes      []string        `json:"scopes,omitempty"`
+	CreatedTs   int64           `json:"createdTs,omitempty"`
+	LastUsedTs  int64           `json:"lastUsedTs,omitempty"`
+	// ExpiresTs is zero for a token that never expires.
+	ExpiresTs   int64           `json:"expiresTs,omitempty"`
+}
+
+// SetAccessToken stores the salted hash of the access token.
+func (t *UserSettingAccessToken) SetAccessToken(accessToken string) error {
+	salt := make([]byte, accessTokenSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %v", err)
+	}
+	t.Salt = hex.EncodeToString(salt)
+	t.TokenHash = hashAccessToken(t.Salt, accessToken)
+	t.AccessToken = ""
+	return nil
+}
+
+// Matches reports whether the access token is the one this entry was created for.
+func (t *UserSettingAccessToken) Matches(accessToken string) bool {
+	if t.TokenHash == "" {
+		return false
+	}
+	hash := hashAccessToken(t.Salt, accessToken)
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(t.TokenHash)) == 1
+}
+
+func hashAccessToken(salt string, accessToken string) string {
+	sum := sha256.Sum256([]byte(salt + accessToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsPersonal reports whether the token is a personal access token. Tokens stored without a type are sessions.
+func (t *UserSettingAccessToken) IsPersonal() bool {
+	return t.Type == AccessTokenTypePersonal
+}
+
+type UserSettingRefreshTokens struct {
+	RefreshTokens []*UserSettingRefreshToken `json:"refreshTokens"`
+}
+
+type UserSettingRefreshToken struct {
+	ID        string `json:"id"`
+	FamilyID  string `json:"familyId"`
+	ExpiresTs int64  `json:"expiresTs"`
+	// Used marks a rotated refresh token, presenting it again revokes the whole family.
+	Used      bool   `json:"used"`
+}
+
+type UserSettingSessions struct {
+	Sessions []*UserSettingSession `json:"sessions"`
+}
+
+// UserSettingSession is a sign-in of the user, its ID is the FamilyID of the tokens issued for it.
+type UserSettingSession struct {
+	ID         string `json:"id"`
+	CreatedTs  int64  `json:"createdTs"`
+	LastUsedTs int64  `json:"lastUsedTs,omitempty"`
+	// ClientIP and UserAgent are of the last request made with the session.
+	ClientIP   string `json:"clientIp,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	// ExpiresTs is the expiry of the latest refresh token of the session.
+	ExpiresTs  int64  `json:"expiresTs"`
+}
+
+// UserSettingDeletion schedules the purge of an archived account, it can be restored until then.
+type UserSettingDeletion struct {
+	RequestedTs int64 `json:"requestedTs"`
+	PurgeTs     int64 `json:"purgeTs"`
+}
+
+type UserSettingExports struct {
+	Exports []*UserSettingExport `json:"exports"`
+}
+
+type ExportState string
+
+const (
+	ExportStateRunning ExportState = "RUNNING"
+	ExportStateDone    ExportState = "DONE"
+	ExportStateFailed  ExportState = "FAILED"
+)
+
+// UserSettingExport is a data export of the user, the archive is a file in the data directory.
+type UserSettingExport struct {
+	ID         string      `json:"id"`
+	State      ExportState `json:"state"`
+	CreatedTs  int64       `json:"createdTs"`
+	FinishedTs int64       `json:"finishedTs,omitempty"`
+	// Size is the size of the archive in bytes.
+	Size       int64       `json:"size,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type UserSettingTOTP struct {
+	Secret        string   `json:"secret"`
+	// Enabled is false until the user verified a code of the enrolled secret.
+	Enabled       bool     `json:"enabled"`
+	// RecoveryCodes are SHA-256 hashes of the unused one-time recovery codes.
+	RecoveryCodes []string `json:"recoveryCodes"`
+	// LastUsedStep is the time step of the last accepted code, a code can not be used twice.
+	LastUsedStep  int64    `json:"lastUsedStep"`
+	CreatedTs     int64    `json:"createdTs"`
+}
+
+type UserSettingEmailVerification struct {
+	// Email is the address the state belongs to, changing the email of the user resets it.
+	Email      string `json:"email"`
+	Verified   bool   `json:"verified"`
+	VerifiedTs int64  `json:"verifiedTs,omitempty"`
+	// TokenID is the ID of the outstanding verification token, empty once it has been used.
+	TokenID    string `json:"tokenId,omitempty"`
+	ExpiresTs  int64  `json:"expiresTs,omitempty"`
+}
+
+// IsVerified reports whether the given email address has been verified.
+func (v *UserSettingEmailVerification) IsVerified(email string) bool {
+	return v != nil && v.Verified && v.Email == email
+}
+
+type UserSettingPasswordReset struct {
+	// TokenID is the ID of the only valid reset token, a new request replaces it.
+	TokenID   string `json:"tokenId"`
+	ExpiresTs int64  `json:"expiresTs"`
 }
 
 func (s *Store) UpsertUserSetting(ctx context.Context, upsert *UserSetting) (*UserSetting, error) {
@@ -157,3 +429,298 @@ func (s *Store) GetUserAccessTokens(ctx context.Context, userID int32) ([]*UserS
 	}
 	return accessTokensUserSetting.AccessTokens, nil
 }
+
+func (s *Store) GetUserRefreshTokens(ctx context.Context, userID int32) ([]*UserSettingRefreshToken, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_REFRESH_TOKENS,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return []*UserSettingRefreshToken{}, nil
+	}
+
+	refreshTokensUserSetting, err := userSetting.GetRefreshTokens()
+	if err != nil {
+		return nil, err
+	}
+	return refreshTokensUserSetting.RefreshTokens, nil
+}
+
+// UpdateUserAccessTokens replaces the access tokens of the user with the ones update returns.
+// Nothing is written when update fails, its error is returned.
+func (s *Store) UpdateUserAccessTokens(ctx context.Context, userID int32, update func([]*UserSettingAccessToken) ([]*UserSettingAccessToken, error)) error {
+	unlock := s.lockUserTokens(userID)
+	defer unlock()
+
+	accessTokens, err := s.GetUserAccessTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	accessTokens, err = update(accessTokens)
+	if err != nil {
+		return err
+	}
+	value, err := ConvertUserSettingValueToString(&UserSettingAccessTokens{
+		AccessTokens: accessTokens,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.UpsertUserSetting(ctx, &UserSetting{
+		UserID: userID,
+		Key:    UserSettingKey_ACCESS_TOKENS,
+		Value:  value,
+	})
+	return err
+}
+
+// UpdateUserRefreshTokens replaces the refresh tokens of the user with the ones update returns.
+// Nothing is written when update fails, its error is returned.
+func (s *Store) UpdateUserRefreshTokens(ctx context.Context, userID int32, update func([]*UserSettingRefreshToken) ([]*UserSettingRefreshToken, error)) error {
+	unlock := s.lockUserTokens(userID)
+	defer unlock()
+
+	refreshTokens, err := s.GetUserRefreshTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	refreshTokens, err = update(refreshTokens)
+	if err != nil {
+		return err
+	}
+	value, err := ConvertUserSettingValueToString(&UserSettingRefreshTokens{
+		RefreshTokens: refreshTokens,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.UpsertUserSetting(ctx, &UserSetting{
+		UserID: userID,
+		Key:    UserSettingKey_REFRESH_TOKENS,
+		Value:  value,
+	})
+	return err
+}
+
+// UpdateUserSessions replaces the sessions of the user with the ones update returns.
+// Nothing is written when update fails, its error is returned.
+func (s *Store) UpdateUserSessions(ctx context.Context, userID int32, update func([]*UserSettingSession) ([]*UserSettingSession, error)) error {
+	unlock := s.lockUserTokens(userID)
+	defer unlock()
+
+	sessions, err := s.GetUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	sessions, err = update(sessions)
+	if err != nil {
+		return err
+	}
+	value, err := ConvertUserSettingValueToString(&UserSettingSessions{
+		Sessions: sessions,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.UpsertUserSetting(ctx, &UserSetting{
+		UserID: userID,
+		Key:    UserSettingKey_SESSIONS,
+		Value:  value,
+	})
+	return err
+}
+
+// UpdateUserTOTP replaces the two-factor setting of the user with the one update returns, update gets nil if there is none.
+// Nothing is written when update fails, its error is returned.
+func (s *Store) UpdateUserTOTP(ctx context.Context, userID int32, update func(*UserSettingTOTP) (*UserSettingTOTP, error)) error {
+	unlock := s.lockUserTokens(userID)
+	defer unlock()
+
+	userTOTP, err := s.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	userTOTP, err = update(userTOTP)
+	if err != nil {
+		return err
+	}
+	value, err := ConvertUserSettingValueToString(userTOTP)
+	if err != nil {
+		return err
+	}
+	_, err = s.UpsertUserSetting(ctx, &UserSetting{
+		UserID: userID,
+		Key:    UserSettingKey_TOTP,
+		Value:  value,
+	})
+	return err
+}
+
+// lockUserTokens serializes the updates of the token and session lists and of the two-factor setting of a user,
+// which are read, changed and written back as a whole.
+// Two refreshes with the same token, or two logins with the same two-factor code, can so not both see it unused.
+// The lock is held by one server process, an update function must not take it again.
+func (s *Store) lockUserTokens(userID int32) func() {
+	value, _ := s.userTokenLocks.LoadOrStore(userID, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// MigrateAccessTokens replaces the plaintext access tokens written by older versions with salted hashes.
+func (s *Store) MigrateAccessTokens(ctx context.Context) error {
+	userSettings, err := s.ListUserSettings(ctx, &FindUserSetting{
+		Key: UserSettingKey_ACCESS_TOKENS,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, userSetting := range userSettings {
+		accessTokens, err := userSetting.GetAccessTokens()
+		if err != nil {
+			return err
+		}
+		migrated := false
+		for _, accessToken := range accessTokens.AccessTokens {
+			if accessToken.AccessToken == "" {
+				continue
+			}
+			if accessToken.ID == "" {
+				accessToken.ID = uuid.NewString()
+			}
+			if err := accessToken.SetAccessToken(accessToken.AccessToken); err != nil {
+				return err
+			}
+			migrated = true
+		}
+		if !migrated {
+			continue
+		}
+
+		value, err := ConvertUserSettingValueToString(accessTokens)
+		if err != nil {
+			return err
+		}
+		if _, err := s.UpsertUserSetting(ctx, &UserSetting{
+			UserID: userSetting.UserID,
+			Key:    UserSettingKey_ACCESS_TOKENS,
+			Value:  value,
+		}); err != nil {
+			return fmt.Errorf("failed to migrate access tokens of user %d: %w", userSetting.UserID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetUserSessions(ctx context.Context, userID int32) ([]*UserSettingSession, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_SESSIONS,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return []*UserSettingSession{}, nil
+	}
+
+	sessionsUserSetting, err := userSetting.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return sessionsUserSetting.Sessions, nil
+}
+
+// GetUserTimezone returns the timezone of the user, DefaultTimezone if the user has not set one.
+func (s *Store) GetUserTimezone(ctx context.Context, userID int32) (string, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_TIMEZONE,
+	})
+	if err != nil {
+		return "", err
+	}
+	if userSetting == nil || userSetting.Value == "" {
+		return DefaultTimezone, nil
+	}
+	return userSetting.Value, nil
+}
+
+func (s *Store) GetUserDeletion(ctx context.Context, userID int32) (*UserSettingDeletion, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_DELETION,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return nil, nil
+	}
+	return userSetting.GetDeletion()
+}
+
+func (s *Store) GetUserExports(ctx context.Context, userID int32) ([]*UserSettingExport, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_EXPORTS,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return []*UserSettingExport{}, nil
+	}
+
+	exportsUserSetting, err := userSetting.GetExports()
+	if err != nil {
+		return nil, err
+	}
+	return exportsUserSetting.Exports, nil
+}
+
+func (s *Store) GetUserTOTP(ctx context.Context, userID int32) (*UserSettingTOTP, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_TOTP,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return nil, nil
+	}
+	return userSetting.GetTOTP()
+}
+
+func (s *Store) GetUserEmailVerification(ctx context.Context, userID int32) (*UserSettingEmailVerification, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_EMAIL_VERIFICATION,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return nil, nil
+	}
+	return userSetting.GetEmailVerification()
+}
+
+func (s *Store) GetUserPasswordReset(ctx context.Context, userID int32) (*UserSettingPasswordReset, error) {
+	userSetting, err := s.GetUserSetting(ctx, &FindUserSetting{
+		UserID: &userID,
+		Key:    UserSettingKey_PASSWORD_RESET,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userSetting == nil {
+		return nil, nil
+	}
+	return userSetting.GetPasswordReset()
+}
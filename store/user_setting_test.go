@@ -0,0 +1,129 @@
+package store_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+	"itsfriday/store/db/memory"
+)
+
+func newMemoryStore(t *testing.T) (*store.Store, *store.User) {
+	t.Helper()
+	s := store.New(memory.NewDB(), &profile.Profile{Mode: "dev", Driver: "memory"})
+	user, err := s.CreateUser(context.Background(), &store.User{Username: "alice", Role: store.RoleUser, Email: "alice@example.com", Nickname: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, user
+}
+
+func TestUpdateUserTOTPIsSerialized(t *testing.T) {
+	ctx := context.Background()
+	s, user := newMemoryStore(t)
+	if err := s.UpdateUserTOTP(ctx, user.ID, func(*store.UserSettingTOTP) (*store.UserSettingTOTP, error) {
+		return &store.UserSettingTOTP{Secret: "secret", Enabled: true, RecoveryCodes: []string{"a", "b"}}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// both updates consume the first recovery code they see
+	consume := func(userTOTP *store.UserSettingTOTP) (*store.UserSettingTOTP, error) {
+		userTOTP.RecoveryCodes = userTOTP.RecoveryCodes[1:]
+		return userTOTP, nil
+	}
+	entered, release := make(chan struct{}), make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- s.UpdateUserTOTP(ctx, user.ID, func(userTOTP *store.UserSettingTOTP) (*store.UserSettingTOTP, error) {
+			close(entered)
+			<-release
+			return consume(userTOTP)
+		})
+	}()
+	<-entered
+	second := make(chan error, 1)
+	go func() {
+		second <- s.UpdateUserTOTP(ctx, user.ID, consume)
+	}()
+	select {
+	case err := <-second:
+		t.Fatalf("the second update ran while the first one held the setting: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for _, done := range []chan error{first, second} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	userTOTP, err := s.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userTOTP.RecoveryCodes) != 0 {
+		t.Errorf("recovery codes are %v, want both consumed", userTOTP.RecoveryCodes)
+	}
+}
+
+// accessTokensValue returns the stored value of the access tokens of the user.
+func accessTokensValue(t *testing.T, s *store.Store, userID int32) string {
+	t.Helper()
+	list, err := s.ListUserSettings(context.Background(), &store.FindUserSetting{UserID: &userID, Key: store.UserSettingKey_ACCESS_TOKENS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("%d access tokens settings, want 1", len(list))
+	}
+	return list[0].Value
+}
+
+func TestMigrateAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	s, user := newMemoryStore(t)
+	if _, err := s.UpsertUserSetting(ctx, &store.UserSetting{
+		UserID: user.ID,
+		Key:    store.UserSettingKey_ACCESS_TOKENS,
+		Value:  `{"accessTokens":[{"accessToken":"legacy-token","description":"old"}]}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MigrateAccessTokens(ctx); err != nil {
+		t.Fatal(err)
+	}
+	value := accessTokensValue(t, s, user.ID)
+	if strings.Contains(value, "legacy-token") {
+		t.Errorf("the migrated setting %s keeps the plaintext token", value)
+	}
+	accessTokens, err := s.GetUserAccessTokens(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accessTokens) != 1 {
+		t.Fatalf("%d access tokens after the migration, want 1", len(accessTokens))
+	}
+	accessToken := accessTokens[0]
+	if accessToken.ID == "" || accessToken.Salt == "" || accessToken.TokenHash == "" || accessToken.AccessToken != "" || accessToken.Description != "old" {
+		t.Errorf("the migrated token is %+v, want a hashed one with an id and the description kept", accessToken)
+	}
+	if !accessToken.Matches("legacy-token") {
+		t.Error("the legacy token does not validate after the migration")
+	}
+	if accessToken.Matches("other-token") {
+		t.Error("another token validates as the migrated one")
+	}
+
+	// a second run leaves the hashed token as it is
+	if err := s.MigrateAccessTokens(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if again := accessTokensValue(t, s, user.ID); again != value {
+		t.Errorf("the setting is %s after a second run, want %s", again, value)
+	}
+}
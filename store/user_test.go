@@ -0,0 +1,76 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"itsfriday/server/profile"
+	"itsfriday/store"
+	"itsfriday/store/db/memory"
+)
+
+func TestCreateSignUpUser(t *testing.T) {
+	ctx := context.Background()
+	s := store.New(memory.NewDB(), &profile.Profile{Mode: "dev", Driver: "memory"})
+	newUser := func(username string) *store.User {
+		return &store.User{Username: username, Role: store.RoleUser, Email: username + "@example.com", Nickname: username}
+	}
+
+	// a refused signup creates no user, the next one is still the first
+	refused := errors.New("refused")
+	if _, err := s.CreateSignUpUser(ctx, newUser("mallory"), func(bool) error { return refused }); !errors.Is(err, refused) {
+		t.Fatalf("the refused signup returned %v, want %v", err, refused)
+	}
+
+	// the first signup is held before it creates its user, the second one waits for it
+	entered, release := make(chan struct{}), make(chan struct{})
+	type result struct {
+		user  *store.User
+		first bool
+		err   error
+	}
+	signUp := func(username string, hold bool) chan result {
+		done := make(chan result, 1)
+		go func() {
+			var first bool
+			user, err := s.CreateSignUpUser(ctx, newUser(username), func(f bool) error {
+				first = f
+				if hold {
+					close(entered)
+					<-release
+				}
+				return nil
+			})
+			done <- result{user: user, first: first, err: err}
+		}()
+		return done
+	}
+	alice := signUp("alice", true)
+	<-entered
+	bob := signUp("bob", false)
+	select {
+	case r := <-bob:
+		t.Fatalf("the second signup ran while the first one was admitted: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	for _, tc := range []struct {
+		done  chan result
+		first bool
+		role  store.Role
+	}{
+		{done: alice, first: true, role: store.RoleHost},
+		{done: bob, first: false, role: store.RoleUser},
+	} {
+		r := <-tc.done
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if r.first != tc.first || r.user.Role != tc.role {
+			t.Errorf("%s was admitted as first %v with the role %s, want %v and %s", r.user.Username, r.first, r.user.Role, tc.first, tc.role)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultInstanceName = "itsfriday"
+	DefaultLocale       = "en"
+)
+
+type WorkspaceSettingKey string
+
+const (
+	// General settings of the instance, see WorkspaceGeneralSetting.
+	WorkspaceSettingKey_GENERAL WorkspaceSettingKey = "GENERAL"
+	// Invite codes for invite-only signup.
+	WorkspaceSettingKey_INVITE_CODES WorkspaceSettingKey = "INVITE_CODES"
+)
+
+func (x WorkspaceSettingKey) String() string {
+	return string(x)
+}
+
+type WorkspaceSetting struct {
+	Key   WorkspaceSettingKey
+	Value string
+}
+
+func (ws *WorkspaceSetting) GetGeneralSetting() (*WorkspaceGeneralSetting, error) {
+	var generalSetting WorkspaceGeneralSetting
+	err := json.Unmarshal([]byte(ws.Value), &generalSetting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &generalSetting, nil
+}
+
+func (ws *WorkspaceSetting) GetInviteCodes() (*WorkspaceInviteCodes, error) {
+	var inviteCodes WorkspaceInviteCodes
+	err := json.Unmarshal([]byte(ws.Value), &inviteCodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %v", err)
+	}
+	return &inviteCodes, nil
+}
+
+type FindWorkspaceSetting struct {
+	// Key is empty to find every setting.
+	Key WorkspaceSettingKey
+}
+
+type DeleteWorkspaceSetting struct {
+	Key WorkspaceSettingKey
+}
+
+type WorkspaceGeneralSetting struct {
+	InstanceName  string `json:"instanceName"`
+	DefaultLocale string `json:"defaultLocale"`
+	// DisallowSignUp closes the public registration, the first user can always sign up.
+	DisallowSignUp bool `json:"disallowSignUp"`
+	// InviteOnly requires a valid invite code to sign up.
+	InviteOnly bool `json:"inviteOnly"`
+	// AllowedEmailDomains limits signup to emails of these domains, empty for any domain.
+	AllowedEmailDomains []string `json:"allowedEmailDomains"`
+}
+
+type WorkspaceInviteCodes struct {
+	InviteCodes []*WorkspaceInviteCode `json:"inviteCodes"`
+}
+
+type WorkspaceInviteCode struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	// MaxUses is the number of signups the code allows, zero for unlimited.
+	MaxUses   int32 `json:"maxUses"`
+	Uses      int32 `json:"uses"`
+	CreatorID int32 `json:"creatorId"`
+	CreatedTs int64 `json:"createdTs"`
+	// ExpiresTs is zero for a code that never expires.
+	ExpiresTs int64 `json:"expiresTs"`
+}
+
+// IsUsable reports whether the invite code can still be used at the given time.
+func (c *WorkspaceInviteCode) IsUsable(now int64) bool {
+	if c.ExpiresTs != 0 && c.ExpiresTs <= now {
+		return false
+	}
+	return c.MaxUses == 0 || c.Uses < c.MaxUses
+}
+
+func (s *Store) UpsertWorkspaceSetting(ctx context.Context, upsert *WorkspaceSetting) (*WorkspaceSetting, error) {
+	workspaceSetting, err := s.driver.UpsertWorkspaceSetting(ctx, upsert)
+	if err != nil {
+		return nil, err
+	}
+	if workspaceSetting == nil {
+		return nil, errors.New("unexpected nil workspace setting")
+	}
+	s.workspaceSettingCache.Store(workspaceSetting.Key.String(), workspaceSetting)
+	return workspaceSetting, nil
+}
+
+func (s *Store) ListWorkspaceSettings(ctx context.Context, find *FindWorkspaceSetting) ([]*WorkspaceSetting, error) {
+	list, err := s.driver.ListWorkspaceSettings(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, workspaceSetting := range list {
+		s.workspaceSettingCache.Store(workspaceSetting.Key.String(), workspaceSetting)
+	}
+	return list, nil
+}
+
+func (s *Store) GetWorkspaceSetting(ctx context.Context, find *FindWorkspaceSetting) (*WorkspaceSetting, error) {
+	if cache, ok := s.workspaceSettingCache.Load(find.Key.String()); ok {
+		workspaceSetting, ok := cache.(*WorkspaceSetting)
+		if ok {
+			return workspaceSetting, nil
+		}
+	}
+
+	list, err := s.ListWorkspaceSettings(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	if len(list) > 1 {
+		return nil, fmt.Errorf("expected 1 workspace setting, but got %d", len(list))
+	}
+	return list[0], nil
+}
+
+func (s *Store) DeleteWorkspaceSetting(ctx context.Context, delete *DeleteWorkspaceSetting) error {
+	if err := s.driver.DeleteWorkspaceSetting(ctx, delete); err != nil {
+		return err
+	}
+
+	s.workspaceSettingCache.Delete(delete.Key.String())
+	return nil
+}
+
+// GetWorkspaceGeneralSetting returns the general setting, with defaults for the values which are not set.
+func (s *Store) GetWorkspaceGeneralSetting(ctx context.Context) (*WorkspaceGeneralSetting, error) {
+	workspaceSetting, err := s.GetWorkspaceSetting(ctx, &FindWorkspaceSetting{
+		Key: WorkspaceSettingKey_GENERAL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	generalSetting := &WorkspaceGeneralSetting{}
+	if workspaceSetting != nil {
+		generalSetting, err = workspaceSetting.GetGeneralSetting()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if generalSetting.InstanceName == "" {
+		generalSetting.InstanceName = DefaultInstanceName
+	}
+	if generalSetting.DefaultLocale == "" {
+		generalSetting.DefaultLocale = DefaultLocale
+	}
+	if generalSetting.AllowedEmailDomains == nil {
+		generalSetting.AllowedEmailDomains = []string{}
+	}
+	return generalSetting, nil
+}
+
+func (s *Store) GetWorkspaceInviteCodes(ctx context.Context) ([]*WorkspaceInviteCode, error) {
+	workspaceSetting, err := s.GetWorkspaceSetting(ctx, &FindWorkspaceSetting{
+		Key: WorkspaceSettingKey_INVITE_CODES,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if workspaceSetting == nil {
+		return []*WorkspaceInviteCode{}, nil
+	}
+
+	inviteCodes, err := workspaceSetting.GetInviteCodes()
+	if err != nil {
+		return nil, err
+	}
+	return inviteCodes.InviteCodes, nil
+}
+
+// UpdateWorkspaceInviteCodes replaces the invite codes with the ones update returns.
+// Nothing is written when update fails, its error is returned.
+// The updates are serialized by the server process, so a code cannot be used twice past its limit.
+func (s *Store) UpdateWorkspaceInviteCodes(ctx context.Context, update func([]*WorkspaceInviteCode) ([]*WorkspaceInviteCode, error)) error {
+	s.inviteCodesLock.Lock()
+	defer s.inviteCodesLock.Unlock()
+
+	inviteCodes, err := s.GetWorkspaceInviteCodes(ctx)
+	if err != nil {
+		return err
+	}
+	inviteCodes, err = update(inviteCodes)
+	if err != nil {
+		return err
+	}
+	value, err := ConvertUserSettingValueToString(&WorkspaceInviteCodes{
+		InviteCodes: inviteCodes,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.UpsertWorkspaceSetting(ctx, &WorkspaceSetting{
+		Key:   WorkspaceSettingKey_INVITE_CODES,
+		Value: value,
+	})
+	return err
+}
@@ -3,9 +3,22 @@ interface RequestOptions extends RequestInit {
   headers?: Record<string, string>;
 }
 
+/** The header the server asks for on POST, PUT and DELETE requests signed in by the cookie. */
+const CSRF_TOKEN_HEADER = 'X-CSRF-Token';
+
+/** Endpoints called before signing in, they need no CSRF token. */
+const PUBLIC_ENDPOINTS = ['/v1/user/signup', '/v1/user/login', '/v1/auth/'];
+
+/** Endpoints which start or end a session, the CSRF token of the previous session is dropped. */
+const SESSION_ENDPOINTS = ['/v1/user/login', '/v1/user/logout'];
+
 class ApiClient {
   private baseURL: string;
   private timeout: number;
+  /** The CSRF token of the current session, fetched before its first change. */
+  private csrfToken: string | null = null;
+  /** The refresh in flight, the requests which find the access token expired wait for the same one. */
+  private refreshing: Promise<boolean> | null = null;
 
   constructor() {
     this.baseURL = 'http://localhost:8088';
@@ -13,29 +26,27 @@ class ApiClient {
   }
 
   private async request<T>(endpoint: string, options: RequestOptions = {}): Promise<T> {
-    const url = `${this.baseURL}${endpoint}`;
-    
-    const config: RequestOptions = {
-      credentials: 'include',
-      headers: {
-        'Content-Type': 'application/json',
-        ...options.headers,
-      },
-      ...options,
-    };
-
-    // timeout
-    const controller = new AbortController();
-    const timeoutId = setTimeout(() => controller.abort(), this.timeout);
+    const method = (options.method ?? 'GET').toUpperCase();
+    const isPublic = PUBLIC_ENDPOINTS.some((prefix) => endpoint.startsWith(prefix));
+    const needsCSRFToken = method !== 'GET' && !isPublic;
 
     try {
-      const response = await fetch(url, {
-        ...config,
-        signal: controller.signal,
-      });
-      
-      clearTimeout(timeoutId);
-      
+      if (needsCSRFToken && !this.csrfToken) {
+        this.csrfToken = await this.fetchCSRFToken();
+      }
+      let response = await this.send(endpoint, options, needsCSRFToken);
+      if (response.status === 401 && !isPublic && await this.refreshAccessToken()) {
+        response = await this.send(endpoint, options, needsCSRFToken);
+      }
+      if (response.status === 403 && needsCSRFToken) {
+        // the token belongs to another session, e.g. after signing in again in another tab
+        this.csrfToken = await this.fetchCSRFToken();
+        response = await this.send(endpoint, options, needsCSRFToken);
+      }
+      if (SESSION_ENDPOINTS.some((prefix) => endpoint.startsWith(prefix))) {
+        this.csrfToken = null;
+      }
+
       if (!response.ok) {
         const errorData = await response.json().catch(() => ({}));
         throw new Error(errorData.message || `HTTP error! status: ${response.status}`);
@@ -47,12 +58,66 @@ class ApiClient {
       
       return await response.json();
     } catch (error) {
-      clearTimeout(timeoutId);
       console.error('API request failed:', error);
       throw error;
     }
   }
 
+  private async send(endpoint: string, options: RequestOptions, withCSRFToken: boolean): Promise<Response> {
+    const headers: Record<string, string> = {
+      'Content-Type': 'application/json',
+      ...options.headers,
+    };
+    if (withCSRFToken && this.csrfToken) {
+      headers[CSRF_TOKEN_HEADER] = this.csrfToken;
+    }
+
+    // timeout
+    const controller = new AbortController();
+    const timeoutId = setTimeout(() => controller.abort(), this.timeout);
+    try {
+      return await fetch(`${this.baseURL}${endpoint}`, {
+        credentials: 'include',
+        ...options,
+        headers,
+        signal: controller.signal,
+      });
+    } finally {
+      clearTimeout(timeoutId);
+    }
+  }
+
+  /** Exchanges the refresh token cookie for new token cookies, the access token expires after 15 minutes. */
+  private refreshAccessToken(): Promise<boolean> {
+    if (!this.refreshing) {
+      this.refreshing = this.send('/v1/auth/refresh', { method: 'POST' }, false)
+        .then((response) => response.ok)
+        .catch(() => false)
+        .finally(() => {
+          this.refreshing = null;
+        });
+    }
+    return this.refreshing;
+  }
+
+  /** The CSRF token is bound to the session, it stays valid when the access token is refreshed. */
+  private async fetchCSRFToken(): Promise<string | null> {
+    let response = await this.send('/v1/auth/csrf-token', {}, false);
+    if (response.status === 401 && await this.refreshAccessToken()) {
+      response = await this.send('/v1/auth/csrf-token', {}, false);
+    }
+    if (!response.ok) {
+      return null;
+    }
+    const data: { csrfToken: string } = await response.json();
+    return data.csrfToken;
+  }
+
+  /** The absolute URL of an endpoint, for the browser to navigate to. */
+  url(endpoint: string): string {
+    return `${this.baseURL}${endpoint}`;
+  }
+
   async get<T>(endpoint: string): Promise<T> {
     return this.request<T>(endpoint);
   }
@@ -85,6 +150,25 @@ export interface SignUpRequest {
   username: string;
   /** The password to sign up with. */
   password: string;
+  /** The email, required when the workspace allows only some email domains. */
+  email?: string;
+  /** The invite code, required when the workspace is invite-only. */
+  inviteCode?: string;
+}
+
+export interface WorkspaceProfile {
+  version: string;
+  instanceName: string;
+  defaultLocale: string;
+  disallowSignUp: boolean;
+  inviteOnly: boolean;
+  allowedEmailDomains: string[];
+}
+
+export interface IdentityProvider {
+  id: number;
+  name: string;
+  type: string;
 }
 
 export interface User {
@@ -92,6 +176,27 @@ export interface User {
     username: string;
 }
 
+export type WeekStart = "MONDAY" | "SUNDAY" | "SATURDAY";
+
+export type Appearance = "SYSTEM" | "LIGHT" | "DARK";
+
+export interface HomeWidget {
+  widget: string;
+  visible: boolean;
+}
+
+export interface UserSettings {
+  /** BCP 47 language tag, e.g. ko-KR. */
+  locale: string;
+  /** IANA timezone, e.g. Asia/Seoul. */
+  timezone: string;
+  /** ISO 4217 currency code, e.g. KRW. */
+  currency: string;
+  weekStart: WeekStart;
+  appearance: Appearance;
+  homeLayout: HomeWidget[];
+}
+
 export interface ApiResponse<T> {
   data: T;
   message: string;
@@ -105,4 +210,22 @@ export const authService = {
     apiClient.post<ApiResponse<User>, SignUpRequest>('/v1/user/login', request),
   logout: (): Promise<ApiResponse<null>> =>
     apiClient.post<ApiResponse<null>>('/v1/user/logout', ""),
+  listIdentityProviders: (): Promise<{ identityProviders: IdentityProvider[] }> =>
+    apiClient.get<{ identityProviders: IdentityProvider[] }>('/v1/auth/idps'),
+  /** The server redirects back to the redirect path of the web app after signing in with the provider. */
+  identityProviderSignInURL: (id: number, redirect: string): string =>
+    apiClient.url(`/v1/auth/idps/${id}/authorize?redirect=${encodeURIComponent(redirect)}`),
+}
+
+export const userService = {
+  getSettings: (): Promise<UserSettings> =>
+    apiClient.get<UserSettings>('/v1/user/settings'),
+  /** Only the given settings are updated, the response has all of them. */
+  updateSettings: (settings: Partial<UserSettings>): Promise<UserSettings> =>
+    apiClient.put<UserSettings, Partial<UserSettings>>('/v1/user/settings', settings),
+}
+
+export const workspaceService = {
+  getProfile: (): Promise<WorkspaceProfile> =>
+    apiClient.get<WorkspaceProfile>('/v1/workspace/profile'),
 }
@@ -1,7 +1,7 @@
 import { Button, Input } from "@usememos/mui";
 import { observer } from "mobx-react-lite";
 import { useState } from "react";
-import { useMutation } from "@tanstack/react-query";
+import { useMutation, useQuery } from "@tanstack/react-query";
 import { useTranslate } from "@/utils/i18n";
 import { authService, type SignUpRequest } from "@/api";
 import useNavigateTo from "@/hooks/useNavigateTo";
@@ -14,6 +14,11 @@ const Login = observer(() => {
 
   // Redirect to root page if already signed in.
 
+  const identityProviders = useQuery({
+    queryKey: ["identityProviders"],
+    queryFn: () => authService.listIdentityProviders(),
+  })
+
   const mutation = useMutation({
     mutationFn: (loginRequest: SignUpRequest) => {
       return authService.login(loginRequest)
@@ -68,6 +73,15 @@ const Login = observer(() => {
           {t("common.log-in")}
         </Button>
       </div>
+      {identityProviders.data?.identityProviders.map((identityProvider) => (
+        <div key={identityProvider.id}>
+          <Button
+            onClick={() => window.location.assign(authService.identityProviderSignInURL(identityProvider.id, "/dashboard"))}
+          >
+            {t("auth.sign-in-with", { name: identityProvider.name })}
+          </Button>
+        </div>
+      ))}
     </div>
   );
 });
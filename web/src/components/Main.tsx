@@ -1,14 +1,20 @@
 import { Button } from "@usememos/mui";
 import { observer } from "mobx-react-lite";
 import { useTranslate } from "@/utils/i18n";
+import { useEffect } from "react";
 import { useMutation } from "@tanstack/react-query";
 import { authService } from "@/api";
 import useNavigateTo from "@/hooks/useNavigateTo";
+import userStore from "@/store/user";
 
 const Main = observer(() => {
   const t = useTranslate();
   const navigateTo = useNavigateTo();
 
+  useEffect(() => {
+    userStore.fetchUserSettings();
+  }, []);
+
   const mutation = useMutation({
       mutationFn: () => {
         return authService.logout()
@@ -5,12 +5,17 @@ import { useMutation } from "@tanstack/react-query";
 import { useTranslate } from "@/utils/i18n";
 import { authService, type SignUpRequest } from "@/api";
 import useNavigateTo from "@/hooks/useNavigateTo";
+import workspaceStore from "@/store/workspace";
 
 const SignUp = observer(() => {
   const t = useTranslate();
   const navigateTo = useNavigateTo();
   const [username, setUsername] = useState("");
   const [password, setPassword] = useState("");
+  const [email, setEmail] = useState("");
+  const [inviteCode, setInviteCode] = useState("");
+  const workspaceProfile = workspaceStore.state.profile;
+  const emailRequired = (workspaceProfile?.allowedEmailDomains.length ?? 0) > 0;
 
   const mutation = useMutation({
     mutationFn: (signUpRequest: SignUpRequest) => {
@@ -31,16 +36,41 @@ const SignUp = observer(() => {
     setPassword(text);
   };
 
+  const handleEmailInputChanged = (e: React.ChangeEvent<HTMLInputElement>) => {
+    const text = e.target.value as string;
+    setEmail(text);
+  };
+
+  const handleInviteCodeInputChanged = (e: React.ChangeEvent<HTMLInputElement>) => {
+    const text = e.target.value as string;
+    setInviteCode(text);
+  };
+
   const handleSignUpButtonClick = async () => {
     if (username === "" || password === "") {
       return;
     }
+    if (emailRequired && email === "") {
+      return;
+    }
+    if (workspaceProfile?.inviteOnly && inviteCode === "") {
+      return;
+    }
+
+    mutation.mutate({ username: username, password: password, email: email, inviteCode: inviteCode })
+  }
 
-    mutation.mutate({ username: username, password: password })
+  if (workspaceProfile?.disallowSignUp) {
+    return (
+      <div>
+        <span>{t("auth.sign-up-disabled")}</span>
+      </div>
+    );
   }
 
   return (
     <div>
+      {workspaceProfile && <h1>{workspaceProfile.instanceName}</h1>}
       <div>
         <span>{t("common.username")}</span>
         <Input
@@ -59,6 +89,26 @@ const SignUp = observer(() => {
           required
         />
       </div>
+      <div>
+        <span>{t("common.email")}</span>
+        <Input
+          placeholder={emailRequired ? workspaceProfile?.allowedEmailDomains.map((domain) => `@${domain}`).join(", ") : t("common.email")}
+          value={email}
+          onChange={handleEmailInputChanged}
+          required={emailRequired}
+        />
+      </div>
+      {workspaceProfile?.inviteOnly && (
+        <div>
+          <span>{t("auth.invite-code")}</span>
+          <Input
+            placeholder={t("auth.invite-code")}
+            value={inviteCode}
+            onChange={handleInviteCodeInputChanged}
+            required
+          />
+        </div>
+      )}
       <div>
         <Button
           onClick={handleSignUpButtonClick}
@@ -1,15 +1,27 @@
+import { useEffect } from 'react';
 import { Outlet } from 'react-router-dom';
 import { QueryClient, QueryClientProvider } from "@tanstack/react-query";
+import workspaceStore from "@/store/workspace";
 
 const queryClient = new QueryClient()
 
-export const Layout = () => (
-  <div>
+export const Layout = () => {
+  useEffect(() => {
+    if (!workspaceStore.state.profile) {
+      workspaceStore.fetchWorkspaceProfile().catch((error) => {
+        console.error("failed to fetch workspace profile", error);
+      });
+    }
+  }, []);
+
+  return (
     <div>
-      <QueryClientProvider client={queryClient}>
-        <Outlet />
-      </QueryClientProvider>
-      
+      <div>
+        <QueryClientProvider client={queryClient}>
+          <Outlet />
+        </QueryClientProvider>
+        
+      </div>
     </div>
-  </div>
-);
+  );
+};
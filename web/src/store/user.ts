@@ -1,7 +1,10 @@
 import { makeAutoObservable } from "mobx";
+import i18n from "@/i18n";
+import { userService, type Appearance, type UserSettings } from "@/api";
 
 class LocalState {
   currentUser?: string;
+  settings?: UserSettings;
 
   constructor() {
     makeAutoObservable(this);
@@ -12,8 +15,40 @@ class LocalState {
   }
 };
 
+// applyAppearance sets the color scheme of the document, SYSTEM follows the device.
+const applyAppearance = (appearance: Appearance) => {
+  const dark = appearance === "DARK" || (appearance === "SYSTEM" && window.matchMedia("(prefers-color-scheme: dark)").matches);
+  document.documentElement.classList.toggle("dark", dark);
+  document.documentElement.style.colorScheme = dark ? "dark" : "light";
+};
+
 const userStore = (() => {
   const state = new LocalState();
-});
+
+  const applySettings = async (settings: UserSettings) => {
+    state.setPartial({ settings });
+    applyAppearance(settings.appearance);
+    await i18n.changeLanguage(settings.locale);
+  };
+
+  // fetchUserSettings loads the preferences of the signed in user, they replace the workspace defaults.
+  const fetchUserSettings = async () => {
+    const settings = await userService.getSettings();
+    await applySettings(settings);
+    return settings;
+  };
+
+  const updateUserSettings = async (update: Partial<UserSettings>) => {
+    const settings = await userService.updateSettings(update);
+    await applySettings(settings);
+    return settings;
+  };
+
+  return {
+    state,
+    fetchUserSettings,
+    updateUserSettings,
+  };
+})();
 
 export default userStore;
@@ -0,0 +1,35 @@
+import { makeAutoObservable } from "mobx";
+import i18n from "@/i18n";
+import { workspaceService, type WorkspaceProfile } from "@/api";
+
+class LocalState {
+  profile?: WorkspaceProfile;
+
+  constructor() {
+    makeAutoObservable(this);
+  }
+
+  setPartial(partial: Partial<LocalState>) {
+    Object.assign(this, partial);
+  }
+};
+
+const workspaceStore = (() => {
+  const state = new LocalState();
+
+  // fetchWorkspaceProfile loads the instance settings the app needs before anyone signs in.
+  const fetchWorkspaceProfile = async () => {
+    const profile = await workspaceService.getProfile();
+    state.setPartial({ profile });
+    document.title = profile.instanceName;
+    await i18n.changeLanguage(profile.defaultLocale);
+    return profile;
+  };
+
+  return {
+    state,
+    fetchWorkspaceProfile,
+  };
+})();
+
+export default workspaceStore;